@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gochat/internal/app"
 	"gochat/internal/schema"
 	"gochat/internal/services"
 	"net/http"
+	"strconv"
 )
 
 type CreateAccountRequest struct {
@@ -18,13 +22,23 @@ type CreateAccountDomainRequest struct {
 	Domain    string `form:"domain" json:"domain"`
 }
 
+type RenameAccountRequest struct {
+	Name string `form:"name" json:"name" binding:"required"`
+}
+
 type AccountHandlers struct {
-	accountService services.AccountService
+	accountService  *services.AccountService
+	userService     *services.UserService
+	sessionService  *services.SessionService
+	providerService *services.OIDCProviderService
 }
 
-func NewAccountHandlers(as *services.AccountService) *AccountHandlers {
+func NewAccountHandlers(a *app.App) *AccountHandlers {
 	return &AccountHandlers{
-		accountService: *as,
+		accountService:  a.Accounts,
+		userService:     a.Users,
+		sessionService:  a.Sessions,
+		providerService: a.OIDCProviders,
 	}
 }
 
@@ -49,8 +63,7 @@ func (h *AccountHandlers) GetUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.Param("id")
 
-		userService := services.NewUserService()
-		user, err := userService.Get(c, userID)
+		user, err := h.userService.Get(c, userID)
 
 		if err != nil {
 			fmt.Println(err)
@@ -157,3 +170,321 @@ func (h *AccountHandlers) ChangeUserAccount() gin.HandlerFunc {
 		})
 	}
 }
+
+// RevokeUserSessions logs a user out on all devices, used when offboarding staff
+func (h *AccountHandlers) RevokeUserSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("id")
+
+		revoked, err := h.sessionService.RevokeAllForUser(c, userID)
+		if err != nil {
+			fmt.Println(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("revoked %d sessions for user %s", revoked, userID),
+		})
+	}
+}
+
+// SetUserRole changes the role of any user, this is the only way to grant platform admin
+func (h *AccountHandlers) SetUserRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("id")
+
+		var params SetRoleRequest
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := h.userService.SetRole(c, userID, params.Role)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("changed role of user %s to %s", userID, params.Role),
+		})
+	}
+}
+
+type CreateOIDCProviderRequest struct {
+	ID           string   `json:"id" binding:"required"`
+	AccountID    string   `json:"accountId" binding:"required"`
+	Name         string   `json:"name" binding:"required"`
+	Issuer       string   `json:"issuer" binding:"required"`
+	ClientID     string   `json:"clientId" binding:"required"`
+	ClientSecret string   `json:"clientSecret"`
+	Scopes       []string `json:"scopes"`
+}
+
+func (h *AccountHandlers) ListOIDCProviders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID := c.Param("id")
+
+		providers, err := h.providerService.ListForAccount(c, accountID)
+		if err != nil {
+			fmt.Println(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"providers": providers,
+		})
+	}
+}
+
+// CreateOIDCProvider configures an identity provider for an account, the client secret may be given as env:NAME
+func (h *AccountHandlers) CreateOIDCProvider() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var params CreateOIDCProviderRequest
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		provider, err := h.providerService.Create(c, services.OIDCProviderParams{
+			ID:           params.ID,
+			AccountID:    params.AccountID,
+			Name:         params.Name,
+			Issuer:       params.Issuer,
+			ClientID:     params.ClientID,
+			ClientSecret: params.ClientSecret,
+			Scopes:       params.Scopes,
+		})
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"provider": provider,
+		})
+	}
+}
+
+func (h *AccountHandlers) DeleteOIDCProvider() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		providerID := c.Param("provider")
+
+		if err := h.providerService.Delete(c, providerID); err != nil {
+			fmt.Println(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "successfully deleted provider: " + providerID,
+		})
+	}
+}
+
+// getPageParams reads ?page=&pageSize=&search= from the query string
+func getPageParams(c *gin.Context) services.PageParams {
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("pageSize"))
+	return services.PageParams{
+		Page:     page,
+		PageSize: pageSize,
+		Search:   c.Query("search"),
+	}.Normalized()
+}
+
+func (h *AccountHandlers) ListAccounts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		params := getPageParams(c)
+
+		accounts, total, err := h.accountService.List(c, params)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list accounts"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"accounts": accounts,
+			"page":     params.Page,
+			"pageSize": params.PageSize,
+			"total":    total,
+		})
+	}
+}
+
+func (h *AccountHandlers) RenameAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID := c.Param("id")
+
+		var params RenameAccountRequest
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := h.accountService.Rename(c, accountID, params.Name)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("renamed account %s to %s", accountID, params.Name),
+		})
+	}
+}
+
+// DeleteAccount deletes the account together with its domains, identity providers and users
+func (h *AccountHandlers) DeleteAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID := c.Param("id")
+
+		err := h.accountService.Delete(c, accountID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+				return
+			}
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete account"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "successfully deleted account: " + accountID,
+		})
+	}
+}
+
+func (h *AccountHandlers) ListAccountDomains() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID := c.Param("id")
+
+		domains, err := h.accountService.ListDomains(c, accountID)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list domains"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"domains": domains,
+		})
+	}
+}
+
+func (h *AccountHandlers) ListUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		params := getPageParams(c)
+
+		users, total, err := h.userService.List(c, c.Query("accountId"), params)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list users"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"users":    users,
+			"page":     params.Page,
+			"pageSize": params.PageSize,
+			"total":    total,
+		})
+	}
+}
+
+func (h *AccountHandlers) DeleteUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("id")
+
+		err := h.userService.Delete(c, userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+				return
+			}
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete user"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "successfully deleted user: " + userID,
+		})
+	}
+}
+
+// SetUserDisabled disables or enables a user, disabling also logs them out everywhere
+func (h *AccountHandlers) SetUserDisabled(disabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("id")
+
+		var err error
+		if disabled {
+			err = h.userService.Disable(c, userID)
+		} else {
+			err = h.userService.Enable(c, userID)
+		}
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+				return
+			}
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update user"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":  fmt.Sprintf("updated user %s", userID),
+			"disabled": disabled,
+		})
+	}
+}
+
+// ImportUsers creates users in an account from an uploaded CSV with email, name and role columns
+func (h *AccountHandlers) ImportUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID := c.PostForm("accountId")
+		if accountID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "accountId is required"})
+			return
+		}
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer file.Close()
+
+		result, err := h.userService.Import(c, accountID, file)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "result": result})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"result": result,
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gochat/internal/services"
+	"net/http"
+)
+
+type CreateAPIKeyRequest struct {
+	Name          string              `json:"name" binding:"required"`
+	Scopes        []services.APIScope `json:"scopes" binding:"required"`
+	ExpiresInDays int                 `json:"expiresInDays"`
+}
+
+type APIKeyHandlers struct {
+	apiKeyService *services.APIKeyService
+}
+
+func NewAPIKeyHandlers(s *services.APIKeyService) *APIKeyHandlers {
+	return &APIKeyHandlers{
+		apiKeyService: s,
+	}
+}
+
+func (h *APIKeyHandlers) ListAPIKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys, err := h.apiKeyService.List(c, c.GetString("user"))
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list api keys"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"keys": keys,
+		})
+	}
+}
+
+func (h *APIKeyHandlers) CreateAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var params CreateAPIKeyRequest
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		key, plaintext, err := h.apiKeyService.Create(c, c.GetString("user"), services.APIKeyParams{
+			Name:          params.Name,
+			Scopes:        params.Scopes,
+			ExpiresInDays: params.ExpiresInDays,
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// The plaintext key is only ever shown once
+		c.JSON(http.StatusCreated, gin.H{
+			"key":    key,
+			"secret": plaintext,
+		})
+	}
+}
+
+func (h *APIKeyHandlers) RevokeAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		err := h.apiKeyService.Revoke(c, c.GetString("user"), id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+				return
+			}
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke api key"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "successfully revoked api key: " + id,
+		})
+	}
+}
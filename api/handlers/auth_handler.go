@@ -1,64 +1,139 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"gochat/internal/app"
 	"gochat/internal/auth"
 	"gochat/internal/services"
 	"net/http"
+	"net/url"
 )
 
-func OAuthRedirectAzure(r *gin.Engine) gin.HandlerFunc {
+func getOIDCProvider(a *app.App, c *gin.Context) (*services.OIDCProviderConfig, bool) {
+	provider, err := a.OIDCProviders.Get(c, c.Param("provider"))
+	if err != nil {
+		fmt.Println("Error getting oidc provider: " + err.Error())
+		c.String(http.StatusInternalServerError, "Login is currently unavailable")
+		return nil, false
+	}
+	if provider == nil || provider.ClientID == "" {
+		c.String(http.StatusNotFound, "Unknown login provider")
+		return nil, false
+	}
+	return provider, true
+}
+
+// OIDCLoginHandler sends the user to the identity provider
+func OIDCLoginHandler(a *app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		config, ok := getOIDCProvider(a, c)
+		if !ok {
+			return
+		}
+
+		flow, err := auth.NewOIDCFlow(config.ID)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "Error starting login: "+err.Error())
+			return
+		}
+		provider := auth.NewOIDCProvider(config)
+		authURL, err := provider.AuthCodeURL(c, flow, auth.OIDCRedirectURI(config.ID))
+		if err != nil {
+			fmt.Println("Error building authorization url: " + err.Error())
+			c.String(http.StatusBadGateway, "Login provider is unavailable")
+			return
+		}
+		if err := auth.SetOIDCFlowCookie(c, flow); err != nil {
+			c.String(http.StatusInternalServerError, "Error starting login: "+err.Error())
+			return
+		}
+
+		c.Redirect(http.StatusTemporaryRedirect, authURL)
+	}
+}
+
+// SSOLoginHandler finds the identity provider configured for the email's account
+func SSOLoginHandler(a *app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email := c.Query("email")
+
+		provider, err := a.OIDCProviders.GetForEmail(c, email)
+		if err != nil || provider == nil {
+			c.String(http.StatusNotFound, "No single sign-on is configured for this email address")
+			return
+		}
+
+		c.Redirect(http.StatusFound, "/login/oidc/"+url.PathEscape(provider.ID))
+	}
+}
+
+// OIDCCallbackHandler finishes the login, the identity provider redirects back here with a code
+func OIDCCallbackHandler(a *app.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if errorCode := c.Query("error"); errorCode != "" {
+			c.String(http.StatusBadRequest, "Login failed: "+errorCode+" "+c.Query("error_description"))
+			return
+		}
 		code := c.Query("code")
 		if code == "" {
 			c.String(http.StatusBadRequest, "Code not provided")
 			return
 		}
 
-		azureToken, err := auth.GetToken(code)
+		config, ok := getOIDCProvider(a, c)
+		if !ok {
+			return
+		}
 
-		if err != nil {
-			c.String(http.StatusInternalServerError, "Error getting token: "+err.Error())
+		flow, err := auth.ReadOIDCFlowCookie(c)
+		if err != nil || flow.Provider != config.ID || flow.State != c.Query("state") {
+			c.String(http.StatusBadRequest, "Invalid login state, please try again")
 			return
 		}
-		userInfo, err := auth.GetUserInfo(azureToken)
 
+		provider := auth.NewOIDCProvider(config)
+		identity, err := provider.Exchange(c, code, flow, auth.OIDCRedirectURI(config.ID))
 		if err != nil {
-			c.String(http.StatusInternalServerError, "Error getting user info: "+err.Error())
+			fmt.Println("Error verifying login: " + err.Error())
+			c.String(http.StatusUnauthorized, "Error verifying login: "+err.Error())
+			return
 		}
 
 		// Get or create user from database
-		externalID := userInfo["id"].(string)
-		name := userInfo["givenName"].(string)
-
+		externalID := identity.ExternalID()
 		user := services.UserParams{
-			Email:      userInfo["mail"].(string),
-			ExternalID: &externalID,
-			Name:       &name,
+			Email:         identity.Email,
+			ExternalID:    &externalID,
+			Name:          &identity.Name,
+			EmailVerified: identity.EmailVerified,
+		}
+		if config.AccountID != "" {
+			user.AccountID = &config.AccountID
 		}
 
-			userService := services.NewUserService()
-			dbUser, err := userService.GetOrCreate(c, user)
-
-
+		dbUser, err := a.Users.GetOrCreate(c, user)
+		if errors.Is(err, services.ErrEmailNotVerified) {
+			c.String(http.StatusForbidden, "Login failed: "+err.Error())
+			return
+		}
 		if err != nil {
 			fmt.Println("Error creating user: " + err.Error())
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
-		// Create a JWT
-		token, err := auth.CreateToken(dbUser.ID)
-		if err != nil {
+		// Start a session, this sets the access and refresh token cookies
+		if err := auth.StartSession(a, c, dbUser.ID); err != nil {
+			fmt.Println("Error starting session: " + err.Error())
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create token"})
 			return
 		}
-		auth.SetTokenCookie(c, token)
 
 		// Track event
-		eventService := services.NewEventService(dbUser.ID)
-		eventService.Create(services.EventLogin, map[string]interface{}{
-			"authProvider": "azure",
+		a.Events(dbUser.ID).Create(services.EventLogin, map[string]interface{}{
+			"authProvider": config.ID,
 		})
 
 		c.Redirect(http.StatusMovedPermanently, "/")
@@ -66,36 +141,32 @@ func OAuthRedirectAzure(r *gin.Engine) gin.HandlerFunc {
 	}
 }
 
+// RefreshTokenHandler rotates the refresh token and issues a new access token
+func RefreshTokenHandler(a *app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, _, err := auth.RefreshSession(a, c); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "token refreshed"})
+	}
+}
+
+// LogoutAllHandler revokes every session of the current user, logging them out on all devices
+func LogoutAllHandler(a *app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("user")
 
-//func OAuthRedirectGoogle(r *gin.Engine) gin.HandlerFunc {
-//	return func(c *gin.Context) {
-//
-//		code := c.Query("code")
-//		if code == "" {
-//			c.String(http.StatusBadRequest, "Code not provided")
-//			return
-//		}
-//
-//		googleToken, err := auth.GetToken(code)
-//
-//		if err != nil {
-//			c.String(http.StatusInternalServerError, "Error getting token: "+err.Error())
-//			return
-//		}
-//		userInfo, err := auth.GetUserInfo(googleToken)
-//		if err != nil {
-//			c.String(http.StatusInternalServerError, "Error getting user info: "+err.Error())
-//		}
-//
-//		// Create a JWT
-//		token, err := auth.CreateToken(userInfo["id"].(string))
-//		if err != nil {
-//			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create token"})
-//			return
-//		}
-//		auth.SetTokenCookie(c, token)
-//
-//		c.Redirect(http.StatusMovedPermanently, "/")
-//
-//	}
-//}
+		revoked, err := a.Sessions.RevokeAllForUser(c, userID)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not log out all devices"})
+			return
+		}
+		auth.UnsetSessionCookies(c)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("logged out %d sessions", revoked),
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gochat/internal/app"
+	"gochat/internal/rag"
+	"gochat/internal/schema"
+	"gochat/internal/services"
+	"mime"
+	"net/http"
+)
+
+// maxExtractionFiles keeps a single extraction from occupying the model for hours
+const maxExtractionFiles = 200
+
+type ExtractionRequest struct {
+	Name   string                     `json:"name" binding:"required"`
+	Fields []services.ExtractionField `json:"fields" binding:"required"`
+	// FileIDs are the files to read, without them every file of the conversation is read
+	FileIDs        []string `json:"fileIds"`
+	ConversationID string   `json:"conversationId"`
+}
+
+type ExtractionHandlers struct {
+	app               *app.App
+	extractionService *services.ExtractionService
+}
+
+func NewExtractionHandlers(a *app.App) *ExtractionHandlers {
+	return &ExtractionHandlers{
+		app:               a,
+		extractionService: a.Extractions,
+	}
+}
+
+// extractionError writes the response for an error of the extraction service
+func extractionError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrExtractionNotFound), errors.Is(err, services.ErrFileNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+func (h *ExtractionHandlers) ListExtractions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(h.app, c)
+		if !ok {
+			return
+		}
+		extractions, err := h.extractionService.List(c, user.ID)
+		if err != nil {
+			extractionError(c, err, "Could not list extractions")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"extractions": extractions})
+	}
+}
+
+// CreateExtraction records the extraction and reads the files in the background, the results are
+// polled with GetExtraction
+func (h *ExtractionHandlers) CreateExtraction() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(h.app, c)
+		if !ok {
+			return
+		}
+		var params ExtractionRequest
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := services.ValidateFields(params.Fields); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		fileService, err := h.app.Files(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var files []schema.File
+		if len(params.FileIDs) > 0 {
+			for _, id := range params.FileIDs {
+				file, err := fileService.Get(c, id)
+				if err != nil {
+					extractionError(c, err, "Could not get file")
+					return
+				}
+				files = append(files, *file)
+			}
+		} else {
+			if !claimConversation(h.app, c, user, params.ConversationID) {
+				return
+			}
+			files, err = fileService.ListConversation(c, params.ConversationID)
+			if err != nil {
+				extractionError(c, err, "Could not list files")
+				return
+			}
+		}
+		if len(files) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "no files to extract from"})
+			return
+		}
+		if len(files) > maxExtractionFiles {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("an extraction can read at most %d files", maxExtractionFiles)})
+			return
+		}
+
+		extraction, err := h.extractionService.Create(c, user.ID, params.Name, params.Fields, files)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// Reading the files takes longer than the request
+		go rag.RunExtraction(context.Background(), h.extractionService, fileService, extraction, files)
+
+		c.JSON(http.StatusAccepted, gin.H{"extraction": extraction})
+	}
+}
+
+func (h *ExtractionHandlers) GetExtraction() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(h.app, c)
+		if !ok {
+			return
+		}
+		extraction, err := h.extractionService.Get(c, user.ID, c.Param("id"))
+		if err != nil {
+			extractionError(c, err, "Could not get extraction")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"extraction": extraction})
+	}
+}
+
+// DownloadExtraction returns the results as a CSV file, or as JSON with ?format=json
+func (h *ExtractionHandlers) DownloadExtraction() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(h.app, c)
+		if !ok {
+			return
+		}
+		extraction, err := h.extractionService.Get(c, user.ID, c.Param("id"))
+		if err != nil {
+			extractionError(c, err, "Could not get extraction")
+			return
+		}
+
+		format := c.DefaultQuery("format", "csv")
+		disposition := func(ext string) string {
+			return mime.FormatMediaType("attachment", map[string]string{"filename": extraction.Name + "." + ext})
+		}
+		switch format {
+		case "csv":
+			c.Header("Content-Disposition", disposition("csv"))
+			c.Header("Content-Type", "text/csv; charset=utf-8")
+			c.Status(http.StatusOK)
+			if err := extraction.WriteCSV(c.Writer); err != nil {
+				fmt.Println("Error writing extraction: " + err.Error())
+			}
+		case "json":
+			c.Header("Content-Disposition", disposition("json"))
+			c.JSON(http.StatusOK, extraction)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown format %q, use csv or json", format)})
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gochat/internal/app"
+	"gochat/internal/rag"
+	"gochat/internal/services"
+	"net/http"
+)
+
+type KnowledgeBaseRequest struct {
+	Name        string                      `form:"name" json:"name" binding:"required"`
+	Description string                      `form:"description" json:"description"`
+	Scope       services.KnowledgeBaseScope `form:"scope" json:"scope"`
+}
+
+type KnowledgeBaseFileRequest struct {
+	FileID string `form:"fileId" json:"fileId" binding:"required"`
+}
+
+type KnowledgeBaseHandlers struct {
+	app                  *app.App
+	knowledgeBaseService *services.KnowledgeBaseService
+}
+
+func NewKnowledgeBaseHandlers(a *app.App) *KnowledgeBaseHandlers {
+	return &KnowledgeBaseHandlers{
+		app:                  a,
+		knowledgeBaseService: a.KnowledgeBases,
+	}
+}
+
+// knowledgeBaseError writes the response for an error of the knowledge base service
+func knowledgeBaseError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrKnowledgeBaseNotFound), errors.Is(err, services.ErrFileNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrKnowledgeBaseReadOnly):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+func (h *KnowledgeBaseHandlers) ListKnowledgeBases() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(h.app, c)
+		if !ok {
+			return
+		}
+		kbs, err := h.knowledgeBaseService.List(c, user)
+		if err != nil {
+			knowledgeBaseError(c, err, "Could not list knowledge bases")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"knowledgeBases": kbs})
+	}
+}
+
+func (h *KnowledgeBaseHandlers) CreateKnowledgeBase() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(h.app, c)
+		if !ok {
+			return
+		}
+		var params KnowledgeBaseRequest
+		if err := c.ShouldBind(&params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		kb, err := h.knowledgeBaseService.Create(c, user, services.KnowledgeBaseParams{
+			Name:        params.Name,
+			Description: params.Description,
+			Scope:       params.Scope,
+		})
+		if errors.Is(err, services.ErrKnowledgeBaseReadOnly) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"knowledgeBase": kb})
+	}
+}
+
+func (h *KnowledgeBaseHandlers) GetKnowledgeBase() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(h.app, c)
+		if !ok {
+			return
+		}
+		kb, err := h.knowledgeBaseService.Get(c, user, c.Param("id"))
+		if err != nil {
+			knowledgeBaseError(c, err, "Could not get knowledge base")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"knowledgeBase": kb})
+	}
+}
+
+func (h *KnowledgeBaseHandlers) UpdateKnowledgeBase() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(h.app, c)
+		if !ok {
+			return
+		}
+		var params KnowledgeBaseRequest
+		if err := c.ShouldBind(&params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		kb, err := h.knowledgeBaseService.Update(c, user, c.Param("id"), params.Name, params.Description)
+		if err != nil {
+			knowledgeBaseError(c, err, "Could not update knowledge base")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"knowledgeBase": kb})
+	}
+}
+
+func (h *KnowledgeBaseHandlers) DeleteKnowledgeBase() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(h.app, c)
+		if !ok {
+			return
+		}
+		kb, err := h.knowledgeBaseService.Delete(c, user, c.Param("id"))
+		if err != nil {
+			knowledgeBaseError(c, err, "Could not delete knowledge base")
+			return
+		}
+		// The knowledge base is gone already, leftover vectors are no longer searched
+		if err := rag.RemovePartition(c, kb.Partition); err != nil {
+			fmt.Println("Error removing knowledge base partition: " + err.Error())
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "successfully deleted knowledge base: " + kb.ID})
+	}
+}
+
+func (h *KnowledgeBaseHandlers) ListFiles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(h.app, c)
+		if !ok {
+			return
+		}
+		files, err := h.knowledgeBaseService.ListFiles(c, user, c.Param("id"))
+		if err != nil {
+			knowledgeBaseError(c, err, "Could not list files")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"files": files})
+	}
+}
+
+// AddFile adds a file the user uploaded earlier, its vectors are copied into the knowledge base
+func (h *KnowledgeBaseHandlers) AddFile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(h.app, c)
+		if !ok {
+			return
+		}
+		var params KnowledgeBaseFileRequest
+		if err := c.ShouldBind(&params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		id := c.Param("id")
+
+		file, err := h.knowledgeBaseService.AddFile(c, user, id, params.FileID)
+		if err != nil {
+			knowledgeBaseError(c, err, "Could not add file")
+			return
+		}
+		// The copies keep the tags of the file
+		var tags []string
+		fileService, err := h.app.Files(c)
+		if err == nil {
+			tags, err = fileService.Tags(c, file.ID)
+		}
+		if err == nil {
+			err = rag.CopyFileToPartition(c, rag.SourceOf(*file, user.Account.ID, tags), services.KnowledgeBasePartition(id))
+		}
+		if err != nil {
+			fmt.Println("Error copying file to knowledge base: " + err.Error())
+			if err := h.knowledgeBaseService.RemoveFile(c, user, id, file.ID); err != nil {
+				fmt.Println("Error removing file from knowledge base: " + err.Error())
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not add file"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("File %s added", file.Name), "id": file.ID})
+	}
+}
+
+// UploadFile uploads a file straight into the knowledge base, it belongs to no conversation
+func (h *KnowledgeBaseHandlers) UploadFile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(h.app, c)
+		if !ok {
+			return
+		}
+		// Check before the upload is stored and embedded
+		kb, err := h.knowledgeBaseService.GetManaged(c, user, c.Param("id"))
+		if err != nil {
+			knowledgeBaseError(c, err, "Could not upload file")
+			return
+		}
+
+		file, ok := uploadFile(h.app, c, user, "", kb.Partition)
+		if !ok {
+			return
+		}
+		if _, err := h.knowledgeBaseService.AddFile(c, user, kb.ID, file.ID); err != nil {
+			knowledgeBaseError(c, err, "Could not add file")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("File %s uploaded successfully", file.Name), "id": file.ID})
+	}
+}
+
+func (h *KnowledgeBaseHandlers) RemoveFile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(h.app, c)
+		if !ok {
+			return
+		}
+		id, fileID := c.Param("id"), c.Param("fileId")
+
+		if err := h.knowledgeBaseService.RemoveFile(c, user, id, fileID); err != nil {
+			knowledgeBaseError(c, err, "Could not remove file")
+			return
+		}
+		if err := rag.RemoveDocumentsByFileId(c, fileID, user.Account.ID, services.KnowledgeBasePartition(id)); err != nil {
+			fmt.Println("Error removing file from knowledge base partition: " + err.Error())
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "successfully removed file: " + fileID})
+	}
+}
+
+func (h *KnowledgeBaseHandlers) ListAttached() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(h.app, c)
+		if !ok {
+			return
+		}
+		kbs, err := h.knowledgeBaseService.Attached(c, user, c.Param("id"))
+		if err != nil {
+			knowledgeBaseError(c, err, "Could not list knowledge bases")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"knowledgeBases": kbs})
+	}
+}
+
+func (h *KnowledgeBaseHandlers) Attach() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(h.app, c)
+		if !ok || !claimConversation(h.app, c, user, c.Param("id")) {
+			return
+		}
+		if err := h.knowledgeBaseService.Attach(c, user, c.Param("id"), c.Param("kb")); err != nil {
+			knowledgeBaseError(c, err, "Could not attach knowledge base")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "successfully attached knowledge base: " + c.Param("kb")})
+	}
+}
+
+func (h *KnowledgeBaseHandlers) Detach() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(h.app, c)
+		if !ok {
+			return
+		}
+		if err := h.knowledgeBaseService.Detach(c, user, c.Param("id"), c.Param("kb")); err != nil {
+			knowledgeBaseError(c, err, "Could not detach knowledge base")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "successfully detached knowledge base: " + c.Param("kb")})
+	}
+}
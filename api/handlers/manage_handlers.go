@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gochat/internal/services"
+	"net/http"
+)
+
+// ManageHandlers let account admins manage their own account, they are always scoped to the
+// account_id set by auth.RequireRole
+type ManageHandlers struct {
+	accountService *services.AccountService
+	userService    *services.UserService
+	sessionService *services.SessionService
+}
+
+type ClaimDomainRequest struct {
+	Domain string `json:"domain" binding:"required"`
+}
+
+type SetRoleRequest struct {
+	Role services.Role `json:"role" binding:"required"`
+}
+
+func NewManageHandlers(as *services.AccountService, us *services.UserService, ss *services.SessionService) *ManageHandlers {
+	return &ManageHandlers{
+		accountService: as,
+		userService:    us,
+		sessionService: ss,
+	}
+}
+
+// getAccountUser returns the user from the path, if it belongs to the admin's account
+func (h *ManageHandlers) getAccountUser(c *gin.Context) (*services.UserDto, bool) {
+	user, err := h.userService.Get(c, c.Param("id"))
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get user"})
+		return nil, false
+	}
+	if user == nil || user.Account.ID != c.GetString("account_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+func (h *ManageHandlers) ListDomains() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domains, err := h.accountService.ListDomains(c, c.GetString("account_id"))
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list domains"})
+			return
+		}
+		claims, err := h.accountService.ListDomainClaims(c, c.GetString("account_id"))
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list domains"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"domains": domains,
+			"pending": claims,
+		})
+	}
+}
+
+func (h *ManageHandlers) ClaimDomain() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var params ClaimDomainRequest
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// The domain is added once the TXT record shows ownership, see VerifyDomain
+		claim, err := h.accountService.ClaimDomain(c, c.GetString("account_id"), params.Domain)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"claim":   claim,
+			"message": "add a TXT record " + claim.Record + " with value " + claim.Value + ", then verify the domain",
+		})
+	}
+}
+
+func (h *ManageHandlers) VerifyDomain() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domain, err := h.accountService.VerifyDomain(c, c.GetString("account_id"), c.Param("domain"))
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				c.JSON(http.StatusNotFound, gin.H{"error": "no claim on this domain"})
+			case errors.Is(err, services.ErrDomainNotVerified):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				fmt.Println(err)
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"domain": domain,
+		})
+	}
+}
+
+func (h *ManageHandlers) RemoveDomain() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domain := c.Param("domain")
+
+		err := h.accountService.RemoveDomain(c, c.GetString("account_id"), domain)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "domain not found"})
+				return
+			}
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete domain"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "successfully deleted domain: " + domain,
+		})
+	}
+}
+
+func (h *ManageHandlers) ListUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		users, err := h.userService.ListByAccount(c, c.GetString("account_id"))
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list users"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"users": users,
+		})
+	}
+}
+
+func (h *ManageHandlers) SetUserRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var params SetRoleRequest
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// Only platform admins hand out or take away platform admin, through the admin api
+		if params.Role == services.RolePlatformAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can't grant this role"})
+			return
+		}
+
+		user, ok := h.getAccountUser(c)
+		if !ok {
+			return
+		}
+		if user.Role == services.RolePlatformAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can't change the role of this user"})
+			return
+		}
+
+		if err := h.userService.SetRole(c, user.ID, params.Role); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("changed role of %s to %s", user.Email, params.Role),
+		})
+	}
+}
+
+// RevokeUserSessions logs a user of the account out on all devices
+func (h *ManageHandlers) RevokeUserSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := h.getAccountUser(c)
+		if !ok {
+			return
+		}
+
+		revoked, err := h.sessionService.RevokeAllForUser(c, user.ID)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke sessions"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("revoked %d sessions for user %s", revoked, user.Email),
+		})
+	}
+}
@@ -9,15 +9,17 @@ import (
 	"github.com/gin-gonic/gin"
 	openai "github.com/sashabaranov/go-openai"
 	"gochat/internal/ai"
+	"gochat/internal/app"
 	"gochat/internal/auth"
 	"gochat/internal/rag"
-
+	"gochat/internal/schema"
 	"gochat/internal/services"
+	"gochat/internal/tables"
 	views "gochat/views"
 	"gochat/views/components"
 	"io"
+	"mime"
 	"net/http"
-
 	"time"
 )
 
@@ -52,78 +54,75 @@ func notify(str string) {
 
 }
 
-func getUserData(ctx *gin.Context) (*services.UserDto, error) {
+func getUserData(a *app.App, ctx *gin.Context) (*services.UserDto, error) {
 	userID := ctx.GetString("user")
-	userService := services.NewUserService()
-	user, err := userService.Get(ctx, userID)
-	if err != nil {
-		return nil, err
+	user, err := a.Users.Get(ctx, userID)
+	if err != nil || user == nil {
+		return user, err
 	}
+	user.Impersonation = auth.GetImpersonation(ctx)
 	return user, nil
 }
 
-func impersonateAccount(ctx *gin.Context, impersonationID string) (*services.UserDto, error) {
-	userID := ctx.GetString("user")
-	userService := services.NewUserService()
-	user, err := userService.Get(ctx, userID)
-	if err != nil {
-		return nil, err
+// currentUser returns the user of the request, it writes the response when there is none
+func currentUser(a *app.App, c *gin.Context) (*services.UserDto, bool) {
+	user, err := getUserData(a, c)
+	if err != nil || user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return nil, false
 	}
-	// If it's not me, we have a joker
-	if user.Email != "wessel@torgon.io" {
-		metadata := map[string]interface{}{
-			"ip":         ctx.ClientIP(),
-			"user_agent": ctx.GetHeader("User-Agent"),
-			"method":     ctx.Request.Method,
-			"url":        ctx.Request.RequestURI,
-			"headers":    ctx.Request.Header,
-			"user_id":    userID,
-			"timestamp":  time.Now().UTC().Format(time.RFC3339),
-		}
-
-		notify("joker alert")
-
-		// Read and reset body if necessary
-		if ctx.Request.Method == "POST" || ctx.Request.Method == "PUT" {
-			body, _ := io.ReadAll(ctx.Request.Body)
-			ctx.Request.Body = io.NopCloser(bytes.NewBuffer(body)) // Reset body for further use
-			metadata["body"] = string(body)
-		}
-
-		eventService := services.NewEventService(userID)
-		_, err := eventService.Create(services.Evil, metadata)
-
-		if err != nil {
-			fmt.Println("Error creating Evil event", err)
-		}
+	return user, true
+}
 
-		return nil, errors.New("not found")
+// claimConversation checks that the conversation is the user's, it writes the response when it isn't
+func claimConversation(a *app.App, c *gin.Context, user *services.UserDto, conversationID string) bool {
+	err := a.Conversations.Claim(c, user.ID, conversationID)
+	if errors.Is(err, services.ErrConversationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return false
 	}
-
-	accountService := services.NewAccountService()
 	if err != nil {
-		return nil, err
+		fmt.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
 	}
-	account, err := accountService.Get(ctx, impersonationID)
-	if err != nil {
-		fmt.Println("accountservice2 error:", err)
+	return true
+}
 
-		return nil, err
+// reportJoker records and reports someone who tries to use admin features
+func reportJoker(a *app.App, ctx *gin.Context) {
+	userID := ctx.GetString("user")
+	metadata := map[string]interface{}{
+		"ip":         ctx.ClientIP(),
+		"user_agent": ctx.GetHeader("User-Agent"),
+		"method":     ctx.Request.Method,
+		"url":        ctx.Request.RequestURI,
+		"headers":    ctx.Request.Header,
+		"user_id":    userID,
+		"timestamp":  time.Now().UTC().Format(time.RFC3339),
 	}
-	if account == nil {
-		return nil, nil
+
+	notify("joker alert")
+
+	// Read and reset body if necessary
+	if ctx.Request.Method == "POST" || ctx.Request.Method == "PUT" {
+		body, _ := io.ReadAll(ctx.Request.Body)
+		ctx.Request.Body = io.NopCloser(bytes.NewBuffer(body)) // Reset body for further use
+		metadata["body"] = string(body)
 	}
 
-	user.Account.ID = impersonationID
+	_, err := a.Events(userID).Create(services.Evil, metadata)
 
-	return user, nil
+	if err != nil {
+		fmt.Println("Error creating Evil event", err)
+	}
 }
 
-func IndexPageHandler() gin.HandlerFunc {
+func IndexPageHandler(a *app.App) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		_, cancel := context.WithTimeout(context.Background(), appTimeout)
 		defer cancel()
-		user, err := getUserData(ctx)
+		user, err := getUserData(a, ctx)
 		if err != nil {
 			fmt.Println("err", err)
 		}
@@ -132,22 +131,61 @@ func IndexPageHandler() gin.HandlerFunc {
 	}
 }
 
-func ImpersonateIndexPageHandler() gin.HandlerFunc {
-	return func(ctx *gin.Context) {
-		_, cancel := context.WithTimeout(context.Background(), appTimeout)
-		defer cancel()
+type StartImpersonationRequest struct {
+	Reason     string `form:"reason" json:"reason" binding:"required"`
+	TTLMinutes int    `form:"ttlMinutes" json:"ttlMinutes"`
+}
 
-		impersonationID := ctx.Param("id")
+// StartImpersonationHandler lets a platform admin act as another user for a limited time
+func StartImpersonationHandler(a *app.App) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if auth.GetImpersonation(ctx) != nil {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Stop the current impersonation first"})
+			return
+		}
 
-		user, err := impersonateAccount(ctx, impersonationID)
+		user, err := getUserData(a, ctx)
 		if err != nil {
 			fmt.Println("err", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// Only platform admins may act as other users, anyone else is a joker
+		if user == nil || user.Role != services.RolePlatformAdmin {
+			reportJoker(a, ctx)
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+
+		var params StartImpersonationRequest
+		if err := ctx.ShouldBind(&params); err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
+		imp, err := auth.StartImpersonation(a, ctx, ctx.Param("id"), services.ImpersonationParams{
+			Reason: params.Reason,
+			TTL:    time.Duration(params.TTLMinutes) * time.Minute,
+		})
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		render(ctx, http.StatusOK, views.Index(user))
+		ctx.Header("HX-Redirect", "/")
+		ctx.JSON(http.StatusCreated, gin.H{
+			"impersonation": imp,
+		})
+	}
+}
+
+// StopImpersonationHandler ends the impersonation, the banner posts here
+func StopImpersonationHandler(a *app.App) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if err := auth.StopImpersonation(a, ctx); err != nil {
+			fmt.Println("err", err)
+		}
+		ctx.Redirect(http.StatusSeeOther, "/")
 	}
 }
 
@@ -160,9 +198,9 @@ func LoginPageHandler() gin.HandlerFunc {
 	}
 }
 
-func LogoutPageHandler() gin.HandlerFunc {
+func LogoutPageHandler(a *app.App) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		auth.UnsetTokenCookie(ctx)
+		auth.EndSession(a, ctx)
 		_, cancel := context.WithTimeout(context.Background(), appTimeout)
 		defer cancel()
 
@@ -170,13 +208,12 @@ func LogoutPageHandler() gin.HandlerFunc {
 	}
 }
 
-func ComponentHandler() gin.HandlerFunc {
+func ComponentHandler(a *app.App) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		_, cancel := context.WithTimeout(context.Background(), appTimeout)
 		defer cancel()
 		userID := ctx.GetString("user")
-		userService := services.NewUserService()
-		user, err := userService.Get(ctx, userID)
+		user, err := a.Users.Get(ctx, userID)
 
 		if err != nil {
 			fmt.Println("err", err)
@@ -188,7 +225,7 @@ func ComponentHandler() gin.HandlerFunc {
 	}
 }
 
-func SendMessageHandler() gin.HandlerFunc {
+func SendMessageHandler(a *app.App) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		// Start timing
 		start := time.Now()
@@ -204,8 +241,7 @@ func SendMessageHandler() gin.HandlerFunc {
 		defer func() {
 			if exists {
 
-				eventService := services.NewEventService(userID.(string))
-				_, logErr := eventService.Create(services.EventMessage, services.EventMetadata{
+				_, logErr := a.Events(userID.(string)).Create(services.EventMessage, services.EventMetadata{
 					"conversation":  data.ConversationID,
 					"hasFiles":      data.HasFiles,
 					"err":           errorMessage,
@@ -256,13 +292,13 @@ func SendMessageHandler() gin.HandlerFunc {
 	}
 }
 
-func ThreadPageHandler() gin.HandlerFunc {
+func ThreadPageHandler(a *app.App) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		_, cancel := context.WithTimeout(context.Background(), appTimeout)
 		defer cancel()
 
 		threadID := ctx.Param("id")
-		user, err := getUserData(ctx)
+		user, err := getUserData(a, ctx)
 		if err != nil {
 			fmt.Println("err", err)
 		}
@@ -274,58 +310,154 @@ func ThreadPageHandler() gin.HandlerFunc {
 
 
 
-func FileUploadHandler() gin.HandlerFunc {
+func FileUploadHandler(a *app.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get conversationId from form data
 		conversationID := c.PostForm("conversationId")
-		// Get file from form data
-		file, err := c.FormFile("file")
 
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "No file uploaded",
-			})
+		user, ok := currentUser(a, c)
+		if !ok || !claimConversation(a, c, user, conversationID) {
 			return
 		}
-		// Save file entry locally
-		fileService, err := services.NewFileService(c)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		dbEntry, ok := uploadFile(a, c, user, conversationID, conversationID)
+		if !ok {
+			return
 		}
-		dbEntry, err := fileService.Create(c, file.Filename)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("File %s uploaded successfully", dbEntry.Name),
+			"id":      dbEntry.ID,
+		})
+	}
+
+}
+
+// uploadFile stores the "file" form field and embeds it into partition. It writes the error response
+// itself and returns false when something failed.
+func uploadFile(a *app.App, c *gin.Context, user *services.UserDto, conversationID string, partition string) (*schema.File, bool) {
+	// Get file from form data
+	file, err := c.FormFile("file")
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "No file uploaded",
+		})
+		return nil, false
+	}
+	// Tags can be sent as several fields or comma separated
+	tags, err := services.NormalizeTags(c.PostFormArray("tags"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	// Keep the original and save the file entry
+	fileService, err := a.Files(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	content, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	defer content.Close()
+	dbEntry, err := fileService.Create(c, services.FileUpload{
+		Name:         file.Filename,
+		Conversation: conversationID,
+		MimeType:     file.Header.Get("Content-Type"),
+		Size:         file.Size,
+		Tags:         tags,
+	}, content)
+	if err != nil {
+		fmt.Println("Error storing file: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not store file"})
+		return nil, false
+	}
+
+	// Spreadsheets are queried with SQL while chatting, their rows are not embedded
+	if tables.IsTabular(file.Filename) {
+		return dbEntry, true
+	}
+
+	// Create embeddings and save to vector DB
+	index, err := rag.HandleFileEmbedding(c, file, rag.SourceOf(*dbEntry, user.Account.ID, tags), partition)
+	if err != nil {
+		fmt.Println("err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err := fileService.SetIndex(c, dbEntry.ID, index.Model, index.Chunker); err != nil {
+		fmt.Println("Error recording file index: " + err.Error())
+	}
+	return dbEntry, true
+}
+
+// FileDownloadHandler returns the original of a file, only to the user who uploaded it
+func FileDownloadHandler(a *app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fileService, err := a.Files(c)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		file, content, err := fileService.Open(c, c.Param("id"))
+		if errors.Is(err, services.ErrFileNotFound) || errors.Is(err, services.ErrNoOriginal) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
 		}
-		fileID := dbEntry.ID
-
-		// Create embeddings and save to vector DB
-		err = rag.HandleFileEmbedding(c, file, fileID, conversationID)
 		if err != nil {
-			fmt.Println("err", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			fmt.Println("Error opening file: " + err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not open file"})
 			return
 		}
+		defer content.Close()
 
-		c.JSON(http.StatusOK, gin.H{
-			"message": fmt.Sprintf("File %s uploaded successfully", file.Filename),
-			"id":      fileID,
+		c.DataFromReader(http.StatusOK, file.Size, file.Mimetype, content, map[string]string{
+			"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": file.Name}),
+			"ETag":                `"` + file.Hash + `"`,
 		})
 	}
-
 }
-func FileDeleteHandler() gin.HandlerFunc {
+
+// FileDeleteHandler removes one of the user's files: its vectors in the conversation and the knowledge
+// bases it was added to, the file itself and its original
+func FileDeleteHandler(a *app.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		// Get conversationId from form data
-		conversationID := c.PostForm("conversationId")
 		fileID := c.PostForm("fileId")
 
-		// Get file from form data
-		// Save file entry locally
-		err := rag.RemoveDocumentsByFileId(c, fileID, conversationID)
+		user, ok := currentUser(a, c)
+		if !ok {
+			return
+		}
+		fileService, err := a.Files(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		file, err := fileService.Get(c, fileID)
+		if errors.Is(err, services.ErrFileNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete file"})
+			return
+		}
 
+		// The vectors go first, a file that is still searchable must not disappear from the list
+		err = rag.RemoveDocumentsByFileId(c, file.ID, user.Account.ID, "")
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := fileService.Delete(c, file.ID); err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete file"})
+			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
@@ -335,17 +467,25 @@ func FileDeleteHandler() gin.HandlerFunc {
 
 }
 
-func PartitionDeleteHandler() gin.HandlerFunc {
+// PartitionDeleteHandler removes one of the user's conversations and the vectors of its uploads
+func PartitionDeleteHandler(a *app.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get conversationId from form data
 		conversationID := c.PostForm("conversationId")
 
-		// Get file from form data
-		// Save file entry locally
+		user, ok := currentUser(a, c)
+		if !ok || !claimConversation(a, c, user, conversationID) {
+			return
+		}
+
 		err := rag.RemovePartition(c, conversationID)
 
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := a.Conversations.Delete(c, user.ID, conversationID); err != nil {
+			fmt.Println("Error deleting conversation: " + err.Error())
 		}
 
 		c.JSON(http.StatusOK, gin.H{
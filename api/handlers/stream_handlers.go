@@ -2,27 +2,36 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/sashabaranov/go-openai"
 	"gochat/internal/ai"
+	"gochat/internal/app"
 	"gochat/internal/rag"
+	"gochat/internal/schema"
 	"gochat/internal/services"
+	"gochat/internal/tables"
 	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
-// ChatStreamHandler handles SSE connections for streaming chat responses
-func ChatStreamHandler(manager *services.ClientManager) gin.HandlerFunc {
+// ChatStreamHandler handles SSE connections for streaming chat responses, only the owner of a
+// thread may follow it
+func ChatStreamHandler(a *app.App, manager *services.ClientManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		threadID := c.Query("thread_id")
 		if threadID == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing conversation_id parameter"})
 			return
 		}
+		user, ok := currentUser(a, c)
+		if !ok || !claimConversation(a, c, user, threadID) {
+			return
+		}
 
 		// Set headers for SSE
 		c.Writer.Header().Set("Content-Type", "text/event-stream")
@@ -102,6 +111,8 @@ type Message struct {
 type MessageHandlerRequestData struct {
 	Messages  []Message `json:"messages"`
 	ThreadID string `json:"threadId"`
+	// Filter restricts what the documents are searched for, to some files, tags or upload dates
+	Filter rag.Filter `json:"filter"`
 }
 
 func processMessages(messages []Message, c *gin.Context) ([]ai.IncomingMessage, error) {
@@ -141,13 +152,26 @@ func processMessages(messages []Message, c *gin.Context) ([]ai.IncomingMessage,
 			return nil, err
 		}
 
+		attachment := ai.Attachment{
+			ID:     attInfo.ID,
+			Type:   attInfo.Type,
+			Name:   header.Filename,
+			Binary: fileBytes,
+		}
+		// Images are checked and scaled down here, whatever type the browser said they are
+		if ai.IsImage(attInfo.Type) || ai.IsImage(http.DetectContentType(fileBytes)) {
+			mimeType, image, err := ai.PrepareImage(fileBytes)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("%s: %s", header.Filename, err),
+				})
+				return nil, err
+			}
+			attachment.Type, attachment.Binary = mimeType, image
+		}
+
 		// Add to message
-		message.Attachments = append(message.Attachments, ai.Attachment{
-		ID:     attInfo.ID,
-		Type:   attInfo.Type,
-		Name:   header.Filename,
-		Binary: fileBytes,
-	})
+		message.Attachments = append(message.Attachments, attachment)
 	}
 
 		processedMessages = append(processedMessages, message)
@@ -173,7 +197,7 @@ func GetModelParamsFromMessages(messages []Message) (*float32, *float32, error)
 }
 
 // MessageHandler handles incoming chat messages and triggers response streaming
-func MessageHandler(manager *services.ClientManager) gin.HandlerFunc {
+func MessageHandler(a *app.App, manager *services.ClientManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		// Parse the multipart form (32MB limit or adjust as needed)
@@ -197,11 +221,20 @@ func MessageHandler(manager *services.ClientManager) gin.HandlerFunc {
 			return
 		}
 
+		// Only the owner of a thread may search its uploads
+		user, ok := currentUser(a, c)
+		if !ok || !claimConversation(a, c, user, requestData.ThreadID) {
+			return
+		}
+
 		// Process each message and its attachments
 		processedMessages, err := processMessages(requestData.Messages, c)
 
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process messages"})
+			// processMessages already said which attachment was the problem
+			if !c.Writer.Written() {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process messages"})
+			}
 			return
 		}
 
@@ -226,7 +259,7 @@ func MessageHandler(manager *services.ClientManager) gin.HandlerFunc {
 		for _, message := range processedMessages {
 			if len(message.Attachments) > 0 {
 				for _, attachment := range message.Attachments {
-					if attachment.Type != "image" {
+					if !ai.IsImage(attachment.Type) {
 						// Check MIME type for PDF and TXT files
 						mimeType := attachment.Type
 						if mimeType == "application/pdf" ||
@@ -242,12 +275,42 @@ func MessageHandler(manager *services.ClientManager) gin.HandlerFunc {
 			}
 		}
 
+		// The thread's own uploads and the knowledge bases attached to it are searched together
+		scope := rag.Scope{Account: user.Account.ID, Partitions: []string{requestData.ThreadID}, Filter: requestData.Filter}
+		if !requestData.Filter.Empty() {
+			useRag = true
+		}
+		kbs, err := a.KnowledgeBases.Attached(c, user, requestData.ThreadID)
+		if err != nil {
+			fmt.Println("Error getting knowledge bases: " + err.Error())
+		}
+		for _, kb := range kbs {
+			scope.Partitions = append(scope.Partitions, kb.Partition)
+			useRag = true
+		}
+
 fmt.Println("useRag: ", useRag)
-		if useRag {
-			go rag.GetRaggedAnswerStream(c, openAIMessages, requestData.ThreadID, openaiRequest, manager)
-		} else {
-			go ai.GetCompletionStream(c, requestData.ThreadID, openAIMessages, openaiRequest, manager)
+		tools := rag.ChatTools(scope)
+		// Spreadsheets are not embedded, their query tool is offered even when LLM_TOOLS is off
+		database := loadTables(a, c, requestData.ThreadID, processedMessages)
+		if database != nil {
+			if tools == nil {
+				tools = ai.NewToolRegistry()
+			}
+			tools.Add(database.Tool())
 		}
+		// The context is reused once the handler returns, the stream gets a copy
+		stream := c.Copy()
+		go func() {
+			if database != nil {
+				defer database.Close()
+			}
+			if useRag {
+				rag.GetRaggedAnswerStream(stream, openAIMessages, requestData.ThreadID, scope, openaiRequest, tools, manager, a.Events(user.ID))
+			} else {
+				ai.GetCompletionStream(stream, requestData.ThreadID, openAIMessages, openaiRequest, tools, manager)
+			}
+		}()
 
 		// Start async goroutine to stream LLM response
 		//go services.StreamLLMResponse(data.ConversationID, manager)
@@ -256,3 +319,140 @@ fmt.Println("useRag: ", useRag)
 		c.JSON(http.StatusAccepted, gin.H{"status": "Message received, response streaming"})
 	}
 }
+
+// loadTables loads the spreadsheets attached to the messages and uploaded to the conversation, so
+// the model can query them. It returns nil when there are none, a file that can't be loaded is left out.
+func loadTables(a *app.App, c *gin.Context, conversationID string, messages []ai.IncomingMessage) *tables.Database {
+	type source struct {
+		name string
+		open func() (io.ReadCloser, error)
+	}
+	var sources []source
+	seen := map[string]bool{}
+	for _, message := range messages {
+		for _, attachment := range message.Attachments {
+			if !tables.IsTabular(attachment.Name) || seen[attachment.Name] {
+				continue
+			}
+			seen[attachment.Name] = true
+			binary := attachment.Binary
+			sources = append(sources, source{attachment.Name, func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(binary)), nil
+			}})
+		}
+	}
+	fileService, err := a.Files(c)
+	if err != nil {
+		fmt.Println("Error getting file service: " + err.Error())
+		return nil
+	}
+	files, err := fileService.ListConversation(c, conversationID)
+	if err != nil {
+		fmt.Println("Error listing conversation files: " + err.Error())
+	}
+	// A newer upload with the same name replaces the older one
+	for i := len(files) - 1; i >= 0; i-- {
+		file := files[i]
+		if !tables.IsTabular(file.Name) || seen[file.Name] {
+			continue
+		}
+		seen[file.Name] = true
+		sources = append(sources, source{file.Name, func() (io.ReadCloser, error) {
+			_, content, err := fileService.Open(c, file.ID)
+			return content, err
+		}})
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+
+	database, err := tables.Open()
+	if err != nil {
+		fmt.Println("Error opening tables: " + err.Error())
+		return nil
+	}
+	for _, s := range sources {
+		content, err := s.open()
+		if err != nil {
+			fmt.Printf("skipping table %s: %s\n", s.name, err)
+			continue
+		}
+		if err := database.Load(c, s.name, content); err != nil {
+			fmt.Printf("skipping table %s: %s\n", s.name, err)
+		}
+		content.Close()
+	}
+	if len(database.Tables) == 0 {
+		database.Close()
+		return nil
+	}
+	return database
+}
+
+// SummarizeHandler streams a summary of one of the conversation's files, or of all of them when no
+// file is given, to the conversation's event stream. A single file may also come from one of the
+// conversation's knowledge bases.
+func SummarizeHandler(a *app.App, manager *services.ClientManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conversationID := c.PostForm("conversationId")
+		fileID := c.PostForm("fileId")
+
+		user, ok := currentUser(a, c)
+		if !ok || !claimConversation(a, c, user, conversationID) {
+			return
+		}
+		fileService, err := a.Files(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var files []schema.File
+		if fileID != "" {
+			file, err := fileService.Get(c, fileID)
+			if err != nil && !errors.Is(err, services.ErrFileNotFound) {
+				fmt.Println(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get file"})
+				return
+			}
+			if file != nil && file.Conversation != conversationID {
+				// A file of another conversation is only summarized here when a knowledge base brings it in
+				searches, err := a.KnowledgeBases.Searches(c, user, conversationID, file.ID)
+				if err != nil {
+					fmt.Println(err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get file"})
+					return
+				}
+				if !searches {
+					file = nil
+				}
+			}
+			if file != nil {
+				files = append(files, *file)
+			}
+		} else {
+			files, err = fileService.ListConversation(c, conversationID)
+			if err != nil {
+				fmt.Println(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list files"})
+				return
+			}
+		}
+		if len(files) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": services.ErrFileNotFound.Error()})
+			return
+		}
+
+		// The context is reused once the handler returns, the summary gets a copy
+		go func(ctx *gin.Context) {
+			err := rag.SummarizeFiles(ctx, fileService, user.Account.ID, files, conversationID, manager)
+			if err != nil {
+				fmt.Println("Error summarizing: " + err.Error())
+				manager.SendRawEventToConversation(conversationID, "error", fmt.Sprintf(`{"error":%q}`, err.Error()))
+				manager.SendRawEventToConversation(conversationID, "message", `{"content":"","isDone":true}`)
+			}
+		}(c.Copy())
+
+		c.JSON(http.StatusAccepted, gin.H{"status": "Summarizing, the summary streams to the conversation"})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"gochat/api/handlers"
+	"gochat/internal/app"
 	"gochat/internal/auth"
 	"gochat/internal/services"
 	"io/ioutil"
@@ -53,54 +54,127 @@ func afterRequestMiddleware(c *gin.Context) {
 
 }
 
-func AddRoutes(r *gin.Engine) {
+func AddRoutes(r *gin.Engine, a *app.App) {
 
 	//r.Static("/static", "./frontend/dist")templ
 	r.Static("/static", "./frontend/dist")
 	r.Static("/e4694570-f591-4c52-bba9-a5865dc4ba09.ico", "./frontend/dist/e4694570-f591-4c52-bba9-a5865dc4ba09.ico")
 	// Auth
 	r.GET("login", handlers.LoginPageHandler())
-	r.GET("/login/microsoft", auth.LoginHandler())
-	r.GET("/login/google", auth.OauthGoogleLogin())
-	r.GET("/oauth/redirect/azure", handlers.OAuthRedirectAzure(r))
-	//r.GET("/oauth/redirect/google", handlers.OAuthRedirectGoogle(r))
+	r.GET("/login/microsoft", func(c *gin.Context) {
+		c.Redirect(http.StatusFound, "/login/oidc/azure")
+	})
+	r.GET("/login/google", func(c *gin.Context) {
+		c.Redirect(http.StatusFound, "/login/oidc/google")
+	})
+	r.GET("/login/sso", handlers.SSOLoginHandler(a))
+	r.GET("/login/oidc/:provider", handlers.OIDCLoginHandler(a))
+	// Azure is registered with /oauth/redirect/azure, so every provider uses this callback
+	r.GET("/oauth/redirect/:provider", handlers.OIDCCallbackHandler(a))
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
-	r.GET("/logout", handlers.LogoutPageHandler())
+	r.GET("/logout", handlers.LogoutPageHandler(a))
+	r.POST("/auth/refresh", handlers.RefreshTokenHandler(a))
 
 	protected := r.Group("")
-	protected.Use(auth.JWTMiddleware(), auth.AccountMiddleware())
+	protected.Use(auth.JWTMiddleware(a), auth.AccountMiddleware(a))
 	m := services.NewClientManager()
+	apiKeyHandlers := handlers.NewAPIKeyHandlers(a.APIKeys)
+	knowledgeBaseHandlers := handlers.NewKnowledgeBaseHandlers(a)
+	extractionHandlers := handlers.NewExtractionHandlers(a)
 	{
-		protected.GET("", handlers.IndexPageHandler())
-		protected.GET("thread/:id", handlers.ThreadPageHandler())
-		protected.GET("component/:componentName", handlers.ComponentHandler())
-		protected.POST("send-message", afterRequestMiddleware, handlers.SendMessageHandler())
+		protected.GET("", handlers.IndexPageHandler(a))
+		protected.GET("thread/:id", handlers.ThreadPageHandler(a))
+		protected.GET("component/:componentName", handlers.ComponentHandler(a))
+		protected.POST("send-message", afterRequestMiddleware, handlers.SendMessageHandler(a))
 		// Split these into separate handlers
-		protected.GET("/chat-stream", handlers.ChatStreamHandler(m))
-		protected.POST("/chat-stream", handlers.MessageHandler(m))
-
-		protected.POST("file/upload", handlers.FileUploadHandler())
-		protected.POST("file/delete", handlers.FileDeleteHandler())
-		protected.POST("conversation/delete", handlers.PartitionDeleteHandler())
+		protected.GET("/chat-stream", handlers.ChatStreamHandler(a, m))
+		protected.POST("/chat-stream", handlers.MessageHandler(a, m))
+
+		protected.POST("file/upload", handlers.FileUploadHandler(a))
+		protected.GET("file/:id", handlers.FileDownloadHandler(a))
+		protected.POST("file/delete", handlers.FileDeleteHandler(a))
+		protected.POST("conversation/delete", handlers.PartitionDeleteHandler(a))
+		protected.POST("conversation/summarize", handlers.SummarizeHandler(a, m))
+
+		protected.POST("impersonate/start/:id", handlers.StartImpersonationHandler(a))
+		protected.POST("impersonate/stop", handlers.StopImpersonationHandler(a))
+
+		protected.POST("logout/all", auth.DenyImpersonation(), handlers.LogoutAllHandler(a))
+
+		protected.GET("api-keys", apiKeyHandlers.ListAPIKeys())
+		protected.POST("api-keys/create", auth.DenyImpersonation(), apiKeyHandlers.CreateAPIKey())
+		protected.POST("api-keys/revoke/:id", auth.DenyImpersonation(), apiKeyHandlers.RevokeAPIKey())
+
+		protected.GET("knowledge-bases", knowledgeBaseHandlers.ListKnowledgeBases())
+		protected.POST("knowledge-bases/create", knowledgeBaseHandlers.CreateKnowledgeBase())
+		protected.GET("knowledge-bases/:id", knowledgeBaseHandlers.GetKnowledgeBase())
+		protected.POST("knowledge-bases/:id/update", knowledgeBaseHandlers.UpdateKnowledgeBase())
+		protected.POST("knowledge-bases/:id/delete", knowledgeBaseHandlers.DeleteKnowledgeBase())
+		protected.GET("knowledge-bases/:id/files", knowledgeBaseHandlers.ListFiles())
+		protected.POST("knowledge-bases/:id/files/add", knowledgeBaseHandlers.AddFile())
+		protected.POST("knowledge-bases/:id/files/upload", knowledgeBaseHandlers.UploadFile())
+		protected.POST("knowledge-bases/:id/files/remove/:fileId", knowledgeBaseHandlers.RemoveFile())
+		protected.GET("conversation/:id/knowledge-bases", knowledgeBaseHandlers.ListAttached())
+		protected.POST("conversation/:id/knowledge-bases/attach/:kb", knowledgeBaseHandlers.Attach())
+		protected.POST("conversation/:id/knowledge-bases/detach/:kb", knowledgeBaseHandlers.Detach())
+
+		protected.GET("extractions", extractionHandlers.ListExtractions())
+		protected.POST("extractions/create", extractionHandlers.CreateExtraction())
+		protected.GET("extractions/:id", extractionHandlers.GetExtraction())
+		protected.GET("extractions/:id/download", extractionHandlers.DownloadExtraction())
+	}
 
-		protected.GET("impersonate/:id", handlers.ImpersonateIndexPageHandler())
+	// Account admins manage their own account, platform admins manage the account they belong to
+	manage := protected.Group("manage")
+	manage.Use(auth.DenyImpersonation(), auth.RequireRole(a, services.RoleAccountAdmin, services.RolePlatformAdmin))
+	manageHandlers := handlers.NewManageHandlers(a.Accounts, a.Users, a.Sessions)
+	{
+		manage.GET("domains", manageHandlers.ListDomains())
+		manage.POST("domains/create", manageHandlers.ClaimDomain())
+		manage.POST("domains/verify/:domain", manageHandlers.VerifyDomain())
+		manage.POST("domains/delete/:domain", manageHandlers.RemoveDomain())
+		manage.GET("users", manageHandlers.ListUsers())
+		manage.POST("users/:id/role", manageHandlers.SetUserRole())
+		manage.POST("users/:id/sessions/revoke", manageHandlers.RevokeUserSessions())
+	}
 
+	// Programmatic access with personal api keys
+	v1 := r.Group("api/v1")
+	v1.Use(auth.APIKeyMiddleware(a), auth.AccountMiddleware(a))
+	{
+		v1.POST("chat/completions", auth.RequireScope(services.APIScopeChat), handlers.SendMessageHandler(a))
+		v1.POST("file/upload", auth.RequireScope(services.APIScopeFiles), handlers.FileUploadHandler(a))
+		v1.GET("file/:id", auth.RequireScope(services.APIScopeFiles), handlers.FileDownloadHandler(a))
+		v1.POST("file/delete", auth.RequireScope(services.APIScopeFiles), handlers.FileDeleteHandler(a))
 	}
 
 	admin := r.Group("patron")
 	authConfig := auth.LoadAdminAuthConfig()
 	admin.Use(auth.AdminAuthMiddleware(authConfig))
 
-	accountService := services.NewAccountService()
-	accountHandlers := handlers.NewAccountHandlers(accountService)
+	accountHandlers := handlers.NewAccountHandlers(a)
 	{
+		admin.GET("users", accountHandlers.ListUsers())
+		admin.POST("user/import", accountHandlers.ImportUsers())
 		admin.GET("user/:id", accountHandlers.GetUser())
+		admin.POST("user/:id/delete", accountHandlers.DeleteUser())
+		admin.POST("user/:id/disable", accountHandlers.SetUserDisabled(true))
+		admin.POST("user/:id/enable", accountHandlers.SetUserDisabled(false))
+		admin.GET("accounts", accountHandlers.ListAccounts())
 		admin.GET("account/:id", accountHandlers.GetAccount())
+		admin.GET("account/:id/domains", accountHandlers.ListAccountDomains())
+		admin.POST("account/:id/rename", accountHandlers.RenameAccount())
+		admin.POST("account/:id/delete", accountHandlers.DeleteAccount())
 		admin.POST("account/create", accountHandlers.CreateAccount())
 		admin.POST("account/accountdomains/create", accountHandlers.AddDomain())
 		admin.GET("account/accountdomains/delete/:domain", accountHandlers.DeleteAccountDomain())
 		admin.POST("account/change-user-account", accountHandlers.ChangeUserAccount())
+		admin.POST("user/:id/sessions/revoke", accountHandlers.RevokeUserSessions())
+		admin.POST("user/:id/role", accountHandlers.SetUserRole())
+		admin.GET("account/:id/oidc", accountHandlers.ListOIDCProviders())
+		admin.POST("account/oidc/create", accountHandlers.CreateOIDCProvider())
+		admin.GET("account/oidc/delete/:provider", accountHandlers.DeleteOIDCProvider())
 	}
 }
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gochat/internal/schema"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type pageFlags struct {
+	page     *int
+	pageSize *int
+	search   *string
+}
+
+func addPageFlags(fs *flag.FlagSet) pageFlags {
+	return pageFlags{
+		page:     fs.Int("page", 1, "Page to show, starting at 1"),
+		pageSize: fs.Int("page-size", 50, "Results per page"),
+		search:   fs.String("search", "", "Only show results containing this text"),
+	}
+}
+
+func (p pageFlags) query() url.Values {
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(*p.page))
+	query.Set("pageSize", strconv.Itoa(*p.pageSize))
+	if *p.search != "" {
+		query.Set("search", *p.search)
+	}
+	return query
+}
+
+type pageResponse struct {
+	Page     int   `json:"page"`
+	PageSize int   `json:"pageSize"`
+	Total    int64 `json:"total"`
+}
+
+func accountsCommand(ctx context.Context, a *app, args []string) error {
+	name, args, err := subcommand(args, "list", "get", "create", "rename", "delete")
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("accounts "+name, flag.ContinueOnError)
+
+	switch name {
+	case "list":
+		page := addPageFlags(fs)
+		if _, err := needArgs(fs, args); err != nil {
+			return err
+		}
+		var resp struct {
+			Accounts []schema.Account `json:"accounts"`
+			pageResponse
+		}
+		if err := a.admin(ctx, http.MethodGet, "accounts", page.query(), nil, &resp); err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(resp.Accounts))
+		for _, account := range resp.Accounts {
+			rows = append(rows, []string{account.ID, account.Name, account.Createdat})
+		}
+		if err := a.out.table(resp, []string{"ID", "NAME", "CREATED"}, rows); err != nil {
+			return err
+		}
+		if !a.out.json {
+			fmt.Fprintln(a.stdout, pageFooter(resp.Page, resp.PageSize, resp.Total))
+		}
+		return nil
+
+	case "get":
+		positional, err := needArgs(fs, args, "account-id")
+		if err != nil {
+			return err
+		}
+		var resp struct {
+			Account schema.GetAccountRow `json:"account"`
+		}
+		if err := a.admin(ctx, http.MethodGet, "account/"+url.PathEscape(positional[0]), nil, nil, &resp); err != nil {
+			return err
+		}
+		return a.out.fields(resp, [][2]string{
+			{"ID", resp.Account.ID},
+			{"Name", resp.Account.Name},
+			{"Domains", fmt.Sprint(resp.Account.Domains)},
+			{"Created", resp.Account.Createdat},
+		})
+
+	case "create":
+		positional, err := needArgs(fs, args, "name")
+		if err != nil {
+			return err
+		}
+		var resp struct {
+			Account schema.Account `json:"account"`
+		}
+		if err := a.admin(ctx, http.MethodPost, "account/create", nil, map[string]string{"name": positional[0]}, &resp); err != nil {
+			return err
+		}
+		return a.out.message(resp, fmt.Sprintf("created account %s (%s)", resp.Account.Name, resp.Account.ID))
+
+	case "rename":
+		positional, err := needArgs(fs, args, "account-id", "name")
+		if err != nil {
+			return err
+		}
+		var resp map[string]interface{}
+		path := "account/" + url.PathEscape(positional[0]) + "/rename"
+		if err := a.admin(ctx, http.MethodPost, path, nil, map[string]string{"name": positional[1]}, &resp); err != nil {
+			return err
+		}
+		return a.out.message(resp, fmt.Sprint(resp["message"]))
+
+	case "delete":
+		yes := fs.Bool("yes", false, "Confirm deleting the account with all its users")
+		positional, err := needArgs(fs, args, "account-id")
+		if err != nil {
+			return err
+		}
+		if !*yes {
+			return fmt.Errorf("this deletes the account with all its users and their data, pass -yes to confirm")
+		}
+		var resp map[string]interface{}
+		if err := a.admin(ctx, http.MethodPost, "account/"+url.PathEscape(positional[0])+"/delete", nil, nil, &resp); err != nil {
+			return err
+		}
+		return a.out.message(resp, fmt.Sprint(resp["message"]))
+	}
+	return nil
+}
+
+func domainsCommand(ctx context.Context, a *app, args []string) error {
+	name, args, err := subcommand(args, "list", "add", "remove")
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("domains "+name, flag.ContinueOnError)
+
+	switch name {
+	case "list":
+		positional, err := needArgs(fs, args, "account-id")
+		if err != nil {
+			return err
+		}
+		var resp struct {
+			Domains []string `json:"domains"`
+		}
+		if err := a.admin(ctx, http.MethodGet, "account/"+url.PathEscape(positional[0])+"/domains", nil, nil, &resp); err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(resp.Domains))
+		for _, domain := range resp.Domains {
+			rows = append(rows, []string{domain})
+		}
+		return a.out.table(resp, []string{"DOMAIN"}, rows)
+
+	case "add":
+		positional, err := needArgs(fs, args, "account-id", "domain")
+		if err != nil {
+			return err
+		}
+		var resp struct {
+			Domain schema.AccountDomain `json:"domain"`
+		}
+		body := map[string]string{"accountId": positional[0], "domain": positional[1]}
+		if err := a.admin(ctx, http.MethodPost, "account/accountdomains/create", nil, body, &resp); err != nil {
+			return err
+		}
+		return a.out.message(resp, fmt.Sprintf("added %s to account %s", resp.Domain.Domain, resp.Domain.Account))
+
+	case "remove":
+		positional, err := needArgs(fs, args, "domain")
+		if err != nil {
+			return err
+		}
+		var resp map[string]interface{}
+		if err := a.admin(ctx, http.MethodGet, "account/accountdomains/delete/"+url.PathEscape(positional[0]), nil, nil, &resp); err != nil {
+			return err
+		}
+		return a.out.message(resp, fmt.Sprint(resp["message"]))
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gochat/internal/rag"
+	"gochat/internal/services"
+	"gochat/internal/store"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openStore connects to the database of the -driver and -db flags without migrating it, the caller closes it
+func (a *app) openStore() (store.Store, error) {
+	if a.db.DSN == "" {
+		return nil, fmt.Errorf("no database, set DB_PATH or DATABASE_URL, or pass -db")
+	}
+	return store.Connect(a.db)
+}
+
+// parseSince accepts a date (2025-01-31), a timestamp (RFC3339) or a duration back from now (24h)
+func parseSince(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func usageCommand(ctx context.Context, a *app, args []string) error {
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	fs := flag.NewFlagSet("usage", flag.ContinueOnError)
+	since := fs.String("since", monthStart.Format("2006-01-02"), "Start of the period (date, RFC3339 or duration like 720h)")
+	until := fs.String("until", "", "End of the period, exclusive, defaults to now")
+	if _, err := needArgs(fs, args); err != nil {
+		return err
+	}
+	from, err := parseSince(*since)
+	if err != nil {
+		return fmt.Errorf("invalid -since: %w", err)
+	}
+	to := now
+	if *until != "" {
+		if to, err = parseSince(*until); err != nil {
+			return fmt.Errorf("invalid -until: %w", err)
+		}
+	}
+
+	st, err := a.openStore()
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	reportService := services.NewReportService(st)
+	usage, err := reportService.Usage(ctx, from, to)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(usage))
+	for _, u := range usage {
+		rows = append(rows, []string{u.AccountID, u.AccountName, strconv.FormatInt(u.Messages, 10), strconv.FormatInt(u.ActiveUsers, 10)})
+	}
+	return a.out.table(usage, []string{"ACCOUNT", "NAME", "MESSAGES", "ACTIVE USERS"}, rows)
+}
+
+func eventsCommand(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("events", flag.ContinueOnError)
+	user := fs.String("user", "", "Only events of this user")
+	eventType := fs.String("type", "", "Only events of this type, like login, message or evil")
+	since := fs.String("since", "24h", "Oldest event to show (date, RFC3339 or duration)")
+	limit := fs.Int("limit", 100, "Maximum number of events")
+	if _, err := needArgs(fs, args); err != nil {
+		return err
+	}
+	from, err := parseSince(*since)
+	if err != nil {
+		return fmt.Errorf("invalid -since: %w", err)
+	}
+
+	st, err := a.openStore()
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	reportService := services.NewReportService(st)
+	events, err := reportService.Events(ctx, services.EventFilter{
+		UserID: *user,
+		Event:  services.EventType(*eventType),
+		Since:  from,
+		Limit:  *limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(events))
+	for _, e := range events {
+		rows = append(rows, []string{strconv.FormatInt(e.ID, 10), e.Timestamp, e.Event, e.UserID, string(e.Metadata)})
+	}
+	return a.out.table(events, []string{"ID", "TIME", "EVENT", "USER", "METADATA"}, rows)
+}
+
+func reindexCommand(ctx context.Context, a *app, args []string) error {
+	target, err := rag.ConfiguredIndex()
+	if err != nil {
+		return err
+	}
+	blobConfig := store.BlobConfigFromEnv()
+
+	fs := flag.NewFlagSet("reindex", flag.ContinueOnError)
+	model := fs.String("model", target.Model, "Embedding model, defaults to $EMBEDDING_MODEL")
+	dim := fs.Int("dim", target.Dim, "Dimension of the model's vectors, defaults to $EMBEDDING_DIM")
+	blobPath := fs.String("blobs", blobConfig.Path, "Directory with the file originals, defaults to $BLOB_PATH (BLOB_DRIVER=s3 uses the bucket)")
+	dropPrevious := fs.Bool("drop-previous", false, "Drop the previous collection after the swap instead of keeping it")
+	if _, err := needArgs(fs, args); err != nil {
+		return err
+	}
+	target.Model, target.Dim = *model, *dim
+	blobConfig.Path = *blobPath
+
+	st, err := a.openStore()
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	blobs, err := store.OpenBlobStore(ctx, blobConfig)
+	if err != nil {
+		return err
+	}
+
+	logf := func(format string, args ...interface{}) {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	}
+	result, err := rag.Reindex(ctx, st, blobs, target, logf)
+	if err != nil {
+		return err
+	}
+	if *dropPrevious {
+		if err := rag.DropCollection(ctx, result.Previous); err != nil {
+			return fmt.Errorf("re-index done, but dropping %s failed: %w", result.Previous, err)
+		}
+		logf("dropped %s", result.Previous)
+	}
+
+	return a.out.fields(result, [][2]string{
+		{"Collection", result.Collection},
+		{"Previous", result.Previous},
+		{"Model", result.Model},
+		{"Files", strconv.Itoa(result.Files)},
+		{"Chunks", strconv.Itoa(result.Chunks)},
+		{"Skipped", strconv.Itoa(len(result.Skipped))},
+	})
+}
+
+func migrateCommand(ctx context.Context, a *app, args []string) error {
+	name, args, err := subcommand(args, "up", "down", "goto", "force", "version")
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet("migrate "+name, flag.ContinueOnError)
+	dir := flags.String("path", "", "Directory with the migration files, defaults to the ones built into gochatctl")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// up and down take an optional number of steps, goto and force a version
+	number := 0
+	switch {
+	case flags.NArg() > 1:
+		return fmt.Errorf("too many arguments")
+	case flags.NArg() == 1:
+		if number, err = strconv.Atoi(flags.Arg(0)); err != nil {
+			return fmt.Errorf("invalid number %q", flags.Arg(0))
+		}
+	case name == "goto" || name == "force":
+		return fmt.Errorf("migrate %s needs a version", name)
+	}
+
+	st, err := a.openStore()
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	var migrations fs.FS
+	if *dir != "" {
+		migrations = os.DirFS(*dir)
+	}
+	migrator, err := store.NewMigrator(st, migrations)
+	if err != nil {
+		return err
+	}
+
+	var versions []int
+	switch name {
+	case "up":
+		versions, err = migrator.Up(ctx, number)
+	case "down":
+		if number == 0 && !confirm("Revert ALL migrations?") {
+			return fmt.Errorf("aborted")
+		}
+		versions, err = migrator.Down(ctx, number)
+	case "goto":
+		err = migrator.Goto(ctx, number)
+	case "force":
+		err = migrator.Force(ctx, number)
+	}
+	for _, v := range versions {
+		fmt.Fprintf(os.Stderr, "%s %d\n", name, v)
+	}
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	result := map[string]interface{}{"version": version, "dirty": dirty}
+	return a.out.fields(result, [][2]string{
+		{"Version", strconv.Itoa(version)},
+		{"Dirty", strconv.FormatBool(dirty)},
+	})
+}
+
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	var answer string
+	fmt.Fscanln(os.Stdin, &answer)
+	return strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes")
+}
+
+func copyToPostgresCommand(ctx context.Context, a *app, args []string) error {
+	flags := flag.NewFlagSet("copy-to-postgres", flag.ContinueOnError)
+	positional, err := needArgs(flags, args, "postgres-url")
+	if err != nil {
+		return err
+	}
+	if a.db.Driver != store.DriverSQLite {
+		return fmt.Errorf("the source has to be a SQLite database, pass it with -db")
+	}
+
+	// Both sides are migrated to the latest version, so their schemas match
+	from, _, err := store.Open(ctx, a.db)
+	if err != nil {
+		return fmt.Errorf("failed to open SQLite: %w", err)
+	}
+	defer from.Close()
+	to, _, err := store.Open(ctx, store.Config{Driver: store.DriverPostgres, DSN: positional[0]})
+	if err != nil {
+		return fmt.Errorf("failed to open Postgres: %w", err)
+	}
+	defer to.Close()
+
+	copies, err := store.CopyToPostgres(ctx, from, to)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(copies))
+	for _, c := range copies {
+		rows = append(rows, []string{c.Table, strconv.FormatInt(c.Copied, 10), strconv.FormatInt(c.Skipped, 10)})
+	}
+	return a.out.table(copies, []string{"TABLE", "COPIED", "SKIPPED"}, rows)
+}
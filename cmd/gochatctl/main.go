@@ -0,0 +1,137 @@
+// Command gochatctl is the admin CLI. Most commands talk to the admin API of a running server,
+// usage, events, reindex, migrate and copy-to-postgres use the database directly.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gochat/internal/store"
+	"io"
+	"os"
+	"os/signal"
+)
+
+const usage = `Usage: gochatctl [flags] <command> [arguments]
+
+Commands (admin API):
+  accounts list|get|create|rename|delete
+  domains  list|add|remove
+  users    list|get|import|role|move|disable|enable|logout|delete
+
+Commands (database):
+  usage    messages and active users per account
+  events   query the event log
+  reindex  rebuild the embeddings of all files into a new collection and switch to it
+  migrate  up|down|goto|force|version
+  copy-to-postgres  copy a SQLite database into an empty Postgres database
+
+Run gochatctl <command> -h for the flags of a command.
+
+Flags:
+`
+
+// app holds the global flags every command can use
+type app struct {
+	url      string
+	adminKey string
+	db       store.Config
+	out      *printer
+	stdout   io.Writer
+}
+
+type command func(ctx context.Context, a *app, args []string) error
+
+var commands = map[string]command{
+	"accounts": accountsCommand,
+	"domains":  domainsCommand,
+	"users":    usersCommand,
+	"usage":    usageCommand,
+	"events":   eventsCommand,
+	"reindex":  reindexCommand,
+	"migrate":  migrateCommand,
+	// Moving from SQLite to Postgres is done once, hence the long name
+	"copy-to-postgres": copyToPostgresCommand,
+}
+
+func envOr(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if err := run(ctx, os.Stdout, os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("gochatctl", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	var (
+		url      = fs.String("url", envOr("GOCHAT_URL", "http://localhost:8080"), "Server to talk to, defaults to $GOCHAT_URL")
+		adminKey = fs.String("admin-key", os.Getenv("ADMIN_API_KEY"), "Admin API key, defaults to $ADMIN_API_KEY")
+		dbConfig = store.ConfigFromEnv()
+		driver   = fs.String("driver", string(dbConfig.Driver), "Database driver, sqlite or postgres, defaults to $DB_DRIVER")
+		dsn      = fs.String("db", dbConfig.DSN, "SQLite file or Postgres url for the database commands, defaults to $DB_PATH or $DATABASE_URL")
+		output   = fs.String("o", "table", "Output format: table or json")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no command given")
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("unknown command %q", fs.Arg(0))
+	}
+
+	a := &app{
+		url:      *url,
+		adminKey: *adminKey,
+		db:       store.Config{Driver: store.Driver(*driver), DSN: *dsn},
+		out:      &printer{w: w, json: *output == "json"},
+		stdout:   w,
+	}
+	return cmd(ctx, a, fs.Args()[1:])
+}
+
+// subcommand splits "list --flag x" into the subcommand name and its arguments
+func subcommand(args []string, names ...string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("missing subcommand, one of %v", names)
+	}
+	for _, name := range names {
+		if args[0] == name {
+			return name, args[1:], nil
+		}
+	}
+	return "", nil, fmt.Errorf("unknown subcommand %q, one of %v", args[0], names)
+}
+
+// needArgs parses the flags and checks the number of positional arguments
+func needArgs(fs *flag.FlagSet, args []string, names ...string) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != len(names) {
+		return nil, fmt.Errorf("%s expects %d arguments: %v", fs.Name(), len(names), names)
+	}
+	return fs.Args(), nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccountsList(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("X-Admin-Key"))
+		assert.Equal(t, "/patron/accounts", r.URL.Path)
+		assert.Equal(t, "acme", r.URL.Query().Get("search"))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"accounts": []map[string]string{{"ID": "A1", "Name": "Acme", "Createdat": "2025-01-01 00:00:00"}},
+			"page":     1,
+			"pageSize": 50,
+			"total":    1,
+		})
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	err := run(context.Background(), &out, []string{"-url", server.URL, "-admin-key", "secret", "accounts", "list", "-search", "acme"})
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "A1  Acme")
+	assert.Contains(t, out.String(), "1 total")
+
+	out.Reset()
+	err = run(context.Background(), &out, []string{"-url", server.URL, "-admin-key", "secret", "-o", "json", "accounts", "list", "-search", "acme"})
+	assert.NoError(t, err)
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.EqualValues(t, 1, decoded["total"])
+}
+
+func TestAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "account not found"})
+	}))
+	defer server.Close()
+
+	err := run(context.Background(), &bytes.Buffer{}, []string{"-url", server.URL, "-admin-key", "secret", "accounts", "rename", "nope", "New name"})
+	assert.ErrorContains(t, err, "account not found")
+
+	err = run(context.Background(), &bytes.Buffer{}, []string{"-url", server.URL, "-admin-key", "secret", "accounts", "delete", "A1"})
+	assert.ErrorContains(t, err, "-yes")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// printer writes results as an aligned table or as indented JSON
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+// table prints rows under the headers, value is what gets printed in JSON mode
+func (p *printer) table(value interface{}, headers []string, rows [][]string) error {
+	if p.json {
+		return p.printJSON(value)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// fields prints a single object as key value lines
+func (p *printer) fields(value interface{}, pairs [][2]string) error {
+	if p.json {
+		return p.printJSON(value)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	for _, pair := range pairs {
+		fmt.Fprintf(tw, "%s:\t%s\n", pair[0], pair[1])
+	}
+	return tw.Flush()
+}
+
+// message prints the server's confirmation
+func (p *printer) message(value interface{}, message string) error {
+	if p.json {
+		return p.printJSON(value)
+	}
+	_, err := fmt.Fprintln(p.w, message)
+	return err
+}
+
+func (p *printer) printJSON(value interface{}) error {
+	encoder := json.NewEncoder(p.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func pageFooter(page, pageSize int, total int64) string {
+	return fmt.Sprintf("page %d, %d per page, %d total", page, pageSize, total)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gochat/internal/services"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+func userRow(user services.UserDto) []string {
+	return []string{user.ID, user.Email, user.Name, user.Account.ID, string(user.Role), strconv.FormatBool(user.Disabled)}
+}
+
+var userHeaders = []string{"ID", "EMAIL", "NAME", "ACCOUNT", "ROLE", "DISABLED"}
+
+func usersCommand(ctx context.Context, a *app, args []string) error {
+	name, args, err := subcommand(args, "list", "get", "import", "role", "move", "disable", "enable", "logout", "delete")
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("users "+name, flag.ContinueOnError)
+
+	// Simple actions on one user that only return a message
+	userActions := map[string]string{
+		"disable": "disable",
+		"enable":  "enable",
+		"logout":  "sessions/revoke",
+		"delete":  "delete",
+	}
+
+	switch name {
+	case "list":
+		page := addPageFlags(fs)
+		account := fs.String("account", "", "Only show users of this account")
+		if _, err := needArgs(fs, args); err != nil {
+			return err
+		}
+		query := page.query()
+		if *account != "" {
+			query.Set("accountId", *account)
+		}
+		var resp struct {
+			Users []services.UserDto `json:"users"`
+			pageResponse
+		}
+		if err := a.admin(ctx, http.MethodGet, "users", query, nil, &resp); err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(resp.Users))
+		for _, user := range resp.Users {
+			rows = append(rows, userRow(user))
+		}
+		if err := a.out.table(resp, userHeaders, rows); err != nil {
+			return err
+		}
+		if !a.out.json {
+			fmt.Fprintln(a.stdout, pageFooter(resp.Page, resp.PageSize, resp.Total))
+		}
+		return nil
+
+	case "get":
+		positional, err := needArgs(fs, args, "user-id")
+		if err != nil {
+			return err
+		}
+		var resp struct {
+			User *services.UserDto `json:"user"`
+		}
+		if err := a.admin(ctx, http.MethodGet, "user/"+url.PathEscape(positional[0]), nil, nil, &resp); err != nil {
+			return err
+		}
+		if resp.User == nil {
+			return fmt.Errorf("user not found")
+		}
+		return a.out.table(resp, userHeaders, [][]string{userRow(*resp.User)})
+
+	case "import":
+		positional, err := needArgs(fs, args, "account-id", "file.csv")
+		if err != nil {
+			return err
+		}
+		body, err := newMultipartBody(map[string]string{"accountId": positional[0]}, positional[1])
+		if err != nil {
+			return err
+		}
+		var resp struct {
+			Result services.UserImportResult `json:"result"`
+		}
+		if err := a.admin(ctx, http.MethodPost, "user/import", nil, body, &resp); err != nil {
+			return err
+		}
+		if a.out.json {
+			return a.out.printJSON(resp)
+		}
+		fmt.Fprintf(a.stdout, "created %d, skipped %d existing, %d errors\n", resp.Result.Created, resp.Result.Skipped, len(resp.Result.Errors))
+		rows := make([][]string, 0, len(resp.Result.Errors))
+		for _, e := range resp.Result.Errors {
+			rows = append(rows, []string{strconv.Itoa(e.Line), e.Email, e.Error})
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return a.out.table(resp, []string{"LINE", "EMAIL", "ERROR"}, rows)
+
+	case "role":
+		positional, err := needArgs(fs, args, "user-id", "role")
+		if err != nil {
+			return err
+		}
+		var resp map[string]interface{}
+		path := "user/" + url.PathEscape(positional[0]) + "/role"
+		if err := a.admin(ctx, http.MethodPost, path, nil, map[string]string{"role": positional[1]}, &resp); err != nil {
+			return err
+		}
+		return a.out.message(resp, fmt.Sprint(resp["message"]))
+
+	case "move":
+		positional, err := needArgs(fs, args, "email", "account-id")
+		if err != nil {
+			return err
+		}
+		var resp map[string]interface{}
+		body := map[string]string{"userEmail": positional[0], "accountID": positional[1]}
+		if err := a.admin(ctx, http.MethodPost, "account/change-user-account", nil, body, &resp); err != nil {
+			return err
+		}
+		return a.out.message(resp, fmt.Sprint(resp["message"]))
+
+	default:
+		yes := fs.Bool("yes", false, "Confirm deleting the user")
+		positional, err := needArgs(fs, args, "user-id")
+		if err != nil {
+			return err
+		}
+		if name == "delete" && !*yes {
+			return fmt.Errorf("this deletes the user with all their data, pass -yes to confirm")
+		}
+		var resp map[string]interface{}
+		path := "user/" + url.PathEscape(positional[0]) + "/" + userActions[name]
+		if err := a.admin(ctx, http.MethodPost, path, nil, nil, &resp); err != nil {
+			return err
+		}
+		return a.out.message(resp, fmt.Sprint(resp["message"]))
+	}
+}
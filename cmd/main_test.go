@@ -1,129 +1,541 @@
 package main_test
 
 import (
+	"bufio"
 	"bytes"
 	"context"
-	_ "embed"
 	"encoding/json"
 	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
 	"github.com/stretchr/testify/assert"
+	"gochat/internal/ai/aitest"
+	"gochat/internal/auth"
+	"gochat/internal/run"
+	"gochat/internal/schema"
+	"gochat/internal/services"
+	"gochat/internal/store"
+	"image"
+	"image/png"
 	"io"
-	"log"
+	"mime/multipart"
+	"net"
 	"net/http"
-	"os"
-	"rboai/internal/apiSchema"
-	"rboai/internal/models"
-	"rboai/internal/run"
-
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
 
-////go:embed ../schema/apiSchema.sql
-//var ddl string
-
-type Response struct {
-	Message  string               `json:"message"`
-	Analyses []apiSchema.Analysis `json:"analyses"` // Assuming Analysis is a defined type
+// testServer is the whole application on a free port, with SQLite in a temp dir and the fake models
+type testServer struct {
+	url    string
+	store  store.Store
+	llm    *aitest.Server
+	client *http.Client
 }
 
-func TestPingRoute(t *testing.T) {
+func startServer(t *testing.T) *testServer {
+	dir := t.TempDir()
+	llm := aitest.NewServer()
+	t.Cleanup(llm.Close)
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_PATH", filepath.Join(dir, "database.db"))
+	t.Setenv("BLOB_DRIVER", "fs")
+	t.Setenv("BLOB_PATH", filepath.Join(dir, "files"))
+	t.Setenv("LLM_BASE_URL", llm.BaseURL())
+	// Without Milvus documents are never found, the router answers without them
+	t.Setenv("MILVUS_PW", "")
+	t.Setenv("RAG_PARAPHRASES", "0")
+	t.Setenv("RAG_HYDE", "false")
+	t.Setenv("SENTRY_DSN", "")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
 	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	t.Cleanup(cancel)
+	done := make(chan error, 1)
+	go func() {
+		done <- run.Run(ctx, io.Discard, []string{"gochat", "--port", fmt.Sprint(port)})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
 
-	port := "8080"
-	args := []string{
-		"--port", port,
+	s := &testServer{
+		url: fmt.Sprintf("http://127.0.0.1:%d", port),
+		llm: llm,
+		client: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+	}
+	// The server migrates before it listens
+	for start := time.Now(); ; time.Sleep(20 * time.Millisecond) {
+		response, err := http.Get(s.url + "/health")
+		if err == nil {
+			response.Body.Close()
+			assert.Equal(t, http.StatusOK, response.StatusCode)
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("server did not start: %s", err)
+		}
 	}
 
-	now := time.Now()
+	s.store, err = store.Connect(store.ConfigFromEnv())
+	assert.NoError(t, err)
+	t.Cleanup(func() { s.store.Close() })
+	return s
+}
 
-	err := os.Setenv("dataSourceName", fmt.Sprintf("test-%s.db", now))
-	//_, db, err := database.Init()
-	if err != nil {
-		fmt.Errorf("failed to initialize database: %w", err)
-	}
+// login creates a user in a new account and returns the cookie of a session
+func (s *testServer) login(t *testing.T, accountName string) (*schema.User, *http.Cookie) {
+	ctx := context.Background()
+	account, err := services.NewAccountService(s.store).Create(ctx, schema.CreateAccountParams{ID: uuid.New().String(), Name: accountName})
+	assert.NoError(t, err)
+	name := "Anna"
+	user, err := services.NewUserService(s.store).Create(ctx, services.UserParams{
+		Name:      &name,
+		Email:     "anna@" + strings.ReplaceAll(account.ID, "-", "") + ".com",
+		AccountID: &account.ID,
+	})
+	assert.NoError(t, err)
+	session, _, err := services.NewSessionService(s.store).Create(ctx, user.ID, services.SessionParams{})
+	assert.NoError(t, err)
+	token, err := auth.CreateToken(user.ID, session.ID)
+	assert.NoError(t, err)
+	return user, &http.Cookie{Name: "token", Value: token}
+}
 
-	// create tables
-	//if _, err := db.ExecContext(ctx, ddl); err != nil {
-	//	fmt.Errorf("failed creating tables: %w", err)
-	//}
+type sseEvent struct {
+	Type string
+	Data string
+}
 
-	url := fmt.Sprintf("http://localhost:%s", port)
+// subscribe opens the event stream of a thread and returns once the server registered it
+func (s *testServer) subscribe(t *testing.T, cookie *http.Cookie, threadID string) <-chan sseEvent {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url+"/chat-stream?thread_id="+threadID, nil)
+	assert.NoError(t, err)
+	request.AddCookie(cookie)
+	response, err := s.client.Do(request)
+	assert.NoError(t, err)
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
 
-	// Run server in new go routine
+	events := make(chan sseEvent, 100)
 	go func() {
-		defer cancel()
-		err := run.Run(ctx, os.Stdout, args)
-		if err != nil {
-			t.Errorf("Failed to run server: %v", err)
+		defer response.Body.Close()
+		defer close(events)
+		scanner := bufio.NewScanner(response.Body)
+		event := sseEvent{Type: "message"}
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event.Type = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.Data = strings.TrimPrefix(line, "data: ")
+			case line == "":
+				events <- event
+				event = sseEvent{Type: "message"}
+			}
 		}
 	}()
+	// The connected event
+	<-events
+	return events
+}
 
-	// Make the request
-	respHealth, err := http.Get(url + "/health")
-
-	var params [2]models.CreateAnalysisParams
+// send posts the messages of a thread the way the frontend does, with an empty answer last
+type attachment struct {
+	name     string
+	mimeType string
+	data     []byte
+}
 
-	params[0] = models.CreateAnalysisParams{
-		Source: "gesprek",
-		Status: "Positief",
+func (s *testServer) send(t *testing.T, cookie *http.Cookie, threadID string, text string, filter map[string]interface{}, attachments ...attachment) *http.Response {
+	var infos []map[string]string
+	for i, a := range attachments {
+		infos = append(infos, map[string]string{"id": strconv.Itoa(i), "type": a.mimeType, "name": a.name})
 	}
-	params[1] = models.CreateAnalysisParams{
-		Source: "email",
-		Status: "Negatief",
+	data, err := json.Marshal(map[string]interface{}{
+		"threadId": threadID,
+		"messages": []map[string]interface{}{
+			{"id": "1", "role": "user", "content": text, "modelParams": map[string]float32{"temperature": 0.2, "top_p": 0.9}, "attachments": infos},
+			{"id": "2", "role": "assistant", "content": ""},
+		},
+		"filter": filter,
+	})
+	assert.NoError(t, err)
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	assert.NoError(t, form.WriteField("messagesData", string(data)))
+	for i, a := range attachments {
+		part, err := form.CreateFormFile(fmt.Sprintf("attachment_1_%d", i), a.name)
+		assert.NoError(t, err)
+		_, err = part.Write(a.data)
+		assert.NoError(t, err)
 	}
+	assert.NoError(t, form.Close())
 
-	// Marshal the data to JSON
-	jsonCreateData, err := json.Marshal(params)
-	jsonSearchData, err := json.Marshal([]string{"ABC"})
+	request, err := http.NewRequest(http.MethodPost, s.url+"/chat-stream", &body)
+	assert.NoError(t, err)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	if cookie != nil {
+		request.AddCookie(cookie)
+	}
+	response, err := s.client.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	return response
+}
 
-	if err != nil {
-		log.Fatalf("Error marshaling JSON: %v", err)
+// answer collects the streamed answer, other events are returned by type
+func answer(t *testing.T, events <-chan sseEvent) (string, map[string][]string) {
+	var content strings.Builder
+	other := map[string][]string{}
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatal("event stream closed")
+			}
+			if event.Type != "message" {
+				other[event.Type] = append(other[event.Type], event.Data)
+				continue
+			}
+			var message struct {
+				Content string `json:"content"`
+				IsDone  bool   `json:"isDone"`
+			}
+			assert.NoError(t, json.Unmarshal([]byte(event.Data), &message))
+			if message.IsDone {
+				return content.String(), other
+			}
+			content.WriteString(message.Content)
+		case <-timeout:
+			t.Fatal("no answer streamed")
+		}
 	}
-	respCreate, err := http.Post(url+"/analyses", "application/json", bytes.NewBuffer(jsonCreateData))
-	respSearch, err := http.Post(url+"/analyses/search", "application/json", bytes.NewBuffer(jsonSearchData))
-	respList, err := http.Get(url + "/analyses")
+}
+
+func TestMessageStream(t *testing.T) {
+	s := startServer(t)
+	_, cookie := s.login(t, "Gemeente Groningen")
+	threadID := uuid.New().String()
+	events := s.subscribe(t, cookie, threadID)
 
-	if err != nil {
-		t.Fatalf("Failed to make request: %v", err)
+	s.llm.Script(aitest.Reply{Content: "Hallo, ik ben AĿbert. Hoe kan ik je helpen?", Delay: time.Millisecond})
+	response := s.send(t, cookie, threadID, "Wie ben je?", nil)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	content, _ := answer(t, events)
+	assert.Equal(t, "Hallo, ik ben AĿbert. Hoe kan ik je helpen?", content)
+
+	// The persona of the account goes with the question
+	requests := s.llm.Requests()
+	assert.Len(t, requests, 1)
+	assert.True(t, requests[0].Stream)
+	assert.InDelta(t, 0.2, requests[0].Temperature, 0.001)
+	assert.Contains(t, aitest.Text(requests[0].Messages[0]), "Gemeente Groningen")
+	assert.Contains(t, aitest.Text(requests[0].Messages[0]), "Wie ben je?")
+}
+
+func TestMessageStreamRetrieval(t *testing.T) {
+	s := startServer(t)
+	user, cookie := s.login(t, "Gemeente Groningen")
+	threadID := uuid.New().String()
+	events := s.subscribe(t, cookie, threadID)
+
+	// A filter asks for documents, none are found so the question is answered without them
+	s.llm.Script(aitest.Reply{Content: "Daar heb ik geen documenten over."})
+	response := s.send(t, cookie, threadID, "Wat staat er in het jaarverslag?", map[string]interface{}{"tags": []string{"jaarverslag"}})
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	content, other := answer(t, events)
+	assert.Equal(t, "Daar heb ik geen documenten over.", content)
+	assert.Len(t, other["retrieval"], 1)
+	assert.JSONEq(t, `{"useRag":false,"reason":"no documents found","topScore":0,"results":0,"classifier":false}`, other["retrieval"][0])
+
+	logged, err := services.NewReportService(s.store).Events(context.Background(), services.EventFilter{UserID: user.ID, Event: services.EventRetrieval})
+	assert.NoError(t, err)
+	assert.Len(t, logged, 1)
+	assert.Contains(t, string(logged[0].Metadata), threadID)
+}
+
+func TestMessageStreamAccess(t *testing.T) {
+	s := startServer(t)
+	_, anna := s.login(t, "Gemeente Groningen")
+	_, bert := s.login(t, "Gemeente Assen")
+	threadID := uuid.New().String()
+
+	response := s.send(t, nil, threadID, "Wie ben je?", nil)
+	assert.Equal(t, http.StatusFound, response.StatusCode)
+	assert.Equal(t, "/login", response.Header.Get("Location"))
+
+	// The first user to send in a thread owns it
+	s.llm.Script(aitest.Reply{Content: "Hallo"})
+	assert.Equal(t, http.StatusAccepted, s.send(t, anna, threadID, "Wie ben je?", nil).StatusCode)
+	assert.Equal(t, http.StatusNotFound, s.send(t, bert, threadID, "Wie ben je?", nil).StatusCode)
+}
+
+func TestChatStreamAccess(t *testing.T) {
+	s := startServer(t)
+	_, anna := s.login(t, "Gemeente Groningen")
+	_, bert := s.login(t, "Gemeente Assen")
+	threadID := uuid.New().String()
+	events := s.subscribe(t, anna, threadID)
+
+	// Only the owner of a thread can follow its answers
+	request, err := http.NewRequest(http.MethodGet, s.url+"/chat-stream?thread_id="+threadID, nil)
+	assert.NoError(t, err)
+	request.AddCookie(bert)
+	response, err := s.client.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	s.llm.Script(aitest.Reply{Content: "Hallo"})
+	assert.Equal(t, http.StatusAccepted, s.send(t, anna, threadID, "Wie ben je?", nil).StatusCode)
+	content, _ := answer(t, events)
+	assert.Equal(t, "Hallo", content)
+}
+
+// upload stores a file of the user the way an upload does, without embedding it
+func (s *testServer) upload(t *testing.T, userID string, conversation string, name string, text string) *schema.File {
+	blobs, err := store.OpenBlobStore(context.Background(), store.BlobConfigFromEnv())
+	assert.NoError(t, err)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("user", userID)
+	files, err := services.NewFileService(s.store, blobs, c)
+	assert.NoError(t, err)
+	file, err := files.Create(context.Background(), services.FileUpload{Name: name, Conversation: conversation, Size: -1}, strings.NewReader(text))
+	assert.NoError(t, err)
+	return file
+}
+
+func (s *testServer) summarize(t *testing.T, cookie *http.Cookie, conversation string, fileID string) int {
+	form := url.Values{"conversationId": {conversation}, "fileId": {fileID}}
+	request, err := http.NewRequest(http.MethodPost, s.url+"/conversation/summarize", strings.NewReader(form.Encode()))
+	assert.NoError(t, err)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.AddCookie(cookie)
+	response, err := s.client.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	return response.StatusCode
+}
+
+func TestSummarize(t *testing.T) {
+	s := startServer(t)
+	user, cookie := s.login(t, "Gemeente Groningen")
+	_, other := s.login(t, "Gemeente Assen")
+	threadID := uuid.New().String()
+	events := s.subscribe(t, cookie, threadID)
+	// Claim the thread
+	s.llm.Script(aitest.Reply{Content: "Hallo"})
+	assert.Equal(t, http.StatusAccepted, s.send(t, cookie, threadID, "Hallo", nil).StatusCode)
+	answer(t, events)
+
+	report := s.upload(t, user.ID, threadID, "jaarverslag.txt", "Het jaarverslag van 2024.\n\nDe gemeente bouwde 300 woningen.")
+	s.llm.Script(aitest.Reply{Content: "Er zijn 300 woningen gebouwd."})
+	assert.Equal(t, http.StatusAccepted, s.summarize(t, cookie, threadID, report.ID))
+	content, _ := answer(t, events)
+	assert.Equal(t, "Er zijn 300 woningen gebouwd.", content)
+	assert.Contains(t, aitest.Text(s.llm.Requests()[1].Messages[0]), "300 woningen")
+
+	// The summary of the file is cached
+	assert.Equal(t, http.StatusAccepted, s.summarize(t, cookie, threadID, report.ID))
+	content, _ = answer(t, events)
+	assert.Equal(t, "Er zijn 300 woningen gebouwd.", content)
+	assert.Len(t, s.llm.Requests(), 2)
+
+	// A conversation is summarized from the summaries of its files
+	s.upload(t, user.ID, threadID, "begroting.txt", "De begroting van 2025 is sluitend.")
+	s.llm.Script(aitest.Reply{Content: "De begroting is sluitend."}, aitest.Reply{Content: "Woningen gebouwd, begroting sluitend."})
+	assert.Equal(t, http.StatusAccepted, s.summarize(t, cookie, threadID, ""))
+	content, progress := answer(t, events)
+	assert.Equal(t, "Woningen gebouwd, begroting sluitend.", content)
+	assert.Equal(t, []string{`{"stage":"files","done":1,"total":2}`, `{"stage":"files","done":2,"total":2}`}, progress["progress"])
+	requests := s.llm.Requests()
+	assert.Len(t, requests, 4)
+	assert.Contains(t, aitest.Text(requests[3].Messages[0]), "## jaarverslag.txt\nEr zijn 300 woningen gebouwd.")
+
+	assert.Equal(t, http.StatusNotFound, s.summarize(t, other, threadID, ""))
+	assert.Equal(t, http.StatusNotFound, s.summarize(t, cookie, threadID, "does-not-exist"))
+	// Files of the user's other conversations are not summarized into this one
+	elsewhere := s.upload(t, user.ID, uuid.New().String(), "notulen.txt", "De raad vergaderde.")
+	assert.Equal(t, http.StatusNotFound, s.summarize(t, cookie, threadID, elsewhere.ID))
+}
+
+func TestExtraction(t *testing.T) {
+	s := startServer(t)
+	user, cookie := s.login(t, "Gemeente Groningen")
+	report := s.upload(t, user.ID, "", "peiling.txt", "Voor de peiling van oktober 2024 zijn 352 ouders gevraagd. 45% drinkt minder.")
+	request := func(method string, path string, body string) (int, string) {
+		r, err := http.NewRequest(method, s.url+path, strings.NewReader(body))
+		assert.NoError(t, err)
+		r.Header.Set("Content-Type", "application/json")
+		r.AddCookie(cookie)
+		response, err := s.client.Do(r)
+		assert.NoError(t, err)
+		defer response.Body.Close()
+		data, err := io.ReadAll(response.Body)
+		assert.NoError(t, err)
+		return response.StatusCode, string(data)
 	}
 
-	// Check the response
-	assert.Equal(t, 200, respHealth.StatusCode)
-	assert.Equal(t, 200, respCreate.StatusCode)
-	assert.Equal(t, 200, respList.StatusCode)
-
-	// Read the response body
-	createBody, err := io.ReadAll(respCreate.Body)
-	listBody, err := io.ReadAll(respList.Body)
-	searchBody, err := io.ReadAll(respSearch.Body)
-	if err != nil {
-		t.Fatalf("Error reading response body: %v", err)
+	s.llm.Script(aitest.Reply{Content: `{"respondents": 352, "share": "45%"}`})
+	status, body := request(http.MethodPost, "/extractions/create", fmt.Sprintf(`{
+		"name": "Peilingen",
+		"fields": [{"name": "respondents", "type": "integer", "required": true}, {"name": "share", "type": "number"}],
+		"fileIds": [%q]
+	}`, report.ID))
+	assert.Equal(t, http.StatusAccepted, status, body)
+	var created struct {
+		Extraction services.ExtractionDto `json:"extraction"`
 	}
+	assert.NoError(t, json.Unmarshal([]byte(body), &created))
 
-	// Attempt to parse the JSON
-	type Response struct {
-		Message  string               `json:"message"`
-		Analyses []apiSchema.Analysis `json:"analyses"`
+	// The files are read in the background
+	for start := time.Now(); ; time.Sleep(20 * time.Millisecond) {
+		_, body = request(http.MethodGet, "/extractions/"+created.Extraction.ID, "")
+		if !strings.Contains(body, services.ExtractionPending) {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("extraction did not finish")
+		}
 	}
-	var createResponse Response
-	var listResponse Response
-	var searchResponse Response
-	err = json.Unmarshal(createBody, &createResponse)
-	err = json.Unmarshal(searchBody, &searchResponse)
-	err = json.Unmarshal(listBody, &listResponse)
-	if err != nil {
-		t.Fatalf("Error parsing JSON: %v", err)
+	status, body = request(http.MethodGet, "/extractions/"+created.Extraction.ID+"/download", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "file,status,error,respondents,share\npeiling.txt,done,,352,45\n", body)
+	assert.Equal(t, "extraction", s.llm.Requests()[0].ResponseFormat.JSONSchema.Name)
+
+	status, _ = request(http.MethodPost, "/extractions/create", `{"name": "Peilingen", "fields": [{"name": "respondents", "type": "integer"}], "fileIds": ["does-not-exist"]}`)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestMessageStreamTools(t *testing.T) {
+	s := startServer(t)
+	t.Setenv("LLM_TOOLS", "true")
+	_, cookie := s.login(t, "Gemeente Groningen")
+	threadID := uuid.New().String()
+	events := s.subscribe(t, cookie, threadID)
+
+	// The model calculates before it answers
+	s.llm.Script(
+		aitest.Reply{Content: "Even rekenen. ", ToolCalls: []openai.ToolCall{{
+			ID:       "call_1",
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: "calculator", Arguments: `{"expression": "(352 - 120) / 352 * 100"}`},
+		}}},
+		aitest.Reply{Content: "Dat is 65,9%."},
+	)
+	response := s.send(t, cookie, threadID, "Hoeveel procent is 232 van 352?", nil)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	content, other := answer(t, events)
+	assert.Equal(t, "Even rekenen. Dat is 65,9%.", content)
+	assert.Equal(t, []string{`{"id":"call_1","name":"calculator","arguments":"{\"expression\": \"(352 - 120) / 352 * 100\"}"}`}, other["tool_call"])
+	assert.Equal(t, []string{`{"id":"call_1","name":"calculator","result":"65.9090909091"}`}, other["tool_result"])
+
+	requests := s.llm.Requests()
+	assert.Len(t, requests, 2)
+	var names []string
+	for _, tool := range requests[0].Tools {
+		names = append(names, tool.Function.Name)
 	}
+	assert.Equal(t, []string{"search_documents", "calculator", "current_date"}, names)
+	followUp := requests[1].Messages
+	assert.Equal(t, openai.ChatMessageRoleAssistant, followUp[len(followUp)-2].Role)
+	assert.Equal(t, "call_1", followUp[len(followUp)-2].ToolCalls[0].ID)
+	assert.Equal(t, openai.ChatMessageRoleTool, followUp[len(followUp)-1].Role)
+	assert.Equal(t, "65.9090909091", followUp[len(followUp)-1].Content)
+}
+
+func TestMessageStreamTables(t *testing.T) {
+	s := startServer(t)
+	t.Setenv("LLM_TOOLS", "true")
+	user, cookie := s.login(t, "Gemeente Groningen")
+	threadID := uuid.New().String()
+	events := s.subscribe(t, cookie, threadID)
+	s.upload(t, user.ID, threadID, "enquete.csv", "gemeente;respondenten\nUtrecht;352\nZeist;120\n")
+
+	// The query the model ran is streamed as a step, with the table it returned
+	query := "SELECT sum(respondenten) AS totaal FROM enquete"
+	s.llm.Script(
+		aitest.Reply{ToolCalls: []openai.ToolCall{{
+			ID:       "call_1",
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: "query_tables", Arguments: `{"query": "` + query + `"}`},
+		}}},
+		aitest.Reply{Content: "Er deden 472 mensen mee."},
+	)
+	response := s.send(t, cookie, threadID, "Hoeveel mensen deden mee?", nil)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	content, other := answer(t, events)
+	assert.Equal(t, "Er deden 472 mensen mee.", content)
+	assert.Equal(t, []string{`{"id":"call_1","name":"query_tables","arguments":"{\"query\": \"` + query + `\"}"}`}, other["tool_call"])
+	assert.Equal(t, []string{`{"id":"call_1","name":"query_tables","result":"| totaal |\n| --- |\n| 472 |\n\n1 row."}`}, other["tool_result"])
+
+	requests := s.llm.Requests()
+	tool := requests[len(requests)-2].Tools[3].Function
+	assert.Equal(t, "query_tables", tool.Name)
+	assert.Contains(t, tool.Description, "enquete(gemeente TEXT, respondenten INTEGER) -- 2 rows from enquete.csv")
+}
+
+func TestMessageStreamTablesWithoutTools(t *testing.T) {
+	s := startServer(t)
+	user, cookie := s.login(t, "Gemeente Groningen")
+	threadID := uuid.New().String()
+	events := s.subscribe(t, cookie, threadID)
+
+	// Without LLM_TOOLS only the spreadsheets can be queried
+	s.llm.Script(aitest.Reply{Content: "Welke vraag heb je over de enquête?"})
+	assert.Equal(t, http.StatusAccepted, s.send(t, cookie, threadID, "Hallo", nil).StatusCode)
+	answer(t, events)
+	assert.Empty(t, s.llm.Requests()[0].Tools)
+
+	s.upload(t, user.ID, threadID, "enquete.csv", "gemeente;respondenten\nUtrecht;352\nZeist;120\n")
+	s.llm.Script(aitest.Reply{Content: "Er deden 472 mensen mee."})
+	assert.Equal(t, http.StatusAccepted, s.send(t, cookie, threadID, "Hoeveel mensen deden mee?", nil).StatusCode)
+	content, _ := answer(t, events)
+	assert.Equal(t, "Er deden 472 mensen mee.", content)
+	tools := s.llm.Requests()[1].Tools
+	assert.Len(t, tools, 1)
+	assert.Equal(t, "query_tables", tools[0].Function.Name)
+}
+
+func TestMessageStreamImages(t *testing.T) {
+	s := startServer(t)
+	_, cookie := s.login(t, "Gemeente Groningen")
+	threadID := uuid.New().String()
+	events := s.subscribe(t, cookie, threadID)
+
+	// The type sent to the model is the one of the content, not what the browser said
+	var screenshot bytes.Buffer
+	assert.NoError(t, png.Encode(&screenshot, image.NewNRGBA(image.Rect(0, 0, 2400, 1200))))
+	s.llm.Script(aitest.Reply{Content: "Een leeg scherm."})
+	response := s.send(t, cookie, threadID, "Wat zie je?", nil, attachment{"scherm.jpg", "image/jpeg", screenshot.Bytes()})
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	content, _ := answer(t, events)
+	assert.Equal(t, "Een leeg scherm.", content)
 
-	// Assertions
-	assert.Equal(t, "success", createResponse.Message)
-	assert.Equal(t, 2, len(createResponse.Analyses))
-	assert.Equal(t, "success", listResponse.Message)
-	assert.Equal(t, 2, len(listResponse.Analyses))
-	assert.Equal(t, 1, len(searchResponse.Analyses))
+	requests := s.llm.Requests()
+	parts := requests[len(requests)-1].Messages[0].MultiContent
+	assert.Len(t, parts, 2)
+	assert.Equal(t, openai.ChatMessagePartTypeImageURL, parts[1].Type)
+	assert.True(t, strings.HasPrefix(parts[1].ImageURL.URL, "data:image/png;base64,"))
 
-	cancel()
+	// Formats the model can't read are refused before anything is sent
+	response = s.send(t, cookie, threadID, "Wat zie je?", nil, attachment{"scan.tiff", "image/tiff", []byte("II*\x00kapot")})
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	assert.Len(t, s.llm.Requests(), len(requests))
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"gochat/internal/ai/aitest"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	judgeDocuments = "# DOCUMENTS #"
+	judgeQuestion  = "# QUESTION #"
+	judgeAnswer    = "# ANSWER #"
+)
+
+var judgeScore = regexp.MustCompile(`(?i)SCORE:\s*([0-9]*\.?[0-9]+)`)
+
+// judgePrompt asks how much of the answer the documents support
+func judgePrompt(documents string, question string, answer string) string {
+	return fmt.Sprintf(`You grade the faithfulness of answers of a research assistant. An answer is faithful when every claim in it is supported by the documents it was given, whether or not it is complete.
+
+OUTPUT FORMAT: "SCORE: " and the share of the claims in the answer that the documents support, a number from 0 to 1, on the first line. Then one line starting with "REASON:".
+
+%s
+%s
+
+%s
+%s
+
+%s
+%s
+`, judgeDocuments, documents, judgeQuestion, question, judgeAnswer, answer)
+}
+
+// parseJudgement reads the score of a judge response
+func parseJudgement(response string) (float64, error) {
+	match := judgeScore.FindStringSubmatch(response)
+	if match == nil {
+		return 0, fmt.Errorf("judge gave no score: %q", response)
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	return min(max(value, 0), 1), nil
+}
+
+// fakeModel stands in for the chat model with -fake. It answers with the first retrieved passage
+// and judges an answer faithful when the documents contain it word for word, other prompts get
+// no answer, so the planner keeps the question as asked.
+func fakeModel(request openai.ChatCompletionRequest) string {
+	if len(request.Messages) == 0 {
+		return ""
+	}
+	last := aitest.Text(request.Messages[len(request.Messages)-1])
+	if strings.Contains(last, judgeAnswer) {
+		_, rest, _ := strings.Cut(last, judgeDocuments)
+		documents, rest, _ := strings.Cut(rest, judgeQuestion)
+		_, answer, _ := strings.Cut(rest, judgeAnswer)
+		if normalize(answer) != "" && strings.Contains(normalize(documents), normalize(answer)) {
+			return "SCORE: 1\nREASON: the documents contain the answer"
+		}
+		return "SCORE: 0\nREASON: the documents don't contain the answer"
+	}
+
+	for _, message := range request.Messages {
+		if message.Role == openai.ChatMessageRoleSystem {
+			return firstPassage(aitest.Text(message))
+		}
+	}
+	return ""
+}
+
+// firstPassage takes the text of the first result out of the formatted search results
+func firstPassage(documents string) string {
+	_, passages, found := strings.Cut(documents, "---\n")
+	if !found {
+		return ""
+	}
+	var lines []string
+	for _, line := range strings.Split(passages, "\n") {
+		if strings.HasPrefix(line, "Relevance Score:") {
+			break
+		}
+		if !strings.HasPrefix(line, "Source:") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
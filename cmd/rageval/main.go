@@ -0,0 +1,205 @@
+// Command rageval measures retrieval and answers against a set of golden questions. It ingests the
+// corpus of a YAML set, asks its questions and reports recall@k, MRR and the faithfulness of the
+// answers as graded by a judge model. With -fake it runs offline against a fake model, for CI.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"gochat/internal/ai"
+	"gochat/internal/ai/aitest"
+	"gochat/internal/rag"
+	"io"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+)
+
+const usage = `Usage: rageval [flags] <set.yaml>
+
+Ingests the corpus of the set, searches every question and reports recall@k, MRR and the
+faithfulness of the answers. The -min flags make it fail below a score, for CI.
+
+Flags:
+`
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if err := run(ctx, os.Stdout, os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// options are the flags of a run
+type options struct {
+	backend        string
+	k              int
+	embeddingModel string
+	model          string
+	judgeModel     string
+	faithfulness   bool
+	planner        rag.PlannerConfig
+	minRecall      float64
+	minMRR         float64
+	minFaithful    float64
+}
+
+func run(ctx context.Context, w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("rageval", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	index, err := rag.ConfiguredIndex()
+	if err != nil {
+		return err
+	}
+	var opts options
+	fs.StringVar(&opts.backend, "backend", "memory", "memory compares every chunk, milvus uses a partition of the active collection")
+	fs.IntVar(&opts.k, "k", 5, "number of chunks retrieved per question")
+	fs.StringVar(&opts.embeddingModel, "embedding-model", index.Model, "embedding model of the memory backend")
+	fs.StringVar(&opts.model, "model", ai.ChatModel, "model that answers")
+	fs.StringVar(&opts.judgeModel, "judge-model", ai.ChatModel, "model that grades the answers")
+	fs.BoolVar(&opts.faithfulness, "faithfulness", true, "answer the questions and grade the answers")
+	fs.IntVar(&opts.planner.Paraphrases, "paraphrases", 0, "paraphrases searched per question")
+	fs.BoolVar(&opts.planner.HyDE, "hyde", false, "also search a hypothetical answer")
+	fs.Float64Var(&opts.minRecall, "min-recall", 0, "fail when recall@k is lower")
+	fs.Float64Var(&opts.minMRR, "min-mrr", 0, "fail when the MRR is lower")
+	fs.Float64Var(&opts.minFaithful, "min-faithfulness", 0, "fail when the faithfulness is lower")
+	fake := fs.Bool("fake", false, "run against a fake model with hashed word embeddings, no Ollama needed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one set")
+	}
+
+	set, err := loadSet(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *fake {
+		server := aitest.NewServer()
+		server.Complete = fakeModel
+		defer server.Close()
+		previous, had := os.LookupEnv("LLM_BASE_URL")
+		os.Setenv("LLM_BASE_URL", server.BaseURL())
+		defer func() {
+			if had {
+				os.Setenv("LLM_BASE_URL", previous)
+			} else {
+				os.Unsetenv("LLM_BASE_URL")
+			}
+		}()
+	}
+
+	var s searcher
+	switch opts.backend {
+	case "memory":
+		s = &memorySearcher{model: opts.embeddingModel}
+	case "milvus":
+		if s, err = newMilvusSearcher(ctx); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown backend %q", opts.backend)
+	}
+	defer func() {
+		if err := s.close(context.Background()); err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to clean up: %s\n", err)
+		}
+	}()
+	if err := readCorpus(ctx, s, set.Corpus); err != nil {
+		return err
+	}
+	return evaluate(ctx, w, s, set, opts)
+}
+
+func evaluate(ctx context.Context, w io.Writer, s searcher, set *evalSet, opts options) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "QUESTION\tRANK\tRECALL@%d\tFAITHFULNESS\n", opts.k)
+
+	var recall, mrr, faithfulness float64
+	judged := 0
+	for _, q := range set.Questions {
+		messages := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: q.Question}}
+		plan := rag.PlanRetrieval(messages, opts.planner, ai.SingleQuery)
+		results, err := s.search(ctx, plan, opts.k)
+		if err != nil {
+			return fmt.Errorf("failed to search %q: %w", q.Question, err)
+		}
+		sc := scoreResults(q, results)
+		recall += sc.Recall
+		mrr += sc.reciprocalRank()
+
+		faithful := "-"
+		if opts.faithfulness {
+			value, err := judge(plan, results, opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: failed to judge %q: %s\n", q.Question, err)
+			} else {
+				faithfulness += value
+				judged++
+				faithful = fmt.Sprintf("%.2f", value)
+			}
+		}
+		rank := "-"
+		if sc.Rank > 0 {
+			rank = fmt.Sprint(sc.Rank)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.2f\t%s\n", shorten(q.Question, 60), rank, sc.Recall, faithful)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	count := float64(len(set.Questions))
+	recall, mrr = recall/count, mrr/count
+	fmt.Fprintf(w, "\n%d questions  recall@%d %.2f  MRR %.2f", len(set.Questions), opts.k, recall, mrr)
+	if judged > 0 {
+		faithfulness /= float64(judged)
+		fmt.Fprintf(w, "  faithfulness %.2f", faithfulness)
+	}
+	fmt.Fprintln(w)
+
+	switch {
+	case recall < opts.minRecall:
+		return fmt.Errorf("recall@%d %.2f is below %.2f", opts.k, recall, opts.minRecall)
+	case mrr < opts.minMRR:
+		return fmt.Errorf("MRR %.2f is below %.2f", mrr, opts.minMRR)
+	case opts.faithfulness && judged > 0 && faithfulness < opts.minFaithful:
+		return fmt.Errorf("faithfulness %.2f is below %.2f", faithfulness, opts.minFaithful)
+	}
+	return nil
+}
+
+// judge answers the question the way the chat does and has the judge model grade the answer
+func judge(plan rag.RetrievalPlan, results []rag.SearchResult, opts options) (float64, error) {
+	documents := rag.FormatSearchResultsToMarkdown(results)
+	question := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: plan.Question}}
+	answer, err := ai.GetCompletionWithModel(opts.model, rag.AssembleRagMessages(question, documents, plan.Query))
+	if err != nil {
+		return 0, fmt.Errorf("failed to answer: %w", err)
+	}
+	response, err := ai.GetCompletionWithModel(opts.judgeModel, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: judgePrompt(documents, plan.Question, answer)},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return parseJudgement(response)
+}
+
+func shorten(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gochat/internal/rag"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCampaignSet(t *testing.T) {
+	set, err := loadSet("../../eval/campaign.yaml")
+	assert.NoError(t, err)
+	text, err := os.ReadFile(set.Corpus[0])
+	assert.NoError(t, err)
+
+	// A passage split over two chunks can never be found
+	var results []rag.SearchResult
+	for _, chunk := range rag.SplitChunks(string(text)) {
+		results = append(results, rag.SearchResult{Text: chunk.Text})
+	}
+	for _, q := range set.Questions {
+		assert.Equal(t, 1.0, scoreResults(q, results).Recall, q.Question)
+	}
+}
+
+func TestScoreResults(t *testing.T) {
+	q := question{Question: "q", Expected: []string{"ruim 350 ouders", "oktober 2024"}}
+	results := []rag.SearchResult{{Text: "Echter"}, {Text: "zijn RUIM 350\nouders gevraagd"}, {Text: "ruim 350 ouders"}}
+
+	s := scoreResults(q, results)
+	assert.Equal(t, score{Rank: 2, Recall: 0.5}, s)
+	assert.Equal(t, 0.5, s.reciprocalRank())
+	assert.Equal(t, 0.0, scoreResults(q, nil).reciprocalRank())
+}
+
+func TestParseJudgement(t *testing.T) {
+	value, err := parseJudgement("SCORE: 0.75\nREASON: one claim is not supported")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.75, value)
+	value, err = parseJudgement("score: 3")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, value)
+	_, err = parseJudgement("The answer is faithful")
+	assert.Error(t, err)
+}
+
+func TestRunFake(t *testing.T) {
+	var out bytes.Buffer
+	err := run(context.Background(), &out, []string{"-fake", "-min-recall", "0.5", "-min-mrr", "0.5", "-min-faithfulness", "0.9", "../../eval/campaign.yaml"})
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "8 questions  recall@5")
+	assert.Len(t, strings.Split(strings.TrimSpace(out.String()), "\n"), 11)
+
+	err = run(context.Background(), &bytes.Buffer{}, []string{"-fake", "-min-recall", "1", "../../eval/campaign.yaml"})
+	assert.ErrorContains(t, err, "is below 1.00")
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"gochat/internal/ai"
+	"gochat/internal/rag"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// searcher is where the corpus is ingested and searched
+type searcher interface {
+	ingest(ctx context.Context, fileID string, fileName string, text string) error
+	search(ctx context.Context, plan rag.RetrievalPlan, k int) ([]rag.SearchResult, error)
+	close(ctx context.Context) error
+}
+
+// readCorpus extracts the text of every file the way uploads are
+func readCorpus(ctx context.Context, s searcher, files []string) error {
+	for i, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		text, err := rag.ExtractText(file, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to extract %s: %w", file, err)
+		}
+		if err := s.ingest(ctx, fmt.Sprintf("rageval-%d", i+1), filepath.Base(file), text); err != nil {
+			return fmt.Errorf("failed to ingest %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// memorySearcher compares every chunk, it needs no Milvus and finds the exact nearest chunks
+type memorySearcher struct {
+	model string
+	docs  []rag.Document
+	names []string
+}
+
+func (m *memorySearcher) ingest(ctx context.Context, fileID string, fileName string, text string) error {
+	docs, err := rag.CreateChunkDocuments(ctx, m.model, text, fileID)
+	if err != nil {
+		return err
+	}
+	for range docs {
+		m.names = append(m.names, fileName)
+	}
+	m.docs = append(m.docs, docs...)
+	return nil
+}
+
+func (m *memorySearcher) search(ctx context.Context, plan rag.RetrievalPlan, k int) ([]rag.SearchResult, error) {
+	embeddings, err := ai.GetEmbeddings(ctx, m.model, plan.Searches)
+	if err != nil {
+		return nil, err
+	}
+	var lists [][]rag.SearchResult
+	for _, embedding := range embeddings {
+		results := make([]rag.SearchResult, 0, len(m.docs))
+		for i, doc := range m.docs {
+			results = append(results, rag.SearchResult{
+				Text:     doc.Text,
+				Score:    cosine(embedding.Embedding, doc.Embedding),
+				FileName: m.names[i],
+				Page:     doc.Page,
+				Section:  doc.Section,
+			})
+		}
+		sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+		lists = append(lists, results[:min(k, len(results))])
+	}
+	return rag.FuseResults(lists, k), nil
+}
+
+func (m *memorySearcher) close(ctx context.Context) error {
+	return nil
+}
+
+func cosine(a []float32, b []float32) float32 {
+	var dot, normA, normB float64
+	for i := range min(len(a), len(b)) {
+		dot += float64(a[i] * b[i])
+		normA += float64(a[i] * a[i])
+		normB += float64(b[i] * b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(dot / math.Sqrt(normA*normB))
+}
+
+// milvusSearcher ingests into a partition of the active collection, so the real index and search
+// parameters are measured. The partition is dropped when done.
+type milvusSearcher struct {
+	index     rag.Index
+	partition string
+}
+
+// evalAccount owns the vectors of the evaluation, no real account has this id
+const evalAccount = "rageval"
+
+func newMilvusSearcher(ctx context.Context) (*milvusSearcher, error) {
+	index, err := rag.ActiveIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &milvusSearcher{index: index, partition: fmt.Sprintf("rageval_%d", time.Now().Unix())}, nil
+}
+
+func (m *milvusSearcher) ingest(ctx context.Context, fileID string, fileName string, text string) error {
+	docs, err := rag.CreateChunkDocuments(ctx, m.index.Model, text, fileID)
+	if err != nil {
+		return err
+	}
+	source := rag.Source{FileID: fileID, Account: evalAccount, FileName: fileName, UploadedAt: time.Now()}
+	return rag.SaveDocuments(ctx, m.index, docs, source, m.partition)
+}
+
+func (m *milvusSearcher) search(ctx context.Context, plan rag.RetrievalPlan, k int) ([]rag.SearchResult, error) {
+	return rag.RetrieveDocuments(ctx, plan, rag.Scope{Account: evalAccount, Partitions: []string{m.partition}}, k)
+}
+
+func (m *milvusSearcher) close(ctx context.Context) error {
+	return rag.RemovePartition(ctx, m.partition)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"gochat/internal/rag"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// evalSet is a YAML file with the corpus to ingest and the questions to ask about it
+type evalSet struct {
+	// Corpus are the files to ingest, relative to the YAML file
+	Corpus    []string   `yaml:"corpus"`
+	Questions []question `yaml:"questions"`
+}
+
+type question struct {
+	Question string `yaml:"question"`
+	// Expected are passages of the corpus that answer the question
+	Expected []string `yaml:"expected"`
+}
+
+func loadSet(path string) (*evalSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set evalSet
+	if err := yaml.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(set.Corpus) == 0 || len(set.Questions) == 0 {
+		return nil, fmt.Errorf("%s needs a corpus and questions", path)
+	}
+	for i, q := range set.Questions {
+		if q.Question == "" || len(q.Expected) == 0 {
+			return nil, fmt.Errorf("question %d of %s needs a question and expected passages", i+1, path)
+		}
+	}
+	for i, file := range set.Corpus {
+		if !filepath.IsAbs(file) {
+			set.Corpus[i] = filepath.Join(filepath.Dir(path), file)
+		}
+	}
+	return &set, nil
+}
+
+// normalize makes passages comparable whatever line breaks the chunker kept
+func normalize(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+// score is how well the retrieval did for one question
+type score struct {
+	// Rank is the 1-based rank of the first relevant chunk, 0 when none was retrieved
+	Rank int
+	// Recall is the share of the expected passages found in the chunks
+	Recall float64
+}
+
+func scoreResults(q question, results []rag.SearchResult) score {
+	var s score
+	found := map[int]bool{}
+	for rank, result := range results {
+		text := normalize(result.Text)
+		for i, expected := range q.Expected {
+			if !strings.Contains(text, normalize(expected)) {
+				continue
+			}
+			found[i] = true
+			if s.Rank == 0 {
+				s.Rank = rank + 1
+			}
+		}
+	}
+	s.Recall = float64(len(found)) / float64(len(q.Expected))
+	return s
+}
+
+// reciprocalRank is what a question adds to the MRR
+func (s score) reciprocalRank() float64 {
+	if s.Rank == 0 {
+		return 0
+	}
+	return 1 / float64(s.Rank)
+}
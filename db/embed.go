@@ -0,0 +1,20 @@
+// Package db holds the SQL that is compiled into the binary
+package db
+
+import "embed"
+
+// Migrations are applied at startup, see database.Migrate
+//
+//go:embed migrations/*.sql
+var Migrations embed.FS
+
+// Seed is development and test data, it never runs in production
+//
+//go:embed seed/*.sql
+var Seed embed.FS
+
+// PostgresMigrations are the Postgres schema, store.Open applies them with database.NewPostgresMigrator.
+// A change to the schema needs a migration in both directories.
+//
+//go:embed postgres/migrations/*.sql
+var PostgresMigrations embed.FS
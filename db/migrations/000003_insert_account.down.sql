@@ -1 +0,0 @@
-DELETE FROM account WHERE id = 'A1234';
\ No newline at end of file
@@ -1,2 +0,0 @@
-INSERT INTO account (id, name)
-VALUES ("A1234", "test account");
@@ -1 +0,0 @@
-DELETE FROM user WHERE externalId = '1234abcd';
\ No newline at end of file
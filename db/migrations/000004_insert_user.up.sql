@@ -1,2 +0,0 @@
-INSERT INTO user (id, name, email, account, externalId, createdAt, updatedAt)
-VALUES ('1234abcd', 'Albert', 'albert@torgon.io', "A1234", '1234abcd', datetime('now'), datetime('now'));
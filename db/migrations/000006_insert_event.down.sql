@@ -1 +0,0 @@
-DELETE FROM event WHERE id = 99999;
\ No newline at end of file
@@ -1,2 +0,0 @@
-INSERT INTO event (id, user, event, metadata)
-VALUES (99999, '1234abcd', 'sendMessage', json('{"foo": "bar"}'));
@@ -1,2 +0,0 @@
-DELETE FROM account_domain
-WHERE account = 'A1234' AND domain = 'test.com';
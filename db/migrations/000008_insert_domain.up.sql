@@ -1,7 +0,0 @@
-INSERT INTO account_domain (account, domain)
-VALUES ("A1234", 'test.com');
-
-INSERT INTO account_domain (account, domain)
-VALUES ("A1234", 'torgon.io');
-
-
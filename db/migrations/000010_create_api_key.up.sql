@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS api_key (
+    id TEXT PRIMARY KEY,
+    user TEXT NOT NULL,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL DEFAULT '',
+    expiresAt TEXT NOT NULL,
+    lastUsedAt TEXT,
+    revokedAt TEXT,
+    createdAt TEXT NOT NULL DEFAULT (datetime('now')),
+    FOREIGN KEY (user) REFERENCES user(id)
+);
+
+CREATE INDEX idx_api_key_user ON api_key(user);
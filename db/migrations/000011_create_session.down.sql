@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_session_user;
+DROP TABLE IF EXISTS session;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS session (
+    id TEXT PRIMARY KEY,
+    user TEXT NOT NULL,
+    refreshHash TEXT NOT NULL UNIQUE,
+    previousRefreshHash TEXT,
+    rotatedAt TEXT,
+    userAgent TEXT,
+    ip TEXT,
+    expiresAt TEXT NOT NULL,
+    revokedAt TEXT,
+    createdAt TEXT NOT NULL DEFAULT (datetime('now')),
+    updatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+    FOREIGN KEY (user) REFERENCES user(id)
+);
+
+CREATE INDEX idx_session_user ON session(user);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_oidc_provider_account;
+DROP TABLE IF EXISTS oidc_provider;
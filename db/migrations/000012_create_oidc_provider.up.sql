@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS oidc_provider (
+    id TEXT PRIMARY KEY,
+    account TEXT,
+    name TEXT NOT NULL,
+    issuer TEXT NOT NULL,
+    clientId TEXT NOT NULL,
+    clientSecret TEXT NOT NULL DEFAULT '',
+    scopes TEXT NOT NULL DEFAULT 'openid email profile',
+    createdAt TEXT NOT NULL DEFAULT (datetime('now')),
+    updatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+    FOREIGN KEY (account) REFERENCES account(id)
+);
+
+CREATE INDEX idx_oidc_provider_account ON oidc_provider(account);
+
+-- Global providers, available to every account. Credentials are read from the environment
+INSERT INTO oidc_provider (id, account, name, issuer, clientId, clientSecret, scopes)
+VALUES ('azure', NULL, 'Microsoft', 'https://login.microsoftonline.com/common/v2.0', 'env:AZURE_CLIENT_ID', 'env:AZURE_CLIENT_SECRET', 'openid email profile offline_access');
+
+INSERT INTO oidc_provider (id, account, name, issuer, clientId, clientSecret, scopes)
+VALUES ('google', NULL, 'Google', 'https://accounts.google.com', 'env:GOOGLE_OAUTH_CLIENT_ID', 'env:GOOGLE_OAUTH_CLIENT_SECRET', 'openid email profile');
@@ -0,0 +1,4 @@
+ALTER TABLE user ADD COLUMN role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('platform_admin', 'account_admin', 'member'));
+
+-- Impersonation used to be limited to this address, keep it working as a platform admin
+UPDATE user SET role = 'platform_admin' WHERE email = 'wessel@torgon.io';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_impersonation_user;
+DROP INDEX IF EXISTS idx_impersonation_actor;
+DROP TABLE IF EXISTS impersonation;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS impersonation (
+    id TEXT PRIMARY KEY,
+    actor TEXT NOT NULL,
+    user TEXT NOT NULL,
+    session TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    expiresAt TEXT NOT NULL,
+    endedAt TEXT,
+    createdAt TEXT NOT NULL DEFAULT (datetime('now')),
+    FOREIGN KEY (actor) REFERENCES user(id),
+    FOREIGN KEY (user) REFERENCES user(id),
+    FOREIGN KEY (session) REFERENCES session(id)
+);
+
+CREATE INDEX idx_impersonation_actor ON impersonation(actor);
+CREATE INDEX idx_impersonation_user ON impersonation(user);
@@ -0,0 +1,2 @@
+-- Lowercase on purpose, sqlc does not match camelCase columns added with ALTER TABLE
+ALTER TABLE user ADD COLUMN disabledat TEXT;
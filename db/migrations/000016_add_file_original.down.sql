@@ -0,0 +1,4 @@
+ALTER TABLE file DROP COLUMN conversation;
+ALTER TABLE file DROP COLUMN mimetype;
+ALTER TABLE file DROP COLUMN size;
+ALTER TABLE file DROP COLUMN hash;
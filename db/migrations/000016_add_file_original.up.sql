@@ -0,0 +1,6 @@
+-- Lowercase on purpose, sqlc does not match camelCase columns added with ALTER TABLE
+-- Files uploaded before this have no stored original, their hash stays empty
+ALTER TABLE file ADD COLUMN hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE file ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE file ADD COLUMN mimetype TEXT NOT NULL DEFAULT '';
+ALTER TABLE file ADD COLUMN conversation TEXT NOT NULL DEFAULT '';
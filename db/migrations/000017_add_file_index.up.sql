@@ -0,0 +1,5 @@
+-- What the vectors of a file were made with, so a re-index knows what is outdated.
+-- Everything uploaded so far was embedded with mxbai-embed-large and the first chunker.
+ALTER TABLE file ADD COLUMN embeddingmodel TEXT NOT NULL DEFAULT '';
+ALTER TABLE file ADD COLUMN chunkerversion INTEGER NOT NULL DEFAULT 0;
+UPDATE file SET embeddingmodel = 'mxbai-embed-large', chunkerversion = 1;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS conversation_knowledge_base;
+DROP TABLE IF EXISTS knowledge_base_file;
+DROP TABLE IF EXISTS knowledge_base;
@@ -0,0 +1,40 @@
+-- A knowledge base belongs to either an account, shared by all its users, or to a single user
+CREATE TABLE IF NOT EXISTS knowledge_base (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    account TEXT,
+    owner TEXT,
+    createdAt TEXT NOT NULL DEFAULT (datetime('now')),
+    updatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+    FOREIGN KEY (account) REFERENCES account(id),
+    FOREIGN KEY (owner) REFERENCES user(id),
+    CHECK ((account IS NULL) <> (owner IS NULL))
+);
+
+CREATE INDEX idx_knowledge_base_account ON knowledge_base(account);
+CREATE INDEX idx_knowledge_base_owner ON knowledge_base(owner);
+
+CREATE TABLE IF NOT EXISTS knowledge_base_file (
+    knowledgeBase TEXT NOT NULL,
+    file TEXT NOT NULL,
+    createdAt TEXT NOT NULL DEFAULT (datetime('now')),
+    PRIMARY KEY (knowledgeBase, file),
+    FOREIGN KEY (knowledgeBase) REFERENCES knowledge_base(id),
+    FOREIGN KEY (file) REFERENCES file(id)
+);
+
+CREATE INDEX idx_knowledge_base_file_file ON knowledge_base_file(file);
+
+-- Conversations only exist in the browser, an attachment belongs to the user who made it
+CREATE TABLE IF NOT EXISTS conversation_knowledge_base (
+    conversation TEXT NOT NULL,
+    knowledgeBase TEXT NOT NULL,
+    user TEXT NOT NULL,
+    createdAt TEXT NOT NULL DEFAULT (datetime('now')),
+    PRIMARY KEY (conversation, knowledgeBase, user),
+    FOREIGN KEY (knowledgeBase) REFERENCES knowledge_base(id),
+    FOREIGN KEY (user) REFERENCES user(id)
+);
+
+CREATE INDEX idx_conversation_knowledge_base_user ON conversation_knowledge_base(user);
@@ -0,0 +1,20 @@
+-- Conversations still live in the browser, the server only records who they belong to so one user
+-- can't search or delete the vectors of another user's conversation. The first upload claims it.
+CREATE TABLE IF NOT EXISTS conversation (
+    id TEXT PRIMARY KEY,
+    owner TEXT NOT NULL,
+    createdAt TEXT NOT NULL DEFAULT (datetime('now')),
+    FOREIGN KEY (owner) REFERENCES user(id)
+);
+
+CREATE INDEX idx_conversation_owner ON conversation(owner);
+
+-- Conversations with uploads belong to whoever uploaded first
+INSERT INTO conversation (id, owner, createdAt)
+SELECT f.conversation, f.owner, f.createdAt FROM file f
+WHERE f.conversation != ''
+  AND NOT EXISTS (
+      SELECT 1 FROM file earlier
+      WHERE earlier.conversation = f.conversation
+        AND (earlier.createdAt < f.createdAt OR (earlier.createdAt = f.createdAt AND earlier.id < f.id))
+  );
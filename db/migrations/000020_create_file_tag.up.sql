@@ -0,0 +1,10 @@
+-- Tags the user gives a file at upload, they are stored with its vectors too so searches can filter on them
+CREATE TABLE IF NOT EXISTS file_tag (
+    file TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    createdAt TEXT NOT NULL DEFAULT (datetime('now')),
+    PRIMARY KEY (file, tag),
+    FOREIGN KEY (file) REFERENCES file(id)
+);
+
+CREATE INDEX idx_file_tag_tag ON file_tag(tag);
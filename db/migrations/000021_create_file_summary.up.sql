@@ -0,0 +1,9 @@
+-- Summaries of files are expensive to make, they are kept per version of the file and of the prompts
+CREATE TABLE IF NOT EXISTS file_summary (
+    file TEXT NOT NULL,
+    version TEXT NOT NULL,
+    summary TEXT NOT NULL,
+    createdAt TEXT NOT NULL DEFAULT (datetime('now')),
+    PRIMARY KEY (file, version),
+    FOREIGN KEY (file) REFERENCES file(id)
+);
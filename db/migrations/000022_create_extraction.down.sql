@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS extraction_result;
+DROP TABLE IF EXISTS extraction;
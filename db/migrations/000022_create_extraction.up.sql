@@ -0,0 +1,27 @@
+-- An extraction runs a schema of fields over files of the user, fields is the schema as JSON
+CREATE TABLE IF NOT EXISTS extraction (
+    id TEXT PRIMARY KEY,
+    owner TEXT NOT NULL,
+    name TEXT NOT NULL,
+    fields TEXT NOT NULL,
+    createdAt TEXT NOT NULL DEFAULT (datetime('now')),
+    FOREIGN KEY (owner) REFERENCES user(id)
+);
+
+CREATE INDEX idx_extraction_owner ON extraction(owner);
+
+-- A result is pending until its file was read, data is a JSON object with a value per field
+CREATE TABLE IF NOT EXISTS extraction_result (
+    extraction TEXT NOT NULL,
+    file TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    data TEXT NOT NULL DEFAULT '{}',
+    error TEXT NOT NULL DEFAULT '',
+    createdAt TEXT NOT NULL DEFAULT (datetime('now')),
+    updatedAt TEXT NOT NULL DEFAULT (datetime('now')),
+    PRIMARY KEY (extraction, file),
+    FOREIGN KEY (extraction) REFERENCES extraction(id),
+    FOREIGN KEY (file) REFERENCES file(id)
+);
+
+CREATE INDEX idx_extraction_result_file ON extraction_result(file);
@@ -0,0 +1,12 @@
+-- A domain an account admin asked for, it is added to the account once the TXT record with the token
+-- is found. Several accounts can have a claim on the same domain, only the owner can verify it.
+CREATE TABLE IF NOT EXISTS domain_claim (
+    account TEXT NOT NULL,
+    domain TEXT NOT NULL,
+    token TEXT NOT NULL,
+    createdAt TEXT NOT NULL DEFAULT (datetime('now')),
+    PRIMARY KEY (account, domain),
+    FOREIGN KEY (account) REFERENCES account(id)
+);
+
+CREATE INDEX idx_domain_claim_domain ON domain_claim(domain);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS impersonation;
+DROP TABLE IF EXISTS oidc_provider;
+DROP TABLE IF EXISTS session;
+DROP TABLE IF EXISTS api_key;
+DROP TABLE IF EXISTS file;
+DROP TABLE IF EXISTS account_domain;
+DROP TABLE IF EXISTS event;
+DROP TABLE IF EXISTS "user";
+DROP TABLE IF EXISTS account;
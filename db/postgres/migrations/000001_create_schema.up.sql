@@ -0,0 +1,104 @@
+-- The Postgres schema mirrors the SQLite migrations up to 000015. Timestamps stay TEXT in the same
+-- formats SQLite writes, so the services, the queries and the copy tool don't translate anything.
+-- "user" is a reserved word in Postgres and has to be quoted.
+
+CREATE TABLE account (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    createdAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS'),
+    updatedAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+);
+CREATE INDEX idx_account_name ON account(name);
+
+CREATE TABLE "user" (
+    id TEXT PRIMARY KEY,
+    name TEXT,
+    email TEXT NOT NULL UNIQUE,
+    account TEXT NOT NULL REFERENCES account(id),
+    externalId TEXT UNIQUE,
+    createdAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS'),
+    updatedAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS'),
+    role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('platform_admin', 'account_admin', 'member')),
+    disabledAt TEXT
+);
+CREATE INDEX idx_user_email ON "user"(email);
+CREATE INDEX idx_user_account ON "user"(account);
+
+CREATE TABLE event (
+    id BIGSERIAL PRIMARY KEY,
+    event TEXT NOT NULL,
+    timestamp TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS'),
+    -- JSON, kept as text like SQLite does
+    metadata TEXT,
+    "user" TEXT NOT NULL REFERENCES "user"(id)
+);
+CREATE INDEX idx_event_user ON event("user");
+
+CREATE TABLE account_domain (
+    account TEXT NOT NULL REFERENCES account(id),
+    domain TEXT NOT NULL,
+    PRIMARY KEY (account, domain)
+);
+
+CREATE TABLE file (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    createdAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS'),
+    updatedAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS'),
+    owner TEXT NOT NULL REFERENCES "user"(id)
+);
+
+CREATE TABLE api_key (
+    id TEXT PRIMARY KEY,
+    "user" TEXT NOT NULL REFERENCES "user"(id),
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL DEFAULT '',
+    expiresAt TEXT NOT NULL,
+    lastUsedAt TEXT,
+    revokedAt TEXT,
+    createdAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+);
+CREATE INDEX idx_api_key_user ON api_key("user");
+
+CREATE TABLE session (
+    id TEXT PRIMARY KEY,
+    "user" TEXT NOT NULL REFERENCES "user"(id),
+    refreshHash TEXT NOT NULL UNIQUE,
+    previousRefreshHash TEXT,
+    rotatedAt TEXT,
+    userAgent TEXT,
+    ip TEXT,
+    expiresAt TEXT NOT NULL,
+    revokedAt TEXT,
+    createdAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS'),
+    updatedAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+);
+CREATE INDEX idx_session_user ON session("user");
+
+CREATE TABLE oidc_provider (
+    id TEXT PRIMARY KEY,
+    account TEXT REFERENCES account(id),
+    name TEXT NOT NULL,
+    issuer TEXT NOT NULL,
+    clientId TEXT NOT NULL,
+    clientSecret TEXT NOT NULL DEFAULT '',
+    scopes TEXT NOT NULL DEFAULT 'openid email profile',
+    createdAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS'),
+    updatedAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+);
+CREATE INDEX idx_oidc_provider_account ON oidc_provider(account);
+
+CREATE TABLE impersonation (
+    id TEXT PRIMARY KEY,
+    actor TEXT NOT NULL REFERENCES "user"(id),
+    "user" TEXT NOT NULL REFERENCES "user"(id),
+    session TEXT NOT NULL REFERENCES session(id),
+    reason TEXT NOT NULL,
+    expiresAt TEXT NOT NULL,
+    endedAt TEXT,
+    createdAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+);
+CREATE INDEX idx_impersonation_actor ON impersonation(actor);
+CREATE INDEX idx_impersonation_user ON impersonation("user");
@@ -0,0 +1,5 @@
+-- Same columns as SQLite migration 000016
+ALTER TABLE file ADD COLUMN hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE file ADD COLUMN size BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE file ADD COLUMN mimetype TEXT NOT NULL DEFAULT '';
+ALTER TABLE file ADD COLUMN conversation TEXT NOT NULL DEFAULT '';
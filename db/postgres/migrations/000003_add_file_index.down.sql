@@ -0,0 +1,2 @@
+ALTER TABLE file DROP COLUMN chunkerversion;
+ALTER TABLE file DROP COLUMN embeddingmodel;
@@ -0,0 +1,4 @@
+-- Same columns as SQLite migration 000017
+ALTER TABLE file ADD COLUMN embeddingmodel TEXT NOT NULL DEFAULT '';
+ALTER TABLE file ADD COLUMN chunkerversion BIGINT NOT NULL DEFAULT 0;
+UPDATE file SET embeddingmodel = 'mxbai-embed-large', chunkerversion = 1;
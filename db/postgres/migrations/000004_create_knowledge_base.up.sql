@@ -0,0 +1,30 @@
+-- Same tables as SQLite migration 000018
+CREATE TABLE knowledge_base (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    account TEXT REFERENCES account(id),
+    owner TEXT REFERENCES "user"(id),
+    createdAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS'),
+    updatedAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS'),
+    CHECK ((account IS NULL) <> (owner IS NULL))
+);
+CREATE INDEX idx_knowledge_base_account ON knowledge_base(account);
+CREATE INDEX idx_knowledge_base_owner ON knowledge_base(owner);
+
+CREATE TABLE knowledge_base_file (
+    knowledgeBase TEXT NOT NULL REFERENCES knowledge_base(id),
+    file TEXT NOT NULL REFERENCES file(id),
+    createdAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS'),
+    PRIMARY KEY (knowledgeBase, file)
+);
+CREATE INDEX idx_knowledge_base_file_file ON knowledge_base_file(file);
+
+CREATE TABLE conversation_knowledge_base (
+    conversation TEXT NOT NULL,
+    knowledgeBase TEXT NOT NULL REFERENCES knowledge_base(id),
+    "user" TEXT NOT NULL REFERENCES "user"(id),
+    createdAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS'),
+    PRIMARY KEY (conversation, knowledgeBase, "user")
+);
+CREATE INDEX idx_conversation_knowledge_base_user ON conversation_knowledge_base("user");
@@ -0,0 +1,16 @@
+-- Same table as SQLite migration 000019
+CREATE TABLE conversation (
+    id TEXT PRIMARY KEY,
+    owner TEXT NOT NULL REFERENCES "user"(id),
+    createdAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+);
+CREATE INDEX idx_conversation_owner ON conversation(owner);
+
+INSERT INTO conversation (id, owner, createdAt)
+SELECT f.conversation, f.owner, f.createdAt FROM file f
+WHERE f.conversation != ''
+  AND NOT EXISTS (
+      SELECT 1 FROM file earlier
+      WHERE earlier.conversation = f.conversation
+        AND (earlier.createdAt < f.createdAt OR (earlier.createdAt = f.createdAt AND earlier.id < f.id))
+  );
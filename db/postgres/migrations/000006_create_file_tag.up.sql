@@ -0,0 +1,8 @@
+-- Same table as SQLite migration 000020
+CREATE TABLE file_tag (
+    file TEXT NOT NULL REFERENCES file(id),
+    tag TEXT NOT NULL,
+    createdAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS'),
+    PRIMARY KEY (file, tag)
+);
+CREATE INDEX idx_file_tag_tag ON file_tag(tag);
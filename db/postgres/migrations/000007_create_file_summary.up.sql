@@ -0,0 +1,8 @@
+-- Same table as SQLite migration 000021
+CREATE TABLE file_summary (
+    file TEXT NOT NULL REFERENCES file(id),
+    version TEXT NOT NULL,
+    summary TEXT NOT NULL,
+    createdAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS'),
+    PRIMARY KEY (file, version)
+);
@@ -0,0 +1,21 @@
+-- Same tables as SQLite migration 000022
+CREATE TABLE extraction (
+    id TEXT PRIMARY KEY,
+    owner TEXT NOT NULL REFERENCES "user"(id),
+    name TEXT NOT NULL,
+    fields TEXT NOT NULL,
+    createdAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+);
+CREATE INDEX idx_extraction_owner ON extraction(owner);
+
+CREATE TABLE extraction_result (
+    extraction TEXT NOT NULL REFERENCES extraction(id),
+    file TEXT NOT NULL REFERENCES file(id),
+    status TEXT NOT NULL DEFAULT 'pending',
+    data TEXT NOT NULL DEFAULT '{}',
+    error TEXT NOT NULL DEFAULT '',
+    createdAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS'),
+    updatedAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS'),
+    PRIMARY KEY (extraction, file)
+);
+CREATE INDEX idx_extraction_result_file ON extraction_result(file);
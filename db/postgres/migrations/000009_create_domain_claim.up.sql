@@ -0,0 +1,10 @@
+-- Same table as SQLite migration 000023
+CREATE TABLE domain_claim (
+    account TEXT NOT NULL REFERENCES account(id),
+    domain TEXT NOT NULL,
+    token TEXT NOT NULL,
+    createdAt TEXT NOT NULL DEFAULT to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS'),
+    PRIMARY KEY (account, domain)
+);
+
+CREATE INDEX idx_domain_claim_domain ON domain_claim(domain);
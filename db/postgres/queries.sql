@@ -0,0 +1,663 @@
+-- Postgres version of db/sqlc/queries.sql, every query there has one here with the same name,
+-- parameters and columns. The store package checks at compile time that both sides match.
+
+-- name: GetAccount :one
+SELECT
+    a.*,
+    COALESCE(string_agg(ad.domain, ','), '') AS domains
+FROM
+    account a
+        LEFT JOIN
+    account_domain ad
+    ON
+        ad.account = a.id
+WHERE
+    a.id = $1
+GROUP BY
+    a.id;
+
+
+-- name: GetAccountByDomain :one
+SELECT
+    a.id,
+    a.name,
+    ad.domain
+FROM
+    account a
+        JOIN
+    account_domain ad ON a.id = ad.account
+WHERE
+    ad.domain = $1;
+
+-- name: DeleteAccountDomain :exec
+DELETE FROM account_domain
+WHERE domain = sqlc.arg(domain);
+
+-- name: DeleteAccountDomainForAccount :execrows
+DELETE FROM account_domain
+WHERE account = sqlc.arg(account)
+  AND domain = sqlc.arg(domain);
+
+-- name: ListAccountDomains :many
+SELECT * FROM account_domain
+WHERE account = $1
+ORDER BY domain;
+
+-- name: CreateDomainClaim :exec
+INSERT INTO domain_claim (account, domain, token)
+VALUES (sqlc.arg(account), sqlc.arg(domain), sqlc.arg(token))
+ON CONFLICT (account, domain) DO NOTHING;
+
+-- name: GetDomainClaim :one
+SELECT * FROM domain_claim
+WHERE account = sqlc.arg(account)
+  AND domain = sqlc.arg(domain);
+
+-- name: ListDomainClaims :many
+SELECT * FROM domain_claim
+WHERE account = sqlc.arg(account)
+ORDER BY domain;
+
+-- name: DeleteDomainClaim :execrows
+DELETE FROM domain_claim
+WHERE account = sqlc.arg(account)
+  AND domain = sqlc.arg(domain);
+
+-- name: DeleteDomainClaims :exec
+DELETE FROM domain_claim
+WHERE domain = sqlc.arg(domain);
+
+-- name: DeleteAccountDomainClaims :exec
+DELETE FROM domain_claim
+WHERE account = sqlc.arg(account);
+
+-- name: ListAccount :many
+SELECT * FROM account;
+
+-- name: ListAccountsPage :many
+SELECT * FROM account
+WHERE name ILIKE sqlc.arg(search) OR id ILIKE sqlc.arg(search)
+ORDER BY name
+LIMIT sqlc.arg('limit')::bigint OFFSET sqlc.arg('offset')::bigint;
+
+-- name: CountAccounts :one
+SELECT COUNT(*) FROM account
+WHERE name ILIKE sqlc.arg(search) OR id ILIKE sqlc.arg(search);
+
+-- name: UpdateAccountName :execrows
+UPDATE account
+SET name = sqlc.arg(name),
+    updatedAt = to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+WHERE id = sqlc.arg(id);
+
+-- name: DeleteAccountDomains :exec
+DELETE FROM account_domain
+WHERE account = $1;
+
+-- name: DeleteAccountConversationKnowledgeBases :exec
+DELETE FROM conversation_knowledge_base
+WHERE knowledgeBase IN (SELECT kb.id FROM knowledge_base kb WHERE kb.account = $1);
+
+-- name: DeleteAccountKnowledgeBaseFiles :exec
+DELETE FROM knowledge_base_file
+WHERE knowledgeBase IN (SELECT kb.id FROM knowledge_base kb WHERE kb.account = $1);
+
+-- name: DeleteAccountKnowledgeBases :exec
+DELETE FROM knowledge_base
+WHERE account = $1;
+
+-- name: DeleteAccountOidcProviders :exec
+DELETE FROM oidc_provider
+WHERE account = $1;
+
+-- name: CreateAccount :one
+INSERT INTO account (
+    id, name
+) VALUES (
+             $1, $2
+         )
+    RETURNING *;
+
+-- name: CreateAccountDomain :one
+INSERT INTO account_domain (
+    account, domain
+) VALUES (
+             $1, $2
+         )
+    RETURNING *;
+
+-- name: DeleteAccount :execrows
+DELETE FROM account
+WHERE id = $1;
+
+-- Users
+-- name: GetUser :one
+SELECT
+    u.*,
+    a.id AS account_id,
+    a.name AS account_name
+FROM "user" u
+         LEFT JOIN account a ON u.account = a.id
+WHERE u.id = $1
+LIMIT 1;
+
+-- name: UpdateUserAccount :exec
+UPDATE "user"
+SET account = sqlc.arg(accountID),
+    updatedAt = to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+WHERE email = sqlc.arg(userEmail);
+
+-- name: GetUserByEmail :one
+SELECT * FROM "user"
+WHERE email = $1 LIMIT 1;
+
+-- name: GetUserByExternalID :one
+SELECT * FROM "user"
+WHERE externalId = $1 LIMIT 1;
+
+-- name: ListUser :many
+SELECT * FROM "user";
+
+-- name: ListUsersPage :many
+SELECT * FROM "user"
+WHERE (account = sqlc.arg(account) OR sqlc.arg(account) = '')
+  AND (email ILIKE sqlc.arg(search) OR COALESCE(name, '') ILIKE sqlc.arg(search))
+ORDER BY email
+LIMIT sqlc.arg('limit')::bigint OFFSET sqlc.arg('offset')::bigint;
+
+-- name: CountUsers :one
+SELECT COUNT(*) FROM "user"
+WHERE (account = sqlc.arg(account) OR sqlc.arg(account) = '')
+  AND (email ILIKE sqlc.arg(search) OR COALESCE(name, '') ILIKE sqlc.arg(search));
+
+-- name: DisableUser :execrows
+UPDATE "user"
+SET disabledAt = sqlc.arg(disabledAt),
+    updatedAt = to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+WHERE id = sqlc.arg(id);
+
+-- name: EnableUser :execrows
+UPDATE "user"
+SET disabledAt = NULL,
+    updatedAt = to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+WHERE id = sqlc.arg(id);
+
+-- name: ListUsersByAccount :many
+SELECT * FROM "user"
+WHERE account = $1
+ORDER BY email;
+
+-- name: UpdateUserRole :execrows
+UPDATE "user"
+SET role = sqlc.arg(role),
+    updatedAt = to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+WHERE id = sqlc.arg(id);
+
+-- name: SetUserExternalID :exec
+UPDATE "user"
+SET externalId = sqlc.arg(externalId),
+    updatedAt = to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+WHERE id = sqlc.arg(id);
+
+-- name: CreateUser :one
+INSERT INTO "user" (
+   id, email, externalId, name, account
+) VALUES (
+           $1,  $2, $3, $4, $5
+         )
+    RETURNING *;
+
+-- name: DeleteUser :execrows
+DELETE FROM "user"
+WHERE id = $1;
+
+-- Everything that references a user has to go before the user itself
+-- name: DeleteUserEvents :exec
+DELETE FROM event
+WHERE "user" = $1;
+
+-- name: DeleteUserFileTags :exec
+DELETE FROM file_tag
+WHERE file IN (SELECT f.id FROM file f WHERE f.owner = $1);
+
+-- name: DeleteUserFileSummaries :exec
+DELETE FROM file_summary
+WHERE file IN (SELECT f.id FROM file f WHERE f.owner = $1);
+
+-- name: DeleteUserExtractionResults :exec
+DELETE FROM extraction_result
+WHERE extraction IN (SELECT e.id FROM extraction e WHERE e.owner = sqlc.arg(owner))
+   OR file IN (SELECT f.id FROM file f WHERE f.owner = sqlc.arg(owner));
+
+-- name: DeleteUserExtractions :exec
+DELETE FROM extraction
+WHERE owner = $1;
+
+-- name: DeleteUserFiles :exec
+DELETE FROM file
+WHERE owner = $1;
+
+-- name: DeleteUserConversationKnowledgeBases :exec
+DELETE FROM conversation_knowledge_base
+WHERE "user" = sqlc.arg('user') OR knowledgeBase IN (SELECT kb.id FROM knowledge_base kb WHERE kb.owner = sqlc.arg('user'));
+
+-- name: DeleteUserKnowledgeBaseFiles :exec
+DELETE FROM knowledge_base_file
+WHERE file IN (SELECT f.id FROM file f WHERE f.owner = sqlc.arg('user'))
+   OR knowledgeBase IN (SELECT kb.id FROM knowledge_base kb WHERE kb.owner = sqlc.arg('user'));
+
+-- name: DeleteUserKnowledgeBases :exec
+DELETE FROM knowledge_base
+WHERE owner = $1;
+
+-- name: DeleteUserConversations :exec
+DELETE FROM conversation
+WHERE owner = $1;
+
+-- name: DeleteUserApiKeys :exec
+DELETE FROM api_key
+WHERE "user" = $1;
+
+-- name: DeleteUserImpersonations :exec
+DELETE FROM impersonation
+WHERE "user" = sqlc.arg('user') OR actor = sqlc.arg('user');
+
+-- name: DeleteUserSessions :exec
+DELETE FROM session
+WHERE "user" = $1;
+
+
+-- EVENTS
+
+-- name: CreateEvent :one
+INSERT INTO event (
+    "user", event, metadata
+) VALUES (
+     $1, $2, $3
+)
+RETURNING *;
+
+-- name: GetEvent :one
+SELECT * FROM event
+WHERE id = $1 LIMIT 1;
+
+-- name: ListEvents :many
+SELECT * FROM event
+WHERE ("user" = sqlc.arg('user') OR sqlc.arg('user') = '')
+  AND (event = sqlc.arg(event) OR sqlc.arg(event) = '')
+  AND timestamp >= sqlc.arg(since)
+ORDER BY id DESC
+LIMIT sqlc.arg('limit')::bigint;
+
+-- name: UsageByAccount :many
+SELECT
+    a.id AS account_id,
+    a.name AS account_name,
+    COUNT(*) AS messages,
+    COUNT(DISTINCT e."user") AS active_users
+FROM event e
+         JOIN "user" u ON e."user" = u.id
+         JOIN account a ON u.account = a.id
+WHERE e.event = 'message'
+  AND e.timestamp >= sqlc.arg(since)
+  AND e.timestamp < sqlc.arg(until)
+GROUP BY a.id
+ORDER BY messages DESC;
+
+
+-- FILES
+-- name: CreateFile :one
+INSERT INTO file (
+    id, name, owner, hash, size, mimetype, conversation
+) VALUES (
+ $1, $2, $3, $4, $5, $6, $7
+ )
+RETURNING *;
+
+-- name: GetFile :one
+SELECT * FROM file
+WHERE id = $1 LIMIT 1;
+
+-- name: ListFiles :many
+SELECT * FROM file
+ORDER BY createdAt, id;
+
+-- name: ListUserFiles :many
+SELECT * FROM file
+WHERE owner = $1
+ORDER BY createdAt, id;
+
+-- name: ListFileAccounts :many
+SELECT f.id, u.account FROM file f
+JOIN "user" u ON u.id = f.owner
+ORDER BY f.id;
+
+-- name: AddFileTag :exec
+INSERT INTO file_tag (
+    file, tag
+) VALUES (
+    $1, $2
+)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteFileTags :exec
+DELETE FROM file_tag
+WHERE file = $1;
+
+-- name: DeleteFileSummaries :exec
+DELETE FROM file_summary
+WHERE file = $1;
+
+-- name: DeleteFileExtractionResults :exec
+DELETE FROM extraction_result
+WHERE file = $1;
+
+-- name: DeleteFileKnowledgeBaseFiles :exec
+DELETE FROM knowledge_base_file
+WHERE file = $1;
+
+-- name: DeleteFile :execrows
+DELETE FROM file
+WHERE id = sqlc.arg(id) AND owner = sqlc.arg(owner);
+
+-- name: ListConversationFiles :many
+SELECT * FROM file
+WHERE owner = $1 AND conversation = $2
+ORDER BY createdAt, id;
+
+-- name: GetFileSummary :one
+SELECT * FROM file_summary
+WHERE file = $1 AND version = $2 LIMIT 1;
+
+-- name: SaveFileSummary :exec
+INSERT INTO file_summary (
+    file, version, summary
+) VALUES (
+    $1, $2, $3
+)
+ON CONFLICT (file, version) DO UPDATE
+SET summary = excluded.summary,
+    createdAt = to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS');
+
+-- name: ListFileTags :many
+SELECT tag FROM file_tag
+WHERE file = $1
+ORDER BY tag;
+
+-- name: ListAllFileTags :many
+SELECT * FROM file_tag
+ORDER BY file, tag;
+
+-- name: SetFileIndex :exec
+UPDATE file
+SET embeddingmodel = $1,
+    chunkerversion = $2,
+    updatedAt = to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+WHERE id = $3;
+
+-- name: GetAccountById :one
+SELECT * FROM account
+WHERE id = $1 LIMIT 1;
+
+-- API KEYS
+-- name: CreateApiKey :one
+INSERT INTO api_key (
+    id, "user", name, prefix, hash, scopes, expiresAt
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7
+)
+RETURNING *;
+
+-- name: GetApiKeyByHash :one
+SELECT * FROM api_key
+WHERE hash = $1 LIMIT 1;
+
+-- name: ListApiKeysByUser :many
+SELECT * FROM api_key
+WHERE "user" = $1
+ORDER BY createdAt DESC;
+
+-- name: RevokeApiKey :execrows
+UPDATE api_key
+SET revokedAt = sqlc.arg(revokedAt)
+WHERE id = sqlc.arg(id)
+  AND "user" = sqlc.arg('user')
+  AND revokedAt IS NULL;
+
+-- name: RevokeUserApiKeys :execrows
+UPDATE api_key
+SET revokedAt = sqlc.arg(revokedAt)
+WHERE "user" = sqlc.arg('user')
+  AND revokedAt IS NULL;
+
+-- name: TouchApiKey :exec
+UPDATE api_key
+SET lastUsedAt = sqlc.arg(lastUsedAt)
+WHERE id = sqlc.arg(id);
+
+
+-- SESSIONS
+-- name: CreateSession :one
+INSERT INTO session (
+    id, "user", refreshHash, userAgent, ip, expiresAt
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: GetSession :one
+SELECT * FROM session
+WHERE id = $1 LIMIT 1;
+
+-- name: RotateSession :execrows
+UPDATE session
+SET refreshHash = sqlc.arg(newHash),
+    previousRefreshHash = refreshHash,
+    rotatedAt = sqlc.arg(rotatedAt),
+    expiresAt = sqlc.arg(expiresAt),
+    updatedAt = to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+WHERE id = sqlc.arg(id)
+  AND refreshHash = sqlc.arg(currentHash)
+  AND revokedAt IS NULL;
+
+-- name: RevokeSession :exec
+UPDATE session
+SET revokedAt = sqlc.arg(revokedAt),
+    updatedAt = to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+WHERE id = sqlc.arg(id)
+  AND revokedAt IS NULL;
+
+-- name: RevokeUserSessions :execrows
+UPDATE session
+SET revokedAt = sqlc.arg(revokedAt),
+    updatedAt = to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+WHERE "user" = sqlc.arg('user')
+  AND revokedAt IS NULL;
+
+
+-- OIDC PROVIDERS
+-- name: GetOidcProvider :one
+SELECT * FROM oidc_provider
+WHERE id = $1 LIMIT 1;
+
+-- name: ListOidcProvidersByAccount :many
+SELECT * FROM oidc_provider
+WHERE account = $1
+ORDER BY name;
+
+-- name: CreateOidcProvider :one
+INSERT INTO oidc_provider (
+    id, account, name, issuer, clientId, clientSecret, scopes
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7
+)
+RETURNING *;
+
+-- name: DeleteOidcProvider :exec
+DELETE FROM oidc_provider
+WHERE id = $1;
+
+
+-- IMPERSONATIONS
+-- name: CreateImpersonation :one
+INSERT INTO impersonation (
+    id, actor, "user", session, reason, expiresAt
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: GetImpersonation :one
+SELECT * FROM impersonation
+WHERE id = $1 LIMIT 1;
+
+-- name: EndImpersonation :execrows
+UPDATE impersonation
+SET endedAt = sqlc.arg(endedAt)
+WHERE id = sqlc.arg(id)
+  AND endedAt IS NULL;
+
+
+-- KNOWLEDGE BASES
+-- name: CreateKnowledgeBase :one
+INSERT INTO knowledge_base (
+    id, name, description, account, owner
+) VALUES (
+    $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: GetKnowledgeBase :one
+SELECT * FROM knowledge_base
+WHERE id = $1 LIMIT 1;
+
+-- The account's knowledge bases and the user's own
+-- name: ListKnowledgeBases :many
+SELECT * FROM knowledge_base
+WHERE account = sqlc.arg(account) OR owner = sqlc.arg('user')
+ORDER BY name, id;
+
+-- name: UpdateKnowledgeBase :execrows
+UPDATE knowledge_base
+SET name = $1,
+    description = $2,
+    updatedAt = to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+WHERE id = $3;
+
+-- name: DeleteKnowledgeBase :execrows
+DELETE FROM knowledge_base
+WHERE id = $1;
+
+-- name: AddKnowledgeBaseFile :exec
+INSERT INTO knowledge_base_file (
+    knowledgeBase, file
+) VALUES (
+    $1, $2
+)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveKnowledgeBaseFile :execrows
+DELETE FROM knowledge_base_file
+WHERE knowledgeBase = $1 AND file = $2;
+
+-- name: DeleteKnowledgeBaseFiles :exec
+DELETE FROM knowledge_base_file
+WHERE knowledgeBase = $1;
+
+-- name: ListKnowledgeBaseFiles :many
+SELECT f.* FROM file f
+JOIN knowledge_base_file kbf ON kbf.file = f.id
+WHERE kbf.knowledgeBase = $1
+ORDER BY f.name, f.id;
+
+-- name: ListKnowledgeBaseMemberships :many
+SELECT * FROM knowledge_base_file
+ORDER BY knowledgeBase, file;
+
+-- name: AttachKnowledgeBase :exec
+INSERT INTO conversation_knowledge_base (
+    conversation, knowledgeBase, "user"
+) VALUES (
+    $1, $2, $3
+)
+ON CONFLICT DO NOTHING;
+
+-- name: DetachKnowledgeBase :execrows
+DELETE FROM conversation_knowledge_base
+WHERE conversation = $1 AND knowledgeBase = $2 AND "user" = $3;
+
+-- name: DeleteKnowledgeBaseConversations :exec
+DELETE FROM conversation_knowledge_base
+WHERE knowledgeBase = $1;
+
+-- name: ListConversationKnowledgeBases :many
+SELECT kb.* FROM knowledge_base kb
+JOIN conversation_knowledge_base ckb ON ckb.knowledgeBase = kb.id
+WHERE ckb.conversation = sqlc.arg(conversation) AND ckb."user" = sqlc.arg('user')
+ORDER BY kb.name, kb.id;
+
+
+-- CONVERSATIONS
+
+-- name: ClaimConversation :exec
+INSERT INTO conversation (
+    id, owner
+) VALUES (
+    $1, $2
+)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: GetConversation :one
+SELECT * FROM conversation
+WHERE id = $1 LIMIT 1;
+
+-- name: DeleteConversation :execrows
+DELETE FROM conversation
+WHERE id = $1 AND owner = $2;
+
+-- name: ListConversationIDs :many
+SELECT id FROM conversation
+ORDER BY id;
+
+-- name: DetachConversationKnowledgeBases :exec
+DELETE FROM conversation_knowledge_base
+WHERE conversation = $1 AND "user" = $2;
+
+
+-- EXTRACTIONS
+
+-- name: CreateExtraction :one
+INSERT INTO extraction (
+    id, owner, name, fields
+) VALUES (
+    $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: GetExtraction :one
+SELECT * FROM extraction
+WHERE id = $1 LIMIT 1;
+
+-- name: ListExtractions :many
+SELECT * FROM extraction
+WHERE owner = $1
+ORDER BY createdAt DESC, id;
+
+-- name: AddExtractionResult :exec
+INSERT INTO extraction_result (
+    extraction, file
+) VALUES (
+    $1, $2
+)
+ON CONFLICT DO NOTHING;
+
+-- name: SaveExtractionResult :exec
+UPDATE extraction_result
+SET status = $1, data = $2, error = $3, updatedAt = to_char(now() AT TIME ZONE 'utc', 'YYYY-MM-DD HH24:MI:SS')
+WHERE extraction = $4 AND file = $5;
+
+-- name: ListExtractionResults :many
+SELECT r.*, f.name AS fileName FROM extraction_result r
+JOIN file f ON f.id = r.file
+WHERE r.extraction = $1
+ORDER BY r.createdAt, f.name, r.file;
@@ -0,0 +1,14 @@
+-- Development and test data, loaded with --seed and by the tests. Never part of the migrations.
+INSERT OR IGNORE INTO account (id, name)
+VALUES ('A1234', 'test account');
+
+INSERT OR IGNORE INTO account_domain (account, domain)
+VALUES ('A1234', 'test.com'),
+       ('A1234', 'torgon.io');
+
+INSERT OR IGNORE INTO user (id, name, email, account, externalId)
+VALUES ('1234abcd', 'Albert', 'albert@torgon.io', 'A1234', '1234abcd'),
+       ('123ABCD', 'Tester', 'tester@test.com', 'A1234', '123ABCD');
+
+INSERT OR IGNORE INTO event (id, user, event, metadata)
+VALUES (99999, '1234abcd', 'sendMessage', json('{"foo": "bar"}'));
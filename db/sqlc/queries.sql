@@ -30,9 +30,83 @@ WHERE
 DELETE FROM account_domain
 WHERE domain = sqlc.arg(domain);
 
+-- name: DeleteAccountDomainForAccount :execrows
+DELETE FROM account_domain
+WHERE account = sqlc.arg(account)
+  AND domain = sqlc.arg(domain);
+
+-- name: ListAccountDomains :many
+SELECT * FROM account_domain
+WHERE account = ?
+ORDER BY domain;
+
+-- name: CreateDomainClaim :exec
+INSERT INTO domain_claim (account, domain, token)
+VALUES (sqlc.arg(account), sqlc.arg(domain), sqlc.arg(token))
+ON CONFLICT (account, domain) DO NOTHING;
+
+-- name: GetDomainClaim :one
+SELECT * FROM domain_claim
+WHERE account = sqlc.arg(account)
+  AND domain = sqlc.arg(domain);
+
+-- name: ListDomainClaims :many
+SELECT * FROM domain_claim
+WHERE account = sqlc.arg(account)
+ORDER BY domain;
+
+-- name: DeleteDomainClaim :execrows
+DELETE FROM domain_claim
+WHERE account = sqlc.arg(account)
+  AND domain = sqlc.arg(domain);
+
+-- name: DeleteDomainClaims :exec
+DELETE FROM domain_claim
+WHERE domain = sqlc.arg(domain);
+
+-- name: DeleteAccountDomainClaims :exec
+DELETE FROM domain_claim
+WHERE account = sqlc.arg(account);
+
 -- name: ListAccount :many
 SELECT * FROM account;
 
+-- name: ListAccountsPage :many
+SELECT * FROM account
+WHERE name LIKE sqlc.arg(search) OR id LIKE sqlc.arg(search)
+ORDER BY name
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: CountAccounts :one
+SELECT COUNT(*) FROM account
+WHERE name LIKE sqlc.arg(search) OR id LIKE sqlc.arg(search);
+
+-- name: UpdateAccountName :execrows
+UPDATE account
+SET name = sqlc.arg(name),
+    updatedAt = datetime('now')
+WHERE id = sqlc.arg(id);
+
+-- name: DeleteAccountDomains :exec
+DELETE FROM account_domain
+WHERE account = ?;
+
+-- name: DeleteAccountConversationKnowledgeBases :exec
+DELETE FROM conversation_knowledge_base
+WHERE knowledgeBase IN (SELECT kb.id FROM knowledge_base kb WHERE kb.account = ?);
+
+-- name: DeleteAccountKnowledgeBaseFiles :exec
+DELETE FROM knowledge_base_file
+WHERE knowledgeBase IN (SELECT kb.id FROM knowledge_base kb WHERE kb.account = ?);
+
+-- name: DeleteAccountKnowledgeBases :exec
+DELETE FROM knowledge_base
+WHERE account = ?;
+
+-- name: DeleteAccountOidcProviders :exec
+DELETE FROM oidc_provider
+WHERE account = ?;
+
 -- name: CreateAccount :one
 INSERT INTO account (
     id, name
@@ -49,7 +123,7 @@ INSERT INTO account_domain (
          )
     RETURNING *;
 
--- name: DeleteAccount :exec
+-- name: DeleteAccount :execrows
 DELETE FROM account
 WHERE id = ?;
 
@@ -81,6 +155,47 @@ WHERE externalId = ? LIMIT 1;
 -- name: ListUser :many
 SELECT * FROM user;
 
+-- name: ListUsersPage :many
+SELECT * FROM user
+WHERE (account = sqlc.arg(account) OR sqlc.arg(account) = '')
+  AND (email LIKE sqlc.arg(search) OR IFNULL(name, '') LIKE sqlc.arg(search))
+ORDER BY email
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: CountUsers :one
+SELECT COUNT(*) FROM user
+WHERE (account = sqlc.arg(account) OR sqlc.arg(account) = '')
+  AND (email LIKE sqlc.arg(search) OR IFNULL(name, '') LIKE sqlc.arg(search));
+
+-- name: DisableUser :execrows
+UPDATE user
+SET disabledAt = sqlc.arg(disabledAt),
+    updatedAt = datetime('now')
+WHERE id = sqlc.arg(id);
+
+-- name: EnableUser :execrows
+UPDATE user
+SET disabledAt = NULL,
+    updatedAt = datetime('now')
+WHERE id = sqlc.arg(id);
+
+-- name: ListUsersByAccount :many
+SELECT * FROM user
+WHERE account = ?
+ORDER BY email;
+
+-- name: UpdateUserRole :execrows
+UPDATE user
+SET role = sqlc.arg(role),
+    updatedAt = datetime('now')
+WHERE id = sqlc.arg(id);
+
+-- name: SetUserExternalID :exec
+UPDATE user
+SET externalId = sqlc.arg(externalId),
+    updatedAt = datetime('now')
+WHERE id = sqlc.arg(id);
+
 -- name: CreateUser :one
 INSERT INTO user (
    id, email, externalId, name, account
@@ -89,10 +204,65 @@ INSERT INTO user (
          )
     RETURNING *;
 
--- name: DeleteUser :exec
+-- name: DeleteUser :execrows
 DELETE FROM user
 WHERE id = ?;
 
+-- Everything that references a user has to go before the user itself
+-- name: DeleteUserEvents :exec
+DELETE FROM event
+WHERE user = ?;
+
+-- name: DeleteUserFileTags :exec
+DELETE FROM file_tag
+WHERE file IN (SELECT f.id FROM file f WHERE f.owner = ?);
+
+-- name: DeleteUserFileSummaries :exec
+DELETE FROM file_summary
+WHERE file IN (SELECT f.id FROM file f WHERE f.owner = ?);
+
+-- name: DeleteUserExtractionResults :exec
+DELETE FROM extraction_result
+WHERE extraction IN (SELECT e.id FROM extraction e WHERE e.owner = sqlc.arg(owner))
+   OR file IN (SELECT f.id FROM file f WHERE f.owner = sqlc.arg(owner));
+
+-- name: DeleteUserExtractions :exec
+DELETE FROM extraction
+WHERE owner = ?;
+
+-- name: DeleteUserFiles :exec
+DELETE FROM file
+WHERE owner = ?;
+
+-- name: DeleteUserConversationKnowledgeBases :exec
+DELETE FROM conversation_knowledge_base
+WHERE user = sqlc.arg(user) OR knowledgeBase IN (SELECT kb.id FROM knowledge_base kb WHERE kb.owner = sqlc.arg(user));
+
+-- name: DeleteUserKnowledgeBaseFiles :exec
+DELETE FROM knowledge_base_file
+WHERE file IN (SELECT f.id FROM file f WHERE f.owner = sqlc.arg(user))
+   OR knowledgeBase IN (SELECT kb.id FROM knowledge_base kb WHERE kb.owner = sqlc.arg(user));
+
+-- name: DeleteUserKnowledgeBases :exec
+DELETE FROM knowledge_base
+WHERE owner = ?;
+
+-- name: DeleteUserConversations :exec
+DELETE FROM conversation
+WHERE owner = ?;
+
+-- name: DeleteUserApiKeys :exec
+DELETE FROM api_key
+WHERE user = ?;
+
+-- name: DeleteUserImpersonations :exec
+DELETE FROM impersonation
+WHERE user = sqlc.arg(user) OR actor = sqlc.arg(user);
+
+-- name: DeleteUserSessions :exec
+DELETE FROM session
+WHERE user = ?;
+
 
 -- EVENTS
 
@@ -108,20 +278,383 @@ RETURNING *;
 SELECT * FROM event
 WHERE id = ? LIMIT 1;
 
+-- name: ListEvents :many
+SELECT * FROM event
+WHERE (user = sqlc.arg(user) OR sqlc.arg(user) = '')
+  AND (event = sqlc.arg(event) OR sqlc.arg(event) = '')
+  AND timestamp >= sqlc.arg(since)
+ORDER BY id DESC
+LIMIT sqlc.arg(limit);
+
+-- name: UsageByAccount :many
+SELECT
+    a.id AS account_id,
+    a.name AS account_name,
+    COUNT(*) AS messages,
+    COUNT(DISTINCT e.user) AS active_users
+FROM event e
+         JOIN user u ON e.user = u.id
+         JOIN account a ON u.account = a.id
+WHERE e.event = 'message'
+  AND e.timestamp >= sqlc.arg(since)
+  AND e.timestamp < sqlc.arg(until)
+GROUP BY a.id
+ORDER BY messages DESC;
+
 
 -- FILES
 -- name: CreateFile :one
 INSERT INTO file (
-    id, name, owner
+    id, name, owner, hash, size, mimetype, conversation
 ) VALUES (
- ?, ?, ?
+ ?, ?, ?, ?, ?, ?, ?
  )
 RETURNING *;
 
--- name: GetFile :many
+-- name: GetFile :one
 SELECT * FROM file
 WHERE id = ? LIMIT 1;
 
+-- name: ListFiles :many
+SELECT * FROM file
+ORDER BY createdAt, id;
+
+-- name: ListUserFiles :many
+SELECT * FROM file
+WHERE owner = ?
+ORDER BY createdAt, id;
+
+-- name: ListFileAccounts :many
+SELECT f.id, u.account FROM file f
+JOIN user u ON u.id = f.owner
+ORDER BY f.id;
+
+-- name: AddFileTag :exec
+INSERT INTO file_tag (
+    file, tag
+) VALUES (
+    ?, ?
+)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteFileTags :exec
+DELETE FROM file_tag
+WHERE file = ?;
+
+-- name: DeleteFileSummaries :exec
+DELETE FROM file_summary
+WHERE file = ?;
+
+-- name: DeleteFileExtractionResults :exec
+DELETE FROM extraction_result
+WHERE file = ?;
+
+-- name: DeleteFileKnowledgeBaseFiles :exec
+DELETE FROM knowledge_base_file
+WHERE file = ?;
+
+-- name: DeleteFile :execrows
+DELETE FROM file
+WHERE id = sqlc.arg(id) AND owner = sqlc.arg(owner);
+
+-- name: ListConversationFiles :many
+SELECT * FROM file
+WHERE owner = ? AND conversation = ?
+ORDER BY createdAt, id;
+
+-- name: GetFileSummary :one
+SELECT * FROM file_summary
+WHERE file = ? AND version = ? LIMIT 1;
+
+-- name: SaveFileSummary :exec
+INSERT INTO file_summary (
+    file, version, summary
+) VALUES (
+    ?, ?, ?
+)
+ON CONFLICT (file, version) DO UPDATE
+SET summary = excluded.summary,
+    createdAt = datetime('now');
+
+-- name: ListFileTags :many
+SELECT tag FROM file_tag
+WHERE file = ?
+ORDER BY tag;
+
+-- name: ListAllFileTags :many
+SELECT * FROM file_tag
+ORDER BY file, tag;
+
+-- name: SetFileIndex :exec
+UPDATE file
+SET embeddingmodel = ?,
+    chunkerversion = ?,
+    updatedAt = datetime('now')
+WHERE id = ?;
+
 -- name: GetAccountById :one
 SELECT * FROM account
-WHERE id = ? LIMIT 1;
\ No newline at end of file
+WHERE id = ? LIMIT 1;
+
+-- API KEYS
+-- name: CreateApiKey :one
+INSERT INTO api_key (
+    id, user, name, prefix, hash, scopes, expiresAt
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?
+)
+RETURNING *;
+
+-- name: GetApiKeyByHash :one
+SELECT * FROM api_key
+WHERE hash = ? LIMIT 1;
+
+-- name: ListApiKeysByUser :many
+SELECT * FROM api_key
+WHERE user = ?
+ORDER BY createdAt DESC;
+
+-- name: RevokeApiKey :execrows
+UPDATE api_key
+SET revokedAt = sqlc.arg(revokedAt)
+WHERE id = sqlc.arg(id)
+  AND user = sqlc.arg(user)
+  AND revokedAt IS NULL;
+
+-- name: RevokeUserApiKeys :execrows
+UPDATE api_key
+SET revokedAt = sqlc.arg(revokedAt)
+WHERE user = sqlc.arg(user)
+  AND revokedAt IS NULL;
+
+-- name: TouchApiKey :exec
+UPDATE api_key
+SET lastUsedAt = sqlc.arg(lastUsedAt)
+WHERE id = sqlc.arg(id);
+
+
+-- SESSIONS
+-- name: CreateSession :one
+INSERT INTO session (
+    id, user, refreshHash, userAgent, ip, expiresAt
+) VALUES (
+    ?, ?, ?, ?, ?, ?
+)
+RETURNING *;
+
+-- name: GetSession :one
+SELECT * FROM session
+WHERE id = ? LIMIT 1;
+
+-- name: RotateSession :execrows
+UPDATE session
+SET refreshHash = sqlc.arg(newHash),
+    previousRefreshHash = refreshHash,
+    rotatedAt = sqlc.arg(rotatedAt),
+    expiresAt = sqlc.arg(expiresAt),
+    updatedAt = datetime('now')
+WHERE id = sqlc.arg(id)
+  AND refreshHash = sqlc.arg(currentHash)
+  AND revokedAt IS NULL;
+
+-- name: RevokeSession :exec
+UPDATE session
+SET revokedAt = sqlc.arg(revokedAt),
+    updatedAt = datetime('now')
+WHERE id = sqlc.arg(id)
+  AND revokedAt IS NULL;
+
+-- name: RevokeUserSessions :execrows
+UPDATE session
+SET revokedAt = sqlc.arg(revokedAt),
+    updatedAt = datetime('now')
+WHERE user = sqlc.arg(user)
+  AND revokedAt IS NULL;
+
+
+-- OIDC PROVIDERS
+-- name: GetOidcProvider :one
+SELECT * FROM oidc_provider
+WHERE id = ? LIMIT 1;
+
+-- name: ListOidcProvidersByAccount :many
+SELECT * FROM oidc_provider
+WHERE account = ?
+ORDER BY name;
+
+-- name: CreateOidcProvider :one
+INSERT INTO oidc_provider (
+    id, account, name, issuer, clientId, clientSecret, scopes
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?
+)
+RETURNING *;
+
+-- name: DeleteOidcProvider :exec
+DELETE FROM oidc_provider
+WHERE id = ?;
+
+
+-- IMPERSONATIONS
+-- name: CreateImpersonation :one
+INSERT INTO impersonation (
+    id, actor, user, session, reason, expiresAt
+) VALUES (
+    ?, ?, ?, ?, ?, ?
+)
+RETURNING *;
+
+-- name: GetImpersonation :one
+SELECT * FROM impersonation
+WHERE id = ? LIMIT 1;
+
+-- name: EndImpersonation :execrows
+UPDATE impersonation
+SET endedAt = sqlc.arg(endedAt)
+WHERE id = sqlc.arg(id)
+  AND endedAt IS NULL;
+
+
+-- KNOWLEDGE BASES
+-- name: CreateKnowledgeBase :one
+INSERT INTO knowledge_base (
+    id, name, description, account, owner
+) VALUES (
+    ?, ?, ?, ?, ?
+)
+RETURNING *;
+
+-- name: GetKnowledgeBase :one
+SELECT * FROM knowledge_base
+WHERE id = ? LIMIT 1;
+
+-- The account's knowledge bases and the user's own
+-- name: ListKnowledgeBases :many
+SELECT * FROM knowledge_base
+WHERE account = sqlc.arg(account) OR owner = sqlc.arg(user)
+ORDER BY name, id;
+
+-- name: UpdateKnowledgeBase :execrows
+UPDATE knowledge_base
+SET name = ?,
+    description = ?,
+    updatedAt = datetime('now')
+WHERE id = ?;
+
+-- name: DeleteKnowledgeBase :execrows
+DELETE FROM knowledge_base
+WHERE id = ?;
+
+-- name: AddKnowledgeBaseFile :exec
+INSERT INTO knowledge_base_file (
+    knowledgeBase, file
+) VALUES (
+    ?, ?
+)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveKnowledgeBaseFile :execrows
+DELETE FROM knowledge_base_file
+WHERE knowledgeBase = ? AND file = ?;
+
+-- name: DeleteKnowledgeBaseFiles :exec
+DELETE FROM knowledge_base_file
+WHERE knowledgeBase = ?;
+
+-- name: ListKnowledgeBaseFiles :many
+SELECT f.* FROM file f
+JOIN knowledge_base_file kbf ON kbf.file = f.id
+WHERE kbf.knowledgeBase = ?
+ORDER BY f.name, f.id;
+
+-- name: ListKnowledgeBaseMemberships :many
+SELECT * FROM knowledge_base_file
+ORDER BY knowledgeBase, file;
+
+-- name: AttachKnowledgeBase :exec
+INSERT INTO conversation_knowledge_base (
+    conversation, knowledgeBase, user
+) VALUES (
+    ?, ?, ?
+)
+ON CONFLICT DO NOTHING;
+
+-- name: DetachKnowledgeBase :execrows
+DELETE FROM conversation_knowledge_base
+WHERE conversation = ? AND knowledgeBase = ? AND user = ?;
+
+-- name: DeleteKnowledgeBaseConversations :exec
+DELETE FROM conversation_knowledge_base
+WHERE knowledgeBase = ?;
+
+-- name: ListConversationKnowledgeBases :many
+SELECT kb.* FROM knowledge_base kb
+JOIN conversation_knowledge_base ckb ON ckb.knowledgeBase = kb.id
+WHERE ckb.conversation = sqlc.arg(conversation) AND ckb.user = sqlc.arg(user)
+ORDER BY kb.name, kb.id;
+
+
+-- CONVERSATIONS
+
+-- name: ClaimConversation :exec
+INSERT INTO conversation (
+    id, owner
+) VALUES (
+    ?, ?
+)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: GetConversation :one
+SELECT * FROM conversation
+WHERE id = ? LIMIT 1;
+
+-- name: DeleteConversation :execrows
+DELETE FROM conversation
+WHERE id = ? AND owner = ?;
+
+-- name: ListConversationIDs :many
+SELECT id FROM conversation
+ORDER BY id;
+
+-- name: DetachConversationKnowledgeBases :exec
+DELETE FROM conversation_knowledge_base
+WHERE conversation = ? AND user = ?;
+
+
+-- EXTRACTIONS
+
+-- name: CreateExtraction :one
+INSERT INTO extraction (
+    id, owner, name, fields
+) VALUES (
+    ?, ?, ?, ?
+)
+RETURNING *;
+
+-- name: GetExtraction :one
+SELECT * FROM extraction
+WHERE id = ? LIMIT 1;
+
+-- name: ListExtractions :many
+SELECT * FROM extraction
+WHERE owner = ?
+ORDER BY createdAt DESC, id;
+
+-- name: AddExtractionResult :exec
+INSERT INTO extraction_result (
+    extraction, file
+) VALUES (
+    ?, ?
+)
+ON CONFLICT DO NOTHING;
+
+-- name: SaveExtractionResult :exec
+UPDATE extraction_result
+SET status = ?, data = ?, error = ?, updatedAt = datetime('now')
+WHERE extraction = ? AND file = ?;
+
+-- name: ListExtractionResults :many
+SELECT r.*, f.name AS fileName FROM extraction_result r
+JOIN file f ON f.id = r.file
+WHERE r.extraction = ?
+ORDER BY r.createdAt, f.name, r.file;
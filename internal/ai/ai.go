@@ -3,21 +3,35 @@ package ai
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"gochat/internal/services"
 	"io"
 	"net/http"
+	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/sashabaranov/go-openai"
 )
 
+// ChatModel answers the chat and the helper prompts of RAG
+const ChatModel = "gemma3:27b-it-q8_0"
+
+// baseURL is the OpenAI compatible API of the models, LLM_BASE_URL points it at another one
+func baseURL() string {
+	if url := os.Getenv("LLM_BASE_URL"); url != "" {
+		return url
+	}
+	return "http://5.22.250.243:11434/v1"
+}
+
 func initClient() (*openai.Client, error) {
 	config := openai.ClientConfig{
-		BaseURL: "http://5.22.250.243:11434/v1",
+		BaseURL: baseURL(),
 		HTTPClient: &http.Client{
 			Timeout: time.Second * 30,
 		},
@@ -29,7 +43,7 @@ func initClient() (*openai.Client, error) {
 
 type Attachment struct {
 	ID     string `json:"id"`
-	Type   string `json:"type"` // e.g., "image", "pdf"
+	Type   string `json:"type"` // MIME type, e.g. "image/png", "application/pdf"
 	Name   string `json:"name"`
 	Binary []byte `json:"binary"`
 }
@@ -67,10 +81,11 @@ func (m IncomingMessage) ToOpenAIMessage() openai.ChatCompletionMessage {
 	// Process attachments
 	for _, att := range m.Attachments {
 		fmt.Printf("Processing attachment: %s, Type: %s\n", att.Name, att.Type)
-		switch att.Type {
-		case "image/png", "image/jpeg", "image/gif":
+		// Images were prepared when they were received, their type is the one detected
+		switch {
+		case IsImage(att.Type):
 			base64Data := encodeToBase64(att.Binary)
-			imageURL := fmt.Sprintf("data:image/jpeg;base64,%s", base64Data)
+			imageURL := fmt.Sprintf("data:%s;base64,%s", att.Type, base64Data)
 
 			multiContent = append(multiContent, openai.ChatMessagePart{
 				Type: openai.ChatMessagePartTypeImageURL,
@@ -87,12 +102,7 @@ func (m IncomingMessage) ToOpenAIMessage() openai.ChatCompletionMessage {
 
 
 // GetCompletionStream handles streaming completions with empty message handling
-func GetCompletionStream(ctx *gin.Context, threadID string, messages []openai.ChatCompletionMessage, openaiRequest openai.ChatCompletionRequest, manager *services.ClientManager) error {
-	client, err := initClient()
-	if err != nil {
-		return fmt.Errorf("failed to initialize client: %w", err)
-	}
-
+func GetCompletionStream(ctx *gin.Context, threadID string, messages []openai.ChatCompletionMessage, openaiRequest openai.ChatCompletionRequest, tools *ToolRegistry, manager *services.ClientManager) error {
 	accountName, exists := ctx.Get("account_name")
 
 	if !exists {
@@ -101,46 +111,118 @@ func GetCompletionStream(ctx *gin.Context, threadID string, messages []openai.Ch
 	}
 	workingMessages := generateMessages(messages, accountName.(string) )
 	openaiRequest.Messages = workingMessages
+	_, err := StreamCompletion(ctx, threadID, openaiRequest, tools, manager)
+	return err
+}
+
+// StreamCompletion streams the answer to the request as message events of the thread and ends with
+// isDone, it returns the whole answer. The messages are sent as they are, without the persona. When
+// the model calls tools they are run, announced with tool_call and tool_result events, and their
+// results are sent back to the model for the next part of the answer.
+func StreamCompletion(ctx context.Context, threadID string, openaiRequest openai.ChatCompletionRequest, tools *ToolRegistry, manager *services.ClientManager) (string, error) {
+	client, err := initClient()
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize client: %w", err)
+	}
+	// The caller's messages are not appended to
+	openaiRequest.Messages = slices.Clip(openaiRequest.Messages)
+
+	var answer strings.Builder
+	for round := 0; ; round++ {
+		// The last round has no tools, so the model has to answer
+		openaiRequest.Tools = nil
+		if round < maxToolRounds {
+			openaiRequest.Tools = tools.Definitions()
+		}
+		content, calls, err := streamRound(ctx, client, threadID, openaiRequest, manager)
+		answer.WriteString(content)
+		if err != nil {
+			return answer.String(), err
+		}
+		if len(calls) == 0 {
+			// Send a completion message with finished flag
+			finishedMsg := `{"content":"","isDone":true}`
+			manager.SendRawEventToConversation(threadID, "message", finishedMsg)
+			return answer.String(), nil
+		}
+
+		for i := range calls {
+			if calls[i].ID == "" {
+				calls[i].ID = fmt.Sprintf("call_%d_%d", round, i)
+			}
+		}
+		openaiRequest.Messages = append(openaiRequest.Messages, openai.ChatCompletionMessage{
+			Role:      openai.ChatMessageRoleAssistant,
+			Content:   content,
+			ToolCalls: calls,
+		})
+		for _, call := range calls {
+			event := ToolEvent{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments}
+			sendToolEvent(threadID, "tool_call", event, manager)
+			event.Arguments = ""
+			result, err := tools.Call(ctx, call)
+			if err != nil {
+				fmt.Printf("tool %s failed: %s\n", call.Function.Name, err)
+				event.Error = err.Error()
+				result = "error: " + err.Error()
+			} else {
+				event.Result = result
+			}
+			sendToolEvent(threadID, "tool_result", event, manager)
+			openaiRequest.Messages = append(openaiRequest.Messages, openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    result,
+				ToolCallID: call.ID,
+			})
+		}
+	}
+}
 
+// streamRound streams one answer of the model, it returns the content and the tools it called
+func streamRound(ctx context.Context, client *openai.Client, threadID string, openaiRequest openai.ChatCompletionRequest, manager *services.ClientManager) (string, []openai.ToolCall, error) {
 	stream, err := client.CreateChatCompletionStream(
 		context.Background(),
 		openaiRequest,
 	)
 	if err != nil {
 		fmt.Printf("error creating stream: %v\n", err)
-		return fmt.Errorf("failed to create chat completion stream: %w", err)
+		return "", nil, fmt.Errorf("failed to create chat completion stream: %w", err)
 	}
 	defer stream.Close()
 
 	// Process streaming responses
+	var content strings.Builder
+	var calls []openai.ToolCall
 	for {
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("stream canceled: %w", ctx.Err())
+			return content.String(), nil, fmt.Errorf("stream canceled: %w", ctx.Err())
 		default:
 			response, err := stream.Recv()
 
 			if errors.Is(err, io.EOF) {
 				fmt.Println("stream closed", err)
-				// Send a completion message with finished flag
-				finishedMsg := `{"content":"","isDone":true}`
-				manager.SendRawEventToConversation(threadID, "message", finishedMsg)
 				// Stream finished naturally
-				return nil
+				return content.String(), calls, nil
 			}
 
 			if err != nil && !errors.Is(err, openai.ErrTooManyEmptyStreamMessages) {
-				return fmt.Errorf("error receiving from stream: %w", err)
+				return content.String(), nil, fmt.Errorf("error receiving from stream: %w", err)
+			}
+			if len(response.Choices) == 0 {
+				continue
+			}
+			// Tool calls come in parts
+			calls, err = accumulateToolCalls(calls, response.Choices[0].Delta.ToolCalls)
+			if err != nil {
+				return content.String(), nil, err
 			}
 
 			// Process content if available
-			if len(response.Choices) > 0 && response.Choices[0].Delta.Content != "" {
-				content := response.Choices[0].Delta.Content
-				//if content == "..." {
-				//	return nil
-				//}
+			if delta := response.Choices[0].Delta.Content; delta != "" {
+				content.WriteString(delta)
 				// Format as JSON with content and finished flag
-				jsonMsg := fmt.Sprintf(`{"content":%q,"isDone":false}`, content)
+				jsonMsg := fmt.Sprintf(`{"content":%q,"isDone":false}`, delta)
 				manager.SendRawEventToConversation(threadID, "message", jsonMsg)
 			}
 		}
@@ -223,6 +305,11 @@ func generateMessages(messages []openai.ChatCompletionMessage, accountName strin
 }
 
 func GetCompletion(messages []openai.ChatCompletionMessage) (string, error) {
+	return GetCompletionWithModel(ChatModel, messages)
+}
+
+// GetCompletionWithModel is GetCompletion with another model, e.g. a small one for classifying
+func GetCompletionWithModel(model string, messages []openai.ChatCompletionMessage) (string, error) {
 	client, err := initClient()
 	if err != nil {
 		return "", err
@@ -231,7 +318,7 @@ func GetCompletion(messages []openai.ChatCompletionMessage) (string, error) {
 	resp, err := client.CreateChatCompletion(
 		context.Background(),
 		openai.ChatCompletionRequest{
-			Model:    "gemma3:27b-it-q8_0",
+			Model:    model,
 			Messages: messages,
 		},
 	)
@@ -251,13 +338,45 @@ func GetCompletion(messages []openai.ChatCompletionMessage) (string, error) {
 	content := resp.Choices[0].Message.Content
 	return content, nil
 }
+
+// GetJSONCompletion answers with a JSON object that follows the JSON schema, for models that support
+// structured outputs
+func GetJSONCompletion(model string, messages []openai.ChatCompletionMessage, name string, schema json.RawMessage) (string, error) {
+	client, err := initClient()
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.CreateChatCompletion(
+		context.Background(),
+		openai.ChatCompletionRequest{
+			Model:    model,
+			Messages: messages,
+			ResponseFormat: &openai.ChatCompletionResponseFormat{
+				Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+				JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+					Name:   name,
+					Schema: schema,
+					Strict: true,
+				},
+			},
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("MISSING CHOICES")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
 func SingleQueryStream(ctx *gin.Context, threadID string, query string, openaiRequest openai.ChatCompletionRequest, manager *services.ClientManager) error {
 	err := GetCompletionStream(ctx, threadID, []openai.ChatCompletionMessage{
 		{
 			Role:    "user",
 			Content: query,
 		},
-	}, openaiRequest, manager)
+	}, openaiRequest, nil, manager)
 	if err != nil {
 		fmt.Printf("Failed to get completion stream for singleQuery: %v\n", err)
 		return err
@@ -277,7 +396,8 @@ func SingleQuery(query string) (string, error) {
 	return completion, nil
 }
 
-func GetEmbeddings(ctx context.Context, texts []string) ([]openai.Embedding, error) {
+// GetEmbeddings embeds texts with model, which has to be the model of the collection they are compared against
+func GetEmbeddings(ctx context.Context, model string, texts []string) ([]openai.Embedding, error) {
 	client, err := initClient()
 	if err != nil {
 		return nil, err
@@ -285,7 +405,7 @@ func GetEmbeddings(ctx context.Context, texts []string) ([]openai.Embedding, err
 
 	request := openai.EmbeddingRequest{
 		Input: texts,
-		Model: "mxbai-embed-large",
+		Model: openai.EmbeddingModel(model),
 	}
 
 	response, err := client.CreateEmbeddings(ctx, request)
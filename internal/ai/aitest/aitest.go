@@ -0,0 +1,306 @@
+// Package aitest runs an OpenAI compatible API in process, so code that calls the models can be
+// run without the Ollama host. Answers can be scripted, streamed, delayed or made to fail.
+package aitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultDim is the length of the embeddings when Server.Dim is not set
+const DefaultDim = 256
+
+// Reply is a scripted answer to one request
+type Reply struct {
+	// Content is the answer, or the error message when Status is set
+	Content string
+	// Status fails the request with this HTTP status
+	Status int
+	// Delay is waited before answering, a streamed answer waits before every chunk
+	Delay time.Duration
+	// ToolCalls are asked for after the content, a streamed call sends its arguments in two parts
+	ToolCalls []openai.ToolCall
+}
+
+// Server answers /v1/embeddings and /v1/chat/completions. Embeddings are hashed words, so texts
+// that share words are similar.
+type Server struct {
+	*httptest.Server
+	// Dim is the length of the embeddings
+	Dim int
+	// Complete answers chat completions that have no scripted reply, without it the last message
+	// is echoed
+	Complete func(request openai.ChatCompletionRequest) string
+
+	mu                sync.Mutex
+	replies           []Reply
+	embeddingReplies  []Reply
+	requests          []openai.ChatCompletionRequest
+	embeddingRequests int
+}
+
+// NewServer starts a server, close it when done
+func NewServer() *Server {
+	s := &Server{Dim: DefaultDim}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/embeddings", s.embeddings)
+	mux.HandleFunc("/v1/chat/completions", s.completions)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// BaseURL is what LLM_BASE_URL is set to
+func (s *Server) BaseURL() string {
+	return s.URL + "/v1"
+}
+
+// Script queues replies for the next chat completions, one reply per request
+func (s *Server) Script(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, replies...)
+}
+
+// ScriptEmbeddings queues replies for the next embedding requests, only Status and Delay are used
+func (s *Server) ScriptEmbeddings(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.embeddingReplies = append(s.embeddingReplies, replies...)
+}
+
+// Requests returns the chat completion requests received so far
+func (s *Server) Requests() []openai.ChatCompletionRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]openai.ChatCompletionRequest{}, s.requests...)
+}
+
+// EmbeddingRequests is how many embedding requests were received so far
+func (s *Server) EmbeddingRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.embeddingRequests
+}
+
+// next takes the first scripted reply of queue
+func next(queue *[]Reply) (Reply, bool) {
+	if len(*queue) == 0 {
+		return Reply{}, false
+	}
+	reply := (*queue)[0]
+	*queue = (*queue)[1:]
+	return reply, true
+}
+
+// Embed makes the embedding of text, the same text always gets the same one
+func Embed(text string, dim int) []float32 {
+	embedding := make([]float32, dim)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := map[string]bool{}
+	for _, word := range words {
+		// Repeated words and short ones like "de" or "of" would make every text look alike
+		if seen[word] || len([]rune(word)) < 3 {
+			continue
+		}
+		seen[word] = true
+		hash := fnv.New32a()
+		hash.Write([]byte(word))
+		embedding[hash.Sum32()%uint32(dim)]++
+	}
+
+	var norm float64
+	for _, value := range embedding {
+		norm += float64(value * value)
+	}
+	if norm == 0 {
+		// Cosine similarity is undefined for a zero vector
+		embedding[0] = 1
+		return embedding
+	}
+	for i := range embedding {
+		embedding[i] /= float32(math.Sqrt(norm))
+	}
+	return embedding
+}
+
+func (s *Server) embeddings(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Input []string `json:"input"`
+		Model string   `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.embeddingRequests++
+	reply, _ := next(&s.embeddingReplies)
+	s.mu.Unlock()
+	time.Sleep(reply.Delay)
+	if reply.Status != 0 {
+		writeError(w, reply.Status, reply.Content)
+		return
+	}
+
+	response := openai.EmbeddingResponse{Object: "list", Model: openai.EmbeddingModel(request.Model)}
+	for i, input := range request.Input {
+		response.Data = append(response.Data, openai.Embedding{
+			Object:    "embedding",
+			Embedding: Embed(input, s.Dim),
+			Index:     i,
+		})
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) completions(w http.ResponseWriter, r *http.Request) {
+	// go-openai only encodes the schema of a response format, it is decoded as raw JSON
+	var body struct {
+		openai.ChatCompletionRequest
+		ResponseFormat *struct {
+			Type       openai.ChatCompletionResponseFormatType `json:"type"`
+			JSONSchema *struct {
+				Name   string          `json:"name"`
+				Schema json.RawMessage `json:"schema"`
+				Strict bool            `json:"strict"`
+			} `json:"json_schema"`
+		} `json:"response_format"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	request := body.ChatCompletionRequest
+	if format := body.ResponseFormat; format != nil {
+		request.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: format.Type}
+		if format.JSONSchema != nil {
+			request.ResponseFormat.JSONSchema = &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   format.JSONSchema.Name,
+				Schema: format.JSONSchema.Schema,
+				Strict: format.JSONSchema.Strict,
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	reply, scripted := next(&s.replies)
+	s.mu.Unlock()
+	if !scripted {
+		if s.Complete != nil {
+			reply.Content = s.Complete(request)
+		} else if len(request.Messages) > 0 {
+			reply.Content = Text(request.Messages[len(request.Messages)-1])
+		}
+	}
+	if reply.Status != 0 {
+		time.Sleep(reply.Delay)
+		writeError(w, reply.Status, reply.Content)
+		return
+	}
+	if request.Stream {
+		stream(w, request.Model, reply)
+		return
+	}
+
+	time.Sleep(reply.Delay)
+	content := reply.Content
+	json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		Object: "chat.completion",
+		Model:  request.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content, ToolCalls: reply.ToolCalls},
+			FinishReason: finishReason(reply),
+		}},
+	})
+}
+
+func finishReason(reply Reply) openai.FinishReason {
+	if len(reply.ToolCalls) > 0 {
+		return openai.FinishReasonToolCalls
+	}
+	return openai.FinishReasonStop
+}
+
+// stream sends the reply a word at a time the way the chat completions API streams
+func stream(w http.ResponseWriter, model string, reply Reply) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+	send := func(delta openai.ChatCompletionStreamChoiceDelta, finish openai.FinishReason) {
+		delta.Role = openai.ChatMessageRoleAssistant
+		data, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+			Object: "chat.completion.chunk",
+			Model:  model,
+			Choices: []openai.ChatCompletionStreamChoice{{
+				Delta:        delta,
+				FinishReason: finish,
+			}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	for _, word := range strings.SplitAfter(reply.Content, " ") {
+		if word == "" {
+			continue
+		}
+		time.Sleep(reply.Delay)
+		send(openai.ChatCompletionStreamChoiceDelta{Content: word}, "")
+	}
+	// The first part of a call has its id and name, the parts after only add to the arguments
+	for i, call := range reply.ToolCalls {
+		index := i
+		half := len(call.Function.Arguments) / 2
+		for half > 0 && !utf8.RuneStart(call.Function.Arguments[half]) {
+			half--
+		}
+		first, rest := call, openai.ToolCall{Index: &index}
+		first.Index = &index
+		first.Function.Arguments, rest.Function.Arguments = call.Function.Arguments[:half], call.Function.Arguments[half:]
+		time.Sleep(reply.Delay)
+		send(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{first}}, "")
+		send(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{rest}}, "")
+	}
+	send(openai.ChatCompletionStreamChoiceDelta{}, finishReason(reply))
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// Text is the text of a message, whether it was sent as content or as parts
+func Text(message openai.ChatCompletionMessage) string {
+	if len(message.MultiContent) == 0 {
+		return message.Content
+	}
+	var parts []string
+	for _, part := range message.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeText {
+			parts = append(parts, part.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"message": message, "type": "invalid_request_error"},
+	})
+}
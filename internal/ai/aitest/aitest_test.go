@@ -0,0 +1,100 @@
+package aitest_test
+
+import (
+	"context"
+	"errors"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"gochat/internal/ai"
+	"gochat/internal/ai/aitest"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestEmbeddings(t *testing.T) {
+	server := aitest.NewServer()
+	defer server.Close()
+	t.Setenv("LLM_BASE_URL", server.BaseURL())
+
+	embeddings, err := ai.GetEmbeddings(context.Background(), "bge-m3", []string{
+		"De ouders drinken minder alcohol",
+		"Drinken ouders minder alcohol?",
+		"Treinen rijden op tijd",
+	})
+	assert.NoError(t, err)
+	assert.Len(t, embeddings, 3)
+	assert.Len(t, embeddings[0].Embedding, aitest.DefaultDim)
+	assert.Equal(t, aitest.Embed("De ouders drinken minder alcohol", aitest.DefaultDim), embeddings[0].Embedding)
+	// Texts sharing words are closer than texts that don't
+	assert.Greater(t, dot(embeddings[0].Embedding, embeddings[1].Embedding), dot(embeddings[0].Embedding, embeddings[2].Embedding))
+
+	server.ScriptEmbeddings(aitest.Reply{Status: http.StatusServiceUnavailable, Content: "model is loading"})
+	_, err = ai.GetEmbeddings(context.Background(), "bge-m3", []string{"again"})
+	var apiErr *openai.APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.HTTPStatusCode)
+	assert.Equal(t, 2, server.EmbeddingRequests())
+}
+
+func TestCompletions(t *testing.T) {
+	server := aitest.NewServer()
+	defer server.Close()
+	t.Setenv("LLM_BASE_URL", server.BaseURL())
+
+	// Scripted replies go first, then the last message is echoed
+	server.Script(aitest.Reply{Content: "Hallo"}, aitest.Reply{Status: http.StatusInternalServerError, Content: "out of memory"})
+	answer, err := ai.SingleQuery("Wie ben je?")
+	assert.NoError(t, err)
+	assert.Equal(t, "Hallo", answer)
+	_, err = ai.SingleQuery("Wie ben je?")
+	assert.ErrorContains(t, err, "out of memory")
+	answer, err = ai.SingleQuery("Echo")
+	assert.NoError(t, err)
+	assert.Equal(t, "Echo", answer)
+
+	requests := server.Requests()
+	assert.Len(t, requests, 3)
+	assert.Equal(t, ai.ChatModel, requests[0].Model)
+}
+
+func TestStream(t *testing.T) {
+	server := aitest.NewServer()
+	defer server.Close()
+	config := openai.DefaultConfig("")
+	config.BaseURL = server.BaseURL()
+	client := openai.NewClientWithConfig(config)
+
+	server.Script(aitest.Reply{Content: "Ik ben AĿbert", Delay: 10 * time.Millisecond})
+	start := time.Now()
+	stream, err := client.CreateChatCompletionStream(context.Background(), openai.ChatCompletionRequest{
+		Model:    ai.ChatModel,
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "Wie ben je?"}},
+		Stream:   true,
+	})
+	assert.NoError(t, err)
+	defer stream.Close()
+
+	var chunks []string
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.NoError(t, err)
+		if content := response.Choices[0].Delta.Content; content != "" {
+			chunks = append(chunks, content)
+		}
+	}
+	assert.Equal(t, []string{"Ik ", "ben ", "AĿbert"}, chunks)
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+}
+
+func dot(a []float32, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
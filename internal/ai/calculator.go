@@ -0,0 +1,139 @@
+package ai
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Calculate evaluates an arithmetic expression with + - * / ^, unary minus, parentheses and decimal
+// numbers. ^ binds strongest and is right associative. A decimal comma is read as a point, * can
+// also be written × and / as :.
+func Calculate(expression string) (float64, error) {
+	p := &calculator{input: []rune(strings.ReplaceAll(expression, ",", "."))}
+	value, err := p.sum()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return 0, fmt.Errorf("unexpected %q at position %d", p.input[p.pos], p.pos+1)
+	}
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return 0, fmt.Errorf("the result is not a number")
+	}
+	return value, nil
+}
+
+type calculator struct {
+	input []rune
+	pos   int
+}
+
+func (p *calculator) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+// next returns the next operator or parenthesis without consuming it, 0 at the end
+func (p *calculator) next() rune {
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+func (p *calculator) sum() (float64, error) {
+	value, err := p.product()
+	for err == nil {
+		op := p.next()
+		if op != '+' && op != '-' {
+			break
+		}
+		p.pos++
+		var right float64
+		if right, err = p.product(); op == '+' {
+			value += right
+		} else {
+			value -= right
+		}
+	}
+	return value, err
+}
+
+func (p *calculator) product() (float64, error) {
+	value, err := p.unary()
+	for err == nil {
+		op := p.next()
+		if op != '*' && op != '/' && op != '×' && op != ':' {
+			break
+		}
+		p.pos++
+		var right float64
+		if right, err = p.unary(); err != nil {
+			break
+		}
+		if op == '*' || op == '×' {
+			value *= right
+		} else if right == 0 {
+			err = fmt.Errorf("division by zero")
+		} else {
+			value /= right
+		}
+	}
+	return value, err
+}
+
+// unary comes before ^, so -2^2 is -4 and 2^-1 is 0.5
+func (p *calculator) unary() (float64, error) {
+	switch p.next() {
+	case '-':
+		p.pos++
+		value, err := p.unary()
+		return -value, err
+	case '+':
+		p.pos++
+		return p.unary()
+	}
+	return p.power()
+}
+
+func (p *calculator) power() (float64, error) {
+	base, err := p.operand()
+	if err != nil || p.next() != '^' {
+		return base, err
+	}
+	p.pos++
+	exponent, err := p.unary()
+	return math.Pow(base, exponent), err
+}
+
+func (p *calculator) operand() (float64, error) {
+	switch r := p.next(); {
+	case r == '(':
+		p.pos++
+		value, err := p.sum()
+		if err != nil {
+			return 0, err
+		}
+		if p.next() != ')' {
+			return 0, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return value, nil
+	case r == '.' || unicode.IsDigit(r):
+		start := p.pos
+		for p.pos < len(p.input) && (p.input[p.pos] == '.' || unicode.IsDigit(p.input[p.pos])) {
+			p.pos++
+		}
+		return strconv.ParseFloat(string(p.input[start:p.pos]), 64)
+	case r == 0:
+		return 0, fmt.Errorf("unexpected end of expression")
+	default:
+		return 0, fmt.Errorf("unexpected %q at position %d", r, p.pos+1)
+	}
+}
@@ -0,0 +1,170 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strings"
+)
+
+const (
+	// maxImageSide is the longest side an image is sent at, vision models scale larger ones down
+	// themselves and it only costs tokens and upload time
+	maxImageSide = 1568
+	// maxImagePixels refuses images that would take gigabytes to decode
+	maxImagePixels = 50_000_000
+	// jpegQuality is used for photos, it's hard to tell from the original at this size
+	jpegQuality = 85
+)
+
+// ErrUnsupportedImage is returned for images that are not PNG, JPEG, GIF or WebP
+var ErrUnsupportedImage = errors.New("unsupported image format, use PNG, JPEG, GIF or WebP")
+
+// IsImage reports whether a MIME type is an image, whichever format
+func IsImage(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "image/")
+}
+
+// PrepareImage makes an image ready to send to the model. The type is detected from the content and
+// not taken from the upload, it is scaled down to maxImageSide and encoded again, which leaves the
+// EXIF data behind. Images with transparency become PNG, the rest JPEG.
+func PrepareImage(data []byte) (string, []byte, error) {
+	switch http.DetectContentType(data) {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+	default:
+		return "", nil, ErrUnsupportedImage
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid image: %w", err)
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return "", nil, fmt.Errorf("image of %dx%d is too large", config.Width, config.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid image: %w", err)
+	}
+
+	prepared := orient(resize(img, maxImageSide), exifOrientation(data))
+	var out bytes.Buffer
+	if !prepared.Opaque() {
+		err = png.Encode(&out, prepared)
+		return "image/png", out.Bytes(), err
+	}
+	err = jpeg.Encode(&out, prepared, &jpeg.Options{Quality: jpegQuality})
+	return "image/jpeg", out.Bytes(), err
+}
+
+// resize scales the image so its longest side is at most size, it always returns a copy
+func resize(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if longest := max(width, height); longest > size {
+		width, height = max(1, width*size/longest), max(1, height*size/longest)
+	}
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	if width == bounds.Dx() && height == bounds.Dy() {
+		draw.Draw(resized, resized.Bounds(), img, bounds.Min, draw.Src)
+	} else {
+		draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Src, nil)
+	}
+	return resized
+}
+
+// orient turns the pixels the way the EXIF orientation says the photo was taken, phones store it
+// rotated. Orientations 2 to 8 are the mirrors and rotations of the TIFF specification.
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	result := image.NewRGBA(image.Rect(0, 0, width, height))
+	if orientation >= 5 {
+		result = image.NewRGBA(image.Rect(0, 0, height, width))
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var tx, ty int
+			switch orientation {
+			case 2:
+				tx, ty = width-1-x, y
+			case 3:
+				tx, ty = width-1-x, height-1-y
+			case 4:
+				tx, ty = x, height-1-y
+			case 5:
+				tx, ty = y, x
+			case 6:
+				tx, ty = height-1-y, x
+			case 7:
+				tx, ty = height-1-y, width-1-x
+			case 8:
+				tx, ty = y, width-1-x
+			}
+			result.SetRGBA(tx, ty, img.RGBAAt(x, y))
+		}
+	}
+	return result
+}
+
+// exifOrientation reads the orientation tag of a JPEG, 1 when it has none
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	// Walk the segments up to the APP1 segment with the EXIF data
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// tiffOrientation finds tag 0x0112 in the first directory of the TIFF structure inside EXIF data
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 1
+}
@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// tinyWebP is a lossless 1x1 WebP
+const tinyWebP = "UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA=="
+
+func encodeJPEG(t *testing.T, width int, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width/2; x++ {
+		img.Set(x, 0, color.White)
+	}
+	var buffer bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buffer, img, nil))
+	return buffer.Bytes()
+}
+
+// withOrientation puts an EXIF segment with the orientation tag behind the start of a JPEG
+func withOrientation(data []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = append(tiff, 0, 3, 0, 0, 0, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := binary.BigEndian.AppendUint16([]byte{0xFF, 0xE1}, uint16(len(segment)+2))
+	result := append([]byte{}, data[:2]...)
+	result = append(result, app1...)
+	result = append(result, segment...)
+	return append(result, data[2:]...)
+}
+
+func TestPrepareImage(t *testing.T) {
+	// Photos are scaled down to the longest side and stay JPEG
+	mimeType, data, err := PrepareImage(encodeJPEG(t, 2000, 1500))
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", mimeType)
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, maxImageSide, config.Width)
+	assert.Equal(t, 1176, config.Height)
+
+	// The EXIF data is left behind, the photo is turned the way it was taken
+	photo := withOrientation(encodeJPEG(t, 40, 20), 6)
+	assert.Equal(t, 6, exifOrientation(photo))
+	_, data, err = PrepareImage(photo)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, exifOrientation(data))
+	assert.NotContains(t, string(data), "Exif")
+	config, _, err = image.DecodeConfig(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Point{20, 40}, image.Point{config.Width, config.Height})
+
+	// Transparency needs PNG, whatever the upload said it was
+	transparent := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	var buffer bytes.Buffer
+	assert.NoError(t, png.Encode(&buffer, transparent))
+	mimeType, _, err = PrepareImage(buffer.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", mimeType)
+
+	webp, _ := base64.StdEncoding.DecodeString(tinyWebP)
+	mimeType, data, err = PrepareImage(webp)
+	assert.NoError(t, err)
+	assert.Contains(t, []string{"image/png", "image/jpeg"}, mimeType)
+	assert.NotEmpty(t, data)
+
+	for _, unsupported := range [][]byte{[]byte("BM\x3a\x00\x00\x00"), []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), []byte("niet een plaatje")} {
+		_, _, err = PrepareImage(unsupported)
+		assert.ErrorIs(t, err, ErrUnsupportedImage)
+	}
+	_, _, err = PrepareImage([]byte("\x89PNG\r\n\x1a\nkapot"))
+	assert.ErrorContains(t, err, "invalid image")
+}
+
+func TestOrient(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.White)
+	for orientation, corner := range map[int]image.Point{1: {0, 0}, 2: {2, 0}, 3: {2, 1}, 4: {0, 1}, 5: {0, 0}, 6: {1, 0}, 7: {1, 2}, 8: {0, 2}} {
+		oriented := orient(img, orientation)
+		assert.Equal(t, color.RGBA{255, 255, 255, 255}, oriented.RGBAAt(corner.X, corner.Y), orientation)
+	}
+}
@@ -0,0 +1,204 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"gochat/internal/services"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxToolRounds is how often the model may call tools for one answer, the round after that
+	// it has to answer without them
+	maxToolRounds = 5
+	// defaultToolTimeout is used for tools that don't set one
+	defaultToolTimeout = 10 * time.Second
+	// maxToolResult is how many characters of a tool's result go back to the model
+	maxToolResult = 8000
+)
+
+// ToolsEnabled reports whether the chat offers tools, set LLM_TOOLS for models that support them
+func ToolsEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("LLM_TOOLS"))
+	return enabled
+}
+
+// Tool is a Go function the model can call. Parameters is the JSON schema of the arguments, Run
+// gets them as the JSON the model wrote.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+	Timeout     time.Duration
+	Run         func(ctx context.Context, arguments string) (string, error)
+}
+
+// ToolRegistry holds the tools offered to the model in one conversation
+type ToolRegistry struct {
+	tools []Tool
+}
+
+func NewToolRegistry(tools ...Tool) *ToolRegistry {
+	return &ToolRegistry{tools: tools}
+}
+
+// Add offers more tools, to a registry made before what the conversation needs was known
+func (r *ToolRegistry) Add(tools ...Tool) {
+	r.tools = append(r.tools, tools...)
+}
+
+// Definitions are the tools as they are sent with a request
+func (r *ToolRegistry) Definitions() []openai.Tool {
+	if r == nil {
+		return nil
+	}
+	definitions := make([]openai.Tool, 0, len(r.tools))
+	for _, tool := range r.tools {
+		definitions = append(definitions, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return definitions
+}
+
+// Call runs the tool the model asked for with its timeout and returns what goes back to the model.
+// Long results are cut off.
+func (r *ToolRegistry) Call(ctx context.Context, call openai.ToolCall) (string, error) {
+	var tool *Tool
+	for i := 0; r != nil && i < len(r.tools); i++ {
+		if r.tools[i].Name == call.Function.Name {
+			tool = &r.tools[i]
+		}
+	}
+	if tool == nil {
+		return "", fmt.Errorf("unknown tool %q", call.Function.Name)
+	}
+	timeout := tool.Timeout
+	if timeout == 0 {
+		timeout = defaultToolTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// A tool that ignores its context is abandoned at the timeout
+	type outcome struct {
+		result string
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := tool.Run(ctx, call.Function.Arguments)
+		done <- outcome{result, err}
+	}()
+	select {
+	case o := <-done:
+		if o.err != nil {
+			return "", o.err
+		}
+		if runes := []rune(o.result); len(runes) > maxToolResult {
+			o.result = string(runes[:maxToolResult]) + "\n(truncated)"
+		}
+		return o.result, nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("%s did not finish in %s", tool.Name, timeout)
+	}
+}
+
+// ToolEvent is sent as a tool_call event before a tool runs and as a tool_result event after it
+type ToolEvent struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments,omitempty"`
+	Result    string `json:"result,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func sendToolEvent(threadID string, eventType string, event ToolEvent, manager *services.ClientManager) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		fmt.Println("Error encoding tool event: " + err.Error())
+		return
+	}
+	manager.SendRawEventToConversation(threadID, eventType, string(data))
+}
+
+// accumulateToolCalls adds the parts of tool calls streamed in a delta to the calls so far. A call
+// starts with its id and name, later parts with the same index add to the arguments. An index can
+// only point at a call so far or the next one, anything else ends the round with an error.
+func accumulateToolCalls(calls []openai.ToolCall, deltas []openai.ToolCall) ([]openai.ToolCall, error) {
+	for _, delta := range deltas {
+		index := len(calls)
+		if delta.Index != nil {
+			index = *delta.Index
+		}
+		if index < 0 || index > len(calls) {
+			return calls, fmt.Errorf("tool call index %d out of range, %d calls so far", index, len(calls))
+		}
+		if index == len(calls) {
+			calls = append(calls, openai.ToolCall{Index: &index, Type: openai.ToolTypeFunction})
+		}
+		call := &calls[index]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Type != "" {
+			call.Type = delta.Type
+		}
+		call.Function.Name += delta.Function.Name
+		call.Function.Arguments += delta.Function.Arguments
+	}
+	return calls, nil
+}
+
+// DateTool tells the model the current date and time, which it otherwise guesses from its training
+func DateTool(now func() time.Time) Tool {
+	return Tool{
+		Name:        "current_date",
+		Description: "Returns the current date, time and weekday in the Netherlands.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{}}`),
+		Run: func(ctx context.Context, arguments string) (string, error) {
+			t := now()
+			if location, err := time.LoadLocation("Europe/Amsterdam"); err == nil {
+				t = t.In(location)
+			}
+			data, err := json.Marshal(map[string]string{
+				"date":    t.Format(time.DateOnly),
+				"time":    t.Format("15:04"),
+				"weekday": t.Weekday().String(),
+				"zone":    t.Format("MST"),
+			})
+			return string(data), err
+		},
+	}
+}
+
+// CalculatorTool evaluates arithmetic, models are bad at it
+func CalculatorTool() Tool {
+	return Tool{
+		Name:        "calculator",
+		Description: "Evaluates an arithmetic expression with + - * / ^, parentheses and decimal numbers, for example (352 - 120) / 352 * 100.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"expression":{"type":"string","description":"the expression to evaluate"}},"required":["expression"]}`),
+		Run: func(ctx context.Context, arguments string) (string, error) {
+			var args struct {
+				Expression string `json:"expression"`
+			}
+			if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+				return "", fmt.Errorf("invalid arguments: %w", err)
+			}
+			value, err := Calculate(args.Expression)
+			if err != nil {
+				return "", err
+			}
+			return strconv.FormatFloat(value, 'g', 12, 64), nil
+		},
+	}
+}
@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalculate(t *testing.T) {
+	for expression, expected := range map[string]float64{
+		"1 + 2 * 3":         7,
+		"(352 - 120) / 352": 232.0 / 352,
+		"2 ^ 3 ^ 2":         512,
+		"-2^2":              -4,
+		"2^-1":              0.5,
+		"- (3 - 5) * 1,5":   3,
+		"45 × 2 : 3":        30,
+		".5 + 0.25":         0.75,
+	} {
+		value, err := Calculate(expression)
+		assert.NoError(t, err, expression)
+		assert.InDelta(t, expected, value, 1e-9, expression)
+	}
+	for _, expression := range []string{"", "1 +", "(1 + 2", "1 / 0", "2 x 3", "1 2", "1.2.3"} {
+		_, err := Calculate(expression)
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestAccumulateToolCalls(t *testing.T) {
+	zero, one := 0, 1
+	calls, err := accumulateToolCalls(nil, []openai.ToolCall{{Index: &zero, ID: "call_1", Function: openai.FunctionCall{Name: "calculator", Arguments: `{"expre`}}})
+	assert.NoError(t, err)
+	calls, err = accumulateToolCalls(calls, []openai.ToolCall{
+		{Index: &zero, Function: openai.FunctionCall{Arguments: `ssion":"1+1"}`}},
+		{Index: &one, ID: "call_2", Function: openai.FunctionCall{Name: "current_date", Arguments: `{}`}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, calls, 2)
+	assert.Equal(t, "call_1", calls[0].ID)
+	assert.Equal(t, `{"expression":"1+1"}`, calls[0].Function.Arguments)
+	assert.Equal(t, "current_date", calls[1].Function.Name)
+	assert.Equal(t, openai.ToolTypeFunction, calls[1].Type)
+
+	// A model can't make the calls grow without limit or point before the first one
+	for _, index := range []int{-1, 3, 1 << 30} {
+		_, err = accumulateToolCalls(calls, []openai.ToolCall{{Index: &index, Function: openai.FunctionCall{Arguments: "{}"}}})
+		assert.Error(t, err, index)
+	}
+}
+
+func TestToolRegistry(t *testing.T) {
+	slow := Tool{Name: "slow", Timeout: 20 * time.Millisecond, Run: func(ctx context.Context, arguments string) (string, error) {
+		time.Sleep(time.Second)
+		return "too late", nil
+	}}
+	long := Tool{Name: "long", Run: func(ctx context.Context, arguments string) (string, error) {
+		return strings.Repeat("a", maxToolResult+10), nil
+	}}
+	date := DateTool(func() time.Time { return time.Date(2025, 3, 14, 8, 30, 0, 0, time.UTC) })
+	registry := NewToolRegistry(CalculatorTool(), date, slow, long)
+	assert.Len(t, registry.Definitions(), 4)
+	assert.Nil(t, (*ToolRegistry)(nil).Definitions())
+
+	call := func(name string, arguments string) (string, error) {
+		return registry.Call(context.Background(), openai.ToolCall{Function: openai.FunctionCall{Name: name, Arguments: arguments}})
+	}
+	result, err := call("calculator", `{"expression": "(352 - 120) / 352 * 100"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "65.9090909091", result)
+	_, err = call("calculator", `{"expression": "1 / 0"}`)
+	assert.ErrorContains(t, err, "division by zero")
+
+	result, err = call("current_date", `{}`)
+	assert.NoError(t, err)
+	var now map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(result), &now))
+	assert.Equal(t, "2025-03-14", now["date"])
+	assert.Equal(t, "Friday", now["weekday"])
+
+	start := time.Now()
+	_, err = call("slow", `{}`)
+	assert.ErrorContains(t, err, "did not finish in 20ms")
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	result, err = call("long", `{}`)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(result, "(truncated)"))
+	_, err = call("rm", `{}`)
+	assert.ErrorContains(t, err, "unknown tool")
+}
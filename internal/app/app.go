@@ -0,0 +1,53 @@
+package app
+
+import (
+	"github.com/gin-gonic/gin"
+	"gochat/internal/rag"
+	"gochat/internal/services"
+	"gochat/internal/store"
+)
+
+// App holds what lives as long as the process: the stores and the services built on them.
+// It is created once in run.Run and handed to the routes, handlers and middleware that need it.
+type App struct {
+	Store store.Store
+	Blobs store.BlobStore
+
+	Accounts       *services.AccountService
+	Users          *services.UserService
+	Sessions       *services.SessionService
+	APIKeys        *services.APIKeyService
+	Impersonations *services.ImpersonationService
+	OIDCProviders  *services.OIDCProviderService
+	Reports        *services.ReportService
+	KnowledgeBases *services.KnowledgeBaseService
+	Conversations  *services.ConversationService
+	Extractions    *services.ExtractionService
+}
+
+func New(s store.Store, blobs store.BlobStore) *App {
+	return &App{
+		Store:          s,
+		Blobs:          blobs,
+		Accounts:       services.NewAccountService(s).WithBlobs(blobs).WithVectorCleanup(rag.RemoveFiles),
+		Users:          services.NewUserService(s).WithBlobs(blobs).WithVectorCleanup(rag.RemoveFiles),
+		Sessions:       services.NewSessionService(s),
+		APIKeys:        services.NewAPIKeyService(s),
+		Impersonations: services.NewImpersonationService(s),
+		OIDCProviders:  services.NewOIDCProviderService(s),
+		Reports:        services.NewReportService(s),
+		KnowledgeBases: services.NewKnowledgeBaseService(s),
+		Conversations:  services.NewConversationService(s),
+		Extractions:    services.NewExtractionService(s),
+	}
+}
+
+// Events returns an event service that logs on behalf of the user
+func (a *App) Events(userID string) *services.EventService {
+	return services.NewEventService(a.Store, userID)
+}
+
+// Files returns a file service for the user of the request
+func (a *App) Files(c *gin.Context) (*services.FileService, error) {
+	return services.NewFileService(a.Store, a.Blobs, c)
+}
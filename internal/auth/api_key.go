@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gochat/internal/app"
+	"gochat/internal/services"
+	"net/http"
+	"strings"
+)
+
+// APIKeyMiddleware authenticates programmatic requests with an `Authorization: Bearer <key>` header.
+// Unlike JWTMiddleware it never redirects, failures are answered with JSON
+func APIKeyMiddleware(a *app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		token, found := strings.CutPrefix(header, "Bearer ")
+		if !found || token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Missing or malformed Authorization header",
+			})
+			return
+		}
+
+		key, userID, err := a.APIKeys.Authenticate(c, token)
+		if err != nil {
+			if errors.Is(err, services.ErrAPIKeyInvalid) || errors.Is(err, services.ErrAPIKeyExpired) || errors.Is(err, services.ErrAPIKeyRevoked) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			fmt.Printf("api key validation error: %v\n", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "Could not verify api key",
+			})
+			return
+		}
+
+		c.Set("user", userID)
+		c.Set("api_key", key)
+		c.Next()
+	}
+}
+
+// RequireScope only lets requests through whose api key was granted the scope
+func RequireScope(scope services.APIScope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get("api_key")
+		key, ok := value.(*services.APIKeyDto)
+		if !exists || !ok || !key.HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": fmt.Sprintf("api key is missing the %q scope", scope),
+			})
+			return
+		}
+		c.Next()
+	}
+}
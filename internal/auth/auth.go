@@ -1,24 +1,16 @@
 package auth
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"gochat/internal/app"
 	"gochat/internal/models"
-	"gochat/internal/services"
-	"io"
 	"net/http"
-	"net/url"
 	"os"
 	"time"
 )
 
-// Todo make a config object with checks and fallbacks
-var (
-	scope = "User.Read offline_access openid email profile"
-)
-
 var protocol = func() string {
 	if os.Getenv("ENV") == "production" {
 		return "https"
@@ -26,11 +18,6 @@ var protocol = func() string {
 	return "http"
 }()
 
-func getRedirectURI() string {
-	domain := os.Getenv("DOMAIN")
-	return protocol + "://" + domain + "/oauth/redirect/azure"
-}
-
 var domain = func() string {
 	if os.Getenv("ENV") == "production" {
 		return "torgon.io"
@@ -65,66 +52,95 @@ func UnsetTokenCookie(c *gin.Context) {
 var jwtKey = []byte(os.Getenv("JWT_SECURITY_TOKEN"))
 
 // Add the account name to the context
-func AccountMiddleware() gin.HandlerFunc {
+func AccountMiddleware(a *app.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, exists := c.Get("user")
 
 		if !exists {
 			c.Next()
+			return
 		}
 
-		userService := services.NewUserService()
-		userDto, err := userService.Get(c, userID.(string))
+		userDto, err := a.Users.Get(c, userID.(string))
 
-		if err != nil {
+		if err != nil || userDto == nil {
 			c.Next()
+			return
 		}
 
-
 		c.Set("account_name", userDto.Account.Name)
 		c.Next()
 	}
 }
 
-func JWTMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-
-		tokenString, err := c.Cookie("token")
-		if err != nil {
-			c.Redirect(http.StatusFound, "/login")
-			c.Abort()
-			return
+func parseToken(tokenString string) (*models.Claims, error) {
+	claims := &models.Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		// Validate the signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 
-		// Parse the token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Validate the signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
+		// Return the key we used to sign the token
+		return jwtKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("token is invalid")
+	}
+	// Tokens from before server side sessions can't be revoked, so we don't accept them anymore
+	if claims.SessionID == "" {
+		return nil, fmt.Errorf("token has no session")
+	}
+	return claims, nil
+}
 
-			// Return the key we used to sign the token
-			return jwtKey, nil
-		})
+// parseAccessToken only accepts the user's own tokens, impersonation tokens have their own cookie
+func parseAccessToken(tokenString string) (*models.Claims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Actor != nil {
+		return nil, fmt.Errorf("token is an impersonation token")
+	}
+	return claims, nil
+}
 
-		if err != nil {
-			fmt.Printf("Token validation error: %v\n", err)
-			c.Redirect(http.StatusFound, "/login")
-			c.Abort()
-			return
-		}
+func JWTMiddleware(a *app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var userID, sessionID string
 
-		if !token.Valid {
-			fmt.Println("Token is invalid")
-			c.Redirect(http.StatusFound, "/login")
-			c.Abort()
-			return
+		tokenString, err := c.Cookie("token")
+		if err == nil {
+			claims, err := parseAccessToken(tokenString)
+			if err != nil {
+				fmt.Printf("Token validation error: %v\n", err)
+			} else {
+				userID, sessionID = claims.UserID, claims.SessionID
+			}
 		}
 
-		if err != nil || !token.Valid {
-			c.Redirect(http.StatusFound, "/login")
-			c.Abort()
-			return
+		if userID != "" {
+			// Access tokens are short-lived, but we still check for revoked sessions on every request
+			if err := a.Sessions.Validate(c, sessionID, userID); err != nil {
+				fmt.Printf("Session validation error: %v\n", err)
+				UnsetSessionCookies(c)
+				c.Redirect(http.StatusFound, "/login")
+				c.Abort()
+				return
+			}
+		} else {
+			// Expired or missing access token, try to continue the session with the refresh token
+			userID, sessionID, err = RefreshSession(a, c)
+			if err != nil {
+				fmt.Printf("Session refresh error: %v\n", err)
+				c.Redirect(http.StatusFound, "/login")
+				c.Abort()
+				return
+			}
 		}
 
 		// Make sure user's can't go back in browser history
@@ -132,19 +148,28 @@ func JWTMiddleware() gin.HandlerFunc {
 		c.Header("Pragma", "no-cache")
 		c.Header("Expires", "0")
 
-		// Get the user ID from the token claims
-		claims := token.Claims.(jwt.MapClaims)
-
+		// An admin impersonating someone continues as that user, every request is audited
+		if imp := resolveImpersonation(a, c, userID, sessionID); imp != nil {
+			c.Set("user", imp.UserID)
+			c.Set("actor", imp.ActorID)
+			c.Set("session", sessionID)
+			c.Set("impersonation", imp)
+			c.Next()
+			auditImpersonatedRequest(a, c, imp)
+			return
+		}
 
-		c.Set("user", claims["sub"])
+		c.Set("user", userID)
+		c.Set("session", sessionID)
 		c.Next()
 	}
 }
 
-func CreateToken(userID string) (string, error) {
-	expirationTime := time.Now().Add(86 * time.Hour)
+func CreateToken(userID string, sessionID string) (string, error) {
+	expirationTime := time.Now().Add(accessTokenTTL)
 	claims := &models.Claims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -155,90 +180,3 @@ func CreateToken(userID string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(jwtKey)
 }
-
-func GetUserInfo(token string) (map[string]interface{}, error) {
-	req, err := http.NewRequest("GET", "https://graph.microsoft.com/v1.0/me", nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var userInfo map[string]interface{}
-	if err := json.Unmarshal(body, &userInfo); err != nil {
-		return nil, err
-	}
-
-	return userInfo, nil
-}
-
-type OAuthAccessResponse struct {
-	AccessToken string `json:"access_token"`
-}
-
-func GetToken(code string) (string, error) {
-	clientID := os.Getenv("AZURE_CLIENT_ID")
-	clientSecret := os.Getenv("AZURE_CLIENT_SECRET")
-
-	tokenURL := fmt.Sprintf("https://login.microsoftonline.com/common/oauth2/v2.0/token")
-	data := url.Values{}
-	data.Set("grant_type", "authorization_code")
-	data.Set("client_id", clientID)
-	data.Set("client_secret", clientSecret)
-	data.Set("code", code)
-	data.Set("redirect_uri", getRedirectURI())
-	data.Set("scope", scope) // Add this line
-
-	resp, err := http.PostForm(tokenURL, data)
-	if err != nil {
-		return "", fmt.Errorf("error making token request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("error reading token response body: %w", err)
-	}
-
-	var result struct {
-		AccessToken string `json:"access_token"`
-		Error       string `json:"error"`
-		ErrorDesc   string `json:"error_description"`
-	}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("error parsing token response: %w", err)
-	}
-
-	if result.Error != "" {
-		return "", fmt.Errorf("error getting token: %s (%s)", result.Error, result.ErrorDesc)
-	}
-
-	if result.AccessToken == "" {
-		return "", fmt.Errorf("token not found in response")
-	}
-
-	return result.AccessToken, nil
-}
-
-func LoginHandler() gin.HandlerFunc {
-	clientID := os.Getenv("AZURE_CLIENT_ID")
-
-	return func(c *gin.Context) {
-		authURL := fmt.Sprintf("https://login.microsoftonline.com/common/oauth2/v2.0/authorize?"+
-			"client_id=%s&response_type=code&redirect_uri=%s&response_mode=query&scope=%s",
-			clientID, url.QueryEscape(getRedirectURI()), url.QueryEscape(scope))
-		c.Redirect(http.StatusTemporaryRedirect, authURL)
-	}
-}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gochat/internal/app"
+	"gochat/internal/models"
+	"gochat/internal/services"
+	"net/http"
+	"time"
+)
+
+// The impersonation token lives next to the admin's own tokens, so the admin's session keeps refreshing
+// and stopping simply drops this cookie
+const impersonationCookie = "impersonation"
+
+func SetImpersonationCookie(c *gin.Context, token string, expiresAt time.Time) {
+	c.SetCookie(
+		impersonationCookie,
+		token,
+		int(time.Until(expiresAt).Seconds()),
+		"/",
+		domain,
+		true,
+		true,
+	)
+}
+
+func UnsetImpersonationCookie(c *gin.Context) {
+	c.SetCookie(
+		impersonationCookie,
+		"",
+		-1,
+		"/",
+		domain,
+		true,
+		true,
+	)
+}
+
+// CreateImpersonationToken issues a token for the impersonated user, with the admin in the act claim
+func CreateImpersonationToken(imp *services.ImpersonationDto) (string, error) {
+	claims := &models.Claims{
+		UserID:    imp.UserID,
+		SessionID: imp.SessionID,
+		Actor: &models.ActorClaims{
+			Subject:         imp.ActorID,
+			ImpersonationID: imp.ID,
+		},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(imp.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtKey)
+}
+
+// StartImpersonation lets the logged-in admin act as the user and sets the impersonation cookie
+func StartImpersonation(a *app.App, c *gin.Context, userID string, params services.ImpersonationParams) (*services.ImpersonationDto, error) {
+	actorID := c.GetString("user")
+
+	imp, err := a.Impersonations.Start(c, actorID, c.GetString("session"), userID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := CreateImpersonationToken(imp)
+	if err != nil {
+		return nil, fmt.Errorf("could not create token: %w", err)
+	}
+	SetImpersonationCookie(c, token, imp.ExpiresAt)
+
+	a.Events(actorID).Create(services.EventImpersonationStart, services.EventMetadata{
+		"impersonation": imp.ID,
+		"user":          imp.UserID,
+		"reason":        imp.Reason,
+		"expiresAt":     imp.ExpiresAt.Format(time.RFC3339),
+		"ip":            c.ClientIP(),
+	})
+	return imp, nil
+}
+
+// StopImpersonation ends the running impersonation, the admin is themselves again on the next request
+func StopImpersonation(a *app.App, c *gin.Context) error {
+	defer UnsetImpersonationCookie(c)
+
+	imp := GetImpersonation(c)
+	if imp == nil {
+		return nil
+	}
+
+	if err := a.Impersonations.End(c, imp.ID); err != nil {
+		return err
+	}
+
+	a.Events(imp.ActorID).Create(services.EventImpersonationEnd, services.EventMetadata{
+		"impersonation": imp.ID,
+		"user":          imp.UserID,
+	})
+	return nil
+}
+
+// GetImpersonation returns the impersonation of the current request, or nil when the user is themselves
+func GetImpersonation(c *gin.Context) *services.ImpersonationDto {
+	value, exists := c.Get("impersonation")
+	if !exists {
+		return nil
+	}
+	imp, _ := value.(*services.ImpersonationDto)
+	return imp
+}
+
+// resolveImpersonation returns the impersonation the admin's browser carries, if it is still running.
+// Anything invalid drops the cookie, so the admin falls back to their own account.
+func resolveImpersonation(a *app.App, c *gin.Context, actorID string, sessionID string) *services.ImpersonationDto {
+	tokenString, err := c.Cookie(impersonationCookie)
+	if err != nil || tokenString == "" {
+		return nil
+	}
+
+	claims, err := parseToken(tokenString)
+	if err != nil || claims.Actor == nil || claims.Actor.Subject != actorID || claims.SessionID != sessionID {
+		UnsetImpersonationCookie(c)
+		return nil
+	}
+
+	imp, err := a.Impersonations.Validate(c, claims.Actor.ImpersonationID, actorID, sessionID)
+	if err != nil || imp.UserID != claims.UserID {
+		fmt.Printf("Impersonation validation error: %v\n", err)
+		UnsetImpersonationCookie(c)
+		return nil
+	}
+	return imp
+}
+
+// auditImpersonatedRequest records a request the admin made while acting as another user
+func auditImpersonatedRequest(a *app.App, c *gin.Context, imp *services.ImpersonationDto) {
+	_, err := a.Events(imp.ActorID).Create(services.EventImpersonatedRequest, services.EventMetadata{
+		"impersonation": imp.ID,
+		"user":          imp.UserID,
+		"method":        c.Request.Method,
+		"path":          c.Request.URL.Path,
+		"status":        c.Writer.Status(),
+		"ip":            c.ClientIP(),
+	})
+	if err != nil {
+		fmt.Println("Error logging impersonated request", err)
+	}
+}
+
+// DenyImpersonation blocks routes an admin should not use on someone else's behalf,
+// like creating credentials that outlive the impersonation
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if GetImpersonation(c) != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Not allowed while impersonating a user"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,516 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gochat/internal/services"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oidcFlowCookie = "oidc_flow"
+	oidcFlowTTL    = 10 * time.Minute
+	oidcCacheTTL   = time.Hour
+)
+
+// OIDCProvider logs users in with any OpenID Connect compliant identity provider, using the
+// authorization code flow with PKCE. Endpoints and signing keys are taken from discovery.
+type OIDCProvider struct {
+	ID           string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	HTTPClient   *http.Client
+}
+
+// OIDCIdentity is the verified user returned by the identity provider
+type OIDCIdentity struct {
+	Issuer  string
+	Subject string
+	Email   string
+	Name    string
+	// EmailVerified is true when the provider vouches for the email address. Only then may it link the
+	// login to an existing user or decide the account by its domain.
+	EmailVerified bool
+}
+
+// ExternalID is what the user is found by on the next login. The subject is only unique per issuer,
+// and a multi-tenant issuer is resolved per tenant.
+func (i *OIDCIdentity) ExternalID() string {
+	return i.Issuer + "#" + i.Subject
+}
+
+// OIDCFlow holds the per-login secrets, kept in a signed cookie between redirect and callback
+type OIDCFlow struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Some providers send email_verified as a string
+type flexBool struct {
+	Set   bool
+	Value bool
+}
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case bool:
+		b.Set, b.Value = true, t
+	case string:
+		b.Set, b.Value = true, t == "true"
+	}
+	return nil
+}
+
+type IDTokenClaims struct {
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     flexBool `json:"email_verified"`
+	Name              string   `json:"name"`
+	GivenName         string   `json:"given_name"`
+	PreferredUsername string   `json:"preferred_username"`
+	TenantID          string   `json:"tid"`
+	// EmailDomainVerified is Azure's optional claim that the tenant owns the domain of the email
+	EmailDomainVerified flexBool `json:"xms_edov"`
+	AuthorizedParty     string   `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+type cachedDiscovery struct {
+	discovery *oidcDiscovery
+	fetchedAt time.Time
+}
+
+type cachedKeys struct {
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+var oidcCache = struct {
+	sync.Mutex
+	discovery map[string]cachedDiscovery
+	keys      map[string]cachedKeys
+}{
+	discovery: map[string]cachedDiscovery{},
+	keys:      map[string]cachedKeys{},
+}
+
+func NewOIDCProvider(config *services.OIDCProviderConfig) *OIDCProvider {
+	return &OIDCProvider{
+		ID:           config.ID,
+		Issuer:       config.Issuer,
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		Scopes:       config.Scopes,
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// OIDCRedirectURI is the callback registered at the identity provider
+func OIDCRedirectURI(providerID string) string {
+	return protocol + "://" + os.Getenv("DOMAIN") + "/oauth/redirect/" + providerID
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func NewOIDCFlow(providerID string) (*OIDCFlow, error) {
+	state, err := randomString(24)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomString(24)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomString(48)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCFlow{
+		Provider: providerID,
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcFlowTTL)),
+		},
+	}, nil
+}
+
+// CodeChallenge is the S256 PKCE challenge for the flow's verifier
+func (f *OIDCFlow) CodeChallenge() string {
+	sum := sha256.Sum256([]byte(f.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func SetOIDCFlowCookie(c *gin.Context, flow *OIDCFlow) error {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, flow).SignedString(jwtKey)
+	if err != nil {
+		return err
+	}
+	c.SetCookie(oidcFlowCookie, signed, int(oidcFlowTTL.Seconds()), "/", domain, true, true)
+	return nil
+}
+
+// ReadOIDCFlowCookie returns the flow started by this browser and removes the cookie, flows are single use
+func ReadOIDCFlowCookie(c *gin.Context) (*OIDCFlow, error) {
+	raw, err := c.Cookie(oidcFlowCookie)
+	if err != nil {
+		return nil, fmt.Errorf("no login in progress")
+	}
+	c.SetCookie(oidcFlowCookie, "", -1, "/", domain, true, true)
+
+	flow := &OIDCFlow{}
+	_, err = jwt.ParseWithClaims(raw, flow, func(token *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("invalid login state: %w", err)
+	}
+	return flow, nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, endpoint string, bearer string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, endpoint)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	oidcCache.Lock()
+	cached, ok := oidcCache.discovery[p.Issuer]
+	oidcCache.Unlock()
+	if ok && time.Since(cached.fetchedAt) < oidcCacheTTL {
+		return cached.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", "", &discovery); err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %w", err)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksURI == "" {
+		return nil, fmt.Errorf("oidc discovery document for %s is incomplete", p.Issuer)
+	}
+	// Multi-tenant Azure publishes a {tenantid} template, which is resolved per token
+	if !strings.Contains(discovery.Issuer, "{tenantid}") && strings.TrimSuffix(discovery.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("oidc discovery issuer mismatch: %s", discovery.Issuer)
+	}
+
+	oidcCache.Lock()
+	oidcCache.discovery[p.Issuer] = cachedDiscovery{discovery: &discovery, fetchedAt: time.Now()}
+	oidcCache.Unlock()
+	return &discovery, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+}
+
+// signingKey finds the key by id, refetching the key set once when it is unknown, to pick up key rotation
+func (p *OIDCProvider) signingKey(ctx context.Context, jwksURI string, kid string) (interface{}, error) {
+	oidcCache.Lock()
+	cached, ok := oidcCache.keys[jwksURI]
+	oidcCache.Unlock()
+	if ok && time.Since(cached.fetchedAt) < oidcCacheTTL {
+		if key, found := cached.keys[kid]; found {
+			return key, nil
+		}
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURI, "", &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	keys := map[string]interface{}{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	oidcCache.Lock()
+	oidcCache.keys[jwksURI] = cachedKeys{keys: keys, fetchedAt: time.Now()}
+	oidcCache.Unlock()
+
+	key, found := keys[kid]
+	if !found {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+	return key, nil
+}
+
+// AuthCodeURL is where the user is sent to log in
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, flow *OIDCFlow, redirectURI string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("response_mode", "query")
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", redirectURI)
+	params.Set("scope", strings.Join(p.Scopes, " "))
+	params.Set("state", flow.State)
+	params.Set("nonce", flow.Nonce)
+	params.Set("code_challenge", flow.CodeChallenge())
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID token
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawIDToken string, nonce string) (*IDTokenClaims, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &IDTokenClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.signingKey(ctx, discovery.JwksURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	expectedIssuer := strings.ReplaceAll(discovery.Issuer, "{tenantid}", claims.TenantID)
+	if claims.Issuer != expectedIssuer {
+		return nil, fmt.Errorf("invalid id token issuer: %s", claims.Issuer)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID {
+		return nil, fmt.Errorf("invalid id token authorized party: %s", claims.AuthorizedParty)
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("invalid id token nonce")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+
+	return claims, nil
+}
+
+// Exchange trades the authorization code for tokens and returns the verified identity
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, flow *OIDCFlow, redirectURI string) (*OIDCIdentity, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("code", code)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("client_id", p.ClientID)
+	data.Set("code_verifier", flow.Verifier)
+	if p.ClientSecret != "" {
+		data.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading token response body: %w", err)
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+		ErrorDesc   string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("error parsing token response: %w", err)
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("error getting token: %s (%s)", result.Error, result.ErrorDesc)
+	}
+	if result.IDToken == "" {
+		return nil, fmt.Errorf("id token not found in response")
+	}
+
+	claims, err := p.VerifyIDToken(ctx, result.IDToken, flow.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &OIDCIdentity{
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+		Name:    claims.GivenName,
+	}
+	if identity.Name == "" {
+		identity.Name = claims.Name
+	}
+
+	// Not every provider puts the email in the ID token, the userinfo endpoint usually has it
+	if identity.Email == "" && discovery.UserinfoEndpoint != "" && result.AccessToken != "" {
+		var userInfo struct {
+			Subject       string   `json:"sub"`
+			Email         string   `json:"email"`
+			EmailVerified flexBool `json:"email_verified"`
+			Name          string   `json:"name"`
+		}
+		if err := p.getJSON(ctx, discovery.UserinfoEndpoint, result.AccessToken, &userInfo); err != nil {
+			fmt.Printf("oidc userinfo request failed: %v\n", err)
+		} else if userInfo.Subject == claims.Subject {
+			identity.Email = userInfo.Email
+			claims.EmailVerified = userInfo.EmailVerified
+			if identity.Name == "" {
+				identity.Name = userInfo.Name
+			}
+		}
+	}
+	if identity.Email == "" {
+		return nil, errors.New("identity provider did not return an email address")
+	}
+	if claims.EmailVerified.Set && !claims.EmailVerified.Value {
+		return nil, errors.New("email address is not verified")
+	}
+	// Any tenant of a multi-tenant issuer can put any address in the email claim, it only counts when
+	// the provider says it checked it. A provider pinned to one issuer is trusted with its addresses.
+	pinned := !strings.Contains(discovery.Issuer, "{tenantid}")
+	identity.EmailVerified = pinned || claims.EmailVerified.Value || claims.EmailDomainVerified.Value
+
+	return identity, nil
+}
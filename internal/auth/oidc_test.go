@@ -0,0 +1,244 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"gochat/internal/auth"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockOIDCServer is a minimal OpenID Connect identity provider
+type mockOIDCServer struct {
+	*httptest.Server
+	key           *rsa.PrivateKey
+	clientID      string
+	codeChallenge string
+	nonce         string
+	claims        jwt.MapClaims
+	// multiTenant makes it publish a {tenantid} issuer like Azure's common endpoint
+	multiTenant bool
+}
+
+func (m *mockOIDCServer) issuer() string {
+	if m.multiTenant {
+		return m.URL + "/{tenantid}/v2.0"
+	}
+	return m.URL
+}
+
+func newMockOIDCServer(t *testing.T) *mockOIDCServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	m := &mockOIDCServer{key: key, clientID: "gochat"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.issuer(),
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"userinfo_endpoint":      m.URL + "/userinfo",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != m.codeChallenge {
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":   strings.ReplaceAll(m.issuer(), "{tenantid}", "tenant-1"),
+			"tid":   "tenant-1",
+			"aud":   m.clientID,
+			"sub":   "user-123",
+			"nonce": m.nonce,
+			"email": "albert@test.com",
+			"name":  "Albert",
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range m.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test-key"
+		idToken, err := token.SignedString(key)
+		assert.NoError(t, err)
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access-token",
+			"id_token":     idToken,
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sub":            "user-123",
+			"email":          "userinfo@test.com",
+			"email_verified": true,
+		})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// login starts a flow, follows the authorization url like a browser would and exchanges the code
+func (m *mockOIDCServer) login(t *testing.T, code string) (*auth.OIDCIdentity, error) {
+	ctx := context.Background()
+	provider := &auth.OIDCProvider{
+		ID:         "mock",
+		Issuer:     m.URL,
+		ClientID:   m.clientID,
+		Scopes:     []string{"openid", "email", "profile"},
+		HTTPClient: m.Client(),
+	}
+	flow, err := auth.NewOIDCFlow(provider.ID)
+	assert.NoError(t, err)
+
+	authURL, err := provider.AuthCodeURL(ctx, flow, "http://localhost/oauth/redirect/mock")
+	assert.NoError(t, err)
+	parsed, err := url.Parse(authURL)
+	assert.NoError(t, err)
+	query := parsed.Query()
+	assert.Equal(t, m.URL+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+	assert.Equal(t, flow.State, query.Get("state"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, "openid email profile", query.Get("scope"))
+
+	m.codeChallenge = query.Get("code_challenge")
+	if m.nonce == "" {
+		m.nonce = query.Get("nonce")
+	}
+
+	return provider.Exchange(ctx, code, flow, "http://localhost/oauth/redirect/mock")
+}
+
+func TestOIDCProvider_Login(t *testing.T) {
+	m := newMockOIDCServer(t)
+
+	identity, err := m.login(t, "good-code")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-123", identity.Subject)
+	assert.Equal(t, "albert@test.com", identity.Email)
+	assert.Equal(t, "Albert", identity.Name)
+	// A provider with a single issuer is trusted with its addresses
+	assert.True(t, identity.EmailVerified)
+	assert.Equal(t, m.URL+"#user-123", identity.ExternalID())
+}
+
+func TestOIDCProvider_MultiTenant(t *testing.T) {
+	m := newMockOIDCServer(t)
+	m.multiTenant = true
+
+	// Any tenant can claim any address, it only counts when the provider verified it
+	identity, err := m.login(t, "good-code")
+	assert.NoError(t, err)
+	assert.False(t, identity.EmailVerified)
+	assert.Equal(t, m.URL+"/tenant-1/v2.0#user-123", identity.ExternalID())
+
+	m.claims, m.nonce = jwt.MapClaims{"email_verified": true}, ""
+	identity, err = m.login(t, "good-code")
+	assert.NoError(t, err)
+	assert.True(t, identity.EmailVerified)
+
+	m.claims, m.nonce = jwt.MapClaims{"xms_edov": true}, ""
+	identity, err = m.login(t, "good-code")
+	assert.NoError(t, err)
+	assert.True(t, identity.EmailVerified)
+}
+
+func TestOIDCProvider_PreferredUsernameIsNoEmail(t *testing.T) {
+	m := newMockOIDCServer(t)
+	m.claims = jwt.MapClaims{"email": "", "preferred_username": "victim@test.com"}
+
+	// The userinfo endpoint has the address, the username is never used for it
+	identity, err := m.login(t, "good-code")
+	assert.NoError(t, err)
+	assert.Equal(t, "userinfo@test.com", identity.Email)
+}
+
+func TestOIDCProvider_InvalidCode(t *testing.T) {
+	m := newMockOIDCServer(t)
+
+	_, err := m.login(t, "bad-code")
+	assert.ErrorContains(t, err, "invalid_grant")
+}
+
+func TestOIDCProvider_NonceMismatch(t *testing.T) {
+	m := newMockOIDCServer(t)
+	m.nonce = "replayed-nonce"
+
+	_, err := m.login(t, "good-code")
+	assert.ErrorContains(t, err, "nonce")
+}
+
+func TestOIDCProvider_WrongAudience(t *testing.T) {
+	m := newMockOIDCServer(t)
+	m.claims = jwt.MapClaims{"aud": "someone-else"}
+
+	_, err := m.login(t, "good-code")
+	assert.ErrorContains(t, err, "invalid id token")
+}
+
+func TestOIDCProvider_WrongIssuer(t *testing.T) {
+	m := newMockOIDCServer(t)
+	m.claims = jwt.MapClaims{"iss": "https://evil.example.com"}
+
+	_, err := m.login(t, "good-code")
+	assert.ErrorContains(t, err, "issuer")
+}
+
+func TestOIDCProvider_ExpiredToken(t *testing.T) {
+	m := newMockOIDCServer(t)
+	m.claims = jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}
+
+	_, err := m.login(t, "good-code")
+	assert.ErrorContains(t, err, "expired")
+}
+
+func TestOIDCProvider_EmailFromUserinfo(t *testing.T) {
+	m := newMockOIDCServer(t)
+	m.claims = jwt.MapClaims{"email": ""}
+
+	identity, err := m.login(t, "good-code")
+	assert.NoError(t, err)
+	assert.Equal(t, "userinfo@test.com", identity.Email)
+}
+
+func TestOIDCProvider_UnverifiedEmail(t *testing.T) {
+	m := newMockOIDCServer(t)
+	m.claims = jwt.MapClaims{"email_verified": "false"}
+
+	_, err := m.login(t, "good-code")
+	assert.ErrorContains(t, err, "not verified")
+}
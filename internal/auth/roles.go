@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gochat/internal/app"
+	"gochat/internal/services"
+	"net/http"
+)
+
+// RequireRole only lets the request through when the logged-in user has one of the roles.
+// It sets "role" and "account_id" on the context for the handlers behind it.
+func RequireRole(a *app.App, roles ...services.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := a.Users.Get(c, c.GetString("user"))
+		if err != nil {
+			fmt.Println("Error getting user for role check: " + err.Error())
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Could not verify role"})
+			return
+		}
+		if user == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unknown user"})
+			return
+		}
+
+		for _, role := range roles {
+			if user.Role == role {
+				c.Set("role", user.Role)
+				c.Set("account_id", user.Account.ID)
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You don't have access to this resource"})
+	}
+}
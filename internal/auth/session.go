@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gochat/internal/app"
+	"gochat/internal/services"
+	"time"
+)
+
+const accessTokenTTL = 15 * time.Minute
+
+func SetRefreshTokenCookie(c *gin.Context, token string) {
+	c.SetCookie(
+		"refresh_token",
+		token,
+		int(services.SessionTTL.Seconds()),
+		"/",
+		domain,
+		true,
+		true,
+	)
+}
+
+func UnsetRefreshTokenCookie(c *gin.Context) {
+	c.SetCookie(
+		"refresh_token",
+		"",
+		-1,
+		"/",
+		domain,
+		true,
+		true,
+	)
+}
+
+// UnsetSessionCookies removes the access and refresh token, and any impersonation riding on the session
+func UnsetSessionCookies(c *gin.Context) {
+	UnsetTokenCookie(c)
+	UnsetRefreshTokenCookie(c)
+	UnsetImpersonationCookie(c)
+}
+
+// StartSession creates a server side session for the user and sets the access and refresh token cookies
+func StartSession(a *app.App, c *gin.Context, userID string) error {
+	session, refreshToken, err := a.Sessions.Create(c, userID, services.SessionParams{
+		UserAgent: c.GetHeader("User-Agent"),
+		IP:        c.ClientIP(),
+	})
+	if err != nil {
+		return err
+	}
+
+	token, err := CreateToken(userID, session.ID)
+	if err != nil {
+		return fmt.Errorf("could not create token: %w", err)
+	}
+
+	SetTokenCookie(c, token)
+	SetRefreshTokenCookie(c, refreshToken)
+	return nil
+}
+
+// RefreshSession rotates the refresh token cookie and issues a new access token.
+// It returns the user and session the new tokens belong to.
+func RefreshSession(a *app.App, c *gin.Context) (string, string, error) {
+	refreshToken, err := c.Cookie("refresh_token")
+	if err != nil || refreshToken == "" {
+		return "", "", fmt.Errorf("no refresh token")
+	}
+
+	session, newRefreshToken, err := a.Sessions.Rotate(c, refreshToken)
+	if err != nil {
+		UnsetSessionCookies(c)
+		return "", "", err
+	}
+
+	token, err := CreateToken(session.User, session.ID)
+	if err != nil {
+		return "", "", fmt.Errorf("could not create token: %w", err)
+	}
+
+	SetTokenCookie(c, token)
+	// Empty when a parallel request already rotated, that response carries the new cookie
+	if newRefreshToken != "" {
+		SetRefreshTokenCookie(c, newRefreshToken)
+	}
+	return session.User, session.ID, nil
+}
+
+// EndSession revokes the session of the current browser and clears its cookies
+func EndSession(a *app.App, c *gin.Context) {
+	defer UnsetSessionCookies(c)
+
+	refreshToken, err := c.Cookie("refresh_token")
+	if err != nil {
+		return
+	}
+
+	if err := a.Sessions.RevokeByRefreshToken(c, refreshToken); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,411 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The migrations used to be run with the golang-migrate CLI, we keep its file names and version table
+// so existing databases continue where they are
+const migrationsTable = "schema_migrations"
+
+// Every replica migrates at boot, the lock row makes sure only one of them does the work
+const (
+	migrationsLockTable = "schema_migrations_lock"
+	// A lock this old was left behind by a process that crashed
+	staleLockAge = 10 * time.Minute
+)
+
+var lockPollInterval = 250 * time.Millisecond
+
+// NilVersion is the version of a database without any migration applied
+const NilVersion = -1
+
+var migrationFilePattern = regexp.MustCompile(`^([0-9]+)_(.*)\.(up|down)\.sql$`)
+
+var ErrDirty = errors.New("database is dirty, a migration failed halfway. Fix it by hand and force the version")
+
+type Migration struct {
+	Version  int
+	Name     string
+	UpFile   string
+	DownFile string
+}
+
+// dialect is what differs between the SQLite and the Postgres migrator
+type dialect struct {
+	versionTable   string
+	lockTable      string
+	placeholder    func(n int) string
+	isLockConflict func(err error) bool
+}
+
+var sqliteDialect = dialect{
+	versionTable:   "(version uint64, dirty bool)",
+	lockTable:      "(id INTEGER PRIMARY KEY CHECK (id = 1), owner TEXT NOT NULL, lockedAt TEXT NOT NULL)",
+	placeholder:    func(int) string { return "?" },
+	isLockConflict: isLockConflict,
+}
+
+// The Postgres version table has the same layout golang-migrate uses
+var postgresDialect = dialect{
+	versionTable:   "(version bigint NOT NULL, dirty boolean NOT NULL)",
+	lockTable:      "(id integer PRIMARY KEY CHECK (id = 1), owner text NOT NULL, lockedAt text NOT NULL)",
+	placeholder:    func(n int) string { return fmt.Sprintf("$%d", n) },
+	isLockConflict: isPostgresLockConflict,
+}
+
+type Migrator struct {
+	db         *sql.DB
+	fsys       fs.FS
+	dialect    dialect
+	migrations []Migration
+}
+
+// NewMigrator reads the SQLite migrations in the root of fsys
+func NewMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	return newMigrator(db, fsys, sqliteDialect)
+}
+
+// NewPostgresMigrator reads the Postgres migrations in the root of fsys
+func NewPostgresMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	return newMigrator(db, fsys, postgresDialect)
+}
+
+func newMigrator(db *sql.DB, fsys fs.FS, d dialect) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version %s: %w", entry.Name(), err)
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if match[3] == "up" {
+			m.UpFile = entry.Name()
+		} else {
+			m.DownFile = entry.Name()
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.UpFile == "" {
+			return nil, fmt.Errorf("migration %d has no up file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return &Migrator{db: db, fsys: fsys, dialect: d, migrations: migrations}, nil
+}
+
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s %s", migrationsTable, m.dialect.versionTable))
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", migrationsTable, err)
+	}
+	_, err = m.db.ExecContext(ctx, fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS version_unique ON %s (version)", migrationsTable))
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", migrationsTable, err)
+	}
+	_, err = m.db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s %s", migrationsLockTable, m.dialect.lockTable))
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", migrationsLockTable, err)
+	}
+	return nil
+}
+
+// lock waits until no other process is migrating, the returned function releases the lock
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	owner := uuid.New().String()
+
+	for {
+		_, err := m.db.ExecContext(ctx, m.bind("DELETE FROM "+migrationsLockTable+" WHERE lockedAt < ?"),
+			time.Now().UTC().Add(-staleLockAge).Format(time.RFC3339))
+		if err != nil && !m.dialect.isLockConflict(err) {
+			return nil, fmt.Errorf("failed to clear stale migration lock: %w", err)
+		}
+
+		_, err = m.db.ExecContext(ctx, m.bind("INSERT INTO "+migrationsLockTable+" (id, owner, lockedAt) VALUES (1, ?, ?)"),
+			owner, time.Now().UTC().Format(time.RFC3339))
+		if err == nil {
+			break
+		}
+		if !m.dialect.isLockConflict(err) {
+			return nil, fmt.Errorf("failed to lock migrations: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for migration lock: %w", ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	return func() {
+		// The context might be cancelled by now, the lock has to go anyway
+		if _, err := m.db.Exec(m.bind("DELETE FROM "+migrationsLockTable+" WHERE owner = ?"), owner); err != nil {
+			fmt.Println("failed to release migration lock: " + err.Error())
+		}
+	}, nil
+}
+
+// bind replaces the ? placeholders with the ones of the dialect
+func (m *Migrator) bind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString(m.dialect.placeholder(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// isLockConflict is true when someone else holds the lock row or the database
+func isLockConflict(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrConstraint || sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
+
+// isPostgresLockConflict is true when someone else inserted the lock row first
+func isPostgresLockConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	// 23505 is unique_violation
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// Version returns the current version, NilVersion when no migration has run
+func (m *Migrator) Version(ctx context.Context) (int, bool, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, false, err
+	}
+	var version int
+	var dirty bool
+	err := m.db.QueryRowContext(ctx, "SELECT version, dirty FROM "+migrationsTable+" LIMIT 1").Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return NilVersion, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read version: %w", err)
+	}
+	return version, dirty, nil
+}
+
+func (m *Migrator) setVersion(ctx context.Context, version int, dirty bool) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM "+migrationsTable); err != nil {
+		return fmt.Errorf("failed to set version: %w", err)
+	}
+	if version != NilVersion || dirty {
+		if _, err := tx.ExecContext(ctx, m.bind("INSERT INTO "+migrationsTable+" (version, dirty) VALUES (?, ?)"), version, dirty); err != nil {
+			return fmt.Errorf("failed to set version: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Force sets the version without running anything, used to recover from a dirty database
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return m.setVersion(ctx, version, false)
+}
+
+// Up applies the next n migrations, or all of them when n <= 0. Returns the versions that were applied.
+func (m *Migrator) Up(ctx context.Context, n int) ([]int, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return m.up(ctx, n)
+}
+
+func (m *Migrator) up(ctx context.Context, n int) ([]int, error) {
+	current, err := m.cleanVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []int
+	for _, migration := range m.migrations {
+		if migration.Version <= current {
+			continue
+		}
+		if n > 0 && len(applied) == n {
+			break
+		}
+		if err := m.run(ctx, migration.UpFile, migration.Version, migration.Version); err != nil {
+			return applied, err
+		}
+		applied = append(applied, migration.Version)
+	}
+	return applied, nil
+}
+
+// Down reverts the last n migrations, or all of them when n <= 0. Returns the versions that were reverted.
+func (m *Migrator) Down(ctx context.Context, n int) ([]int, error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return m.down(ctx, n)
+}
+
+func (m *Migrator) down(ctx context.Context, n int) ([]int, error) {
+	current, err := m.cleanVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []int
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version > current {
+			continue
+		}
+		if n > 0 && len(reverted) == n {
+			break
+		}
+		if migration.DownFile == "" {
+			return reverted, fmt.Errorf("migration %d has no down file", migration.Version)
+		}
+		previous := NilVersion
+		if i > 0 {
+			previous = m.migrations[i-1].Version
+		}
+		if err := m.run(ctx, migration.DownFile, migration.Version, previous); err != nil {
+			return reverted, err
+		}
+		reverted = append(reverted, migration.Version)
+	}
+	return reverted, nil
+}
+
+// Goto migrates up or down until the database is at the version
+func (m *Migrator) Goto(ctx context.Context, version int) error {
+	if version != NilVersion && m.index(version) == -1 {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current, err := m.cleanVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if version > current {
+		_, err = m.up(ctx, m.position(version)-m.position(current))
+	} else if version < current {
+		_, err = m.down(ctx, m.position(current)-m.position(version))
+	}
+	return err
+}
+
+func (m *Migrator) index(version int) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// position counts the migrations up to and including the version. Databases can be at a version
+// whose file was removed, like the old seed migrations, so this doesn't require the version to exist.
+func (m *Migrator) position(version int) int {
+	n := 0
+	for _, migration := range m.migrations {
+		if migration.Version <= version {
+			n++
+		}
+	}
+	return n
+}
+
+func (m *Migrator) cleanVersion(ctx context.Context) (int, error) {
+	version, dirty, err := m.Version(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("%w (version %d)", ErrDirty, version)
+	}
+	return version, nil
+}
+
+// run executes one migration file. Like golang-migrate the version is marked dirty while it runs,
+// so a failure halfway is visible, and the file itself runs in a transaction.
+func (m *Migrator) run(ctx context.Context, file string, dirtyVersion int, version int) error {
+	body, err := fs.ReadFile(m.fsys, file)
+	if err != nil {
+		return fmt.Errorf("failed to read migration %s: %w", file, err)
+	}
+	if err := m.setVersion(ctx, dirtyVersion, true); err != nil {
+		return err
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, string(body)); err != nil {
+		return fmt.Errorf("migration %s failed: %w", file, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migration %s failed: %w", file, err)
+	}
+
+	return m.setVersion(ctx, version, false)
+}
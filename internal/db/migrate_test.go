@@ -0,0 +1,95 @@
+package database_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	database "gochat/internal/db"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+var testMigrations = fstest.MapFS{
+	"000001_create_account.up.sql":   {Data: []byte("CREATE TABLE account (id TEXT PRIMARY KEY);")},
+	"000001_create_account.down.sql": {Data: []byte("DROP TABLE account;")},
+	"000002_insert_account.up.sql":   {Data: []byte("INSERT INTO account (id) VALUES ('A1');")},
+	"000002_insert_account.down.sql": {Data: []byte("DELETE FROM account;")},
+	"000003_broken.up.sql":           {Data: []byte("INSERT INTO nope (id) VALUES ('A1');")},
+	"000003_broken.down.sql":         {Data: []byte("")},
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.Open(filepath.Join(t.TempDir(), "test.db"))
+	assert.NoError(t, err)
+
+	migrator, err := database.NewMigrator(db, testMigrations)
+	assert.NoError(t, err)
+	assert.Len(t, migrator.Migrations(), 3)
+
+	version, _, err := migrator.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, database.NilVersion, version)
+
+	applied, err := migrator.Up(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, applied)
+
+	// A failing migration leaves the database dirty until the version is forced
+	_, err = migrator.Up(ctx, 0)
+	assert.Error(t, err)
+	version, dirty, err := migrator.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, version)
+	assert.True(t, dirty)
+	_, err = migrator.Down(ctx, 1)
+	assert.ErrorIs(t, err, database.ErrDirty)
+
+	assert.NoError(t, migrator.Force(ctx, 2))
+	assert.NoError(t, migrator.Goto(ctx, database.NilVersion))
+	version, dirty, err = migrator.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, database.NilVersion, version)
+	assert.False(t, dirty)
+
+	var count int
+	assert.Error(t, db.QueryRow("SELECT COUNT(*) FROM account").Scan(&count))
+}
+
+func TestMigrate_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+
+	// Replicas booting at the same time each apply the migrations once between them
+	var wg sync.WaitGroup
+	results := make([][]int, 3)
+	errs := make([]error, 3)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db, err := database.Open(dbPath)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer db.Close()
+			results[i], errs[i] = database.Migrate(ctx, db)
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for i := range results {
+		assert.NoError(t, errs[i])
+		total += len(results[i])
+	}
+	assert.Equal(t, len(embeddedMigrations(t)), total)
+}
+
+func embeddedMigrations(t *testing.T) []database.Migration {
+	migrator, err := database.NewMigrator(nil, database.EmbeddedMigrations())
+	assert.NoError(t, err)
+	return migrator.Migrations()
+}
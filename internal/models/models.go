@@ -17,7 +17,15 @@ func (s MyNullString) MarshalJSON() ([]byte, error) {
 	return []byte(`null`), nil
 }
 
+// ActorClaims is the "act" claim (RFC 8693), the user who is really acting when an admin impersonates someone
+type ActorClaims struct {
+	Subject         string `json:"sub"`
+	ImpersonationID string `json:"imp"`
+}
+
 type Claims struct {
-	UserID string `json:"sub"`
+	UserID    string       `json:"sub"`
+	SessionID string       `json:"sid"`
+	Actor     *ActorClaims `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
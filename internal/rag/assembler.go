@@ -0,0 +1,30 @@
+package rag
+
+import (
+	"github.com/sashabaranov/go-openai"
+)
+
+// AssembleRagMessages puts the retrieved documents in a system message right before the last
+// question, so the answer keeps the conversation and the persona instead of starting over. The
+// message sits at the end because older turns are cut off before the history is sent.
+func AssembleRagMessages(messages []openai.ChatCompletionMessage, documentContext string, query string) []openai.ChatCompletionMessage {
+	last := -1
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == openai.ChatMessageRoleUser {
+			last = i
+			break
+		}
+	}
+	contextMessage := openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: RagContextPrompt(documentContext, query),
+	}
+	if last == -1 {
+		return append(append([]openai.ChatCompletionMessage{}, messages...), contextMessage)
+	}
+
+	assembled := make([]openai.ChatCompletionMessage, 0, len(messages)+1)
+	assembled = append(assembled, messages[:last]...)
+	assembled = append(assembled, contextMessage)
+	return append(assembled, messages[last:]...)
+}
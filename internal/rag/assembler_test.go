@@ -0,0 +1,26 @@
+package rag
+
+import (
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAssembleRagMessages(t *testing.T) {
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "What is the travel budget?"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "30.000 euro in 2024."},
+		{Role: openai.ChatMessageRoleUser, Content: "And in 2023?"},
+		{Role: openai.ChatMessageRoleAssistant, Content: " "},
+	}
+
+	assembled := AssembleRagMessages(messages, "Travel: 40.000 euro", "What was the travel budget in 2023?")
+	assert.Len(t, assembled, 5)
+	// The history is kept, the documents come right before the last question
+	assert.Equal(t, messages[:2], assembled[:2])
+	assert.Equal(t, openai.ChatMessageRoleSystem, assembled[2].Role)
+	assert.Contains(t, assembled[2].Content, "Travel: 40.000 euro")
+	assert.Contains(t, assembled[2].Content, "What was the travel budget in 2023?")
+	assert.Equal(t, messages[2:], assembled[3:])
+	assert.Len(t, messages, 4)
+}
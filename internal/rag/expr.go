@@ -0,0 +1,54 @@
+package rag
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	exprPlaceholder = regexp.MustCompile(`\{(\w+)\}`)
+	// exprValue is what a parameter may hold: ids of files, accounts and partitions
+	exprValue = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// filterExpr fills the {name} placeholders of a Milvus filter expression with the quoted params, a
+// []string becomes a list for "in" and an int64 is put in as it is. The SDK has no expression parameters, so values are limited to id
+// characters instead and can never change the expression itself.
+func filterExpr(template string, params map[string]interface{}) (string, error) {
+	var err error
+	expr := exprPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		var quoted string
+		switch value := params[name].(type) {
+		case int64:
+			quoted = strconv.FormatInt(value, 10)
+		case string:
+			quoted, err = quoteExprValue(name, value, err)
+		case []string:
+			values := make([]string, len(value))
+			for i, v := range value {
+				values[i], err = quoteExprValue(name, v, err)
+			}
+			quoted = "[" + strings.Join(values, ",") + "]"
+		default:
+			if err == nil {
+				err = fmt.Errorf("no value for %s in filter", placeholder)
+			}
+		}
+		return quoted
+	})
+	if err != nil {
+		return "", err
+	}
+	return expr, nil
+}
+
+// quoteExprValue keeps the first error, so the caller reports the value that failed first
+func quoteExprValue(name string, value string, err error) (string, error) {
+	if err == nil && !exprValue.MatchString(value) {
+		err = fmt.Errorf("invalid value for %s in filter: %q", name, value)
+	}
+	return `"` + value + `"`, err
+}
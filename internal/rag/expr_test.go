@@ -0,0 +1,23 @@
+package rag
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFilterExpr(t *testing.T) {
+	expr, err := filterExpr("account == {account} && fileId in {files}", map[string]interface{}{
+		"account": "4f1c-9a",
+		"files":   []string{"a_1", "b-2"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `account == "4f1c-9a" && fileId in ["a_1","b-2"]`, expr)
+
+	// Values that would end the string and add conditions are refused
+	_, err = filterExpr("fileId == {file}", map[string]interface{}{"file": `x" || fileId != "`})
+	assert.Error(t, err)
+	_, err = filterExpr("fileId in {files}", map[string]interface{}{"files": []string{"ok", ""}})
+	assert.Error(t, err)
+	_, err = filterExpr("fileId == {file}", nil)
+	assert.Error(t, err)
+}
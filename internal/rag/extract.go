@@ -0,0 +1,129 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"gochat/internal/ai"
+	"gochat/internal/schema"
+	"gochat/internal/services"
+	"strings"
+)
+
+// extractionBatchSize is about how many characters of a document go into one extraction prompt
+const extractionBatchSize = 16000
+
+// fieldSchema is the JSON schema the model's answer has to follow, every field is present and may
+// be null
+func fieldSchema(fields []services.ExtractionField) json.RawMessage {
+	properties := map[string]interface{}{}
+	var required []string
+	for _, field := range fields {
+		property := map[string]interface{}{"description": field.Description}
+		switch field.Type {
+		case services.FieldDate:
+			property["type"] = []string{"string", "null"}
+			property["format"] = "date"
+		default:
+			property["type"] = []string{string(field.Type), "null"}
+		}
+		properties[field.Name] = property
+		required = append(required, field.Name)
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	})
+	return data
+}
+
+// describeFields lists the fields for the prompt, one per line
+func describeFields(fields []services.ExtractionField) string {
+	var lines []string
+	for _, field := range fields {
+		line := fmt.Sprintf("- %s (%s)", field.Name, field.Type)
+		if field.Description != "" {
+			line += ": " + field.Description
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// extractFields asks for the fields batch by batch, a field keeps the first value found. It stops
+// once every field has a value. Values that don't fit their field are dropped, the last problem is
+// returned with the required fields that were not found.
+func extractFields(texts []string, fields []services.ExtractionField, complete func(prompt string) (string, error)) (map[string]interface{}, error) {
+	batches := batchTexts(texts, extractionBatchSize)
+	if len(batches) == 0 {
+		return nil, fmt.Errorf("the document has no text")
+	}
+	record := map[string]interface{}{}
+	var problem error
+	for i, batch := range batches {
+		answer, err := complete(ExtractionPrompt(describeFields(fields), batch))
+		if err != nil {
+			return record, fmt.Errorf("failed to extract from part %d of %d: %w", i+1, len(batches), err)
+		}
+		values, err := services.ParseRecord(fields, answer)
+		if err != nil {
+			problem = err
+		}
+		for name, value := range values {
+			if _, ok := record[name]; !ok {
+				record[name] = value
+			}
+		}
+		if len(record) == len(fields) {
+			break
+		}
+	}
+	if missing := services.MissingFields(fields, record); len(missing) > 0 {
+		err := fmt.Errorf("required fields not found: %s", strings.Join(missing, ", "))
+		if problem != nil {
+			err = fmt.Errorf("%w (%s)", err, problem)
+		}
+		return record, err
+	}
+	return record, nil
+}
+
+// RunExtraction reads the files one by one and saves what was extracted from each, it runs after the
+// request so it gets a context of its own
+func RunExtraction(ctx context.Context, extractions *services.ExtractionService, files *services.FileService, extraction *services.ExtractionDto, list []schema.File) {
+	format := fieldSchema(extraction.Fields)
+	complete := func(prompt string) (string, error) {
+		return ai.GetJSONCompletion(ai.ChatModel, []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: prompt},
+		}, "extraction", format)
+	}
+	for _, file := range list {
+		record, err := extractFile(ctx, files, file, extraction.Fields, complete)
+		if err != nil {
+			fmt.Printf("extraction %s of %s: %s\n", extraction.ID, file.ID, err)
+		}
+		if err := extractions.SaveResult(ctx, extraction.ID, file.ID, record, err); err != nil {
+			fmt.Println("Error saving extraction result: " + err.Error())
+		}
+	}
+}
+
+func extractFile(ctx context.Context, files *services.FileService, file schema.File, fields []services.ExtractionField, complete func(string) (string, error)) (map[string]interface{}, error) {
+	_, content, err := files.Open(ctx, file.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	text, err := ExtractText(file.Name, content)
+	if err != nil {
+		return nil, err
+	}
+	var texts []string
+	for _, chunk := range SplitChunks(text) {
+		texts = append(texts, chunk.Text)
+	}
+	return extractFields(texts, fields, complete)
+}
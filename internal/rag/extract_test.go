@@ -0,0 +1,63 @@
+package rag
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gochat/internal/services"
+	"strings"
+	"testing"
+)
+
+func TestFieldSchema(t *testing.T) {
+	var schema struct {
+		Properties map[string]struct {
+			Type   []string `json:"type"`
+			Format string   `json:"format"`
+		} `json:"properties"`
+		Required []string `json:"required"`
+	}
+	fields := []services.ExtractionField{
+		{Name: "respondents", Type: services.FieldInteger, Description: "number of people who answered"},
+		{Name: "start", Type: services.FieldDate},
+	}
+	assert.NoError(t, json.Unmarshal(fieldSchema(fields), &schema))
+	assert.Equal(t, []string{"respondents", "start"}, schema.Required)
+	assert.Equal(t, []string{"integer", "null"}, schema.Properties["respondents"].Type)
+	assert.Equal(t, []string{"string", "null"}, schema.Properties["start"].Type)
+	assert.Equal(t, "date", schema.Properties["start"].Format)
+	assert.Equal(t, "- respondents (integer): number of people who answered\n- start (date)", describeFields(fields))
+}
+
+func TestExtractFields(t *testing.T) {
+	fields := []services.ExtractionField{
+		{Name: "respondents", Type: services.FieldInteger, Required: true},
+		{Name: "share", Type: services.FieldNumber},
+	}
+	chunk := strings.Repeat("x", extractionBatchSize-10)
+
+	// Fields keep the first value found, the search stops once all are found
+	answers := []string{`{"respondents": null, "share": 12}`, `{"respondents": 352, "share": 40}`, `{"respondents": 1}`}
+	var prompts []string
+	complete := func(prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		return answers[len(prompts)-1], nil
+	}
+	record, err := extractFields([]string{chunk, chunk, chunk}, fields, complete)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"respondents": 352.0, "share": 12.0}, record)
+	assert.Len(t, prompts, 2)
+	assert.Contains(t, prompts[0], "- respondents (integer)")
+
+	// A required field that is never found fails the file, with the values that were found
+	answers, prompts = []string{`{"respondents": "veel", "share": 12}`}, nil
+	record, err = extractFields([]string{"Veel ouders deden mee"}, fields, complete)
+	assert.ErrorContains(t, err, "required fields not found: respondents")
+	assert.ErrorContains(t, err, "veel")
+	assert.Equal(t, map[string]interface{}{"share": 12.0}, record)
+
+	_, err = extractFields(nil, fields, complete)
+	assert.Error(t, err)
+	_, err = extractFields([]string{"tekst"}, fields, func(string) (string, error) { return "", errors.New("timeout") })
+	assert.ErrorContains(t, err, "timeout")
+}
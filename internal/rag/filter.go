@@ -0,0 +1,85 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"gochat/internal/schema"
+	"strings"
+	"time"
+)
+
+// ErrNoMetadata is returned for tag and date filters on a collection from before metadata was stored
+var ErrNoMetadata = errors.New("the documents have no metadata to filter on yet, re-index them first")
+
+// Source is the file chunks come from, it is stored with every chunk
+type Source struct {
+	FileID     string
+	Account    string
+	FileName   string
+	UploadedAt time.Time
+	Tags       []string
+}
+
+// SourceOf describes a stored file, it was uploaded when it was created
+func SourceOf(file schema.File, account string, tags []string) Source {
+	uploadedAt, _ := time.Parse(time.DateTime, file.Createdat)
+	return Source{
+		FileID:     file.ID,
+		Account:    account,
+		FileName:   file.Name,
+		UploadedAt: uploadedAt,
+		Tags:       tags,
+	}
+}
+
+// Filter narrows a search down, empty fields don't filter
+type Filter struct {
+	FileIDs []string `json:"fileIds,omitempty"`
+	// Tags matches the files with any of them
+	Tags []string `json:"tags,omitempty"`
+	// From and Until are upload dates as YYYY-MM-DD, both days included
+	From  string `json:"from,omitempty"`
+	Until string `json:"until,omitempty"`
+}
+
+func (f Filter) Empty() bool {
+	return len(f.FileIDs) == 0 && len(f.Tags) == 0 && f.From == "" && f.Until == ""
+}
+
+// expr returns the filter as an expression for filterExpr
+func (f Filter) expr(index Index) (string, map[string]interface{}, error) {
+	var conditions []string
+	params := map[string]interface{}{}
+	if len(f.FileIDs) > 0 {
+		conditions = append(conditions, "fileId in {files}")
+		params["files"] = f.FileIDs
+	}
+	if (len(f.Tags) > 0 || f.From != "" || f.Until != "") && !index.HasMetadata {
+		return "", nil, ErrNoMetadata
+	}
+	if len(f.Tags) > 0 {
+		tags := make([]string, len(f.Tags))
+		for i, tag := range f.Tags {
+			tags[i] = strings.ToLower(strings.TrimSpace(tag))
+		}
+		conditions = append(conditions, "array_contains_any(tags, {tags})")
+		params["tags"] = tags
+	}
+	if f.From != "" {
+		from, err := time.Parse(time.DateOnly, f.From)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid from date %q, use YYYY-MM-DD", f.From)
+		}
+		conditions = append(conditions, "uploadedAt >= {from}")
+		params["from"] = from.Unix()
+	}
+	if f.Until != "" {
+		until, err := time.Parse(time.DateOnly, f.Until)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid until date %q, use YYYY-MM-DD", f.Until)
+		}
+		conditions = append(conditions, "uploadedAt < {until}")
+		params["until"] = until.AddDate(0, 0, 1).Unix()
+	}
+	return strings.Join(conditions, " && "), params, nil
+}
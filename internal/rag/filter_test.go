@@ -0,0 +1,28 @@
+package rag
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	index := Index{HasAccount: true, HasMetadata: true}
+	filter := Filter{FileIDs: []string{"f1", "f2"}, Tags: []string{"2024-Budget"}, From: "2024-01-01", Until: "2024-01-31"}
+	expr, params, err := filter.expr(index)
+	assert.NoError(t, err)
+	expr, err = accountFilter(index, "A1234", expr, params)
+	assert.NoError(t, err)
+	assert.Equal(t, `account == "A1234" && (fileId in ["f1","f2"] && array_contains_any(tags, ["2024-budget"]) && uploadedAt >= 1704067200 && uploadedAt < 1706745600)`, expr)
+
+	// Collections from before metadata can only filter on files
+	_, _, err = Filter{Tags: []string{"x"}}.expr(Index{})
+	assert.ErrorIs(t, err, ErrNoMetadata)
+	expr, params, err = Filter{FileIDs: []string{"f1"}}.expr(Index{})
+	assert.NoError(t, err)
+	expr, err = accountFilter(Index{}, "A1234", expr, params)
+	assert.NoError(t, err)
+	assert.Equal(t, `fileId in ["f1"]`, expr)
+
+	_, _, err = Filter{From: "01-01-2024"}.expr(index)
+	assert.Error(t, err)
+}
@@ -2,26 +2,95 @@ package rag
 
 import (
 	"context"
+	"fmt"
 	"github.com/milvus-io/milvus-sdk-go/v2/client"
 	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+	"os"
+	"strconv"
+	"time"
 )
 
-// CreateFAQCollection creates the FAQ collection in Milvus if it doesn't exist
+const (
+	// documentsAlias points at the collection in use, a re-index builds a new collection and moves it
+	documentsAlias = "documents_active"
+	// Collections record what their vectors were made with
+	propertyModel   = "gochat.embedding_model"
+	propertyChunker = "gochat.chunker_version"
+	// The first collection, "documents", was created before models were recorded
+	legacyModel = "mxbai-embed-large"
+)
+
+// Index describes a documents collection and what its vectors were made with
+type Index struct {
+	Collection string
+	Model      string
+	Dim        int
+	Chunker    int
+	// HasAccount is false for collections from before vectors recorded their account, a re-index
+	// builds one that has it
+	HasAccount bool
+	// HasMetadata is false for collections from before chunks stored their file name, page, section,
+	// upload date and tags
+	HasMetadata bool
+}
+
+// metadataFields are the fields a collection with metadata has on top of text and fileId
+var metadataFields = []string{"fileName", "page", "section", "uploadedAt", "tags"}
+
+// ConfiguredIndex is what new collections are built with, EMBEDDING_MODEL and EMBEDDING_DIM change it.
+// An existing collection keeps its model until a re-index replaces it.
+func ConfiguredIndex() (Index, error) {
+	index := Index{Model: legacyModel, Dim: 1024, Chunker: ChunkerVersion, HasAccount: true, HasMetadata: true}
+	if model := os.Getenv("EMBEDDING_MODEL"); model != "" {
+		index.Model = model
+	}
+	if dim := os.Getenv("EMBEDDING_DIM"); dim != "" {
+		d, err := strconv.Atoi(dim)
+		if err != nil || d <= 0 {
+			return Index{}, fmt.Errorf("invalid EMBEDDING_DIM %q", dim)
+		}
+		index.Dim = d
+	}
+	return index, nil
+}
+
+// CreateDocumentsCollection makes sure the documents alias points at a collection. The collection
+// from before aliases is adopted as it is, a new install gets one built for the configured model.
 func CreateDocumentsCollection(ctx context.Context, client client.Client) error {
-	// Check if collection exists first
-	has, err := client.HasCollection(ctx, "documents")
+	// Check if the alias exists first
+	has, err := client.HasCollection(ctx, documentsAlias)
 	if err != nil {
 		return err
 	}
-
 	if has {
-		// Collection already exists, no need to create
+		// Already set up, no need to create
 		return nil
 	}
 
+	has, err = client.HasCollection(ctx, collectionName)
+	if err != nil {
+		return err
+	}
+	if has {
+		return client.CreateAlias(ctx, collectionName, documentsAlias)
+	}
+
+	index, err := ConfiguredIndex()
+	if err != nil {
+		return err
+	}
+	index.Collection = collectionName
+	if err := createIndexCollection(ctx, client, index); err != nil {
+		return err
+	}
+	return client.CreateAlias(ctx, collectionName, documentsAlias)
+}
+
+// createIndexCollection creates and loads an empty collection for index
+func createIndexCollection(ctx context.Context, milvusClient client.Client, index Index) error {
 	// Define schema for the collection
 	schema := &entity.Schema{
-		CollectionName: "documents",
+		CollectionName: index.Collection,
 		Description:    "documents collection",
 		Fields: []*entity.Field{
 			{
@@ -41,7 +110,7 @@ func CreateDocumentsCollection(ctx context.Context, client client.Client) error
 				Name:     "embedding",
 				DataType: entity.FieldTypeFloatVector,
 				TypeParams: map[string]string{
-					"dim": "1024",
+					"dim": strconv.Itoa(index.Dim),
 				},
 			},
 			{
@@ -51,11 +120,56 @@ func CreateDocumentsCollection(ctx context.Context, client client.Client) error
 					"max_length": "2048",
 				},
 			},
+			// Every search and delete filters on the account. A partition key would be the Milvus way,
+			// but those can't be combined with the partitions of conversations and knowledge bases.
+			{
+				Name:     "account",
+				DataType: entity.FieldTypeVarChar,
+				TypeParams: map[string]string{
+					"max_length": "64",
+				},
+			},
+			// Metadata of the chunk that searches filter on and return
+			{
+				Name:     "fileName",
+				DataType: entity.FieldTypeVarChar,
+				TypeParams: map[string]string{
+					"max_length": "512",
+				},
+			},
+			{
+				Name:     "page",
+				DataType: entity.FieldTypeInt64,
+			},
+			{
+				Name:     "section",
+				DataType: entity.FieldTypeVarChar,
+				TypeParams: map[string]string{
+					"max_length": "512",
+				},
+			},
+			// Unix seconds
+			{
+				Name:     "uploadedAt",
+				DataType: entity.FieldTypeInt64,
+			},
+			{
+				Name:        "tags",
+				DataType:    entity.FieldTypeArray,
+				ElementType: entity.FieldTypeVarChar,
+				TypeParams: map[string]string{
+					"max_capacity": "32",
+					"max_length":   "64",
+				},
+			},
 		},
 	}
 
 	// Create collection
-	err = client.CreateCollection(ctx, schema, int32(2))
+	err := milvusClient.CreateCollection(ctx, schema, int32(2),
+		client.WithCollectionProperty(propertyModel, index.Model),
+		client.WithCollectionProperty(propertyChunker, strconv.Itoa(index.Chunker)),
+	)
 	if err != nil {
 		return err
 	}
@@ -66,16 +180,135 @@ func CreateDocumentsCollection(ctx context.Context, client client.Client) error
 		return err
 	}
 
-	err = client.CreateIndex(ctx, "documents", "embedding", idx, false)
+	err = milvusClient.CreateIndex(ctx, index.Collection, "embedding", idx, false)
 	if err != nil {
 		return err
 	}
 
 	// Load collection to memory
-	err = client.LoadCollection(ctx, "documents", false)
+	return milvusClient.LoadCollection(ctx, index.Collection, false)
+}
+
+// activeIndex describes the collection the documents alias points at
+func activeIndex(ctx context.Context, milvusClient client.Client) (Index, error) {
+	collection, err := milvusClient.DescribeCollection(ctx, documentsAlias)
+	if err != nil {
+		return Index{}, fmt.Errorf("failed to describe %s: %w", documentsAlias, err)
+	}
+
+	index := Index{Collection: collection.Name, Model: legacyModel, Chunker: 1}
+	for _, field := range collection.Schema.Fields {
+		switch field.Name {
+		case "embedding":
+			index.Dim, _ = strconv.Atoi(field.TypeParams["dim"])
+		case "account":
+			index.HasAccount = true
+		case "fileName":
+			index.HasMetadata = true
+		}
+	}
+	if model, ok := collection.Properties[propertyModel]; ok {
+		index.Model = model
+	}
+	if chunker, ok := collection.Properties[propertyChunker]; ok {
+		index.Chunker, _ = strconv.Atoi(chunker)
+	}
+	return index, nil
+}
+
+// accountFilter limits expr to the vectors of account. Collections without accounts rely on the
+// ownership checks of the conversations and files alone.
+func accountFilter(index Index, account string, expr string, params map[string]interface{}) (string, error) {
+	if index.HasAccount {
+		if expr == "" {
+			expr = "account == {account}"
+		} else {
+			expr = "account == {account} && (" + expr + ")"
+		}
+		if params == nil {
+			params = map[string]interface{}{}
+		}
+		params["account"] = account
+	}
+	return filterExpr(expr, params)
+}
+
+// chunkFields are the output fields chunksFrom reads
+func chunkFields(index Index, extra ...string) []string {
+	fields := append([]string{"text", "fileId"}, extra...)
+	if index.HasMetadata {
+		fields = append(fields, metadataFields...)
+	}
+	return fields
+}
+
+// chunksFrom reads the rows of a search or query with chunkFields, scores are left for the caller
+func chunksFrom(columns client.ResultSet, count int) []SearchResult {
+	textCol, fileIDCol := columns.GetColumn("text"), columns.GetColumn("fileId")
+	fileNameCol, pageCol, sectionCol := columns.GetColumn("fileName"), columns.GetColumn("page"), columns.GetColumn("section")
+	uploadedAtCol := columns.GetColumn("uploadedAt")
+	tagsCol, _ := columns.GetColumn("tags").(*entity.ColumnVarCharArray)
+
+	results := make([]SearchResult, 0, count)
+	for i := 0; i < count; i++ {
+		var result SearchResult
+		if textCol != nil {
+			result.Text, _ = textCol.GetAsString(i)
+		}
+		if fileIDCol != nil {
+			result.FileID, _ = fileIDCol.GetAsString(i)
+		}
+		if fileNameCol != nil {
+			result.FileName, _ = fileNameCol.GetAsString(i)
+		}
+		if pageCol != nil {
+			page, _ := pageCol.GetAsInt64(i)
+			result.Page = int(page)
+		}
+		if sectionCol != nil {
+			result.Section, _ = sectionCol.GetAsString(i)
+		}
+		if uploadedAtCol != nil {
+			if seconds, _ := uploadedAtCol.GetAsInt64(i); seconds > 0 {
+				uploadedAt := time.Unix(seconds, 0).UTC()
+				result.UploadedAt = &uploadedAt
+			}
+		}
+		if tagsCol != nil {
+			tags, _ := tagsCol.ValueByIdx(i)
+			for _, tag := range tags {
+				result.Tags = append(result.Tags, string(tag))
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// ActiveIndex describes the collection that searches and uploads currently use
+func ActiveIndex(ctx context.Context) (Index, error) {
+	milvusClient, err := InitMilvusClient(ctx)
+	if err != nil {
+		return Index{}, err
+	}
+	defer milvusClient.Close()
+	return activeIndex(ctx, milvusClient)
+}
+
+// DropCollection removes a collection the documents alias no longer points at
+func DropCollection(ctx context.Context, name string) error {
+	milvusClient, err := InitMilvusClient(ctx)
 	if err != nil {
 		return err
 	}
+	defer milvusClient.Close()
 
-	return nil
+	index, err := activeIndex(ctx, milvusClient)
+	if err != nil {
+		return err
+	}
+	if index.Collection == name {
+		return fmt.Errorf("%s is in use", name)
+	}
+	return milvusClient.DropCollection(ctx, name)
 }
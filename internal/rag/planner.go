@@ -0,0 +1,175 @@
+package rag
+
+import (
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// historyTurns is how many earlier messages the planner sees when it rewrites a follow-up
+const historyTurns = 6
+
+// listMarker is how models start the lines of a list, "1. ", "2) " or "- "
+var listMarker = regexp.MustCompile(`^(\d+[.)]|[-*•])\s+`)
+
+// PlannerConfig says how many extra searches a question gets, RAG_PARAPHRASES and RAG_HYDE opt in
+type PlannerConfig struct {
+	// Paraphrases is how many other phrasings of the question are searched too, each costs a search
+	// and a first question a call to the model it otherwise doesn't need
+	Paraphrases int
+	// HyDE also searches a made up passage that would answer the question, it is phrased like the
+	// documents are where a question is not
+	HyDE bool
+}
+
+func ConfiguredPlanner() PlannerConfig {
+	var config PlannerConfig
+	if paraphrases, err := strconv.Atoi(os.Getenv("RAG_PARAPHRASES")); err == nil && paraphrases >= 0 {
+		config.Paraphrases = min(paraphrases, 5)
+	}
+	if hyde, err := strconv.ParseBool(os.Getenv("RAG_HYDE")); err == nil {
+		config.HyDE = hyde
+	}
+	return config
+}
+
+// RetrievalPlan is what gets searched for the last question of a conversation
+type RetrievalPlan struct {
+	// Question is what the user typed
+	Question string
+	// Query is the question rewritten to stand on its own, the answer is prompted with it
+	Query string
+	// Searches has the query first, then paraphrases and the HyDE passage
+	Searches []string
+}
+
+// PlanRetrieval condenses the conversation into a standalone query and adds the extra searches of
+// config. complete asks the chat model, when it fails the plan falls back to the question as typed.
+func PlanRetrieval(messages []openai.ChatCompletionMessage, config PlannerConfig, complete func(prompt string) (string, error)) RetrievalPlan {
+	var history []openai.ChatCompletionMessage
+	question := ""
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == openai.ChatMessageRoleUser {
+			question = strings.TrimSpace(extractTextFromMessage(messages[i]))
+			history = messages[:i]
+			break
+		}
+	}
+	plan := RetrievalPlan{Question: question, Query: question}
+	if question == "" {
+		return plan
+	}
+
+	transcript := formatHistory(history)
+	// A first question stands on its own already, it is only sent to the model for paraphrases
+	if transcript != "" || config.Paraphrases > 0 {
+		response, err := complete(QueryRewritePrompt(transcript, question, config.Paraphrases))
+		if err != nil {
+			fmt.Println("Error rewriting query: " + err.Error())
+		} else {
+			lines := responseLines(response)
+			if len(lines) > 0 {
+				plan.Query = lines[0]
+			}
+			for _, line := range lines[1:] {
+				if len(plan.Searches) < config.Paraphrases {
+					plan.Searches = append(plan.Searches, line)
+				}
+			}
+		}
+	}
+	plan.Searches = append([]string{plan.Query}, plan.Searches...)
+
+	if config.HyDE {
+		passage, err := complete(HyDEPrompt(plan.Query))
+		if err != nil {
+			fmt.Println("Error writing hypothetical passage: " + err.Error())
+		} else if passage = strings.TrimSpace(passage); passage != "" {
+			plan.Searches = append(plan.Searches, passage)
+		}
+	}
+	plan.Searches = dedupe(plan.Searches)
+	return plan
+}
+
+// formatHistory writes the last turns before the question as a transcript, system prompts left out
+func formatHistory(messages []openai.ChatCompletionMessage) string {
+	var turns []string
+	for _, message := range messages {
+		text := strings.TrimSpace(extractTextFromMessage(message))
+		if text == "" || (message.Role != openai.ChatMessageRoleUser && message.Role != openai.ChatMessageRoleAssistant) {
+			continue
+		}
+		turns = append(turns, message.Role+": "+text)
+	}
+	if len(turns) > historyTurns {
+		turns = turns[len(turns)-historyTurns:]
+	}
+	return strings.Join(turns, "\n")
+}
+
+// responseLines returns the non-empty lines of a model response without list markers or quotes
+func responseLines(response string) []string {
+	var lines []string
+	for _, line := range strings.Split(response, "\n") {
+		line = listMarker.ReplaceAllString(strings.TrimSpace(line), "")
+		line = strings.TrimSpace(strings.Trim(line, `"`))
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func dedupe(texts []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, text := range texts {
+		key := strings.ToLower(text)
+		if !seen[key] {
+			seen[key] = true
+			result = append(result, text)
+		}
+	}
+	return result
+}
+
+// rrfK dampens the weight of the first ranks, 60 is what the reciprocal rank fusion paper uses
+const rrfK = 60
+
+// FuseResults merges the results of several searches with reciprocal rank fusion. A chunk found by
+// several searches moves up, it keeps its best similarity score.
+func FuseResults(lists [][]SearchResult, topK int) []SearchResult {
+	fused := map[string]float64{}
+	best := map[string]SearchResult{}
+	for _, list := range lists {
+		for rank, result := range list {
+			fused[result.Text] += 1 / float64(rrfK+rank+1)
+			if current, ok := best[result.Text]; !ok || result.Score > current.Score {
+				best[result.Text] = result
+			}
+		}
+	}
+
+	results := make([]SearchResult, 0, len(best))
+	for _, result := range best {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if fused[results[i].Text] != fused[results[j].Text] {
+			return fused[results[i].Text] > fused[results[j].Text]
+		}
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Text < results[j].Text
+	})
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	return results
+}
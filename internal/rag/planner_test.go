@@ -0,0 +1,80 @@
+package rag
+
+import (
+	"errors"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestPlanRetrieval(t *testing.T) {
+	var prompts []string
+	complete := func(response string, err error) func(string) (string, error) {
+		return func(prompt string) (string, error) {
+			prompts = append(prompts, prompt)
+			if strings.Contains(prompt, "passage") {
+				return "The 2023 travel budget was 40.000 euro.", nil
+			}
+			return response, err
+		}
+	}
+	first := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "You are helpful"},
+		{Role: openai.ChatMessageRoleUser, Content: "What is the travel budget?"},
+	}
+	followUp := append(first,
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "30.000 euro in 2024."},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, MultiContent: []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: "And in 2023?"},
+		}},
+		// The client sends the empty answer it streams into
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant},
+	)
+
+	// A first question without paraphrases is searched as typed
+	plan := PlanRetrieval(first, PlannerConfig{}, complete("", nil))
+	assert.Empty(t, prompts)
+	assert.Equal(t, RetrievalPlan{Question: "What is the travel budget?", Query: "What is the travel budget?", Searches: []string{"What is the travel budget?"}}, plan)
+
+	// A follow-up is rewritten, the list markers of the paraphrases are dropped
+	plan = PlanRetrieval(followUp, PlannerConfig{Paraphrases: 2}, complete("What was the travel budget in 2023?\n1. How much was budgeted for travel in 2023?\n2. what was the travel budget in 2023?\n3. 2023 travel costs", nil))
+	assert.Len(t, prompts, 1)
+	assert.Contains(t, prompts[0], "assistant: 30.000 euro in 2024.")
+	assert.NotContains(t, prompts[0], "You are helpful")
+	assert.Equal(t, "And in 2023?", plan.Question)
+	assert.Equal(t, "What was the travel budget in 2023?", plan.Query)
+	assert.Equal(t, []string{"What was the travel budget in 2023?", "How much was budgeted for travel in 2023?"}, plan.Searches)
+
+	// The HyDE passage is searched last
+	prompts = nil
+	plan = PlanRetrieval(followUp, PlannerConfig{HyDE: true}, complete("What was the travel budget in 2023?", nil))
+	assert.Len(t, prompts, 2)
+	assert.Equal(t, []string{"What was the travel budget in 2023?", "The 2023 travel budget was 40.000 euro."}, plan.Searches)
+
+	// Without a rewrite the question is searched as typed
+	plan = PlanRetrieval(followUp, PlannerConfig{Paraphrases: 2}, complete("", errors.New("rate limited")))
+	assert.Equal(t, "And in 2023?", plan.Query)
+	assert.Equal(t, []string{"And in 2023?"}, plan.Searches)
+}
+
+func TestFuseResults(t *testing.T) {
+	lists := [][]SearchResult{
+		{{Text: "a", Score: 0.9}, {Text: "b", Score: 0.8}, {Text: "c", Score: 0.7}},
+		{{Text: "c", Score: 0.85}, {Text: "d", Score: 0.6}},
+	}
+
+	results := FuseResults(lists, 3)
+	// c is found by both searches and keeps its best score
+	assert.Equal(t, []SearchResult{{Text: "c", Score: 0.85}, {Text: "a", Score: 0.9}, {Text: "b", Score: 0.8}}, results)
+}
+
+func TestConfiguredPlanner(t *testing.T) {
+	t.Setenv("RAG_PARAPHRASES", "")
+	t.Setenv("RAG_HYDE", "")
+	assert.Equal(t, PlannerConfig{}, ConfiguredPlanner())
+
+	t.Setenv("RAG_PARAPHRASES", "9")
+	t.Setenv("RAG_HYDE", "true")
+	assert.Equal(t, PlannerConfig{Paraphrases: 5, HyDE: true}, ConfiguredPlanner())
+}
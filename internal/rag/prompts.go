@@ -89,7 +89,7 @@ If you understand, answer the user question given the provided data.
 
 func RAGDeterminationPrompt(query string, documentContext string) string {
 	return fmt.Sprintf(`You are a binary classifier tasked with determining whether to use Retrieval-Augmented Generation (RAG) for the given query.
-OUTPUT FORMAT: Respond ONLY with "YES" or "NO"
+OUTPUT FORMAT: "YES" or "NO" on the first line, then one line starting with "REASON:"
 DECISION CRITERIA:
 
 YES if:
@@ -112,3 +112,85 @@ OUTPUT: [YES/NO]
 REASON: [Your reasoning]
 `, documentContext, query)
 }
+
+// QueryRewritePrompt asks for the question as a standalone search query on the first line and
+// paraphrases of it on the lines after
+func QueryRewritePrompt(history string, question string, paraphrases int) string {
+	if history == "" {
+		history = "(no earlier messages)"
+	}
+	return fmt.Sprintf(`You rewrite questions from a chat into search queries for a document search.
+
+TASK:
+1. Rewrite the LAST QUESTION so it can be understood without the conversation. Resolve references like "it", "that report" or "and what about 2023?" using the conversation. Keep names, numbers and dates. Keep the language of the question. If it already stands on its own, repeat it unchanged.
+2. Then write %d other phrasings of the rewritten question, using different words someone might find in the documents.
+
+OUTPUT FORMAT: one query per line, the rewritten question first. No numbering, no explanations.
+
+CONVERSATION:
+%s
+
+LAST QUESTION: %s
+`, paraphrases, history, question)
+}
+
+// HyDEPrompt asks for a made up passage that answers the query, it is searched for similar passages
+func HyDEPrompt(query string) string {
+	return fmt.Sprintf(`Write a short passage, at most 5 sentences, that could appear in a document and answers the question below. Write it in the style of a report, in the language of the question. Invent plausible details if you have to, it is only used to find similar passages. Output only the passage.
+
+QUESTION: %s
+`, query)
+}
+
+// RagContextPrompt is the context message put before the last question of a conversation, query is
+// the question as it was searched
+func RagContextPrompt(documentContext string, query string) string {
+	return fmt.Sprintf(`# RETRIEVED DOCUMENTS #
+The passages below were retrieved from the user's documents for their next message, searched as: %s
+
+Use them to answer the next message, together with the conversation so far.
+1. If the answer is in the documents, quote it verbatim and cite the source line of the passage.
+2. If the documents are relevant but incomplete, give an informed synthesis and say what is missing.
+3. If the documents do not contain the answer, say so instead of making one up.
+4. Always use the language used by the user.
+
+%s
+`, query, documentContext)
+}
+
+// SummaryPrompt asks for a summary of a document or of a part of one
+func SummaryPrompt(text string) string {
+	return fmt.Sprintf(`Summarize the text below, it is a document or a part of one. Keep the main points, conclusions, names, numbers and dates. Use at most 10 sentences or a short list of points. Write in the language of the text. Output only the summary.
+
+# TEXT #
+%s
+`, text)
+}
+
+// CombineSummariesPrompt asks for one summary of the summaries of the parts of a document, or of
+// several documents
+func CombineSummariesPrompt(summaries string) string {
+	return fmt.Sprintf(`Below are summaries of consecutive parts of a document, or of several documents. Combine them into one summary of the whole. Keep the main points, conclusions, names, numbers and dates, and leave out what is repeated. Use at most 15 sentences or a short list of points. Write in the language of the summaries. Output only the summary.
+
+# SUMMARIES #
+%s
+`, summaries)
+}
+
+// ExtractionPrompt asks for the fields as a JSON object, fields describes them one per line
+func ExtractionPrompt(fields string, text string) string {
+	return fmt.Sprintf(`Extract the fields below from the text of a document. Answer with a JSON object that has the field names as keys.
+
+RULES:
+1. Only use what the text states, use null for a field the text does not mention.
+2. Write numbers without units or thousands separators, a percentage as its number: 45%% becomes 45.
+3. Write dates as YYYY-MM-DD.
+4. Text fields are short and in the language of the document.
+
+# FIELDS #
+%s
+
+# TEXT #
+%s
+`, fields, text)
+}
@@ -2,6 +2,7 @@ package rag
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/milvus-io/milvus-sdk-go/v2/client"
@@ -14,20 +15,29 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
-type TextExtractor func(*multipart.FileHeader) (string, error)
+type TextExtractor func(io.Reader) (string, error)
 
 var extractors = map[string]TextExtractor{
 	".txt": getTextFromText,
 }
 
 const (
-	collectionName     = `documents`
-	dim                = 1024
-	relevanceThreshold = 10
+	collectionName = `documents`
+	// ChunkerVersion goes up whenever SplitText changes, files record the version they were split with
+	ChunkerVersion = 1
+)
+
+var (
+	sentenceEnd = regexp.MustCompile(`[\.\?]\s+|[\.\?]$`)
+	// markdownHeading captures the title of a Markdown heading line
+	markdownHeading = regexp.MustCompile(`(?m)^#{1,6}[ \t]+(.+?)[ \t#]*$`)
 )
 
 type Document struct {
@@ -35,30 +45,83 @@ type Document struct {
 	Embedding []float32 // Vector embedding
 	ID        int64
 	fileID    string
+	Page      int
+	Section   string
 }
 
 type SearchResult struct {
-	Text  string  // The text chunk
-	Score float32 // Similarity score
+	Text  string  `json:"text"`  // The text chunk
+	Score float32 `json:"score"` // Similarity score
+	// Where the chunk comes from, collections from before metadata was stored only know the file id
+	FileID     string     `json:"fileId"`
+	FileName   string     `json:"fileName,omitempty"`
+	Page       int        `json:"page,omitempty"`
+	Section    string     `json:"section,omitempty"`
+	UploadedAt *time.Time `json:"uploadedAt,omitempty"`
+	Tags       []string   `json:"tags,omitempty"`
+}
+
+// source names the file, page and section of the result, as far as they are known
+func (r SearchResult) source() string {
+	var parts []string
+	if r.FileName != "" {
+		parts = append(parts, r.FileName)
+	}
+	if r.Page > 0 {
+		parts = append(parts, fmt.Sprintf("page %d", r.Page))
+	}
+	if r.Section != "" {
+		parts = append(parts, r.Section)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Chunk is a piece of a file and where in the file it was found
+type Chunk struct {
+	Text string
+	// Page counts from 1 and goes up at every form feed, which is how extracted PDF text marks pages
+	Page int
+	// Section is the title of the last Markdown heading before the chunk
+	Section string
 }
 
 // SplitText splits the input text into strings based on new lines or sentence-ending punctuation.
 func SplitText(text string) []string {
+	chunks := SplitChunks(text)
+	result := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		result[i] = chunk.Text
+	}
+	return result
+}
 
-	re := regexp.MustCompile(`[\.\?]\s+|[\.\?]$`)
-	// Use the regex to split the text
-	sentences := re.Split(text, -1)
-
-	// Trim spaces from each resulting string and filter out empty results
-	var result []string
-	for _, sentence := range sentences {
+// SplitChunks splits like SplitText and also tells the page and section of every chunk
+func SplitChunks(text string) []Chunk {
+	headings := markdownHeading.FindAllStringSubmatchIndex(text, -1)
+	var chunks []Chunk
+	section, next := "", 0
+	add := func(start int, end int) {
+		// Trim spaces from each resulting string and filter out empty results
+		sentence := text[start:end]
 		trimmed := strings.TrimSpace(sentence)
-		if trimmed != "" {
-			result = append(result, trimmed)
+		if trimmed == "" {
+			return
+		}
+		offset := start + len(sentence) - len(strings.TrimLeftFunc(sentence, unicode.IsSpace))
+		for next < len(headings) && headings[next][0] <= offset {
+			section = text[headings[next][2]:headings[next][3]]
+			next++
 		}
+		chunks = append(chunks, Chunk{Text: trimmed, Page: strings.Count(text[:offset], "\f") + 1, Section: section})
 	}
 
-	return result
+	start := 0
+	for _, match := range sentenceEnd.FindAllStringIndex(text, -1) {
+		add(start, match[0])
+		start = match[1]
+	}
+	add(start, len(text))
+	return chunks
 }
 
 type EmbeddingWithOriginal struct {
@@ -66,25 +129,35 @@ type EmbeddingWithOriginal struct {
 	Text             string
 }
 
-func CreateChunkDocuments(ctx context.Context, text string, fileID string) ([]Document, error) {
+func CreateChunkDocuments(ctx context.Context, model string, text string, fileID string) ([]Document, error) {
 
-	texts := SplitText(text)
+	chunks := SplitChunks(text)
+	return embedChunks(ctx, model, chunks, fileID)
+}
+
+func embedChunks(ctx context.Context, model string, chunks []Chunk, fileID string) ([]Document, error) {
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
 	docs := make([]Document, 0, len(texts))
 	//fmt.Println("texts", texts)
-	embeddings, err := ai.GetEmbeddings(ctx, texts)
+	embeddings, err := ai.GetEmbeddings(ctx, model, texts)
 
 	if err != nil {
 		return nil, err
 	}
 
 	for i, embedding := range embeddings {
-		originalText := texts[embedding.Index]
+		chunk := chunks[embedding.Index]
 
 		doc := Document{
-			Text:      originalText,
+			Text:      chunk.Text,
 			Embedding: embedding.Embedding,
 			ID:        int64(i + 1),
 			fileID:    fileID,
+			Page:      chunk.Page,
+			Section:   chunk.Section,
 		}
 		docs = append(docs, doc)
 	}
@@ -127,8 +200,16 @@ func InitMilvusClient(ctx context.Context) (client.Client, error) {
 	return milvusClient, nil
 }
 
-// SaveDocuments Saves new documents to the Vector DB's conversation partition
-func SaveDocuments(ctx context.Context, docs []Document, fileID string, conversationID string) error {
+// Scope is what a search may see, the vectors of the account in the partitions of a conversation
+// and its knowledge bases, narrowed down by the filter of the request
+type Scope struct {
+	Account    string
+	Partitions []string
+	Filter     Filter
+}
+
+// SaveDocuments Saves new documents to the Vector DB's conversation partition of the index
+func SaveDocuments(ctx context.Context, index Index, docs []Document, source Source, conversationID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
@@ -136,41 +217,82 @@ func SaveDocuments(ctx context.Context, docs []Document, fileID string, conversa
 	if err != nil {
 		return err
 	}
+	defer milvusClient.Close()
+	return insertDocuments(ctx, milvusClient, index, docs, source, conversationID)
+}
+
+func insertDocuments(ctx context.Context, milvusClient client.Client, index Index, docs []Document, source Source, partitionName string) error {
+	if len(docs) == 0 {
+		return nil
+	}
 	// Prepare the data columns
 	numDocs := len(docs)
 
 	texts := make([]string, numDocs)
 	ids := make([]string, numDocs)
+	accounts := make([]string, numDocs)
 	embeddings := make([][]float32, numDocs)
+	fileNames := make([]string, numDocs)
+	pages := make([]int64, numDocs)
+	sections := make([]string, numDocs)
+	uploadedAts := make([]int64, numDocs)
+	tags := make([][][]byte, numDocs)
 
+	fileTags := make([][]byte, len(source.Tags))
+	for i, tag := range source.Tags {
+		fileTags[i] = []byte(tag)
+	}
 	// Split the data into columns
 	for i, doc := range docs {
 		texts[i] = strings.ToValidUTF8(doc.Text, "")
 		embeddings[i] = doc.Embedding
-		ids[i] = fileID
+		ids[i] = source.FileID
+		accounts[i] = source.Account
+		fileNames[i] = truncate(source.FileName, 512)
+		pages[i] = int64(doc.Page)
+		sections[i] = truncate(doc.Section, 512)
+		uploadedAts[i] = source.UploadedAt.Unix()
+		tags[i] = fileTags
 	}
 
-	partitionName := conversationID
-
-	err = milvusClient.CreatePartition(ctx, collectionName, partitionName)
+	has, err := milvusClient.HasPartition(ctx, index.Collection, partitionName)
 	if err != nil {
 		return err
 	}
+	if !has {
+		err = milvusClient.CreatePartition(ctx, index.Collection, partitionName)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Create column-based data
 	textCol := entity.NewColumnVarChar("text", texts)
 	fileIdCol := entity.NewColumnVarChar("fileId", ids)
-	embeddingCol := entity.NewColumnFloatVector("embedding", dim, embeddings)
+	embeddingCol := entity.NewColumnFloatVector("embedding", index.Dim, embeddings)
+	columns := []entity.Column{textCol, embeddingCol, fileIdCol}
+	if index.HasAccount {
+		if source.Account == "" {
+			return fmt.Errorf("account is required for %s", index.Collection)
+		}
+		columns = append(columns, entity.NewColumnVarChar("account", accounts))
+	}
+	if index.HasMetadata {
+		columns = append(columns,
+			entity.NewColumnVarChar("fileName", fileNames),
+			entity.NewColumnInt64("page", pages),
+			entity.NewColumnVarChar("section", sections),
+			entity.NewColumnInt64("uploadedAt", uploadedAts),
+			entity.NewColumnVarCharArray("tags", tags),
+		)
+	}
 
-	fmt.Println(textCol, embeddingCol, embeddingCol)
 	// Insert data
 	_, err = milvusClient.Insert(
 		ctx,
-		collectionName,
+		index.Collection,
 		partitionName,
-		textCol,
-		embeddingCol,
-		fileIdCol,
+		columns...,
 	)
 
 	if err != nil {
@@ -179,7 +301,7 @@ func SaveDocuments(ctx context.Context, docs []Document, fileID string, conversa
 	}
 
 	// Optional: Flush to make the data immediately searchable
-	err = milvusClient.Flush(ctx, collectionName, false)
+	err = milvusClient.Flush(ctx, index.Collection, false)
 	if err != nil {
 		return err
 	}
@@ -187,7 +309,21 @@ func SaveDocuments(ctx context.Context, docs []Document, fileID string, conversa
 	return nil
 }
 
-func RemoveDocumentsByFileId(ctx context.Context, fileID string, conversationID string) error {
+// truncate cuts s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, "")
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// RemoveDocumentsByFileId removes the file's chunks from a partition, or from every partition when it
+// is empty. The caller checked that the file and the partition belong to the user.
+func RemoveDocumentsByFileId(ctx context.Context, fileID string, account string, partition string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	milvusClient, err := InitMilvusClient(ctx)
@@ -195,9 +331,18 @@ func RemoveDocumentsByFileId(ctx context.Context, fileID string, conversationID
 		return err
 	}
 
-	expr := fmt.Sprintf("fileId == \"%s\"", fileID)
+	defer milvusClient.Close()
 
-	err = milvusClient.Delete(ctx, collectionName, conversationID, expr)
+	index, err := activeIndex(ctx, milvusClient)
+	if err != nil {
+		return err
+	}
+	expr, err := accountFilter(index, account, "fileId == {file}", map[string]interface{}{"file": fileID})
+	if err != nil {
+		return err
+	}
+
+	err = milvusClient.Delete(ctx, index.Collection, partition, expr)
 	if err != nil {
 		fmt.Println("Delete err:", err.Error())
 		return err
@@ -206,15 +351,57 @@ func RemoveDocumentsByFileId(ctx context.Context, fileID string, conversationID
 	return nil
 }
 
-func RemovePartition(ctx context.Context, conversationID string) error {
+// RemoveFiles removes the chunks of files from every partition, for files whose owner was deleted.
+// The ids go to Milvus in batches, a filter with thousands of them is refused.
+func RemoveFiles(ctx context.Context, account string, fileIDs []string) error {
+	if len(fileIDs) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	milvusClient, err := InitMilvusClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer milvusClient.Close()
+
+	index, err := activeIndex(ctx, milvusClient)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(fileIDs); start += 100 {
+		batch := fileIDs[start:min(start+100, len(fileIDs))]
+		expr, err := accountFilter(index, account, "fileId in {files}", map[string]interface{}{"files": batch})
+		if err != nil {
+			return err
+		}
+		if err := milvusClient.Delete(ctx, index.Collection, "", expr); err != nil {
+			return fmt.Errorf("failed to delete vectors: %w", err)
+		}
+	}
+	return nil
+}
+
+// RemovePartition drops a conversation's or knowledge base's partition, nothing was stored when it doesn't exist
+func RemovePartition(ctx context.Context, partition string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	milvusClient, err := InitMilvusClient(ctx)
 	if err != nil {
 		return err
 	}
+	defer milvusClient.Close()
+
+	index, err := activeIndex(ctx, milvusClient)
+	if err != nil {
+		return err
+	}
+	has, err := milvusClient.HasPartition(ctx, index.Collection, partition)
+	if err != nil || !has {
+		return err
+	}
 
-	err = milvusClient.DropPartition(ctx, collectionName, conversationID)
+	err = milvusClient.DropPartition(ctx, index.Collection, partition)
 	if err != nil {
 		fmt.Println("Delete err:", err.Error())
 		return err
@@ -223,102 +410,228 @@ func RemovePartition(ctx context.Context, conversationID string) error {
 	return nil
 }
 
+// CopyFileToPartition copies the chunks of a file, wherever they are, into partition. Knowledge bases
+// get their own copy, so they keep working when the conversation the file was uploaded in is deleted.
+func CopyFileToPartition(ctx context.Context, source Source, partition string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	milvusClient, err := InitMilvusClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer milvusClient.Close()
+
+	index, err := activeIndex(ctx, milvusClient)
+	if err != nil {
+		return err
+	}
+	expr, err := accountFilter(index, source.Account, "fileId == {file}", map[string]interface{}{"file": source.FileID})
+	if err != nil {
+		return err
+	}
+	rows, err := milvusClient.Query(ctx, index.Collection, nil, expr, chunkFields(index, "embedding"), client.WithLimit(16384))
+	if err != nil {
+		return fmt.Errorf("failed to read chunks: %w", err)
+	}
+	vectors, ok := rows.GetColumn("embedding").(*entity.ColumnFloatVector)
+	if !ok || vectors.Len() == 0 {
+		return fmt.Errorf("file %s has no chunks", source.FileID)
+	}
+
+	// The file may be in several partitions already, one copy of each chunk is enough
+	seen := map[string]bool{}
+	var docs []Document
+	for i, chunk := range chunksFrom(rows, vectors.Len()) {
+		if seen[chunk.Text] {
+			continue
+		}
+		seen[chunk.Text] = true
+		docs = append(docs, Document{
+			Text:      chunk.Text,
+			Embedding: vectors.Data()[i],
+			fileID:    source.FileID,
+			Page:      chunk.Page,
+			Section:   chunk.Section,
+		})
+	}
+
+	if err := removeFromPartition(ctx, milvusClient, index, source.FileID, source.Account, partition); err != nil {
+		return err
+	}
+	return insertDocuments(ctx, milvusClient, index, docs, source, partition)
+}
+
+// removeFromPartition deletes the file's chunks from partition, if it exists
+func removeFromPartition(ctx context.Context, milvusClient client.Client, index Index, fileID string, account string, partition string) error {
+	has, err := milvusClient.HasPartition(ctx, index.Collection, partition)
+	if err != nil || !has {
+		return err
+	}
+	expr, err := accountFilter(index, account, "fileId == {file}", map[string]interface{}{"file": fileID})
+	if err != nil {
+		return err
+	}
+	return milvusClient.Delete(ctx, index.Collection, partition, expr)
+}
+
+// SearchSimilarChunks searches the partitions of a conversation and its knowledge bases together
 func SearchSimilarChunks(
 	ctx context.Context,
 	queryEmbedding []float32,
-	conversationID string,
+	scope Scope,
 	topK int64,
 ) ([]SearchResult, error) {
+	lists, err := searchChunks(ctx, [][]float32{queryEmbedding}, scope, topK)
+	if err != nil || len(lists) == 0 {
+		return nil, err
+	}
+	return lists[0], nil
+}
+
+// searchEf is the ef of HNSW searches, RAG_SEARCH_EF changes it to compare settings with rageval
+func searchEf() int {
+	if ef, err := strconv.Atoi(os.Getenv("RAG_SEARCH_EF")); err == nil && ef > 0 {
+		return ef
+	}
+	return 74
+}
+
+// searchChunks searches every embedding in one request, it returns the results per embedding
+func searchChunks(ctx context.Context, embeddings [][]float32, scope Scope, topK int64) ([][]SearchResult, error) {
 	milvusClient, err := InitMilvusClient(ctx)
 	if err != nil {
 		return nil, err
 	}
+	defer milvusClient.Close()
 
-	err = milvusClient.LoadCollection(ctx, collectionName, true)
+	index, err := activeIndex(ctx, milvusClient)
+	if err != nil {
+		return nil, err
+	}
+	// Searching a partition that doesn't exist fails, a conversation only gets one with its first upload
+	var existing []string
+	for _, partition := range scope.Partitions {
+		has, err := milvusClient.HasPartition(ctx, index.Collection, partition)
+		if err != nil {
+			return nil, err
+		}
+		if has {
+			existing = append(existing, partition)
+		}
+	}
+	if len(existing) == 0 {
+		return nil, nil
+	}
+	filter, params, err := scope.Filter.expr(index)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := accountFilter(index, scope.Account, filter, params)
+	if err != nil {
+		return nil, err
+	}
+
+	err = milvusClient.LoadCollection(ctx, index.Collection, true)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load collection: %w", err)
 	}
 	//sp, _ := entity.NewIndexFlatSearchParam()
 	//sp, err := entity.NewIndexIvfFlatSearchParam(200)
-	sp, err := entity.NewIndexHNSWSearchParam(74)
+	sp, err := entity.NewIndexHNSWSearchParam(searchEf())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create search parameters: %w", err)
 	}
 
-	vectors := []entity.Vector{
-		entity.FloatVector(queryEmbedding),
+	vectors := make([]entity.Vector, 0, len(embeddings))
+	for _, embedding := range embeddings {
+		vectors = append(vectors, entity.FloatVector(embedding))
 	}
 
-	cols := []string{"text"}
+	cols := chunkFields(index)
 
-	// Now also retrieving chunk_index
 	sr, err := milvusClient.Search(
 		ctx,
-		collectionName,
-		[]string{conversationID},
-		"",
+		index.Collection,
+		existing,
+		expr,
 		cols,
 		vectors,
 		"embedding",
 		entity.COSINE,
-		5,
+		int(topK),
 		sp,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("search failed: %w", err)
 	}
 
-	firstResult := sr[0]
-	results := make([]SearchResult, sr[0].ResultCount)
+	lists := make([][]SearchResult, 0, len(sr))
+	for _, set := range sr {
+		results := make([]SearchResult, 0, set.ResultCount)
+		// A file in the conversation and in one of its knowledge bases is found twice
+		seen := map[string]bool{}
 
-	// This is a bit brittle and doesn't scale well if we add more cols to the search
-	for i := range results {
-		text, err := firstResult.Fields[0].GetAsString(i)
-		if err != nil {
-			fmt.Println("error", err.Error())
-			continue
+		for i, result := range chunksFrom(set.Fields, set.ResultCount) {
+			if seen[result.Text] {
+				continue
+			}
+			seen[result.Text] = true
+			result.Score = set.Scores[i]
+			results = append(results, result)
 		}
-		results[i].Text = text
-		results[i].Score = firstResult.Scores[i]
+		lists = append(lists, results)
 	}
 
-	return results, nil
+	return lists, nil
 }
 
-func HandleFileEmbedding(ctx context.Context, file *multipart.FileHeader, fileID string, conversationID string) error {
-	ext := filepath.Ext(file.Filename)
-
-	extractor, exists := extractors[ext]
-	if !exists {
-		fmt.Errorf("unsupported file type: %s", ext)
+// HandleFileEmbedding embeds the file into a partition of the active index and returns that index,
+// the file records it so a re-index knows which files are outdated
+func HandleFileEmbedding(ctx context.Context, file *multipart.FileHeader, source Source, partition string) (Index, error) {
+	src, err := file.Open()
+	if err != nil {
+		return Index{}, fmt.Errorf("error opening file: %v", err)
 	}
+	defer src.Close()
 
-	extractedText, err := extractor(file)
+	extractedText, err := ExtractText(file.Filename, src)
 	if err != nil {
-		fmt.Println("extractor failed:", err.Error())
+		return Index{}, err
 	}
 
-	docs, err := CreateChunkDocuments(ctx, extractedText, fileID)
+	index, err := ActiveIndex(ctx)
+	if err != nil {
+		return Index{}, err
+	}
+	docs, err := CreateChunkDocuments(ctx, index.Model, extractedText, source.FileID)
+	if err != nil {
+		return Index{}, err
+	}
 	fmt.Println("CreateChunkDocuments:", len(docs))
-	err = SaveDocuments(ctx, docs, fileID, conversationID)
+	err = SaveDocuments(ctx, index, docs, source, partition)
 
 	if err != nil {
-		return err
+		return Index{}, err
 	}
 
-	return nil
+	return index, nil
 }
 
-func getTextFromText(file *multipart.FileHeader) (string, error) {
-	// Open the file
-	src, err := file.Open()
-	if err != nil {
-		return "", fmt.Errorf("error opening file: %v", err)
+// ExtractText picks the extractor by the extension of the file name
+func ExtractText(fileName string, r io.Reader) (string, error) {
+	ext := filepath.Ext(fileName)
+
+	extractor, exists := extractors[ext]
+	if !exists {
+		return "", fmt.Errorf("unsupported file type: %s", ext)
 	}
-	defer src.Close()
 
+	return extractor(r)
+}
+
+func getTextFromText(r io.Reader) (string, error) {
 	// Use io.ReadAll for simpler reading
-	content, err := io.ReadAll(src)
+	content, err := io.ReadAll(r)
 	if err != nil {
 		return "", fmt.Errorf("error reading file: %v", err)
 	}
@@ -326,7 +639,8 @@ func getTextFromText(file *multipart.FileHeader) (string, error) {
 	return string(content), nil
 }
 
-func formatSearchResultsToMarkdown(results []SearchResult) string {
+// FormatSearchResultsToMarkdown writes the results the way they are put in a prompt
+func FormatSearchResultsToMarkdown(results []SearchResult) string {
 	if len(results) == 0 {
 		return ""
 	}
@@ -336,6 +650,9 @@ func formatSearchResultsToMarkdown(results []SearchResult) string {
 
 	for _, result := range results {
 		formattedContext.WriteString("---\n")
+		if source := result.source(); source != "" {
+			formattedContext.WriteString(fmt.Sprintf("Source: %s\n", source))
+		}
 		formattedContext.WriteString(fmt.Sprintf("%s\n", result.Text))
 		formattedContext.WriteString(fmt.Sprintf("Relevance Score: %.2f\n", result.Score))
 	}
@@ -343,31 +660,45 @@ func formatSearchResultsToMarkdown(results []SearchResult) string {
 	return formattedContext.String()
 }
 
-func GetDocumentsFromQuery(ctx context.Context, query string, conversationID string) (string, error) {
-	queryEmbedding, err := ai.GetEmbeddings(ctx, []string{query})
+// GetDocumentsFromQuery searches the partitions of the conversation and of its knowledge bases
+func GetDocumentsFromQuery(ctx context.Context, query string, scope Scope) (string, error) {
+	searchResult, err := RetrieveDocuments(ctx, RetrievalPlan{Question: query, Query: query, Searches: []string{query}}, scope, 5)
+	markdown := FormatSearchResultsToMarkdown(searchResult)
+	fmt.Println(markdown)
+	return markdown, err
+}
 
+// RetrieveDocuments embeds the searches of the plan in one call, searches them and fuses the results
+func RetrieveDocuments(ctx context.Context, plan RetrievalPlan, scope Scope, topK int) ([]SearchResult, error) {
+	if len(plan.Searches) == 0 {
+		return nil, nil
+	}
+	// The searches have to be embedded with the model of the collection they are searched in
+	index, err := ActiveIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	embeddings, err := ai.GetEmbeddings(ctx, index.Model, plan.Searches)
 	if err != nil {
 		fmt.Println("err", err.Error())
-		return "", err
+		return nil, err
+	}
+	vectors := make([][]float32, 0, len(embeddings))
+	for _, embedding := range embeddings {
+		vectors = append(vectors, embedding.Embedding)
 	}
 
-	searchResult, err := SearchSimilarChunks(ctx, queryEmbedding[0].Embedding, conversationID, 5)
-	markdown := formatSearchResultsToMarkdown(searchResult)
-	fmt.Println(markdown)
-	return markdown, err
-}
-
-func determineRAGWithContext(userQuery string, documentContext string) (bool, error) {
-	prompt := RAGDeterminationPrompt(userQuery, documentContext)
-	response, err := ai.SingleQuery(prompt)
-	fmt.Println("documentContext:", documentContext)
+	lists, err := searchChunks(ctx, vectors, scope, int64(topK))
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	return strings.Contains(response, "YES"), nil
+	return FuseResults(lists, topK), nil
 }
 
 func extractTextFromMessage(msg openai.ChatCompletionMessage) string {
+	if len(msg.MultiContent) == 0 {
+		return msg.Content
+	}
 	var textParts []string
 	for _, part := range msg.MultiContent {
 		if part.Type == openai.ChatMessagePartTypeText {
@@ -377,26 +708,38 @@ func extractTextFromMessage(msg openai.ChatCompletionMessage) string {
 	return strings.Join(textParts, "\n")
 }
 
-func GetRaggedAnswerStream(ctx *gin.Context, messages []openai.ChatCompletionMessage, threadID string, openaiRequest openai.ChatCompletionRequest, manager *services.ClientManager) error {
-	lastMsg := messages[len(messages)-2]
-	query := extractTextFromMessage(lastMsg)
-	documentContext, err := GetDocumentsFromQuery(ctx, query, threadID)
+// GetRaggedAnswerStream answers from the documents in scope, the thread's own and those of its knowledge bases.
+// The router decides on their scores whether they are used, the decision goes to the event log and the stream.
+func GetRaggedAnswerStream(ctx *gin.Context, messages []openai.ChatCompletionMessage, threadID string, scope Scope, openaiRequest openai.ChatCompletionRequest, tools *ai.ToolRegistry, manager *services.ClientManager, events *services.EventService) error {
+	// Follow-ups like "and in 2023?" are rewritten first, the answer is prompted with the rewrite too
+	plan := PlanRetrieval(messages, ConfiguredPlanner(), ai.SingleQuery)
+	query := plan.Query
+	results, err := RetrieveDocuments(ctx, plan, scope, 5)
 	if err != nil {
 		fmt.Println("err", err.Error())
 	}
-	// LLM will decide whether RAG is required, given the question and the document context
-	useRAG, err := determineRAGWithContext(query, documentContext)
 
-	if useRAG {
-		fmt.Println("USING RAG")
-		prompt := RagPrompt2(documentContext, query)
-		err = ai.SingleQueryStream(ctx, threadID, prompt, openaiRequest, manager)
+	config := ConfiguredRouter()
+	var classify func(prompt string) (string, error)
+	if config.ClassifierModel != "" {
+		classify = func(prompt string) (string, error) {
+			return ai.GetCompletionWithModel(config.ClassifierModel, []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: prompt},
+			})
+		}
+	}
+	decision := Route(results, scope, query, config, classify)
+	logDecision(threadID, decision, manager, events)
+
+	if decision.UseRAG {
+		documentContext := FormatSearchResultsToMarkdown(results)
+		err = ai.GetCompletionStream(ctx, threadID, AssembleRagMessages(messages, documentContext, query), openaiRequest, tools, manager)
 		if err != nil {
 			fmt.Println("err", err.Error())
 			return err
 		}
 	} else {
-		err = ai.GetCompletionStream(ctx, threadID, messages, openaiRequest, manager)
+		err = ai.GetCompletionStream(ctx, threadID, messages, openaiRequest, tools, manager)
 		if err != nil {
 			fmt.Println("err", err.Error())
 			return err
@@ -404,3 +747,25 @@ func GetRaggedAnswerStream(ctx *gin.Context, messages []openai.ChatCompletionMes
 	}
 	return nil
 }
+
+// logDecision records the decision of the router as an event and sends it as a retrieval event
+func logDecision(threadID string, decision RouteDecision, manager *services.ClientManager, events *services.EventService) {
+	fmt.Printf("useRag: %t, %s\n", decision.UseRAG, decision.Reason)
+	_, err := events.Create(services.EventRetrieval, services.EventMetadata{
+		"conversation": threadID,
+		"useRag":       decision.UseRAG,
+		"reason":       decision.Reason,
+		"topScore":     decision.TopScore,
+		"results":      decision.Results,
+		"classifier":   decision.Classifier,
+	})
+	if err != nil {
+		fmt.Println("Error logging retrieval decision: " + err.Error())
+	}
+	data, err := json.Marshal(decision)
+	if err != nil {
+		fmt.Println("Error encoding retrieval decision: " + err.Error())
+		return
+	}
+	manager.SendRawEventToConversation(threadID, "retrieval", string(data))
+}
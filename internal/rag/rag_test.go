@@ -0,0 +1,20 @@
+package rag
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSplitChunks(t *testing.T) {
+	text := "# Budget\nWe spend less. Or do we?\n\n## Travel\nTrains only.\fPage two starts here. \n"
+
+	chunks := SplitChunks(text)
+	assert.Equal(t, []Chunk{
+		{Text: "# Budget\nWe spend less", Page: 1, Section: "Budget"},
+		{Text: "Or do we", Page: 1, Section: "Budget"},
+		{Text: "## Travel\nTrains only", Page: 1, Section: "Travel"},
+		{Text: "Page two starts here", Page: 2, Section: "Travel"},
+	}, chunks)
+	// The texts are what the chunker always made, so vectors don't need to be made again
+	assert.Equal(t, []string{"# Budget\nWe spend less", "Or do we", "## Travel\nTrains only", "Page two starts here"}, SplitText(text))
+}
@@ -0,0 +1,404 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/milvus-io/milvus-sdk-go/v2/client"
+	"gochat/internal/schema"
+	"gochat/internal/services"
+	"gochat/internal/store"
+	"io"
+	"time"
+)
+
+type ReindexSkip struct {
+	FileID string `json:"fileId"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+type ReindexResult struct {
+	Collection string `json:"collection"`
+	// Previous is the collection the alias pointed at before, it is kept so the swap can be undone
+	Previous string        `json:"previous"`
+	Model    string        `json:"model"`
+	Files    int           `json:"files"`
+	Chunks   int           `json:"chunks"`
+	Skipped  []ReindexSkip `json:"skipped"`
+}
+
+// Reindex rebuilds the vectors of every file into a new collection for target and then moves the
+// documents alias to it, searches use the previous collection until that moment. Files with a stored
+// original are extracted and split again, older files only exist as chunks in the previous collection
+// and get those chunks embedded again. Files without chunks in the previous collection were deleted
+// or never embedded, they are skipped.
+func Reindex(ctx context.Context, s store.Store, blobs store.BlobStore, target Index, logf func(format string, args ...interface{})) (*ReindexResult, error) {
+	milvusClient, err := InitMilvusClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer milvusClient.Close()
+
+	previous, err := activeIndex(ctx, milvusClient)
+	if err != nil {
+		return nil, fmt.Errorf("no active collection, start the server once first: %w", err)
+	}
+	target.Collection = fmt.Sprintf("%s_%s", collectionName, time.Now().UTC().Format("20060102_150405"))
+	if err := createIndexCollection(ctx, milvusClient, target); err != nil {
+		return nil, fmt.Errorf("failed to create collection %s: %w", target.Collection, err)
+	}
+	logf("building %s with %s (dim %d, chunker %d)", target.Collection, target.Model, target.Dim, target.Chunker)
+
+	r := &reindexer{
+		client:   milvusClient,
+		blobs:    blobs,
+		previous: previous,
+		target:   target,
+		indexed:  map[string]int{},
+		skipped:  map[string]bool{},
+		result:   &ReindexResult{Collection: target.Collection, Previous: previous.Collection, Model: target.Model},
+		logf:     logf,
+	}
+	files, err := s.ListFiles(ctx)
+	if err == nil {
+		err = r.loadScopes(ctx, s)
+	}
+	if err == nil {
+		err = r.indexFiles(ctx, files)
+	}
+	if err != nil {
+		// Nothing points at the new collection yet, it can go
+		if dropErr := milvusClient.DropCollection(ctx, target.Collection); dropErr != nil {
+			logf("failed to drop %s: %s", target.Collection, dropErr)
+		}
+		return nil, err
+	}
+
+	swapped := time.Now().UTC().Format("2006-01-02 15:04:05")
+	if err := milvusClient.AlterAlias(ctx, target.Collection, documentsAlias); err != nil {
+		return nil, fmt.Errorf("failed to move %s to %s: %w", documentsAlias, target.Collection, err)
+	}
+	logf("%s now points at %s", documentsAlias, target.Collection)
+
+	// Uploads that went into the previous collection while this ran. Files from after the swap are
+	// in the new collection already.
+	files, err = s.ListFiles(ctx)
+	if err == nil {
+		err = r.loadScopes(ctx, s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var missed []schema.File
+	current := map[string]bool{}
+	for _, file := range files {
+		current[file.ID] = true
+		if _, done := r.indexed[file.ID]; !done && !r.skipped[file.ID] && file.Createdat <= swapped {
+			missed = append(missed, file)
+		}
+	}
+	// Files deleted while this ran lost their vectors in the previous collection only
+	for id := range r.indexed {
+		if current[id] {
+			continue
+		}
+		logf("removing %s, it was deleted during the re-index", id)
+		expr, err := filterExpr("fileId == {file}", map[string]interface{}{"file": id})
+		if err != nil {
+			return nil, err
+		}
+		if err := milvusClient.Delete(ctx, target.Collection, "", expr); err != nil {
+			return nil, fmt.Errorf("failed to remove %s: %w", id, err)
+		}
+		delete(r.indexed, id)
+	}
+	if len(missed) > 0 {
+		logf("indexing %d files uploaded during the re-index", len(missed))
+		// An upload that was embedding during the swap may have landed in the new collection already
+		r.catchUp = true
+		if err := r.indexFiles(ctx, missed); err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.InTx(ctx, func(q schema.Querier) error {
+		for id, chunker := range r.indexed {
+			err := q.SetFileIndex(ctx, schema.SetFileIndexParams{ID: id, Embeddingmodel: target.Model, Chunkerversion: int64(chunker)})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record the index of the files: %w", err)
+	}
+	r.result.Files = len(r.indexed)
+	return r.result, nil
+}
+
+type reindexer struct {
+	client   client.Client
+	blobs    store.BlobStore
+	previous Index
+	target   Index
+	// knowledgeBases has the knowledge base partitions of every file, they get a copy of its chunks
+	knowledgeBases map[string][]string
+	// conversations has the conversations that were not deleted
+	conversations map[string]bool
+	// accounts has the account of every file's owner, vectors are filtered on it
+	accounts map[string]string
+	tags     map[string][]string
+	// indexed has the chunker version of every file that made it into the target
+	indexed map[string]int
+	skipped map[string]bool
+	// catchUp removes what is in the target for a file before adding it
+	catchUp bool
+	result  *ReindexResult
+	logf    func(format string, args ...interface{})
+}
+
+// indexFiles fails on errors of Milvus or the embedding model, files that cannot be read are skipped
+func (r *reindexer) indexFiles(ctx context.Context, files []schema.File) error {
+	var legacy []schema.File
+	for _, file := range files {
+		if r.accounts[file.ID] == "" {
+			r.skip(file, "owner has no account")
+			continue
+		}
+		if file.Hash == "" {
+			legacy = append(legacy, file)
+			continue
+		}
+		partitions := r.partitions(file)
+		if len(partitions) == 0 {
+			r.skip(file, "conversation was deleted")
+			continue
+		}
+		// Deleting a file used to remove its vectors only, and spreadsheets are never embedded. Uploads
+		// that finished during the swap may only be in the target, catching up skips the check.
+		if !r.catchUp {
+			count, err := countChunks(ctx, r.client, r.previous.Collection, nil, file.ID)
+			if err != nil {
+				return err
+			}
+			if count == 0 {
+				r.skip(file, "no chunks in "+r.previous.Collection)
+				continue
+			}
+		}
+		reader, err := r.blobs.Get(ctx, services.FileBlobKey(file.Owner, file.ID))
+		if err != nil {
+			r.skip(file, "original not readable: "+err.Error())
+			continue
+		}
+		text, err := ExtractText(file.Name, reader)
+		reader.Close()
+		if err != nil {
+			r.skip(file, err.Error())
+			continue
+		}
+
+		if err := r.replace(ctx, file, partitions, SplitChunks(text)); err != nil {
+			return fmt.Errorf("failed to index %s: %w", file.ID, err)
+		}
+		r.indexed[file.ID] = r.target.Chunker
+	}
+	return r.copyLegacy(ctx, legacy)
+}
+
+// partitions returns the partitions the file is searched in: its conversation and its knowledge
+// bases. Deleting a conversation drops its partition but leaves the file, it is only indexed again
+// for the knowledge bases it is in. Files of no conversation go in the default partition.
+func (r *reindexer) partitions(file schema.File) []string {
+	partitions := r.knowledgeBases[file.ID]
+	if file.Conversation != "" && r.conversations[file.Conversation] {
+		partitions = append([]string{file.Conversation}, partitions...)
+	}
+	if file.Conversation == "" && len(partitions) == 0 {
+		partitions = []string{""}
+	}
+	return partitions
+}
+
+// copyLegacy embeds the chunks of files without an original again. Their conversation was not
+// recorded, so every partition of the previous collection is searched for them. A file is only
+// indexed when every chunk Milvus counts for it was read.
+func (r *reindexer) copyLegacy(ctx context.Context, files []schema.File) error {
+	if len(files) == 0 {
+		return nil
+	}
+	byID := map[string]schema.File{}
+	ids := make([]string, 0, len(files))
+	for _, file := range files {
+		byID[file.ID] = file
+		ids = append(ids, file.ID)
+	}
+
+	partitions, err := r.client.ShowPartitions(ctx, r.previous.Collection)
+	if err != nil {
+		return err
+	}
+	found := map[string]bool{}
+	// Milvus limits the size of expressions, so the files are looked up in batches
+	for start := 0; start < len(ids); start += 100 {
+		end := min(start+100, len(ids))
+		// chunks has the chunks of every file by partition
+		chunks := map[string]map[string][]Chunk{}
+		for _, partition := range partitions {
+			if err := r.readChunks(ctx, partition.Name, ids[start:end], chunks); err != nil {
+				return err
+			}
+		}
+
+	nextFile:
+		for fileID, byPartition := range chunks {
+			found[fileID] = true
+			for partition, fileChunks := range byPartition {
+				count, err := countChunks(ctx, r.client, r.previous.Collection, []string{partition}, fileID)
+				if err != nil {
+					return err
+				}
+				if count != int64(len(fileChunks)) {
+					r.skip(byID[fileID], fmt.Sprintf("read %d of %d chunks in %s", len(fileChunks), count, partition))
+					continue nextFile
+				}
+			}
+			for partition, fileChunks := range byPartition {
+				if err := r.replace(ctx, byID[fileID], []string{partition}, fileChunks); err != nil {
+					return fmt.Errorf("failed to index %s: %w", fileID, err)
+				}
+			}
+			// The chunks are the ones of the previous chunker
+			r.indexed[fileID] = int(byID[fileID].Chunkerversion)
+		}
+	}
+
+	for _, file := range files {
+		if !found[file.ID] {
+			r.skip(file, "no original and no chunks in "+r.previous.Collection)
+		}
+	}
+	return nil
+}
+
+// readChunks pages through the chunks of files in a partition of the previous collection, a single
+// query returns at most 16384 rows
+func (r *reindexer) readChunks(ctx context.Context, partition string, ids []string, chunks map[string]map[string][]Chunk) error {
+	expr, err := filterExpr("fileId in {files}", map[string]interface{}{"files": ids})
+	if err != nil {
+		return err
+	}
+	iterator, err := r.client.QueryIterator(ctx, client.NewQueryIteratorOption(r.previous.Collection).
+		WithPartitions(partition).WithExpr(expr).WithOutputFields(chunkFields(r.previous)...).WithBatchSize(1000))
+	if err != nil {
+		return fmt.Errorf("failed to read chunks from %s: %w", partition, err)
+	}
+	for {
+		rows, err := iterator.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read chunks from %s: %w", partition, err)
+		}
+		for _, row := range chunksFrom(rows, rows.Len()) {
+			if chunks[row.FileID] == nil {
+				chunks[row.FileID] = map[string][]Chunk{}
+			}
+			chunks[row.FileID][partition] = append(chunks[row.FileID][partition], Chunk{Text: row.Text, Page: row.Page, Section: row.Section})
+		}
+	}
+}
+
+// countChunks counts the chunks of a file in the partitions of a collection, all of them when nil
+func countChunks(ctx context.Context, milvusClient client.Client, collection string, partitions []string, fileID string) (int64, error) {
+	expr, err := filterExpr("fileId == {file}", map[string]interface{}{"file": fileID})
+	if err != nil {
+		return 0, err
+	}
+	rows, err := milvusClient.Query(ctx, collection, partitions, expr, []string{"count(*)"})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count chunks of %s: %w", fileID, err)
+	}
+	column := rows.GetColumn("count(*)")
+	if column == nil || column.Len() == 0 {
+		return 0, fmt.Errorf("failed to count chunks of %s: no count returned", fileID)
+	}
+	return column.GetAsInt64(0)
+}
+
+// loadScopes reads the knowledge bases, the account and the tags of every file
+func (r *reindexer) loadScopes(ctx context.Context, s store.Store) error {
+	memberships, err := s.ListKnowledgeBaseMemberships(ctx)
+	if err != nil {
+		return err
+	}
+	r.knowledgeBases = map[string][]string{}
+	for _, m := range memberships {
+		r.knowledgeBases[m.File] = append(r.knowledgeBases[m.File], services.KnowledgeBasePartition(m.Knowledgebase))
+	}
+
+	conversations, err := s.ListConversationIDs(ctx)
+	if err != nil {
+		return err
+	}
+	r.conversations = map[string]bool{}
+	for _, id := range conversations {
+		r.conversations[id] = true
+	}
+
+	accounts, err := s.ListFileAccounts(ctx)
+	if err != nil {
+		return err
+	}
+	r.accounts = map[string]string{}
+	for _, a := range accounts {
+		r.accounts[a.ID] = a.Account
+	}
+
+	tags, err := s.ListAllFileTags(ctx)
+	if err != nil {
+		return err
+	}
+	r.tags = map[string][]string{}
+	for _, t := range tags {
+		r.tags[t.File] = append(r.tags[t.File], t.Tag)
+	}
+	return nil
+}
+
+// replace embeds chunks once into every partition of the target, while catching up it first removes
+// what is there for the file
+func (r *reindexer) replace(ctx context.Context, file schema.File, partitions []string, chunks []Chunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+	docs, err := embedChunks(ctx, r.target.Model, chunks, file.ID)
+	if err != nil {
+		return err
+	}
+	source := SourceOf(file, r.accounts[file.ID], r.tags[file.ID])
+	for _, partition := range partitions {
+		if partition == "" {
+			partition = "_default"
+		}
+		if r.catchUp {
+			if err := removeFromPartition(ctx, r.client, r.target, file.ID, source.Account, partition); err != nil {
+				return err
+			}
+		}
+		if err := insertDocuments(ctx, r.client, r.target, docs, source, partition); err != nil {
+			return err
+		}
+		r.result.Chunks += len(docs)
+	}
+	return nil
+}
+
+func (r *reindexer) skip(file schema.File, reason string) {
+	r.logf("skipping %s (%s): %s", file.ID, file.Name, reason)
+	r.skipped[file.ID] = true
+	r.result.Skipped = append(r.result.Skipped, ReindexSkip{FileID: file.ID, Name: file.Name, Reason: reason})
+}
@@ -0,0 +1,22 @@
+package rag
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gochat/internal/schema"
+	"testing"
+)
+
+func TestReindexPartitions(t *testing.T) {
+	r := &reindexer{
+		knowledgeBases: map[string][]string{"report": {"kb_policy"}, "notes": {"kb_policy"}},
+		conversations:  map[string]bool{"kept": true},
+	}
+
+	assert.Equal(t, []string{"kept", "kb_policy"}, r.partitions(schema.File{ID: "report", Conversation: "kept"}))
+	assert.Equal(t, []string{""}, r.partitions(schema.File{ID: "upload"}))
+	assert.Equal(t, []string{"kb_policy"}, r.partitions(schema.File{ID: "notes"}))
+
+	// A deleted conversation is not built again, the knowledge base keeps its copy
+	assert.Equal(t, []string{"kb_policy"}, r.partitions(schema.File{ID: "report", Conversation: "deleted"}))
+	assert.Empty(t, r.partitions(schema.File{ID: "draft", Conversation: "deleted"}))
+}
@@ -0,0 +1,92 @@
+package rag
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RouterConfig has the cosine similarity thresholds of the retrieval router, RAG_MIN_SCORE,
+// RAG_ACCEPT_SCORE and RAG_CLASSIFIER_MODEL change it
+type RouterConfig struct {
+	// MinScore is the best score below which documents are not used
+	MinScore float32
+	// AcceptScore is the best score from which documents are used without asking
+	AcceptScore float32
+	// ClassifierModel decides the scores in between, without one the documents are used
+	ClassifierModel string
+}
+
+func ConfiguredRouter() RouterConfig {
+	config := RouterConfig{MinScore: 0.5, AcceptScore: 0.7, ClassifierModel: os.Getenv("RAG_CLASSIFIER_MODEL")}
+	if score, err := strconv.ParseFloat(os.Getenv("RAG_MIN_SCORE"), 32); err == nil {
+		config.MinScore = float32(score)
+	}
+	if score, err := strconv.ParseFloat(os.Getenv("RAG_ACCEPT_SCORE"), 32); err == nil {
+		config.AcceptScore = float32(score)
+	}
+	config.MinScore = min(config.MinScore, config.AcceptScore)
+	return config
+}
+
+// RouteDecision says whether an answer is grounded in the retrieved documents, it is logged and
+// streamed to the client
+type RouteDecision struct {
+	UseRAG     bool    `json:"useRag"`
+	Reason     string  `json:"reason"`
+	TopScore   float32 `json:"topScore"`
+	Results    int     `json:"results"`
+	Classifier bool    `json:"classifier"`
+}
+
+var (
+	classifierAnswer = regexp.MustCompile(`\b(YES|NO)\b`)
+	classifierReason = regexp.MustCompile(`(?i)REASON:\s*(.+)`)
+)
+
+// Route decides on the scores of the results. Only scores between MinScore and AcceptScore are
+// passed to classify, which is nil when no classifier model is configured.
+func Route(results []SearchResult, scope Scope, query string, config RouterConfig, classify func(prompt string) (string, error)) RouteDecision {
+	decision := RouteDecision{Results: len(results)}
+	for _, result := range results {
+		decision.TopScore = max(decision.TopScore, result.Score)
+	}
+
+	switch {
+	case len(results) == 0:
+		decision.Reason = "no documents found"
+	case !scope.Filter.Empty():
+		decision.UseRAG = true
+		decision.Reason = "the question was asked about selected documents"
+	case decision.TopScore >= config.AcceptScore:
+		decision.UseRAG = true
+		decision.Reason = fmt.Sprintf("best score %.2f reaches %.2f", decision.TopScore, config.AcceptScore)
+	case decision.TopScore < config.MinScore:
+		decision.Reason = fmt.Sprintf("best score %.2f is below %.2f", decision.TopScore, config.MinScore)
+	case classify == nil:
+		decision.UseRAG = true
+		decision.Reason = fmt.Sprintf("best score %.2f is between %.2f and %.2f, no classifier configured", decision.TopScore, config.MinScore, config.AcceptScore)
+	default:
+		decision.Classifier = true
+		response, err := classify(RAGDeterminationPrompt(query, FormatSearchResultsToMarkdown(results)))
+		if err != nil {
+			// The documents were close enough to be worth showing
+			decision.UseRAG = true
+			decision.Reason = "classifier failed: " + err.Error()
+			break
+		}
+		answer := classifierAnswer.FindString(strings.ToUpper(response))
+		decision.UseRAG = answer == "YES"
+		decision.Reason = "classifier answered " + strings.ToLower(answer)
+		if answer == "" {
+			decision.UseRAG = true
+			decision.Reason = "classifier gave no answer"
+		}
+		if reason := classifierReason.FindStringSubmatch(response); reason != nil {
+			decision.Reason += ": " + strings.TrimSpace(reason[1])
+		}
+	}
+	return decision
+}
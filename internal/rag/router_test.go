@@ -0,0 +1,57 @@
+package rag
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRoute(t *testing.T) {
+	config := RouterConfig{MinScore: 0.5, AcceptScore: 0.7}
+	results := func(scores ...float32) []SearchResult {
+		var results []SearchResult
+		for _, score := range scores {
+			results = append(results, SearchResult{Text: "passage", Score: score})
+		}
+		return results
+	}
+	classifier := func(response string, err error) func(string) (string, error) {
+		return func(string) (string, error) { return response, err }
+	}
+
+	decision := Route(nil, Scope{}, "q", config, nil)
+	assert.False(t, decision.UseRAG)
+	assert.Equal(t, "no documents found", decision.Reason)
+
+	decision = Route(results(0.3, 0.75), Scope{}, "q", config, classifier("NO", nil))
+	assert.Equal(t, RouteDecision{UseRAG: true, Reason: "best score 0.75 reaches 0.70", TopScore: 0.75, Results: 2}, decision)
+
+	decision = Route(results(0.45), Scope{}, "q", config, nil)
+	assert.False(t, decision.UseRAG)
+	assert.Equal(t, "best score 0.45 is below 0.50", decision.Reason)
+
+	// Documents picked by the user are used whatever they score
+	decision = Route(results(0.45), Scope{Filter: Filter{Tags: []string{"finance"}}}, "q", config, nil)
+	assert.True(t, decision.UseRAG)
+
+	// Only scores in between are classified
+	decision = Route(results(0.6), Scope{}, "q", config, nil)
+	assert.True(t, decision.UseRAG)
+	assert.False(t, decision.Classifier)
+	decision = Route(results(0.6), Scope{}, "q", config, classifier("OUTPUT: NO\nREASON: The passages are about trains.", nil))
+	assert.Equal(t, RouteDecision{Reason: "classifier answered no: The passages are about trains.", TopScore: 0.6, Results: 1, Classifier: true}, decision)
+	decision = Route(results(0.6), Scope{}, "q", config, classifier("yes", nil))
+	assert.True(t, decision.UseRAG)
+	decision = Route(results(0.6), Scope{}, "q", config, classifier("", errors.New("timeout")))
+	assert.True(t, decision.UseRAG)
+	assert.Equal(t, "classifier failed: timeout", decision.Reason)
+}
+
+func TestConfiguredRouter(t *testing.T) {
+	t.Setenv("RAG_MIN_SCORE", "0.8")
+	t.Setenv("RAG_ACCEPT_SCORE", "0.6")
+	t.Setenv("RAG_CLASSIFIER_MODEL", "")
+
+	// The minimum can't be above the score that is accepted without asking
+	assert.Equal(t, RouterConfig{MinScore: 0.6, AcceptScore: 0.6}, ConfiguredRouter())
+}
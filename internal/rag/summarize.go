@@ -0,0 +1,254 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/milvus-io/milvus-sdk-go/v2/client"
+	"github.com/sashabaranov/go-openai"
+	"gochat/internal/ai"
+	"gochat/internal/schema"
+	"gochat/internal/services"
+	"io"
+	"strings"
+)
+
+// SummaryVersion goes up when the summary prompts or batching change, summaries cached for an older
+// version are made again
+const SummaryVersion = 1
+
+// summaryBatchSize is about how many characters of text go into one summary prompt
+const summaryBatchSize = 12000
+
+// SummaryProgress is sent as a progress event after every summary of a batch
+type SummaryProgress struct {
+	// Stage is "map" for the passages of a file, "reduce" for combining summaries and "files" for the
+	// files of a conversation
+	Stage string `json:"stage"`
+	File  string `json:"file,omitempty"`
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+}
+
+// SummaryCacheVersion is what a summary of the file is cached under, a new upload of the same
+// content shares it
+func SummaryCacheVersion(file schema.File) string {
+	return fmt.Sprintf("%s-%d", file.Hash, SummaryVersion)
+}
+
+// batchTexts joins consecutive texts into batches of at most size characters, a longer text gets a
+// batch of its own
+func batchTexts(texts []string, size int) []string {
+	var batches []string
+	var batch strings.Builder
+	for _, text := range texts {
+		if batch.Len() > 0 && batch.Len()+len(text)+2 > size {
+			batches = append(batches, batch.String())
+			batch.Reset()
+		}
+		if batch.Len() > 0 {
+			batch.WriteString("\n\n")
+		}
+		batch.WriteString(text)
+	}
+	if batch.Len() > 0 {
+		batches = append(batches, batch.String())
+	}
+	return batches
+}
+
+// mapReduce summarizes the texts batch by batch with prompt and combines the summaries until they
+// fit in one batch. It returns the prompt of that last step, the caller completes or streams it.
+func mapReduce(texts []string, prompt func(string) string, complete func(string) (string, error), progress func(stage string, done int, total int)) (string, error) {
+	batches := batchTexts(texts, summaryBatchSize)
+	if len(batches) == 0 {
+		return "", fmt.Errorf("nothing to summarize")
+	}
+	stage := "map"
+	for len(batches) > 1 {
+		summaries := make([]string, len(batches))
+		for i, batch := range batches {
+			summary, err := complete(prompt(batch))
+			if err != nil {
+				return "", fmt.Errorf("failed to summarize part %d of %d: %w", i+1, len(batches), err)
+			}
+			summaries[i] = strings.TrimSpace(summary)
+			progress(stage, i+1, len(batches))
+		}
+		next := batchTexts(summaries, summaryBatchSize)
+		// Summaries longer than half a batch would never be combined, they go in pairs
+		if len(next) == len(summaries) {
+			next = next[:0]
+			for i := 0; i < len(summaries); i += 2 {
+				next = append(next, strings.Join(summaries[i:min(i+2, len(summaries))], "\n\n"))
+			}
+		}
+		batches, prompt, stage = next, CombineSummariesPrompt, "reduce"
+	}
+	return prompt(batches[0]), nil
+}
+
+// fileSummaryPrompt reads the original of the file and map-reduces its chunks into the prompt of
+// the final summary. Files uploaded before originals were stored are summarized from their chunks.
+func fileSummaryPrompt(ctx context.Context, files *services.FileService, account string, file schema.File, progress func(stage string, done int, total int)) (string, error) {
+	texts, err := fileTexts(ctx, files, account, file)
+	if err != nil {
+		return "", err
+	}
+	return mapReduce(texts, SummaryPrompt, ai.SingleQuery, progress)
+}
+
+func fileTexts(ctx context.Context, files *services.FileService, account string, file schema.File) ([]string, error) {
+	_, content, err := files.Open(ctx, file.ID)
+	if errors.Is(err, services.ErrNoOriginal) {
+		return storedChunks(ctx, account, file.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	text, err := ExtractText(file.Name, content)
+	if err != nil {
+		return nil, err
+	}
+	var texts []string
+	for _, chunk := range SplitChunks(text) {
+		texts = append(texts, chunk.Text)
+	}
+	return texts, nil
+}
+
+// storedChunks reads the chunks of a file from Milvus in the order they were stored. Its conversation
+// may not have been recorded, so every partition is searched, like copyLegacy does. The caller checked
+// that the file belongs to the user. Returns services.ErrNoOriginal when there are none either.
+func storedChunks(ctx context.Context, account string, fileID string) ([]string, error) {
+	milvusClient, err := InitMilvusClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer milvusClient.Close()
+	index, err := activeIndex(ctx, milvusClient)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := accountFilter(index, account, "fileId == {file}", map[string]interface{}{"file": fileID})
+	if err != nil {
+		return nil, err
+	}
+	iterator, err := milvusClient.QueryIterator(ctx, client.NewQueryIteratorOption(index.Collection).
+		WithExpr(expr).WithOutputFields("text").WithBatchSize(1000))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunks: %w", err)
+	}
+	var texts []string
+	for {
+		rows, err := iterator.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chunks: %w", err)
+		}
+		for _, row := range chunksFrom(rows, rows.Len()) {
+			texts = append(texts, row.Text)
+		}
+	}
+	if len(texts) == 0 {
+		return nil, services.ErrNoOriginal
+	}
+	return texts, nil
+}
+
+// SummarizeFiles streams a summary of the files to the thread, with progress events while the
+// chunks are summarized. Summaries of single files are cached per version, a conversation is
+// summarized from the summaries of its files. The chunks of files without an original are read
+// from the user's account.
+func SummarizeFiles(ctx context.Context, files *services.FileService, account string, list []schema.File, threadID string, manager *services.ClientManager) error {
+	progress := func(file string) func(string, int, int) {
+		return func(stage string, done int, total int) {
+			data, _ := json.Marshal(SummaryProgress{Stage: stage, File: file, Done: done, Total: total})
+			manager.SendRawEventToConversation(threadID, "progress", string(data))
+		}
+	}
+
+	if len(list) == 1 {
+		file := list[0]
+		version := SummaryCacheVersion(file)
+		summary, ok, err := files.Summary(ctx, file.ID, version)
+		if err != nil {
+			return err
+		}
+		if ok {
+			manager.SendRawEventToConversation(threadID, "message", fmt.Sprintf(`{"content":%q,"isDone":false}`, summary))
+			manager.SendRawEventToConversation(threadID, "message", `{"content":"","isDone":true}`)
+			return nil
+		}
+		prompt, err := fileSummaryPrompt(ctx, files, account, file, progress(file.ID))
+		if err != nil {
+			return err
+		}
+		summary, err = streamSummary(ctx, threadID, prompt, manager)
+		if err != nil {
+			return err
+		}
+		if err := files.SaveSummary(ctx, file.ID, version, summary); err != nil {
+			fmt.Println("Error caching summary: " + err.Error())
+		}
+		return nil
+	}
+
+	var summaries []string
+	for i, file := range list {
+		summary, err := cachedFileSummary(ctx, files, account, file, progress(file.ID))
+		// Files with neither an original nor chunks are left out
+		if errors.Is(err, services.ErrNoOriginal) {
+			fmt.Printf("skipping %s in summary: %s\n", file.ID, err)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to summarize %s: %w", file.Name, err)
+		}
+		summaries = append(summaries, fmt.Sprintf("## %s\n%s", file.Name, summary))
+		progress("")("files", i+1, len(list))
+	}
+	if len(summaries) == 0 {
+		return services.ErrNoOriginal
+	}
+	prompt, err := mapReduce(summaries, CombineSummariesPrompt, ai.SingleQuery, progress(""))
+	if err != nil {
+		return err
+	}
+	_, err = streamSummary(ctx, threadID, prompt, manager)
+	return err
+}
+
+// cachedFileSummary returns the cached summary of the file, or makes and caches it
+func cachedFileSummary(ctx context.Context, files *services.FileService, account string, file schema.File, progress func(string, int, int)) (string, error) {
+	version := SummaryCacheVersion(file)
+	summary, ok, err := files.Summary(ctx, file.ID, version)
+	if err != nil || ok {
+		return summary, err
+	}
+	prompt, err := fileSummaryPrompt(ctx, files, account, file, progress)
+	if err != nil {
+		return "", err
+	}
+	summary, err = ai.SingleQuery(prompt)
+	if err != nil {
+		return "", err
+	}
+	summary = strings.TrimSpace(summary)
+	if err := files.SaveSummary(ctx, file.ID, version, summary); err != nil {
+		fmt.Println("Error caching summary: " + err.Error())
+	}
+	return summary, nil
+}
+
+func streamSummary(ctx context.Context, threadID string, prompt string, manager *services.ClientManager) (string, error) {
+	summary, err := ai.StreamCompletion(ctx, threadID, openai.ChatCompletionRequest{
+		Model:    ai.ChatModel,
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}},
+	}, nil, manager)
+	return strings.TrimSpace(summary), err
+}
@@ -0,0 +1,58 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestBatchTexts(t *testing.T) {
+	assert.Equal(t, []string{"aaa\n\nbbb", "ccccc", "dd"}, batchTexts([]string{"aaa", "bbb", "ccccc", "dd"}, 8))
+	// A text longer than a batch is not split
+	assert.Equal(t, []string{"a", "0123456789", "b"}, batchTexts([]string{"a", "0123456789", "b"}, 8))
+	assert.Empty(t, batchTexts(nil, 8))
+}
+
+func TestMapReduce(t *testing.T) {
+	var prompts []string
+	var steps []string
+	complete := func(prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		return fmt.Sprintf(" summary %d ", len(prompts)), nil
+	}
+	progress := func(stage string, done int, total int) {
+		steps = append(steps, fmt.Sprintf("%s %d/%d", stage, done, total))
+	}
+
+	// One batch is summarized by the caller
+	prompt, err := mapReduce([]string{"kort", "verhaal"}, SummaryPrompt, complete, progress)
+	assert.NoError(t, err)
+	assert.Equal(t, SummaryPrompt("kort\n\nverhaal"), prompt)
+	assert.Empty(t, prompts)
+
+	chunk := strings.Repeat("x", summaryBatchSize-10)
+	prompt, err = mapReduce([]string{chunk, chunk, chunk}, SummaryPrompt, complete, progress)
+	assert.NoError(t, err)
+	assert.Equal(t, CombineSummariesPrompt("summary 1\n\nsummary 2\n\nsummary 3"), prompt)
+	assert.Equal(t, []string{SummaryPrompt(chunk), SummaryPrompt(chunk), SummaryPrompt(chunk)}, prompts)
+	assert.Equal(t, []string{"map 1/3", "map 2/3", "map 3/3"}, steps)
+
+	// Summaries that don't fit together are combined in pairs until they do
+	prompts, steps = nil, nil
+	long := func(prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		return strings.Repeat("y", summaryBatchSize*2/3), nil
+	}
+	prompt, err = mapReduce([]string{chunk, chunk, chunk, chunk}, SummaryPrompt, long, progress)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"map 1/4", "map 2/4", "map 3/4", "map 4/4", "reduce 1/2", "reduce 2/2"}, steps)
+	assert.Len(t, prompts, 6)
+	assert.True(t, strings.HasPrefix(prompt, CombineSummariesPrompt("")[:40]))
+
+	_, err = mapReduce(nil, SummaryPrompt, complete, progress)
+	assert.Error(t, err)
+	_, err = mapReduce([]string{chunk, chunk}, SummaryPrompt, func(string) (string, error) { return "", errors.New("timeout") }, progress)
+	assert.ErrorContains(t, err, "part 1 of 2")
+}
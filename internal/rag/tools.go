@@ -0,0 +1,50 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gochat/internal/ai"
+	"strings"
+	"time"
+)
+
+// DocumentSearchTool searches the documents in scope, so the model can look things up itself on top
+// of what the router gave it
+func DocumentSearchTool(scope Scope) ai.Tool {
+	return ai.Tool{
+		Name:        "search_documents",
+		Description: "Searches the documents the user uploaded to this conversation and its knowledge bases. Returns the most relevant passages with their source.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"query":{"type":"string","description":"what to search for, a question or keywords in the language of the documents"}},"required":["query"]}`),
+		Timeout:     20 * time.Second,
+		Run: func(ctx context.Context, arguments string) (string, error) {
+			var args struct {
+				Query string `json:"query"`
+			}
+			if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+				return "", fmt.Errorf("invalid arguments: %w", err)
+			}
+			query := strings.TrimSpace(args.Query)
+			if query == "" {
+				return "", fmt.Errorf("query is required")
+			}
+			plan := RetrievalPlan{Question: query, Query: query, Searches: []string{query}}
+			results, err := RetrieveDocuments(ctx, plan, scope, 5)
+			if err != nil {
+				return "", err
+			}
+			if len(results) == 0 {
+				return "No passages found.", nil
+			}
+			return FormatSearchResultsToMarkdown(results), nil
+		},
+	}
+}
+
+// ChatTools are the tools offered in a conversation, nil when LLM_TOOLS is off
+func ChatTools(scope Scope) *ai.ToolRegistry {
+	if !ai.ToolsEnabled() {
+		return nil
+	}
+	return ai.NewToolRegistry(DocumentSearchTool(scope), ai.CalculatorTool(), ai.DateTool(time.Now))
+}
@@ -8,7 +8,9 @@ import (
 	sentrygin "github.com/getsentry/sentry-go/gin"
 	"github.com/gin-gonic/gin"
 	"gochat/api"
+	"gochat/internal/app"
 	"gochat/internal/rag"
+	"gochat/internal/store"
 	"io"
 	"log"
 	"net/http"
@@ -18,7 +20,7 @@ import (
 	"time"
 )
 
-func newServer() *gin.Engine {
+func newServer(a *app.App) *gin.Engine {
 	r := gin.Default()
 
 	//if os.Getenv("ENV") == "production" {
@@ -37,7 +39,7 @@ func newServer() *gin.Engine {
 
 	//}
 
-	api.AddRoutes(r)
+	api.AddRoutes(r, a)
 	return r
 }
 func main() {
@@ -53,21 +55,54 @@ func Run(ctx context.Context, w io.Writer, args []string) error {
 	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
 	defer cancel()
 
-	// Make sure we have a documents collection
-	milvusClient, err := rag.InitMilvusClient(ctx)
-	err = rag.CreateDocumentsCollection(ctx, milvusClient)
-
 	//Flags
 	fs := flag.NewFlagSet("myflagset", flag.ExitOnError)
 	var (
-		port = fs.String("port", "8080", "Port to listen on")
+		port        = fs.String("port", "8080", "Port to listen on")
+		migrateOnly = fs.Bool("migrate-only", false, "Apply the database migrations and exit")
+		seed        = fs.Bool("seed", false, "Load the development seed data after migrating")
 	)
-	err = fs.Parse(args[1:])
+	err := fs.Parse(args[1:])
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	srv := newServer()
+	// One pool for the whole process, every replica migrates it at boot and the migrator's lock lets only
+	// one of them do the work. DB_DRIVER selects SQLite or Postgres.
+	st, applied, err := store.Open(ctx, store.ConfigFromEnv())
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	for _, version := range applied {
+		log.Printf("applied %s migration %d\n", st.Driver(), version)
+	}
+	if *seed {
+		if err := store.Seed(ctx, st); err != nil {
+			return fmt.Errorf("failed to seed database: %w", err)
+		}
+	}
+	if *migrateOnly {
+		return nil
+	}
+	// Originals of uploaded files, BLOB_DRIVER selects the filesystem or S3
+	blobs, err := store.OpenBlobStore(ctx, store.BlobConfigFromEnv())
+	if err != nil {
+		return err
+	}
+	a := app.New(st, blobs)
+
+	// Make sure we have a documents collection, without Milvus the chat still works but documents aren't searched
+	milvusClient, err := rag.InitMilvusClient(ctx)
+	if err == nil {
+		err = rag.CreateDocumentsCollection(ctx, milvusClient)
+		milvusClient.Close()
+	}
+	if err != nil {
+		log.Printf("failed to set up the documents collection: %s\n", err)
+	}
+
+	srv := newServer(a)
 
 	httpServer := &http.Server{
 		Addr:    fmt.Sprintf(":%s", *port),
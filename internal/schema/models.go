@@ -20,6 +20,39 @@ type AccountDomain struct {
 	Domain  string
 }
 
+type ApiKey struct {
+	ID         string
+	User       string
+	Name       string
+	Prefix     string
+	Hash       string
+	Scopes     string
+	Expiresat  string
+	Lastusedat sql.NullString
+	Revokedat  sql.NullString
+	Createdat  string
+}
+
+type Conversation struct {
+	ID        string
+	Owner     string
+	Createdat string
+}
+
+type ConversationKnowledgeBase struct {
+	Conversation  string
+	Knowledgebase string
+	User          string
+	Createdat     string
+}
+
+type DomainClaim struct {
+	Account   string
+	Domain    string
+	Token     string
+	Createdat string
+}
+
 type Event struct {
 	ID        int64
 	Event     string
@@ -28,12 +61,102 @@ type Event struct {
 	User      string
 }
 
-type File struct {
+type Extraction struct {
 	ID        string
+	Owner     string
 	Name      string
+	Fields    string
 	Createdat string
-	Updatedat string
-	Owner     string
+}
+
+type ExtractionResult struct {
+	Extraction string
+	File       string
+	Status     string
+	Data       string
+	Error      string
+	Createdat  string
+	Updatedat  string
+}
+
+type File struct {
+	ID             string
+	Name           string
+	Createdat      string
+	Updatedat      string
+	Owner          string
+	Hash           string
+	Size           int64
+	Mimetype       string
+	Conversation   string
+	Embeddingmodel string
+	Chunkerversion int64
+}
+
+type FileSummary struct {
+	File      string
+	Version   string
+	Summary   string
+	Createdat string
+}
+
+type FileTag struct {
+	File      string
+	Tag       string
+	Createdat string
+}
+
+type Impersonation struct {
+	ID        string
+	Actor     string
+	User      string
+	Session   string
+	Reason    string
+	Expiresat string
+	Endedat   sql.NullString
+	Createdat string
+}
+
+type KnowledgeBase struct {
+	ID          string
+	Name        string
+	Description string
+	Account     sql.NullString
+	Owner       sql.NullString
+	Createdat   string
+	Updatedat   string
+}
+
+type KnowledgeBaseFile struct {
+	Knowledgebase string
+	File          string
+	Createdat     string
+}
+
+type OidcProvider struct {
+	ID           string
+	Account      sql.NullString
+	Name         string
+	Issuer       string
+	Clientid     string
+	Clientsecret string
+	Scopes       string
+	Createdat    string
+	Updatedat    string
+}
+
+type Session struct {
+	ID                  string
+	User                string
+	Refreshhash         string
+	Previousrefreshhash sql.NullString
+	Rotatedat           sql.NullString
+	Useragent           sql.NullString
+	Ip                  sql.NullString
+	Expiresat           string
+	Revokedat           sql.NullString
+	Createdat           string
+	Updatedat           string
 }
 
 type User struct {
@@ -44,4 +167,6 @@ type User struct {
 	Externalid sql.NullString
 	Createdat  string
 	Updatedat  string
+	Role       string
+	Disabledat sql.NullString
 }
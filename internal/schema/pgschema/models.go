@@ -0,0 +1,172 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+
+package pgschema
+
+import (
+	"database/sql"
+)
+
+type Account struct {
+	ID        string
+	Name      string
+	Createdat string
+	Updatedat string
+}
+
+type AccountDomain struct {
+	Account string
+	Domain  string
+}
+
+type ApiKey struct {
+	ID         string
+	User       string
+	Name       string
+	Prefix     string
+	Hash       string
+	Scopes     string
+	Expiresat  string
+	Lastusedat sql.NullString
+	Revokedat  sql.NullString
+	Createdat  string
+}
+
+type Conversation struct {
+	ID        string
+	Owner     string
+	Createdat string
+}
+
+type ConversationKnowledgeBase struct {
+	Conversation  string
+	Knowledgebase string
+	User          string
+	Createdat     string
+}
+
+type DomainClaim struct {
+	Account   string
+	Domain    string
+	Token     string
+	Createdat string
+}
+
+type Event struct {
+	ID        int64
+	Event     string
+	Timestamp string
+	Metadata  sql.NullString
+	User      string
+}
+
+type Extraction struct {
+	ID        string
+	Owner     string
+	Name      string
+	Fields    string
+	Createdat string
+}
+
+type ExtractionResult struct {
+	Extraction string
+	File       string
+	Status     string
+	Data       string
+	Error      string
+	Createdat  string
+	Updatedat  string
+}
+
+type File struct {
+	ID             string
+	Name           string
+	Createdat      string
+	Updatedat      string
+	Owner          string
+	Hash           string
+	Size           int64
+	Mimetype       string
+	Conversation   string
+	Embeddingmodel string
+	Chunkerversion int64
+}
+
+type FileSummary struct {
+	File      string
+	Version   string
+	Summary   string
+	Createdat string
+}
+
+type FileTag struct {
+	File      string
+	Tag       string
+	Createdat string
+}
+
+type Impersonation struct {
+	ID        string
+	Actor     string
+	User      string
+	Session   string
+	Reason    string
+	Expiresat string
+	Endedat   sql.NullString
+	Createdat string
+}
+
+type KnowledgeBase struct {
+	ID          string
+	Name        string
+	Description string
+	Account     sql.NullString
+	Owner       sql.NullString
+	Createdat   string
+	Updatedat   string
+}
+
+type KnowledgeBaseFile struct {
+	Knowledgebase string
+	File          string
+	Createdat     string
+}
+
+type OidcProvider struct {
+	ID           string
+	Account      sql.NullString
+	Name         string
+	Issuer       string
+	Clientid     string
+	Clientsecret string
+	Scopes       string
+	Createdat    string
+	Updatedat    string
+}
+
+type Session struct {
+	ID                  string
+	User                string
+	Refreshhash         string
+	Previousrefreshhash sql.NullString
+	Rotatedat           sql.NullString
+	Useragent           sql.NullString
+	Ip                  sql.NullString
+	Expiresat           string
+	Revokedat           sql.NullString
+	Createdat           string
+	Updatedat           string
+}
+
+type User struct {
+	ID         string
+	Name       sql.NullString
+	Email      string
+	Account    string
+	Externalid sql.NullString
+	Createdat  string
+	Updatedat  string
+	Role       string
+	Disabledat sql.NullString
+}
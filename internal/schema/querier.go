@@ -0,0 +1,142 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+
+package schema
+
+import (
+	"context"
+	"database/sql"
+)
+
+type Querier interface {
+	AddExtractionResult(ctx context.Context, arg AddExtractionResultParams) error
+	AddFileTag(ctx context.Context, arg AddFileTagParams) error
+	AddKnowledgeBaseFile(ctx context.Context, arg AddKnowledgeBaseFileParams) error
+	AttachKnowledgeBase(ctx context.Context, arg AttachKnowledgeBaseParams) error
+	// CONVERSATIONS
+	ClaimConversation(ctx context.Context, arg ClaimConversationParams) error
+	CountAccounts(ctx context.Context, search string) (int64, error)
+	CountUsers(ctx context.Context, arg CountUsersParams) (int64, error)
+	CreateAccount(ctx context.Context, arg CreateAccountParams) (Account, error)
+	CreateAccountDomain(ctx context.Context, arg CreateAccountDomainParams) (AccountDomain, error)
+	// API KEYS
+	CreateApiKey(ctx context.Context, arg CreateApiKeyParams) (ApiKey, error)
+	CreateDomainClaim(ctx context.Context, arg CreateDomainClaimParams) error
+	// EVENTS
+	CreateEvent(ctx context.Context, arg CreateEventParams) (Event, error)
+	// EXTRACTIONS
+	CreateExtraction(ctx context.Context, arg CreateExtractionParams) (Extraction, error)
+	// FILES
+	CreateFile(ctx context.Context, arg CreateFileParams) (File, error)
+	// IMPERSONATIONS
+	CreateImpersonation(ctx context.Context, arg CreateImpersonationParams) (Impersonation, error)
+	// KNOWLEDGE BASES
+	CreateKnowledgeBase(ctx context.Context, arg CreateKnowledgeBaseParams) (KnowledgeBase, error)
+	CreateOidcProvider(ctx context.Context, arg CreateOidcProviderParams) (OidcProvider, error)
+	// SESSIONS
+	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
+	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	DeleteAccount(ctx context.Context, id string) (int64, error)
+	DeleteAccountConversationKnowledgeBases(ctx context.Context, account sql.NullString) error
+	DeleteAccountDomain(ctx context.Context, domain string) error
+	DeleteAccountDomainClaims(ctx context.Context, account string) error
+	DeleteAccountDomainForAccount(ctx context.Context, arg DeleteAccountDomainForAccountParams) (int64, error)
+	DeleteAccountDomains(ctx context.Context, account string) error
+	DeleteAccountKnowledgeBaseFiles(ctx context.Context, account sql.NullString) error
+	DeleteAccountKnowledgeBases(ctx context.Context, account sql.NullString) error
+	DeleteAccountOidcProviders(ctx context.Context, account sql.NullString) error
+	DeleteConversation(ctx context.Context, arg DeleteConversationParams) (int64, error)
+	DeleteDomainClaim(ctx context.Context, arg DeleteDomainClaimParams) (int64, error)
+	DeleteDomainClaims(ctx context.Context, domain string) error
+	DeleteFile(ctx context.Context, arg DeleteFileParams) (int64, error)
+	DeleteFileExtractionResults(ctx context.Context, file string) error
+	DeleteFileKnowledgeBaseFiles(ctx context.Context, file string) error
+	DeleteFileSummaries(ctx context.Context, file string) error
+	DeleteFileTags(ctx context.Context, file string) error
+	DeleteKnowledgeBase(ctx context.Context, id string) (int64, error)
+	DeleteKnowledgeBaseConversations(ctx context.Context, knowledgebase string) error
+	DeleteKnowledgeBaseFiles(ctx context.Context, knowledgebase string) error
+	DeleteOidcProvider(ctx context.Context, id string) error
+	DeleteUser(ctx context.Context, id string) (int64, error)
+	DeleteUserApiKeys(ctx context.Context, user string) error
+	DeleteUserConversationKnowledgeBases(ctx context.Context, user string) error
+	DeleteUserConversations(ctx context.Context, owner string) error
+	// Everything that references a user has to go before the user itself
+	DeleteUserEvents(ctx context.Context, user string) error
+	DeleteUserExtractionResults(ctx context.Context, owner string) error
+	DeleteUserExtractions(ctx context.Context, owner string) error
+	DeleteUserFileSummaries(ctx context.Context, owner string) error
+	DeleteUserFileTags(ctx context.Context, owner string) error
+	DeleteUserFiles(ctx context.Context, owner string) error
+	DeleteUserImpersonations(ctx context.Context, user string) error
+	DeleteUserKnowledgeBaseFiles(ctx context.Context, user string) error
+	DeleteUserKnowledgeBases(ctx context.Context, owner sql.NullString) error
+	DeleteUserSessions(ctx context.Context, user string) error
+	DetachConversationKnowledgeBases(ctx context.Context, arg DetachConversationKnowledgeBasesParams) error
+	DetachKnowledgeBase(ctx context.Context, arg DetachKnowledgeBaseParams) (int64, error)
+	DisableUser(ctx context.Context, arg DisableUserParams) (int64, error)
+	EnableUser(ctx context.Context, id string) (int64, error)
+	EndImpersonation(ctx context.Context, arg EndImpersonationParams) (int64, error)
+	GetAccount(ctx context.Context, id string) (GetAccountRow, error)
+	GetAccountByDomain(ctx context.Context, domain string) (GetAccountByDomainRow, error)
+	GetAccountById(ctx context.Context, id string) (Account, error)
+	GetApiKeyByHash(ctx context.Context, hash string) (ApiKey, error)
+	GetConversation(ctx context.Context, id string) (Conversation, error)
+	GetDomainClaim(ctx context.Context, arg GetDomainClaimParams) (DomainClaim, error)
+	GetEvent(ctx context.Context, id int64) (Event, error)
+	GetExtraction(ctx context.Context, id string) (Extraction, error)
+	GetFile(ctx context.Context, id string) (File, error)
+	GetFileSummary(ctx context.Context, arg GetFileSummaryParams) (FileSummary, error)
+	GetImpersonation(ctx context.Context, id string) (Impersonation, error)
+	GetKnowledgeBase(ctx context.Context, id string) (KnowledgeBase, error)
+	// OIDC PROVIDERS
+	GetOidcProvider(ctx context.Context, id string) (OidcProvider, error)
+	GetSession(ctx context.Context, id string) (Session, error)
+	// Users
+	GetUser(ctx context.Context, id string) (GetUserRow, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserByExternalID(ctx context.Context, externalid sql.NullString) (User, error)
+	ListAccount(ctx context.Context) ([]Account, error)
+	ListAccountDomains(ctx context.Context, account string) ([]AccountDomain, error)
+	ListAccountsPage(ctx context.Context, arg ListAccountsPageParams) ([]Account, error)
+	ListAllFileTags(ctx context.Context) ([]FileTag, error)
+	ListApiKeysByUser(ctx context.Context, user string) ([]ApiKey, error)
+	ListConversationFiles(ctx context.Context, arg ListConversationFilesParams) ([]File, error)
+	ListConversationIDs(ctx context.Context) ([]string, error)
+	ListConversationKnowledgeBases(ctx context.Context, arg ListConversationKnowledgeBasesParams) ([]KnowledgeBase, error)
+	ListDomainClaims(ctx context.Context, account string) ([]DomainClaim, error)
+	ListEvents(ctx context.Context, arg ListEventsParams) ([]Event, error)
+	ListExtractionResults(ctx context.Context, extraction string) ([]ListExtractionResultsRow, error)
+	ListExtractions(ctx context.Context, owner string) ([]Extraction, error)
+	ListFileAccounts(ctx context.Context) ([]ListFileAccountsRow, error)
+	ListFileTags(ctx context.Context, file string) ([]string, error)
+	ListFiles(ctx context.Context) ([]File, error)
+	ListKnowledgeBaseFiles(ctx context.Context, knowledgebase string) ([]File, error)
+	ListKnowledgeBaseMemberships(ctx context.Context) ([]KnowledgeBaseFile, error)
+	// The account's knowledge bases and the user's own
+	ListKnowledgeBases(ctx context.Context, arg ListKnowledgeBasesParams) ([]KnowledgeBase, error)
+	ListOidcProvidersByAccount(ctx context.Context, account sql.NullString) ([]OidcProvider, error)
+	ListUser(ctx context.Context) ([]User, error)
+	ListUserFiles(ctx context.Context, owner string) ([]File, error)
+	ListUsersByAccount(ctx context.Context, account string) ([]User, error)
+	ListUsersPage(ctx context.Context, arg ListUsersPageParams) ([]User, error)
+	RemoveKnowledgeBaseFile(ctx context.Context, arg RemoveKnowledgeBaseFileParams) (int64, error)
+	RevokeApiKey(ctx context.Context, arg RevokeApiKeyParams) (int64, error)
+	RevokeSession(ctx context.Context, arg RevokeSessionParams) error
+	RevokeUserApiKeys(ctx context.Context, arg RevokeUserApiKeysParams) (int64, error)
+	RevokeUserSessions(ctx context.Context, arg RevokeUserSessionsParams) (int64, error)
+	RotateSession(ctx context.Context, arg RotateSessionParams) (int64, error)
+	SaveExtractionResult(ctx context.Context, arg SaveExtractionResultParams) error
+	SaveFileSummary(ctx context.Context, arg SaveFileSummaryParams) error
+	SetFileIndex(ctx context.Context, arg SetFileIndexParams) error
+	SetUserExternalID(ctx context.Context, arg SetUserExternalIDParams) error
+	TouchApiKey(ctx context.Context, arg TouchApiKeyParams) error
+	UpdateAccountName(ctx context.Context, arg UpdateAccountNameParams) (int64, error)
+	UpdateKnowledgeBase(ctx context.Context, arg UpdateKnowledgeBaseParams) (int64, error)
+	UpdateUserAccount(ctx context.Context, arg UpdateUserAccountParams) error
+	UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (int64, error)
+	UsageByAccount(ctx context.Context, arg UsageByAccountParams) ([]UsageByAccountRow, error)
+}
+
+var _ Querier = (*Queries)(nil)
@@ -10,6 +10,134 @@ import (
 	"database/sql"
 )
 
+const addExtractionResult = `-- name: AddExtractionResult :exec
+INSERT INTO extraction_result (
+    extraction, file
+) VALUES (
+    ?, ?
+)
+ON CONFLICT DO NOTHING
+`
+
+type AddExtractionResultParams struct {
+	Extraction string
+	File       string
+}
+
+func (q *Queries) AddExtractionResult(ctx context.Context, arg AddExtractionResultParams) error {
+	_, err := q.db.ExecContext(ctx, addExtractionResult, arg.Extraction, arg.File)
+	return err
+}
+
+const addFileTag = `-- name: AddFileTag :exec
+INSERT INTO file_tag (
+    file, tag
+) VALUES (
+    ?, ?
+)
+ON CONFLICT DO NOTHING
+`
+
+type AddFileTagParams struct {
+	File string
+	Tag  string
+}
+
+func (q *Queries) AddFileTag(ctx context.Context, arg AddFileTagParams) error {
+	_, err := q.db.ExecContext(ctx, addFileTag, arg.File, arg.Tag)
+	return err
+}
+
+const addKnowledgeBaseFile = `-- name: AddKnowledgeBaseFile :exec
+INSERT INTO knowledge_base_file (
+    knowledgeBase, file
+) VALUES (
+    ?, ?
+)
+ON CONFLICT DO NOTHING
+`
+
+type AddKnowledgeBaseFileParams struct {
+	Knowledgebase string
+	File          string
+}
+
+func (q *Queries) AddKnowledgeBaseFile(ctx context.Context, arg AddKnowledgeBaseFileParams) error {
+	_, err := q.db.ExecContext(ctx, addKnowledgeBaseFile, arg.Knowledgebase, arg.File)
+	return err
+}
+
+const attachKnowledgeBase = `-- name: AttachKnowledgeBase :exec
+INSERT INTO conversation_knowledge_base (
+    conversation, knowledgeBase, user
+) VALUES (
+    ?, ?, ?
+)
+ON CONFLICT DO NOTHING
+`
+
+type AttachKnowledgeBaseParams struct {
+	Conversation  string
+	Knowledgebase string
+	User          string
+}
+
+func (q *Queries) AttachKnowledgeBase(ctx context.Context, arg AttachKnowledgeBaseParams) error {
+	_, err := q.db.ExecContext(ctx, attachKnowledgeBase, arg.Conversation, arg.Knowledgebase, arg.User)
+	return err
+}
+
+const claimConversation = `-- name: ClaimConversation :exec
+
+INSERT INTO conversation (
+    id, owner
+) VALUES (
+    ?, ?
+)
+ON CONFLICT (id) DO NOTHING
+`
+
+type ClaimConversationParams struct {
+	ID    string
+	Owner string
+}
+
+// CONVERSATIONS
+func (q *Queries) ClaimConversation(ctx context.Context, arg ClaimConversationParams) error {
+	_, err := q.db.ExecContext(ctx, claimConversation, arg.ID, arg.Owner)
+	return err
+}
+
+const countAccounts = `-- name: CountAccounts :one
+SELECT COUNT(*) FROM account
+WHERE name LIKE ?1 OR id LIKE ?1
+`
+
+func (q *Queries) CountAccounts(ctx context.Context, search string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countAccounts, search)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countUsers = `-- name: CountUsers :one
+SELECT COUNT(*) FROM user
+WHERE (account = ?1 OR ?1 = '')
+  AND (email LIKE ?2 OR IFNULL(name, '') LIKE ?2)
+`
+
+type CountUsersParams struct {
+	Account string
+	Search  string
+}
+
+func (q *Queries) CountUsers(ctx context.Context, arg CountUsersParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsers, arg.Account, arg.Search)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createAccount = `-- name: CreateAccount :one
 INSERT INTO account (
     id, name
@@ -57,6 +185,69 @@ func (q *Queries) CreateAccountDomain(ctx context.Context, arg CreateAccountDoma
 	return i, err
 }
 
+const createApiKey = `-- name: CreateApiKey :one
+INSERT INTO api_key (
+    id, user, name, prefix, hash, scopes, expiresAt
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?
+)
+RETURNING id, user, name, prefix, hash, scopes, expiresat, lastusedat, revokedat, createdat
+`
+
+type CreateApiKeyParams struct {
+	ID        string
+	User      string
+	Name      string
+	Prefix    string
+	Hash      string
+	Scopes    string
+	Expiresat string
+}
+
+// API KEYS
+func (q *Queries) CreateApiKey(ctx context.Context, arg CreateApiKeyParams) (ApiKey, error) {
+	row := q.db.QueryRowContext(ctx, createApiKey,
+		arg.ID,
+		arg.User,
+		arg.Name,
+		arg.Prefix,
+		arg.Hash,
+		arg.Scopes,
+		arg.Expiresat,
+	)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.User,
+		&i.Name,
+		&i.Prefix,
+		&i.Hash,
+		&i.Scopes,
+		&i.Expiresat,
+		&i.Lastusedat,
+		&i.Revokedat,
+		&i.Createdat,
+	)
+	return i, err
+}
+
+const createDomainClaim = `-- name: CreateDomainClaim :exec
+INSERT INTO domain_claim (account, domain, token)
+VALUES (?1, ?2, ?3)
+ON CONFLICT (account, domain) DO NOTHING
+`
+
+type CreateDomainClaimParams struct {
+	Account string
+	Domain  string
+	Token   string
+}
+
+func (q *Queries) CreateDomainClaim(ctx context.Context, arg CreateDomainClaimParams) error {
+	_, err := q.db.ExecContext(ctx, createDomainClaim, arg.Account, arg.Domain, arg.Token)
+	return err
+}
+
 const createEvent = `-- name: CreateEvent :one
 
 INSERT INTO event (
@@ -87,24 +278,72 @@ func (q *Queries) CreateEvent(ctx context.Context, arg CreateEventParams) (Event
 	return i, err
 }
 
+const createExtraction = `-- name: CreateExtraction :one
+
+INSERT INTO extraction (
+    id, owner, name, fields
+) VALUES (
+    ?, ?, ?, ?
+)
+RETURNING id, owner, name, fields, createdat
+`
+
+type CreateExtractionParams struct {
+	ID     string
+	Owner  string
+	Name   string
+	Fields string
+}
+
+// EXTRACTIONS
+func (q *Queries) CreateExtraction(ctx context.Context, arg CreateExtractionParams) (Extraction, error) {
+	row := q.db.QueryRowContext(ctx, createExtraction,
+		arg.ID,
+		arg.Owner,
+		arg.Name,
+		arg.Fields,
+	)
+	var i Extraction
+	err := row.Scan(
+		&i.ID,
+		&i.Owner,
+		&i.Name,
+		&i.Fields,
+		&i.Createdat,
+	)
+	return i, err
+}
+
 const createFile = `-- name: CreateFile :one
 INSERT INTO file (
-    id, name, owner
+    id, name, owner, hash, size, mimetype, conversation
 ) VALUES (
- ?, ?, ?
+ ?, ?, ?, ?, ?, ?, ?
  )
-RETURNING id, name, createdat, updatedat, owner
+RETURNING id, name, createdat, updatedat, owner, hash, size, mimetype, conversation, embeddingmodel, chunkerversion
 `
 
 type CreateFileParams struct {
-	ID    string
-	Name  string
-	Owner string
+	ID           string
+	Name         string
+	Owner        string
+	Hash         string
+	Size         int64
+	Mimetype     string
+	Conversation string
 }
 
 // FILES
 func (q *Queries) CreateFile(ctx context.Context, arg CreateFileParams) (File, error) {
-	row := q.db.QueryRowContext(ctx, createFile, arg.ID, arg.Name, arg.Owner)
+	row := q.db.QueryRowContext(ctx, createFile,
+		arg.ID,
+		arg.Name,
+		arg.Owner,
+		arg.Hash,
+		arg.Size,
+		arg.Mimetype,
+		arg.Conversation,
+	)
 	var i File
 	err := row.Scan(
 		&i.ID,
@@ -112,6 +351,182 @@ func (q *Queries) CreateFile(ctx context.Context, arg CreateFileParams) (File, e
 		&i.Createdat,
 		&i.Updatedat,
 		&i.Owner,
+		&i.Hash,
+		&i.Size,
+		&i.Mimetype,
+		&i.Conversation,
+		&i.Embeddingmodel,
+		&i.Chunkerversion,
+	)
+	return i, err
+}
+
+const createImpersonation = `-- name: CreateImpersonation :one
+INSERT INTO impersonation (
+    id, actor, user, session, reason, expiresAt
+) VALUES (
+    ?, ?, ?, ?, ?, ?
+)
+RETURNING id, actor, user, session, reason, expiresat, endedat, createdat
+`
+
+type CreateImpersonationParams struct {
+	ID        string
+	Actor     string
+	User      string
+	Session   string
+	Reason    string
+	Expiresat string
+}
+
+// IMPERSONATIONS
+func (q *Queries) CreateImpersonation(ctx context.Context, arg CreateImpersonationParams) (Impersonation, error) {
+	row := q.db.QueryRowContext(ctx, createImpersonation,
+		arg.ID,
+		arg.Actor,
+		arg.User,
+		arg.Session,
+		arg.Reason,
+		arg.Expiresat,
+	)
+	var i Impersonation
+	err := row.Scan(
+		&i.ID,
+		&i.Actor,
+		&i.User,
+		&i.Session,
+		&i.Reason,
+		&i.Expiresat,
+		&i.Endedat,
+		&i.Createdat,
+	)
+	return i, err
+}
+
+const createKnowledgeBase = `-- name: CreateKnowledgeBase :one
+INSERT INTO knowledge_base (
+    id, name, description, account, owner
+) VALUES (
+    ?, ?, ?, ?, ?
+)
+RETURNING id, name, description, account, owner, createdat, updatedat
+`
+
+type CreateKnowledgeBaseParams struct {
+	ID          string
+	Name        string
+	Description string
+	Account     sql.NullString
+	Owner       sql.NullString
+}
+
+// KNOWLEDGE BASES
+func (q *Queries) CreateKnowledgeBase(ctx context.Context, arg CreateKnowledgeBaseParams) (KnowledgeBase, error) {
+	row := q.db.QueryRowContext(ctx, createKnowledgeBase,
+		arg.ID,
+		arg.Name,
+		arg.Description,
+		arg.Account,
+		arg.Owner,
+	)
+	var i KnowledgeBase
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.Account,
+		&i.Owner,
+		&i.Createdat,
+		&i.Updatedat,
+	)
+	return i, err
+}
+
+const createOidcProvider = `-- name: CreateOidcProvider :one
+INSERT INTO oidc_provider (
+    id, account, name, issuer, clientId, clientSecret, scopes
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?
+)
+RETURNING id, account, name, issuer, clientid, clientsecret, scopes, createdat, updatedat
+`
+
+type CreateOidcProviderParams struct {
+	ID           string
+	Account      sql.NullString
+	Name         string
+	Issuer       string
+	Clientid     string
+	Clientsecret string
+	Scopes       string
+}
+
+func (q *Queries) CreateOidcProvider(ctx context.Context, arg CreateOidcProviderParams) (OidcProvider, error) {
+	row := q.db.QueryRowContext(ctx, createOidcProvider,
+		arg.ID,
+		arg.Account,
+		arg.Name,
+		arg.Issuer,
+		arg.Clientid,
+		arg.Clientsecret,
+		arg.Scopes,
+	)
+	var i OidcProvider
+	err := row.Scan(
+		&i.ID,
+		&i.Account,
+		&i.Name,
+		&i.Issuer,
+		&i.Clientid,
+		&i.Clientsecret,
+		&i.Scopes,
+		&i.Createdat,
+		&i.Updatedat,
+	)
+	return i, err
+}
+
+const createSession = `-- name: CreateSession :one
+INSERT INTO session (
+    id, user, refreshHash, userAgent, ip, expiresAt
+) VALUES (
+    ?, ?, ?, ?, ?, ?
+)
+RETURNING id, user, refreshhash, previousrefreshhash, rotatedat, useragent, ip, expiresat, revokedat, createdat, updatedat
+`
+
+type CreateSessionParams struct {
+	ID          string
+	User        string
+	Refreshhash string
+	Useragent   sql.NullString
+	Ip          sql.NullString
+	Expiresat   string
+}
+
+// SESSIONS
+func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error) {
+	row := q.db.QueryRowContext(ctx, createSession,
+		arg.ID,
+		arg.User,
+		arg.Refreshhash,
+		arg.Useragent,
+		arg.Ip,
+		arg.Expiresat,
+	)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.User,
+		&i.Refreshhash,
+		&i.Previousrefreshhash,
+		&i.Rotatedat,
+		&i.Useragent,
+		&i.Ip,
+		&i.Expiresat,
+		&i.Revokedat,
+		&i.Createdat,
+		&i.Updatedat,
 	)
 	return i, err
 }
@@ -122,7 +537,7 @@ INSERT INTO user (
 ) VALUES (
            ?,  ?, ?, ?, ?
          )
-    RETURNING id, name, email, account, externalid, createdat, updatedat
+    RETURNING id, name, email, account, externalid, createdat, updatedat, role, disabledat
 `
 
 type CreateUserParams struct {
@@ -150,17 +565,32 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Externalid,
 		&i.Createdat,
 		&i.Updatedat,
+		&i.Role,
+		&i.Disabledat,
 	)
 	return i, err
 }
 
-const deleteAccount = `-- name: DeleteAccount :exec
+const deleteAccount = `-- name: DeleteAccount :execrows
 DELETE FROM account
 WHERE id = ?
 `
 
-func (q *Queries) DeleteAccount(ctx context.Context, id string) error {
-	_, err := q.db.ExecContext(ctx, deleteAccount, id)
+func (q *Queries) DeleteAccount(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteAccount, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteAccountConversationKnowledgeBases = `-- name: DeleteAccountConversationKnowledgeBases :exec
+DELETE FROM conversation_knowledge_base
+WHERE knowledgeBase IN (SELECT kb.id FROM knowledge_base kb WHERE kb.account = ?)
+`
+
+func (q *Queries) DeleteAccountConversationKnowledgeBases(ctx context.Context, account sql.NullString) error {
+	_, err := q.db.ExecContext(ctx, deleteAccountConversationKnowledgeBases, account)
 	return err
 }
 
@@ -174,121 +604,1381 @@ func (q *Queries) DeleteAccountDomain(ctx context.Context, domain string) error
 	return err
 }
 
-const deleteUser = `-- name: DeleteUser :exec
-DELETE FROM user
-WHERE id = ?
+const deleteAccountDomainClaims = `-- name: DeleteAccountDomainClaims :exec
+DELETE FROM domain_claim
+WHERE account = ?1
 `
 
-func (q *Queries) DeleteUser(ctx context.Context, id string) error {
-	_, err := q.db.ExecContext(ctx, deleteUser, id)
+func (q *Queries) DeleteAccountDomainClaims(ctx context.Context, account string) error {
+	_, err := q.db.ExecContext(ctx, deleteAccountDomainClaims, account)
 	return err
 }
 
-const getAccount = `-- name: GetAccount :one
-SELECT
-    a.id, a.name, a.createdat, a.updatedat,
-    IFNULL(GROUP_CONCAT(ad.domain), '') AS domains
-FROM
-    account a
-        LEFT JOIN
-    account_domain ad
-    ON
-        ad.account = a.id
-WHERE
-    a.id = ?
-GROUP BY
-    a.id
+const deleteAccountDomainForAccount = `-- name: DeleteAccountDomainForAccount :execrows
+DELETE FROM account_domain
+WHERE account = ?1
+  AND domain = ?2
 `
 
-type GetAccountRow struct {
-	ID        string
-	Name      string
-	Createdat string
-	Updatedat string
-	Domains   interface{}
+type DeleteAccountDomainForAccountParams struct {
+	Account string
+	Domain  string
 }
 
-func (q *Queries) GetAccount(ctx context.Context, id string) (GetAccountRow, error) {
-	row := q.db.QueryRowContext(ctx, getAccount, id)
-	var i GetAccountRow
-	err := row.Scan(
-		&i.ID,
-		&i.Name,
-		&i.Createdat,
-		&i.Updatedat,
-		&i.Domains,
-	)
-	return i, err
+func (q *Queries) DeleteAccountDomainForAccount(ctx context.Context, arg DeleteAccountDomainForAccountParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteAccountDomainForAccount, arg.Account, arg.Domain)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
-const getAccountByDomain = `-- name: GetAccountByDomain :one
-SELECT
-    a.id,
-    a.name,
-    ad.domain
-FROM
-    account a
-        JOIN
-    account_domain ad ON a.id = ad.account
-WHERE
-    ad.domain = ?
+const deleteAccountDomains = `-- name: DeleteAccountDomains :exec
+DELETE FROM account_domain
+WHERE account = ?
 `
 
-type GetAccountByDomainRow struct {
-	ID     string
-	Name   string
-	Domain string
+func (q *Queries) DeleteAccountDomains(ctx context.Context, account string) error {
+	_, err := q.db.ExecContext(ctx, deleteAccountDomains, account)
+	return err
 }
 
-func (q *Queries) GetAccountByDomain(ctx context.Context, domain string) (GetAccountByDomainRow, error) {
-	row := q.db.QueryRowContext(ctx, getAccountByDomain, domain)
-	var i GetAccountByDomainRow
-	err := row.Scan(&i.ID, &i.Name, &i.Domain)
+const deleteAccountKnowledgeBaseFiles = `-- name: DeleteAccountKnowledgeBaseFiles :exec
+DELETE FROM knowledge_base_file
+WHERE knowledgeBase IN (SELECT kb.id FROM knowledge_base kb WHERE kb.account = ?)
+`
+
+func (q *Queries) DeleteAccountKnowledgeBaseFiles(ctx context.Context, account sql.NullString) error {
+	_, err := q.db.ExecContext(ctx, deleteAccountKnowledgeBaseFiles, account)
+	return err
+}
+
+const deleteAccountKnowledgeBases = `-- name: DeleteAccountKnowledgeBases :exec
+DELETE FROM knowledge_base
+WHERE account = ?
+`
+
+func (q *Queries) DeleteAccountKnowledgeBases(ctx context.Context, account sql.NullString) error {
+	_, err := q.db.ExecContext(ctx, deleteAccountKnowledgeBases, account)
+	return err
+}
+
+const deleteAccountOidcProviders = `-- name: DeleteAccountOidcProviders :exec
+DELETE FROM oidc_provider
+WHERE account = ?
+`
+
+func (q *Queries) DeleteAccountOidcProviders(ctx context.Context, account sql.NullString) error {
+	_, err := q.db.ExecContext(ctx, deleteAccountOidcProviders, account)
+	return err
+}
+
+const deleteConversation = `-- name: DeleteConversation :execrows
+DELETE FROM conversation
+WHERE id = ? AND owner = ?
+`
+
+type DeleteConversationParams struct {
+	ID    string
+	Owner string
+}
+
+func (q *Queries) DeleteConversation(ctx context.Context, arg DeleteConversationParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteConversation, arg.ID, arg.Owner)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteDomainClaim = `-- name: DeleteDomainClaim :execrows
+DELETE FROM domain_claim
+WHERE account = ?1
+  AND domain = ?2
+`
+
+type DeleteDomainClaimParams struct {
+	Account string
+	Domain  string
+}
+
+func (q *Queries) DeleteDomainClaim(ctx context.Context, arg DeleteDomainClaimParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteDomainClaim, arg.Account, arg.Domain)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteDomainClaims = `-- name: DeleteDomainClaims :exec
+DELETE FROM domain_claim
+WHERE domain = ?1
+`
+
+func (q *Queries) DeleteDomainClaims(ctx context.Context, domain string) error {
+	_, err := q.db.ExecContext(ctx, deleteDomainClaims, domain)
+	return err
+}
+
+const deleteFile = `-- name: DeleteFile :execrows
+DELETE FROM file
+WHERE id = ?1 AND owner = ?2
+`
+
+type DeleteFileParams struct {
+	ID    string
+	Owner string
+}
+
+func (q *Queries) DeleteFile(ctx context.Context, arg DeleteFileParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteFile, arg.ID, arg.Owner)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteFileExtractionResults = `-- name: DeleteFileExtractionResults :exec
+DELETE FROM extraction_result
+WHERE file = ?
+`
+
+func (q *Queries) DeleteFileExtractionResults(ctx context.Context, file string) error {
+	_, err := q.db.ExecContext(ctx, deleteFileExtractionResults, file)
+	return err
+}
+
+const deleteFileKnowledgeBaseFiles = `-- name: DeleteFileKnowledgeBaseFiles :exec
+DELETE FROM knowledge_base_file
+WHERE file = ?
+`
+
+func (q *Queries) DeleteFileKnowledgeBaseFiles(ctx context.Context, file string) error {
+	_, err := q.db.ExecContext(ctx, deleteFileKnowledgeBaseFiles, file)
+	return err
+}
+
+const deleteFileSummaries = `-- name: DeleteFileSummaries :exec
+DELETE FROM file_summary
+WHERE file = ?
+`
+
+func (q *Queries) DeleteFileSummaries(ctx context.Context, file string) error {
+	_, err := q.db.ExecContext(ctx, deleteFileSummaries, file)
+	return err
+}
+
+const deleteFileTags = `-- name: DeleteFileTags :exec
+DELETE FROM file_tag
+WHERE file = ?
+`
+
+func (q *Queries) DeleteFileTags(ctx context.Context, file string) error {
+	_, err := q.db.ExecContext(ctx, deleteFileTags, file)
+	return err
+}
+
+const deleteKnowledgeBase = `-- name: DeleteKnowledgeBase :execrows
+DELETE FROM knowledge_base
+WHERE id = ?
+`
+
+func (q *Queries) DeleteKnowledgeBase(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteKnowledgeBase, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteKnowledgeBaseConversations = `-- name: DeleteKnowledgeBaseConversations :exec
+DELETE FROM conversation_knowledge_base
+WHERE knowledgeBase = ?
+`
+
+func (q *Queries) DeleteKnowledgeBaseConversations(ctx context.Context, knowledgebase string) error {
+	_, err := q.db.ExecContext(ctx, deleteKnowledgeBaseConversations, knowledgebase)
+	return err
+}
+
+const deleteKnowledgeBaseFiles = `-- name: DeleteKnowledgeBaseFiles :exec
+DELETE FROM knowledge_base_file
+WHERE knowledgeBase = ?
+`
+
+func (q *Queries) DeleteKnowledgeBaseFiles(ctx context.Context, knowledgebase string) error {
+	_, err := q.db.ExecContext(ctx, deleteKnowledgeBaseFiles, knowledgebase)
+	return err
+}
+
+const deleteOidcProvider = `-- name: DeleteOidcProvider :exec
+DELETE FROM oidc_provider
+WHERE id = ?
+`
+
+func (q *Queries) DeleteOidcProvider(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, deleteOidcProvider, id)
+	return err
+}
+
+const deleteUser = `-- name: DeleteUser :execrows
+DELETE FROM user
+WHERE id = ?
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteUserApiKeys = `-- name: DeleteUserApiKeys :exec
+DELETE FROM api_key
+WHERE user = ?
+`
+
+func (q *Queries) DeleteUserApiKeys(ctx context.Context, user string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserApiKeys, user)
+	return err
+}
+
+const deleteUserConversationKnowledgeBases = `-- name: DeleteUserConversationKnowledgeBases :exec
+DELETE FROM conversation_knowledge_base
+WHERE user = ?1 OR knowledgeBase IN (SELECT kb.id FROM knowledge_base kb WHERE kb.owner = ?1)
+`
+
+func (q *Queries) DeleteUserConversationKnowledgeBases(ctx context.Context, user string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserConversationKnowledgeBases, user)
+	return err
+}
+
+const deleteUserConversations = `-- name: DeleteUserConversations :exec
+DELETE FROM conversation
+WHERE owner = ?
+`
+
+func (q *Queries) DeleteUserConversations(ctx context.Context, owner string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserConversations, owner)
+	return err
+}
+
+const deleteUserEvents = `-- name: DeleteUserEvents :exec
+DELETE FROM event
+WHERE user = ?
+`
+
+// Everything that references a user has to go before the user itself
+func (q *Queries) DeleteUserEvents(ctx context.Context, user string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserEvents, user)
+	return err
+}
+
+const deleteUserExtractionResults = `-- name: DeleteUserExtractionResults :exec
+DELETE FROM extraction_result
+WHERE extraction IN (SELECT e.id FROM extraction e WHERE e.owner = ?1)
+   OR file IN (SELECT f.id FROM file f WHERE f.owner = ?1)
+`
+
+func (q *Queries) DeleteUserExtractionResults(ctx context.Context, owner string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserExtractionResults, owner)
+	return err
+}
+
+const deleteUserExtractions = `-- name: DeleteUserExtractions :exec
+DELETE FROM extraction
+WHERE owner = ?
+`
+
+func (q *Queries) DeleteUserExtractions(ctx context.Context, owner string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserExtractions, owner)
+	return err
+}
+
+const deleteUserFileSummaries = `-- name: DeleteUserFileSummaries :exec
+DELETE FROM file_summary
+WHERE file IN (SELECT f.id FROM file f WHERE f.owner = ?)
+`
+
+func (q *Queries) DeleteUserFileSummaries(ctx context.Context, owner string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserFileSummaries, owner)
+	return err
+}
+
+const deleteUserFileTags = `-- name: DeleteUserFileTags :exec
+DELETE FROM file_tag
+WHERE file IN (SELECT f.id FROM file f WHERE f.owner = ?)
+`
+
+func (q *Queries) DeleteUserFileTags(ctx context.Context, owner string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserFileTags, owner)
+	return err
+}
+
+const deleteUserFiles = `-- name: DeleteUserFiles :exec
+DELETE FROM file
+WHERE owner = ?
+`
+
+func (q *Queries) DeleteUserFiles(ctx context.Context, owner string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserFiles, owner)
+	return err
+}
+
+const deleteUserImpersonations = `-- name: DeleteUserImpersonations :exec
+DELETE FROM impersonation
+WHERE user = ?1 OR actor = ?1
+`
+
+func (q *Queries) DeleteUserImpersonations(ctx context.Context, user string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserImpersonations, user)
+	return err
+}
+
+const deleteUserKnowledgeBaseFiles = `-- name: DeleteUserKnowledgeBaseFiles :exec
+DELETE FROM knowledge_base_file
+WHERE file IN (SELECT f.id FROM file f WHERE f.owner = ?1)
+   OR knowledgeBase IN (SELECT kb.id FROM knowledge_base kb WHERE kb.owner = ?1)
+`
+
+func (q *Queries) DeleteUserKnowledgeBaseFiles(ctx context.Context, user string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserKnowledgeBaseFiles, user)
+	return err
+}
+
+const deleteUserKnowledgeBases = `-- name: DeleteUserKnowledgeBases :exec
+DELETE FROM knowledge_base
+WHERE owner = ?
+`
+
+func (q *Queries) DeleteUserKnowledgeBases(ctx context.Context, owner sql.NullString) error {
+	_, err := q.db.ExecContext(ctx, deleteUserKnowledgeBases, owner)
+	return err
+}
+
+const deleteUserSessions = `-- name: DeleteUserSessions :exec
+DELETE FROM session
+WHERE user = ?
+`
+
+func (q *Queries) DeleteUserSessions(ctx context.Context, user string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserSessions, user)
+	return err
+}
+
+const detachConversationKnowledgeBases = `-- name: DetachConversationKnowledgeBases :exec
+DELETE FROM conversation_knowledge_base
+WHERE conversation = ? AND user = ?
+`
+
+type DetachConversationKnowledgeBasesParams struct {
+	Conversation string
+	User         string
+}
+
+func (q *Queries) DetachConversationKnowledgeBases(ctx context.Context, arg DetachConversationKnowledgeBasesParams) error {
+	_, err := q.db.ExecContext(ctx, detachConversationKnowledgeBases, arg.Conversation, arg.User)
+	return err
+}
+
+const detachKnowledgeBase = `-- name: DetachKnowledgeBase :execrows
+DELETE FROM conversation_knowledge_base
+WHERE conversation = ? AND knowledgeBase = ? AND user = ?
+`
+
+type DetachKnowledgeBaseParams struct {
+	Conversation  string
+	Knowledgebase string
+	User          string
+}
+
+func (q *Queries) DetachKnowledgeBase(ctx context.Context, arg DetachKnowledgeBaseParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, detachKnowledgeBase, arg.Conversation, arg.Knowledgebase, arg.User)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const disableUser = `-- name: DisableUser :execrows
+UPDATE user
+SET disabledAt = ?1,
+    updatedAt = datetime('now')
+WHERE id = ?2
+`
+
+type DisableUserParams struct {
+	Disabledat sql.NullString
+	ID         string
+}
+
+func (q *Queries) DisableUser(ctx context.Context, arg DisableUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, disableUser, arg.Disabledat, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const enableUser = `-- name: EnableUser :execrows
+UPDATE user
+SET disabledAt = NULL,
+    updatedAt = datetime('now')
+WHERE id = ?1
+`
+
+func (q *Queries) EnableUser(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, enableUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const endImpersonation = `-- name: EndImpersonation :execrows
+UPDATE impersonation
+SET endedAt = ?1
+WHERE id = ?2
+  AND endedAt IS NULL
+`
+
+type EndImpersonationParams struct {
+	Endedat sql.NullString
+	ID      string
+}
+
+func (q *Queries) EndImpersonation(ctx context.Context, arg EndImpersonationParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, endImpersonation, arg.Endedat, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getAccount = `-- name: GetAccount :one
+SELECT
+    a.id, a.name, a.createdat, a.updatedat,
+    IFNULL(GROUP_CONCAT(ad.domain), '') AS domains
+FROM
+    account a
+        LEFT JOIN
+    account_domain ad
+    ON
+        ad.account = a.id
+WHERE
+    a.id = ?
+GROUP BY
+    a.id
+`
+
+type GetAccountRow struct {
+	ID        string
+	Name      string
+	Createdat string
+	Updatedat string
+	Domains   interface{}
+}
+
+func (q *Queries) GetAccount(ctx context.Context, id string) (GetAccountRow, error) {
+	row := q.db.QueryRowContext(ctx, getAccount, id)
+	var i GetAccountRow
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Createdat,
+		&i.Updatedat,
+		&i.Domains,
+	)
 	return i, err
 }
 
-const getAccountById = `-- name: GetAccountById :one
-SELECT id, name, createdat, updatedat FROM account
-WHERE id = ? LIMIT 1
+const getAccountByDomain = `-- name: GetAccountByDomain :one
+SELECT
+    a.id,
+    a.name,
+    ad.domain
+FROM
+    account a
+        JOIN
+    account_domain ad ON a.id = ad.account
+WHERE
+    ad.domain = ?
+`
+
+type GetAccountByDomainRow struct {
+	ID     string
+	Name   string
+	Domain string
+}
+
+func (q *Queries) GetAccountByDomain(ctx context.Context, domain string) (GetAccountByDomainRow, error) {
+	row := q.db.QueryRowContext(ctx, getAccountByDomain, domain)
+	var i GetAccountByDomainRow
+	err := row.Scan(&i.ID, &i.Name, &i.Domain)
+	return i, err
+}
+
+const getAccountById = `-- name: GetAccountById :one
+SELECT id, name, createdat, updatedat FROM account
+WHERE id = ? LIMIT 1
+`
+
+func (q *Queries) GetAccountById(ctx context.Context, id string) (Account, error) {
+	row := q.db.QueryRowContext(ctx, getAccountById, id)
+	var i Account
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Createdat,
+		&i.Updatedat,
+	)
+	return i, err
+}
+
+const getApiKeyByHash = `-- name: GetApiKeyByHash :one
+SELECT id, user, name, prefix, hash, scopes, expiresat, lastusedat, revokedat, createdat FROM api_key
+WHERE hash = ? LIMIT 1
+`
+
+func (q *Queries) GetApiKeyByHash(ctx context.Context, hash string) (ApiKey, error) {
+	row := q.db.QueryRowContext(ctx, getApiKeyByHash, hash)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.User,
+		&i.Name,
+		&i.Prefix,
+		&i.Hash,
+		&i.Scopes,
+		&i.Expiresat,
+		&i.Lastusedat,
+		&i.Revokedat,
+		&i.Createdat,
+	)
+	return i, err
+}
+
+const getConversation = `-- name: GetConversation :one
+SELECT id, owner, createdat FROM conversation
+WHERE id = ? LIMIT 1
+`
+
+func (q *Queries) GetConversation(ctx context.Context, id string) (Conversation, error) {
+	row := q.db.QueryRowContext(ctx, getConversation, id)
+	var i Conversation
+	err := row.Scan(&i.ID, &i.Owner, &i.Createdat)
+	return i, err
+}
+
+const getDomainClaim = `-- name: GetDomainClaim :one
+SELECT account, domain, token, createdat FROM domain_claim
+WHERE account = ?1
+  AND domain = ?2
+`
+
+type GetDomainClaimParams struct {
+	Account string
+	Domain  string
+}
+
+func (q *Queries) GetDomainClaim(ctx context.Context, arg GetDomainClaimParams) (DomainClaim, error) {
+	row := q.db.QueryRowContext(ctx, getDomainClaim, arg.Account, arg.Domain)
+	var i DomainClaim
+	err := row.Scan(
+		&i.Account,
+		&i.Domain,
+		&i.Token,
+		&i.Createdat,
+	)
+	return i, err
+}
+
+const getEvent = `-- name: GetEvent :one
+SELECT id, event, timestamp, metadata, user FROM event
+WHERE id = ? LIMIT 1
+`
+
+func (q *Queries) GetEvent(ctx context.Context, id int64) (Event, error) {
+	row := q.db.QueryRowContext(ctx, getEvent, id)
+	var i Event
+	err := row.Scan(
+		&i.ID,
+		&i.Event,
+		&i.Timestamp,
+		&i.Metadata,
+		&i.User,
+	)
+	return i, err
+}
+
+const getExtraction = `-- name: GetExtraction :one
+SELECT id, owner, name, fields, createdat FROM extraction
+WHERE id = ? LIMIT 1
+`
+
+func (q *Queries) GetExtraction(ctx context.Context, id string) (Extraction, error) {
+	row := q.db.QueryRowContext(ctx, getExtraction, id)
+	var i Extraction
+	err := row.Scan(
+		&i.ID,
+		&i.Owner,
+		&i.Name,
+		&i.Fields,
+		&i.Createdat,
+	)
+	return i, err
+}
+
+const getFile = `-- name: GetFile :one
+SELECT id, name, createdat, updatedat, owner, hash, size, mimetype, conversation, embeddingmodel, chunkerversion FROM file
+WHERE id = ? LIMIT 1
+`
+
+func (q *Queries) GetFile(ctx context.Context, id string) (File, error) {
+	row := q.db.QueryRowContext(ctx, getFile, id)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Createdat,
+		&i.Updatedat,
+		&i.Owner,
+		&i.Hash,
+		&i.Size,
+		&i.Mimetype,
+		&i.Conversation,
+		&i.Embeddingmodel,
+		&i.Chunkerversion,
+	)
+	return i, err
+}
+
+const getFileSummary = `-- name: GetFileSummary :one
+SELECT file, version, summary, createdat FROM file_summary
+WHERE file = ? AND version = ? LIMIT 1
+`
+
+type GetFileSummaryParams struct {
+	File    string
+	Version string
+}
+
+func (q *Queries) GetFileSummary(ctx context.Context, arg GetFileSummaryParams) (FileSummary, error) {
+	row := q.db.QueryRowContext(ctx, getFileSummary, arg.File, arg.Version)
+	var i FileSummary
+	err := row.Scan(
+		&i.File,
+		&i.Version,
+		&i.Summary,
+		&i.Createdat,
+	)
+	return i, err
+}
+
+const getImpersonation = `-- name: GetImpersonation :one
+SELECT id, actor, user, session, reason, expiresat, endedat, createdat FROM impersonation
+WHERE id = ? LIMIT 1
+`
+
+func (q *Queries) GetImpersonation(ctx context.Context, id string) (Impersonation, error) {
+	row := q.db.QueryRowContext(ctx, getImpersonation, id)
+	var i Impersonation
+	err := row.Scan(
+		&i.ID,
+		&i.Actor,
+		&i.User,
+		&i.Session,
+		&i.Reason,
+		&i.Expiresat,
+		&i.Endedat,
+		&i.Createdat,
+	)
+	return i, err
+}
+
+const getKnowledgeBase = `-- name: GetKnowledgeBase :one
+SELECT id, name, description, account, owner, createdat, updatedat FROM knowledge_base
+WHERE id = ? LIMIT 1
+`
+
+func (q *Queries) GetKnowledgeBase(ctx context.Context, id string) (KnowledgeBase, error) {
+	row := q.db.QueryRowContext(ctx, getKnowledgeBase, id)
+	var i KnowledgeBase
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.Account,
+		&i.Owner,
+		&i.Createdat,
+		&i.Updatedat,
+	)
+	return i, err
+}
+
+const getOidcProvider = `-- name: GetOidcProvider :one
+SELECT id, account, name, issuer, clientid, clientsecret, scopes, createdat, updatedat FROM oidc_provider
+WHERE id = ? LIMIT 1
+`
+
+// OIDC PROVIDERS
+func (q *Queries) GetOidcProvider(ctx context.Context, id string) (OidcProvider, error) {
+	row := q.db.QueryRowContext(ctx, getOidcProvider, id)
+	var i OidcProvider
+	err := row.Scan(
+		&i.ID,
+		&i.Account,
+		&i.Name,
+		&i.Issuer,
+		&i.Clientid,
+		&i.Clientsecret,
+		&i.Scopes,
+		&i.Createdat,
+		&i.Updatedat,
+	)
+	return i, err
+}
+
+const getSession = `-- name: GetSession :one
+SELECT id, user, refreshhash, previousrefreshhash, rotatedat, useragent, ip, expiresat, revokedat, createdat, updatedat FROM session
+WHERE id = ? LIMIT 1
+`
+
+func (q *Queries) GetSession(ctx context.Context, id string) (Session, error) {
+	row := q.db.QueryRowContext(ctx, getSession, id)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.User,
+		&i.Refreshhash,
+		&i.Previousrefreshhash,
+		&i.Rotatedat,
+		&i.Useragent,
+		&i.Ip,
+		&i.Expiresat,
+		&i.Revokedat,
+		&i.Createdat,
+		&i.Updatedat,
+	)
+	return i, err
+}
+
+const getUser = `-- name: GetUser :one
+SELECT
+    u.id, u.name, u.email, u.account, u.externalid, u.createdat, u.updatedat, u.role, u.disabledat,
+    a.id AS account_id,
+    a.name AS account_name
+FROM user u
+         LEFT JOIN account a ON u.account = a.id
+WHERE u.id = ?
+LIMIT 1
+`
+
+type GetUserRow struct {
+	ID          string
+	Name        sql.NullString
+	Email       string
+	Account     string
+	Externalid  sql.NullString
+	Createdat   string
+	Updatedat   string
+	Role        string
+	Disabledat  sql.NullString
+	AccountID   sql.NullString
+	AccountName sql.NullString
+}
+
+// Users
+func (q *Queries) GetUser(ctx context.Context, id string) (GetUserRow, error) {
+	row := q.db.QueryRowContext(ctx, getUser, id)
+	var i GetUserRow
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Email,
+		&i.Account,
+		&i.Externalid,
+		&i.Createdat,
+		&i.Updatedat,
+		&i.Role,
+		&i.Disabledat,
+		&i.AccountID,
+		&i.AccountName,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT id, name, email, account, externalid, createdat, updatedat, role, disabledat FROM user
+WHERE email = ? LIMIT 1
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Email,
+		&i.Account,
+		&i.Externalid,
+		&i.Createdat,
+		&i.Updatedat,
+		&i.Role,
+		&i.Disabledat,
+	)
+	return i, err
+}
+
+const getUserByExternalID = `-- name: GetUserByExternalID :one
+SELECT id, name, email, account, externalid, createdat, updatedat, role, disabledat FROM user
+WHERE externalId = ? LIMIT 1
+`
+
+func (q *Queries) GetUserByExternalID(ctx context.Context, externalid sql.NullString) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByExternalID, externalid)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Email,
+		&i.Account,
+		&i.Externalid,
+		&i.Createdat,
+		&i.Updatedat,
+		&i.Role,
+		&i.Disabledat,
+	)
+	return i, err
+}
+
+const listAccount = `-- name: ListAccount :many
+SELECT id, name, createdat, updatedat FROM account
+`
+
+func (q *Queries) ListAccount(ctx context.Context) ([]Account, error) {
+	rows, err := q.db.QueryContext(ctx, listAccount)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Account
+	for rows.Next() {
+		var i Account
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Createdat,
+			&i.Updatedat,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAccountDomains = `-- name: ListAccountDomains :many
+SELECT account, domain FROM account_domain
+WHERE account = ?
+ORDER BY domain
+`
+
+func (q *Queries) ListAccountDomains(ctx context.Context, account string) ([]AccountDomain, error) {
+	rows, err := q.db.QueryContext(ctx, listAccountDomains, account)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AccountDomain
+	for rows.Next() {
+		var i AccountDomain
+		if err := rows.Scan(&i.Account, &i.Domain); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAccountsPage = `-- name: ListAccountsPage :many
+SELECT id, name, createdat, updatedat FROM account
+WHERE name LIKE ?1 OR id LIKE ?1
+ORDER BY name
+LIMIT ?3 OFFSET ?2
+`
+
+type ListAccountsPageParams struct {
+	Search string
+	Offset int64
+	Limit  int64
+}
+
+func (q *Queries) ListAccountsPage(ctx context.Context, arg ListAccountsPageParams) ([]Account, error) {
+	rows, err := q.db.QueryContext(ctx, listAccountsPage, arg.Search, arg.Offset, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Account
+	for rows.Next() {
+		var i Account
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Createdat,
+			&i.Updatedat,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAllFileTags = `-- name: ListAllFileTags :many
+SELECT file, tag, createdat FROM file_tag
+ORDER BY file, tag
+`
+
+func (q *Queries) ListAllFileTags(ctx context.Context) ([]FileTag, error) {
+	rows, err := q.db.QueryContext(ctx, listAllFileTags)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FileTag
+	for rows.Next() {
+		var i FileTag
+		if err := rows.Scan(&i.File, &i.Tag, &i.Createdat); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listApiKeysByUser = `-- name: ListApiKeysByUser :many
+SELECT id, user, name, prefix, hash, scopes, expiresat, lastusedat, revokedat, createdat FROM api_key
+WHERE user = ?
+ORDER BY createdAt DESC
+`
+
+func (q *Queries) ListApiKeysByUser(ctx context.Context, user string) ([]ApiKey, error) {
+	rows, err := q.db.QueryContext(ctx, listApiKeysByUser, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ApiKey
+	for rows.Next() {
+		var i ApiKey
+		if err := rows.Scan(
+			&i.ID,
+			&i.User,
+			&i.Name,
+			&i.Prefix,
+			&i.Hash,
+			&i.Scopes,
+			&i.Expiresat,
+			&i.Lastusedat,
+			&i.Revokedat,
+			&i.Createdat,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConversationFiles = `-- name: ListConversationFiles :many
+SELECT id, name, createdat, updatedat, owner, hash, size, mimetype, conversation, embeddingmodel, chunkerversion FROM file
+WHERE owner = ? AND conversation = ?
+ORDER BY createdAt, id
+`
+
+type ListConversationFilesParams struct {
+	Owner        string
+	Conversation string
+}
+
+func (q *Queries) ListConversationFiles(ctx context.Context, arg ListConversationFilesParams) ([]File, error) {
+	rows, err := q.db.QueryContext(ctx, listConversationFiles, arg.Owner, arg.Conversation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []File
+	for rows.Next() {
+		var i File
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Createdat,
+			&i.Updatedat,
+			&i.Owner,
+			&i.Hash,
+			&i.Size,
+			&i.Mimetype,
+			&i.Conversation,
+			&i.Embeddingmodel,
+			&i.Chunkerversion,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConversationIDs = `-- name: ListConversationIDs :many
+SELECT id FROM conversation
+ORDER BY id
+`
+
+func (q *Queries) ListConversationIDs(ctx context.Context) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listConversationIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConversationKnowledgeBases = `-- name: ListConversationKnowledgeBases :many
+SELECT kb.id, kb.name, kb.description, kb.account, kb.owner, kb.createdat, kb.updatedat FROM knowledge_base kb
+JOIN conversation_knowledge_base ckb ON ckb.knowledgeBase = kb.id
+WHERE ckb.conversation = ?1 AND ckb.user = ?2
+ORDER BY kb.name, kb.id
+`
+
+type ListConversationKnowledgeBasesParams struct {
+	Conversation string
+	User         string
+}
+
+func (q *Queries) ListConversationKnowledgeBases(ctx context.Context, arg ListConversationKnowledgeBasesParams) ([]KnowledgeBase, error) {
+	rows, err := q.db.QueryContext(ctx, listConversationKnowledgeBases, arg.Conversation, arg.User)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []KnowledgeBase
+	for rows.Next() {
+		var i KnowledgeBase
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.Account,
+			&i.Owner,
+			&i.Createdat,
+			&i.Updatedat,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDomainClaims = `-- name: ListDomainClaims :many
+SELECT account, domain, token, createdat FROM domain_claim
+WHERE account = ?1
+ORDER BY domain
+`
+
+func (q *Queries) ListDomainClaims(ctx context.Context, account string) ([]DomainClaim, error) {
+	rows, err := q.db.QueryContext(ctx, listDomainClaims, account)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DomainClaim
+	for rows.Next() {
+		var i DomainClaim
+		if err := rows.Scan(
+			&i.Account,
+			&i.Domain,
+			&i.Token,
+			&i.Createdat,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listEvents = `-- name: ListEvents :many
+SELECT id, event, timestamp, metadata, user FROM event
+WHERE (user = ?1 OR ?1 = '')
+  AND (event = ?2 OR ?2 = '')
+  AND timestamp >= ?3
+ORDER BY id DESC
+LIMIT ?4
+`
+
+type ListEventsParams struct {
+	User  string
+	Event string
+	Since string
+	Limit int64
+}
+
+func (q *Queries) ListEvents(ctx context.Context, arg ListEventsParams) ([]Event, error) {
+	rows, err := q.db.QueryContext(ctx, listEvents,
+		arg.User,
+		arg.Event,
+		arg.Since,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Event
+	for rows.Next() {
+		var i Event
+		if err := rows.Scan(
+			&i.ID,
+			&i.Event,
+			&i.Timestamp,
+			&i.Metadata,
+			&i.User,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listExtractionResults = `-- name: ListExtractionResults :many
+SELECT r.extraction, r.file, r.status, r.data, r.error, r.createdat, r.updatedat, f.name AS fileName FROM extraction_result r
+JOIN file f ON f.id = r.file
+WHERE r.extraction = ?
+ORDER BY r.createdAt, f.name, r.file
+`
+
+type ListExtractionResultsRow struct {
+	Extraction string
+	File       string
+	Status     string
+	Data       string
+	Error      string
+	Createdat  string
+	Updatedat  string
+	Filename   string
+}
+
+func (q *Queries) ListExtractionResults(ctx context.Context, extraction string) ([]ListExtractionResultsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listExtractionResults, extraction)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListExtractionResultsRow
+	for rows.Next() {
+		var i ListExtractionResultsRow
+		if err := rows.Scan(
+			&i.Extraction,
+			&i.File,
+			&i.Status,
+			&i.Data,
+			&i.Error,
+			&i.Createdat,
+			&i.Updatedat,
+			&i.Filename,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listExtractions = `-- name: ListExtractions :many
+SELECT id, owner, name, fields, createdat FROM extraction
+WHERE owner = ?
+ORDER BY createdAt DESC, id
 `
 
-func (q *Queries) GetAccountById(ctx context.Context, id string) (Account, error) {
-	row := q.db.QueryRowContext(ctx, getAccountById, id)
-	var i Account
-	err := row.Scan(
-		&i.ID,
-		&i.Name,
-		&i.Createdat,
-		&i.Updatedat,
-	)
-	return i, err
+func (q *Queries) ListExtractions(ctx context.Context, owner string) ([]Extraction, error) {
+	rows, err := q.db.QueryContext(ctx, listExtractions, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Extraction
+	for rows.Next() {
+		var i Extraction
+		if err := rows.Scan(
+			&i.ID,
+			&i.Owner,
+			&i.Name,
+			&i.Fields,
+			&i.Createdat,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const getEvent = `-- name: GetEvent :one
-SELECT id, event, timestamp, metadata, user FROM event
-WHERE id = ? LIMIT 1
+const listFileAccounts = `-- name: ListFileAccounts :many
+SELECT f.id, u.account FROM file f
+JOIN user u ON u.id = f.owner
+ORDER BY f.id
 `
 
-func (q *Queries) GetEvent(ctx context.Context, id int64) (Event, error) {
-	row := q.db.QueryRowContext(ctx, getEvent, id)
-	var i Event
-	err := row.Scan(
-		&i.ID,
-		&i.Event,
-		&i.Timestamp,
-		&i.Metadata,
-		&i.User,
-	)
-	return i, err
+type ListFileAccountsRow struct {
+	ID      string
+	Account string
 }
 
-const getFile = `-- name: GetFile :many
-SELECT id, name, createdat, updatedat, owner FROM file
-WHERE id = ? LIMIT 1
+func (q *Queries) ListFileAccounts(ctx context.Context) ([]ListFileAccountsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listFileAccounts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListFileAccountsRow
+	for rows.Next() {
+		var i ListFileAccountsRow
+		if err := rows.Scan(&i.ID, &i.Account); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFileTags = `-- name: ListFileTags :many
+SELECT tag FROM file_tag
+WHERE file = ?
+ORDER BY tag
+`
+
+func (q *Queries) ListFileTags(ctx context.Context, file string) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listFileTags, file)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		items = append(items, tag)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFiles = `-- name: ListFiles :many
+SELECT id, name, createdat, updatedat, owner, hash, size, mimetype, conversation, embeddingmodel, chunkerversion FROM file
+ORDER BY createdAt, id
 `
 
-func (q *Queries) GetFile(ctx context.Context, id string) ([]File, error) {
-	rows, err := q.db.QueryContext(ctx, getFile, id)
+func (q *Queries) ListFiles(ctx context.Context) ([]File, error) {
+	rows, err := q.db.QueryContext(ctx, listFiles)
 	if err != nil {
 		return nil, err
 	}
@@ -302,6 +1992,12 @@ func (q *Queries) GetFile(ctx context.Context, id string) ([]File, error) {
 			&i.Createdat,
 			&i.Updatedat,
 			&i.Owner,
+			&i.Hash,
+			&i.Size,
+			&i.Mimetype,
+			&i.Conversation,
+			&i.Embeddingmodel,
+			&i.Chunkerversion,
 		); err != nil {
 			return nil, err
 		}
@@ -316,105 +2012,222 @@ func (q *Queries) GetFile(ctx context.Context, id string) ([]File, error) {
 	return items, nil
 }
 
-const getUser = `-- name: GetUser :one
-SELECT
-    u.id, u.name, u.email, u.account, u.externalid, u.createdat, u.updatedat,
-    a.id AS account_id,
-    a.name AS account_name
-FROM user u
-         LEFT JOIN account a ON u.account = a.id
-WHERE u.id = ?
-LIMIT 1
+const listKnowledgeBaseFiles = `-- name: ListKnowledgeBaseFiles :many
+SELECT f.id, f.name, f.createdat, f.updatedat, f.owner, f.hash, f.size, f.mimetype, f.conversation, f.embeddingmodel, f.chunkerversion FROM file f
+JOIN knowledge_base_file kbf ON kbf.file = f.id
+WHERE kbf.knowledgeBase = ?
+ORDER BY f.name, f.id
 `
 
-type GetUserRow struct {
-	ID          string
-	Name        sql.NullString
-	Email       string
-	Account     string
-	Externalid  sql.NullString
-	Createdat   string
-	Updatedat   string
-	AccountID   sql.NullString
-	AccountName sql.NullString
+func (q *Queries) ListKnowledgeBaseFiles(ctx context.Context, knowledgebase string) ([]File, error) {
+	rows, err := q.db.QueryContext(ctx, listKnowledgeBaseFiles, knowledgebase)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []File
+	for rows.Next() {
+		var i File
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Createdat,
+			&i.Updatedat,
+			&i.Owner,
+			&i.Hash,
+			&i.Size,
+			&i.Mimetype,
+			&i.Conversation,
+			&i.Embeddingmodel,
+			&i.Chunkerversion,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-// Users
-func (q *Queries) GetUser(ctx context.Context, id string) (GetUserRow, error) {
-	row := q.db.QueryRowContext(ctx, getUser, id)
-	var i GetUserRow
-	err := row.Scan(
-		&i.ID,
-		&i.Name,
-		&i.Email,
-		&i.Account,
-		&i.Externalid,
-		&i.Createdat,
-		&i.Updatedat,
-		&i.AccountID,
-		&i.AccountName,
-	)
-	return i, err
+const listKnowledgeBaseMemberships = `-- name: ListKnowledgeBaseMemberships :many
+SELECT knowledgebase, file, createdat FROM knowledge_base_file
+ORDER BY knowledgeBase, file
+`
+
+func (q *Queries) ListKnowledgeBaseMemberships(ctx context.Context) ([]KnowledgeBaseFile, error) {
+	rows, err := q.db.QueryContext(ctx, listKnowledgeBaseMemberships)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []KnowledgeBaseFile
+	for rows.Next() {
+		var i KnowledgeBaseFile
+		if err := rows.Scan(&i.Knowledgebase, &i.File, &i.Createdat); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, name, email, account, externalid, createdat, updatedat FROM user
-WHERE email = ? LIMIT 1
+const listKnowledgeBases = `-- name: ListKnowledgeBases :many
+SELECT id, name, description, account, owner, createdat, updatedat FROM knowledge_base
+WHERE account = ?1 OR owner = ?2
+ORDER BY name, id
 `
 
-func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
-	var i User
-	err := row.Scan(
-		&i.ID,
-		&i.Name,
-		&i.Email,
-		&i.Account,
-		&i.Externalid,
-		&i.Createdat,
-		&i.Updatedat,
-	)
-	return i, err
+type ListKnowledgeBasesParams struct {
+	Account sql.NullString
+	User    sql.NullString
+}
+
+// The account's knowledge bases and the user's own
+func (q *Queries) ListKnowledgeBases(ctx context.Context, arg ListKnowledgeBasesParams) ([]KnowledgeBase, error) {
+	rows, err := q.db.QueryContext(ctx, listKnowledgeBases, arg.Account, arg.User)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []KnowledgeBase
+	for rows.Next() {
+		var i KnowledgeBase
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.Account,
+			&i.Owner,
+			&i.Createdat,
+			&i.Updatedat,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOidcProvidersByAccount = `-- name: ListOidcProvidersByAccount :many
+SELECT id, account, name, issuer, clientid, clientsecret, scopes, createdat, updatedat FROM oidc_provider
+WHERE account = ?
+ORDER BY name
+`
+
+func (q *Queries) ListOidcProvidersByAccount(ctx context.Context, account sql.NullString) ([]OidcProvider, error) {
+	rows, err := q.db.QueryContext(ctx, listOidcProvidersByAccount, account)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []OidcProvider
+	for rows.Next() {
+		var i OidcProvider
+		if err := rows.Scan(
+			&i.ID,
+			&i.Account,
+			&i.Name,
+			&i.Issuer,
+			&i.Clientid,
+			&i.Clientsecret,
+			&i.Scopes,
+			&i.Createdat,
+			&i.Updatedat,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const getUserByExternalID = `-- name: GetUserByExternalID :one
-SELECT id, name, email, account, externalid, createdat, updatedat FROM user
-WHERE externalId = ? LIMIT 1
+const listUser = `-- name: ListUser :many
+SELECT id, name, email, account, externalid, createdat, updatedat, role, disabledat FROM user
 `
 
-func (q *Queries) GetUserByExternalID(ctx context.Context, externalid sql.NullString) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUserByExternalID, externalid)
-	var i User
-	err := row.Scan(
-		&i.ID,
-		&i.Name,
-		&i.Email,
-		&i.Account,
-		&i.Externalid,
-		&i.Createdat,
-		&i.Updatedat,
-	)
-	return i, err
+func (q *Queries) ListUser(ctx context.Context) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUser)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Email,
+			&i.Account,
+			&i.Externalid,
+			&i.Createdat,
+			&i.Updatedat,
+			&i.Role,
+			&i.Disabledat,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const listAccount = `-- name: ListAccount :many
-SELECT id, name, createdat, updatedat FROM account
+const listUserFiles = `-- name: ListUserFiles :many
+SELECT id, name, createdat, updatedat, owner, hash, size, mimetype, conversation, embeddingmodel, chunkerversion FROM file
+WHERE owner = ?
+ORDER BY createdAt, id
 `
 
-func (q *Queries) ListAccount(ctx context.Context) ([]Account, error) {
-	rows, err := q.db.QueryContext(ctx, listAccount)
+func (q *Queries) ListUserFiles(ctx context.Context, owner string) ([]File, error) {
+	rows, err := q.db.QueryContext(ctx, listUserFiles, owner)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Account
+	var items []File
 	for rows.Next() {
-		var i Account
+		var i File
 		if err := rows.Scan(
 			&i.ID,
 			&i.Name,
 			&i.Createdat,
 			&i.Updatedat,
+			&i.Owner,
+			&i.Hash,
+			&i.Size,
+			&i.Mimetype,
+			&i.Conversation,
+			&i.Embeddingmodel,
+			&i.Chunkerversion,
 		); err != nil {
 			return nil, err
 		}
@@ -429,12 +2242,67 @@ func (q *Queries) ListAccount(ctx context.Context) ([]Account, error) {
 	return items, nil
 }
 
-const listUser = `-- name: ListUser :many
-SELECT id, name, email, account, externalid, createdat, updatedat FROM user
+const listUsersByAccount = `-- name: ListUsersByAccount :many
+SELECT id, name, email, account, externalid, createdat, updatedat, role, disabledat FROM user
+WHERE account = ?
+ORDER BY email
 `
 
-func (q *Queries) ListUser(ctx context.Context) ([]User, error) {
-	rows, err := q.db.QueryContext(ctx, listUser)
+func (q *Queries) ListUsersByAccount(ctx context.Context, account string) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsersByAccount, account)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Email,
+			&i.Account,
+			&i.Externalid,
+			&i.Createdat,
+			&i.Updatedat,
+			&i.Role,
+			&i.Disabledat,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsersPage = `-- name: ListUsersPage :many
+SELECT id, name, email, account, externalid, createdat, updatedat, role, disabledat FROM user
+WHERE (account = ?1 OR ?1 = '')
+  AND (email LIKE ?2 OR IFNULL(name, '') LIKE ?2)
+ORDER BY email
+LIMIT ?4 OFFSET ?3
+`
+
+type ListUsersPageParams struct {
+	Account string
+	Search  string
+	Offset  int64
+	Limit   int64
+}
+
+func (q *Queries) ListUsersPage(ctx context.Context, arg ListUsersPageParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsersPage,
+		arg.Account,
+		arg.Search,
+		arg.Offset,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -450,6 +2318,8 @@ func (q *Queries) ListUser(ctx context.Context) ([]User, error) {
 			&i.Externalid,
 			&i.Createdat,
 			&i.Updatedat,
+			&i.Role,
+			&i.Disabledat,
 		); err != nil {
 			return nil, err
 		}
@@ -464,6 +2334,280 @@ func (q *Queries) ListUser(ctx context.Context) ([]User, error) {
 	return items, nil
 }
 
+const removeKnowledgeBaseFile = `-- name: RemoveKnowledgeBaseFile :execrows
+DELETE FROM knowledge_base_file
+WHERE knowledgeBase = ? AND file = ?
+`
+
+type RemoveKnowledgeBaseFileParams struct {
+	Knowledgebase string
+	File          string
+}
+
+func (q *Queries) RemoveKnowledgeBaseFile(ctx context.Context, arg RemoveKnowledgeBaseFileParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, removeKnowledgeBaseFile, arg.Knowledgebase, arg.File)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeApiKey = `-- name: RevokeApiKey :execrows
+UPDATE api_key
+SET revokedAt = ?1
+WHERE id = ?2
+  AND user = ?3
+  AND revokedAt IS NULL
+`
+
+type RevokeApiKeyParams struct {
+	Revokedat sql.NullString
+	ID        string
+	User      string
+}
+
+func (q *Queries) RevokeApiKey(ctx context.Context, arg RevokeApiKeyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeApiKey, arg.Revokedat, arg.ID, arg.User)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeSession = `-- name: RevokeSession :exec
+UPDATE session
+SET revokedAt = ?1,
+    updatedAt = datetime('now')
+WHERE id = ?2
+  AND revokedAt IS NULL
+`
+
+type RevokeSessionParams struct {
+	Revokedat sql.NullString
+	ID        string
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) error {
+	_, err := q.db.ExecContext(ctx, revokeSession, arg.Revokedat, arg.ID)
+	return err
+}
+
+const revokeUserApiKeys = `-- name: RevokeUserApiKeys :execrows
+UPDATE api_key
+SET revokedAt = ?1
+WHERE user = ?2
+  AND revokedAt IS NULL
+`
+
+type RevokeUserApiKeysParams struct {
+	Revokedat sql.NullString
+	User      string
+}
+
+func (q *Queries) RevokeUserApiKeys(ctx context.Context, arg RevokeUserApiKeysParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeUserApiKeys, arg.Revokedat, arg.User)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeUserSessions = `-- name: RevokeUserSessions :execrows
+UPDATE session
+SET revokedAt = ?1,
+    updatedAt = datetime('now')
+WHERE user = ?2
+  AND revokedAt IS NULL
+`
+
+type RevokeUserSessionsParams struct {
+	Revokedat sql.NullString
+	User      string
+}
+
+func (q *Queries) RevokeUserSessions(ctx context.Context, arg RevokeUserSessionsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeUserSessions, arg.Revokedat, arg.User)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rotateSession = `-- name: RotateSession :execrows
+UPDATE session
+SET refreshHash = ?1,
+    previousRefreshHash = refreshHash,
+    rotatedAt = ?2,
+    expiresAt = ?3,
+    updatedAt = datetime('now')
+WHERE id = ?4
+  AND refreshHash = ?5
+  AND revokedAt IS NULL
+`
+
+type RotateSessionParams struct {
+	Newhash     string
+	Rotatedat   sql.NullString
+	Expiresat   string
+	ID          string
+	Currenthash string
+}
+
+func (q *Queries) RotateSession(ctx context.Context, arg RotateSessionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rotateSession,
+		arg.Newhash,
+		arg.Rotatedat,
+		arg.Expiresat,
+		arg.ID,
+		arg.Currenthash,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const saveExtractionResult = `-- name: SaveExtractionResult :exec
+UPDATE extraction_result
+SET status = ?, data = ?, error = ?, updatedAt = datetime('now')
+WHERE extraction = ? AND file = ?
+`
+
+type SaveExtractionResultParams struct {
+	Status     string
+	Data       string
+	Error      string
+	Extraction string
+	File       string
+}
+
+func (q *Queries) SaveExtractionResult(ctx context.Context, arg SaveExtractionResultParams) error {
+	_, err := q.db.ExecContext(ctx, saveExtractionResult,
+		arg.Status,
+		arg.Data,
+		arg.Error,
+		arg.Extraction,
+		arg.File,
+	)
+	return err
+}
+
+const saveFileSummary = `-- name: SaveFileSummary :exec
+INSERT INTO file_summary (
+    file, version, summary
+) VALUES (
+    ?, ?, ?
+)
+ON CONFLICT (file, version) DO UPDATE
+SET summary = excluded.summary,
+    createdAt = datetime('now')
+`
+
+type SaveFileSummaryParams struct {
+	File    string
+	Version string
+	Summary string
+}
+
+func (q *Queries) SaveFileSummary(ctx context.Context, arg SaveFileSummaryParams) error {
+	_, err := q.db.ExecContext(ctx, saveFileSummary, arg.File, arg.Version, arg.Summary)
+	return err
+}
+
+const setFileIndex = `-- name: SetFileIndex :exec
+UPDATE file
+SET embeddingmodel = ?,
+    chunkerversion = ?,
+    updatedAt = datetime('now')
+WHERE id = ?
+`
+
+type SetFileIndexParams struct {
+	Embeddingmodel string
+	Chunkerversion int64
+	ID             string
+}
+
+func (q *Queries) SetFileIndex(ctx context.Context, arg SetFileIndexParams) error {
+	_, err := q.db.ExecContext(ctx, setFileIndex, arg.Embeddingmodel, arg.Chunkerversion, arg.ID)
+	return err
+}
+
+const setUserExternalID = `-- name: SetUserExternalID :exec
+UPDATE user
+SET externalId = ?1,
+    updatedAt = datetime('now')
+WHERE id = ?2
+`
+
+type SetUserExternalIDParams struct {
+	Externalid sql.NullString
+	ID         string
+}
+
+func (q *Queries) SetUserExternalID(ctx context.Context, arg SetUserExternalIDParams) error {
+	_, err := q.db.ExecContext(ctx, setUserExternalID, arg.Externalid, arg.ID)
+	return err
+}
+
+const touchApiKey = `-- name: TouchApiKey :exec
+UPDATE api_key
+SET lastUsedAt = ?1
+WHERE id = ?2
+`
+
+type TouchApiKeyParams struct {
+	Lastusedat sql.NullString
+	ID         string
+}
+
+func (q *Queries) TouchApiKey(ctx context.Context, arg TouchApiKeyParams) error {
+	_, err := q.db.ExecContext(ctx, touchApiKey, arg.Lastusedat, arg.ID)
+	return err
+}
+
+const updateAccountName = `-- name: UpdateAccountName :execrows
+UPDATE account
+SET name = ?1,
+    updatedAt = datetime('now')
+WHERE id = ?2
+`
+
+type UpdateAccountNameParams struct {
+	Name string
+	ID   string
+}
+
+func (q *Queries) UpdateAccountName(ctx context.Context, arg UpdateAccountNameParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateAccountName, arg.Name, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateKnowledgeBase = `-- name: UpdateKnowledgeBase :execrows
+UPDATE knowledge_base
+SET name = ?,
+    description = ?,
+    updatedAt = datetime('now')
+WHERE id = ?
+`
+
+type UpdateKnowledgeBaseParams struct {
+	Name        string
+	Description string
+	ID          string
+}
+
+func (q *Queries) UpdateKnowledgeBase(ctx context.Context, arg UpdateKnowledgeBaseParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateKnowledgeBase, arg.Name, arg.Description, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const updateUserAccount = `-- name: UpdateUserAccount :exec
 UPDATE user
 SET account = ?1,
@@ -480,3 +2624,79 @@ func (q *Queries) UpdateUserAccount(ctx context.Context, arg UpdateUserAccountPa
 	_, err := q.db.ExecContext(ctx, updateUserAccount, arg.Accountid, arg.Useremail)
 	return err
 }
+
+const updateUserRole = `-- name: UpdateUserRole :execrows
+UPDATE user
+SET role = ?1,
+    updatedAt = datetime('now')
+WHERE id = ?2
+`
+
+type UpdateUserRoleParams struct {
+	Role string
+	ID   string
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateUserRole, arg.Role, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const usageByAccount = `-- name: UsageByAccount :many
+SELECT
+    a.id AS account_id,
+    a.name AS account_name,
+    COUNT(*) AS messages,
+    COUNT(DISTINCT e.user) AS active_users
+FROM event e
+         JOIN user u ON e.user = u.id
+         JOIN account a ON u.account = a.id
+WHERE e.event = 'message'
+  AND e.timestamp >= ?1
+  AND e.timestamp < ?2
+GROUP BY a.id
+ORDER BY messages DESC
+`
+
+type UsageByAccountParams struct {
+	Since string
+	Until string
+}
+
+type UsageByAccountRow struct {
+	AccountID   string
+	AccountName string
+	Messages    int64
+	ActiveUsers int64
+}
+
+func (q *Queries) UsageByAccount(ctx context.Context, arg UsageByAccountParams) ([]UsageByAccountRow, error) {
+	rows, err := q.db.QueryContext(ctx, usageByAccount, arg.Since, arg.Until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UsageByAccountRow
+	for rows.Next() {
+		var i UsageByAccountRow
+		if err := rows.Scan(
+			&i.AccountID,
+			&i.AccountName,
+			&i.Messages,
+			&i.ActiveUsers,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
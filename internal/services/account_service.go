@@ -2,13 +2,61 @@ package services
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	database "gochat/internal/db"
 	"gochat/internal/schema"
+	"gochat/internal/store"
+	"gochat/pkg/utils"
+	"net"
+	"regexp"
+	"strings"
 )
 
+// Account admins can't claim these, every account would get their users
+var publicEmailDomains = map[string]bool{
+	"gmail.com":      true,
+	"googlemail.com": true,
+	"outlook.com":    true,
+	"hotmail.com":    true,
+	"live.com":       true,
+	"yahoo.com":      true,
+	"icloud.com":     true,
+	"proton.me":      true,
+	"protonmail.com": true,
+}
+
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}$`)
+
+// domainChallengePrefix is the name of the TXT record that proves a domain claim, under the domain
+const domainChallengePrefix = "_gochat-challenge."
+
+// ErrDomainNotVerified is returned when the TXT record of a domain claim can't be found (yet)
+var ErrDomainNotVerified = errors.New("the TXT record was not found, DNS changes can take a while to show up")
+
 type AccountService struct {
-	queries *schema.Queries
+	queries store.Store
+	// lookupTXT resolves the TXT records of a name, tests replace it
+	lookupTXT func(ctx context.Context, name string) ([]string, error)
+	// blobs holds the originals of the files of deleted users, nil leaves them
+	blobs store.BlobStore
+	// removeVectors drops the vectors of the files of deleted users, nil leaves them
+	removeVectors VectorCleanup
+}
+
+// DomainClaim is a domain waiting for its owner to prove it, by adding Value as a TXT record on Record
+type DomainClaim struct {
+	Domain string `json:"domain"`
+	Record string `json:"record"`
+	Value  string `json:"value"`
+}
+
+func toDomainClaim(claim schema.DomainClaim) DomainClaim {
+	return DomainClaim{
+		Domain: claim.Domain,
+		Record: domainChallengePrefix + claim.Domain,
+		Value:  "gochat-domain-verification=" + claim.Token,
+	}
 }
 
 type AddDomainParams struct {
@@ -16,13 +64,26 @@ type AddDomainParams struct {
 	accountID string
 }
 
-func NewAccountService() *AccountService {
-	queries, _, err := database.Init()
-	if err != nil {
-		fmt.Println("Error initializing queries for account service: " + err.Error())
-		return nil
-	}
-	return &AccountService{queries: queries}
+func NewAccountService(s store.Store) *AccountService {
+	return &AccountService{queries: s, lookupTXT: net.DefaultResolver.LookupTXT}
+}
+
+// WithBlobs lets Delete remove the originals of the users' files
+func (as *AccountService) WithBlobs(blobs store.BlobStore) *AccountService {
+	as.blobs = blobs
+	return as
+}
+
+// WithVectorCleanup lets Delete remove the vectors of the users' files
+func (as *AccountService) WithVectorCleanup(cleanup VectorCleanup) *AccountService {
+	as.removeVectors = cleanup
+	return as
+}
+
+// WithTXTLookup replaces the DNS lookup of domain claims
+func (as *AccountService) WithTXTLookup(lookup func(ctx context.Context, name string) ([]string, error)) *AccountService {
+	as.lookupTXT = lookup
+	return as
 }
 
 func (as *AccountService) Get(ctx context.Context, id string) (*schema.GetAccountRow, error) {
@@ -64,3 +125,213 @@ func (as *AccountService) UpdateUserAccount(c context.Context, params schema.Upd
 	}
 	return nil
 }
+
+func (as *AccountService) ListDomains(ctx context.Context, accountID string) ([]string, error) {
+	domains, err := as.queries.ListAccountDomains(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domains: %w", err)
+	}
+	result := make([]string, 0, len(domains))
+	for _, d := range domains {
+		result = append(result, d.Domain)
+	}
+	return result, nil
+}
+
+// ClaimDomain starts a claim on a domain for an account admin. Every signup and login from a domain
+// lands in its account, so the domain is only added once VerifyDomain finds the TXT record of the
+// claim. Domains already in use or shared by many organisations are refused.
+func (as *AccountService) ClaimDomain(ctx context.Context, accountID string, domain string) (*DomainClaim, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if !domainPattern.MatchString(domain) {
+		return nil, fmt.Errorf("invalid domain: %s", domain)
+	}
+	if publicEmailDomains[domain] {
+		return nil, fmt.Errorf("public email domains can't be added to an account")
+	}
+	if err := as.checkDomainFree(ctx, as.queries, domain); err != nil {
+		return nil, err
+	}
+
+	token, err := generateSecret()
+	if err != nil {
+		return nil, err
+	}
+	// Claiming again keeps the token, a record that was already added stays valid
+	if err := as.queries.CreateDomainClaim(ctx, schema.CreateDomainClaimParams{Account: accountID, Domain: domain, Token: token}); err != nil {
+		return nil, fmt.Errorf("failed to create domain claim: %w", err)
+	}
+	claim, err := as.queries.GetDomainClaim(ctx, schema.GetDomainClaimParams{Account: accountID, Domain: domain})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain claim: %w", err)
+	}
+	result := toDomainClaim(claim)
+	return &result, nil
+}
+
+// VerifyDomain adds the domain of a claim to the account when its TXT record is found, the claims of
+// other accounts on it are dropped. Returns sql.ErrNoRows when the account has no claim on it.
+func (as *AccountService) VerifyDomain(ctx context.Context, accountID string, domain string) (*schema.AccountDomain, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	claim, err := as.queries.GetDomainClaim(ctx, schema.GetDomainClaimParams{Account: accountID, Domain: domain})
+	if err != nil {
+		return nil, err
+	}
+	expected := toDomainClaim(claim)
+	records, err := as.lookupTXT(ctx, expected.Record)
+	var dnsErr *net.DNSError
+	if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		return nil, fmt.Errorf("failed to look up %s: %w", expected.Record, err)
+	}
+	found := false
+	for _, record := range records {
+		found = found || strings.TrimSpace(record) == expected.Value
+	}
+	if !found {
+		return nil, ErrDomainNotVerified
+	}
+
+	var accountDomain schema.AccountDomain
+	err = as.queries.InTx(ctx, func(q schema.Querier) error {
+		if err := as.checkDomainFree(ctx, q, domain); err != nil {
+			return err
+		}
+		if err := q.DeleteDomainClaims(ctx, domain); err != nil {
+			return fmt.Errorf("failed to delete domain claims: %w", err)
+		}
+		accountDomain, err = q.CreateAccountDomain(ctx, schema.CreateAccountDomainParams{Account: accountID, Domain: domain})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &accountDomain, nil
+}
+
+// ListDomainClaims returns the claims of the account that were not verified yet
+func (as *AccountService) ListDomainClaims(ctx context.Context, accountID string) ([]DomainClaim, error) {
+	claims, err := as.queries.ListDomainClaims(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domain claims: %w", err)
+	}
+	result := make([]DomainClaim, 0, len(claims))
+	for _, claim := range claims {
+		result = append(result, toDomainClaim(claim))
+	}
+	return result, nil
+}
+
+func (as *AccountService) checkDomainFree(ctx context.Context, q schema.Querier, domain string) error {
+	_, err := q.GetAccountByDomain(ctx, domain)
+	if err == nil {
+		return fmt.Errorf("domain %s is already in use", domain)
+	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to check domain: %w", err)
+	}
+	return nil
+}
+
+// RemoveDomain removes a domain from the account, returns sql.ErrNoRows when the account doesn't have it
+func (as *AccountService) RemoveDomain(ctx context.Context, accountID string, domain string) error {
+	affected, err := as.queries.DeleteAccountDomainForAccount(ctx, schema.DeleteAccountDomainForAccountParams{
+		Account: accountID,
+		Domain:  domain,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete domain: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// List returns a page of accounts, searching on name and id
+func (as *AccountService) List(ctx context.Context, params PageParams) ([]schema.Account, int64, error) {
+	params = params.Normalized()
+	accounts, err := as.queries.ListAccountsPage(ctx, schema.ListAccountsPageParams{
+		Search: params.searchPattern(),
+		Limit:  params.limit(),
+		Offset: params.offset(),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list accounts: %w", err)
+	}
+	total, err := as.queries.CountAccounts(ctx, params.searchPattern())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count accounts: %w", err)
+	}
+	return accounts, total, nil
+}
+
+// Rename changes the account's name, returns sql.ErrNoRows when the account does not exist
+func (as *AccountService) Rename(ctx context.Context, accountID string, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	affected, err := as.queries.UpdateAccountName(ctx, schema.UpdateAccountNameParams{
+		Name: name,
+		ID:   accountID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rename account: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Delete removes the account with its domains, identity providers and users, all or nothing. The
+// vectors and originals of the users' files are removed once that succeeded.
+// Returns sql.ErrNoRows when the account does not exist.
+func (as *AccountService) Delete(ctx context.Context, accountID string) error {
+	var files []schema.File
+	err := as.queries.InTx(ctx, func(q schema.Querier) error {
+		users, err := q.ListUsersByAccount(ctx, accountID)
+		if err != nil {
+			return fmt.Errorf("failed to list users: %w", err)
+		}
+		for _, user := range users {
+			_, userFiles, err := deleteUser(ctx, q, user.ID)
+			if err != nil {
+				return err
+			}
+			files = append(files, userFiles...)
+		}
+		if err := q.DeleteAccountDomains(ctx, accountID); err != nil {
+			return fmt.Errorf("failed to delete domains: %w", err)
+		}
+		if err := q.DeleteAccountDomainClaims(ctx, accountID); err != nil {
+			return fmt.Errorf("failed to delete domain claims: %w", err)
+		}
+		if err := q.DeleteAccountOidcProviders(ctx, utils.StringToNullString(accountID)); err != nil {
+			return fmt.Errorf("failed to delete oidc providers: %w", err)
+		}
+		if err := q.DeleteAccountConversationKnowledgeBases(ctx, utils.StringToNullString(accountID)); err != nil {
+			return fmt.Errorf("failed to delete knowledge base attachments: %w", err)
+		}
+		if err := q.DeleteAccountKnowledgeBaseFiles(ctx, utils.StringToNullString(accountID)); err != nil {
+			return fmt.Errorf("failed to delete knowledge base files: %w", err)
+		}
+		if err := q.DeleteAccountKnowledgeBases(ctx, utils.StringToNullString(accountID)); err != nil {
+			return fmt.Errorf("failed to delete knowledge bases: %w", err)
+		}
+
+		affected, err := q.DeleteAccount(ctx, accountID)
+		if err != nil {
+			return fmt.Errorf("failed to delete account: %w", err)
+		}
+		if affected == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	removeDeletedFiles(ctx, as.blobs, as.removeVectors, accountID, files)
+	return nil
+}
@@ -0,0 +1,152 @@
+package services_test
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gochat/internal/schema"
+	"gochat/internal/services"
+	"gochat/internal/store"
+	"strings"
+	"testing"
+)
+
+func createTestAccount(t *testing.T, accountService *services.AccountService) *schema.Account {
+	account, err := accountService.Create(context.Background(), schema.CreateAccountParams{
+		ID:   uuid.New().String(),
+		Name: "Test " + uuid.New().String(),
+	})
+	assert.NoError(t, err)
+	return account
+}
+
+func TestAccountService_ListAndRename(t *testing.T) {
+	ctx := context.Background()
+	accountService := services.NewAccountService(testStore)
+	account := createTestAccount(t, accountService)
+
+	accounts, total, err := accountService.List(ctx, services.PageParams{Search: account.Name})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, account.ID, accounts[0].ID)
+
+	assert.NoError(t, accountService.Rename(ctx, account.ID, "Renamed "+account.ID))
+	accounts, _, err = accountService.List(ctx, services.PageParams{Search: "Renamed " + account.ID})
+	assert.NoError(t, err)
+	assert.Len(t, accounts, 1)
+
+	assert.ErrorIs(t, accountService.Rename(ctx, "idontexist", "Name"), sql.ErrNoRows)
+}
+
+func TestAccountService_DeleteCascades(t *testing.T) {
+	ctx := context.Background()
+	blobs, err := store.NewFSBlobStore(t.TempDir())
+	assert.NoError(t, err)
+	removed := map[string][]string{}
+	accountService := services.NewAccountService(testStore).WithBlobs(blobs).WithVectorCleanup(func(ctx context.Context, account string, fileIDs []string) error {
+		removed[account] = fileIDs
+		return nil
+	})
+	userService := services.NewUserService(testStore)
+	account := createTestAccount(t, accountService)
+
+	domain := strings.ReplaceAll(account.ID, "-", "") + ".com"
+	_, err = accountService.CreateAccountDomain(ctx, schema.CreateAccountDomainParams{Account: account.ID, Domain: domain})
+	assert.NoError(t, err)
+	_, err = accountService.ClaimDomain(ctx, account.ID, "pending-"+domain)
+	assert.NoError(t, err)
+
+	result, err := userService.Import(ctx, account.ID, strings.NewReader(
+		"email,name,role\n"+
+			"anna@"+domain+",Anna,account_admin\n"+
+			"bert@"+domain+",,\n"+
+			"not-an-email,Nobody,\n"+
+			"carl@"+domain+",Carl,platform_admin\n"+
+			"anna@"+domain+",Anna again,\n",
+	))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Created)
+	assert.Equal(t, 1, result.Skipped)
+	assert.Len(t, result.Errors, 2)
+
+	users, total, err := userService.List(ctx, account.ID, services.PageParams{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, services.RoleAccountAdmin, users[0].Role)
+
+	// Users with sessions and events are deleted with the account
+	_, _, err = services.NewSessionService(testStore).Create(ctx, users[0].ID, services.SessionParams{})
+	assert.NoError(t, err)
+	_, err = services.NewEventService(testStore, users[0].ID).Create(services.EventLogin, nil)
+	assert.NoError(t, err)
+	// The vectors and originals of their files go once the rows are gone
+	file, err := newFileService(t, blobs, users[0].ID).Create(ctx, services.FileUpload{Name: "a.txt", Size: -1}, strings.NewReader("a"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, accountService.Delete(ctx, account.ID))
+	_, err = blobs.Get(ctx, services.FileBlobKey(users[0].ID, file.ID))
+	assert.ErrorIs(t, err, store.ErrBlobNotFound)
+	assert.Equal(t, map[string][]string{account.ID: {file.ID}}, removed)
+
+	user, err := userService.Get(ctx, users[0].ID)
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+	domains, err := accountService.ListDomains(ctx, account.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, domains)
+	claims, err := accountService.ListDomainClaims(ctx, account.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, claims)
+
+	assert.ErrorIs(t, accountService.Delete(ctx, account.ID), sql.ErrNoRows)
+}
+
+func TestAccountService_ClaimDomain(t *testing.T) {
+	ctx := context.Background()
+	records := map[string][]string{}
+	lookup := func(ctx context.Context, name string) ([]string, error) {
+		return records[name], nil
+	}
+	accountService := services.NewAccountService(testStore).WithTXTLookup(lookup)
+	account := createTestAccount(t, accountService)
+	other := createTestAccount(t, accountService)
+	domain := strings.ReplaceAll(account.ID, "-", "") + ".nl"
+
+	_, err := accountService.ClaimDomain(ctx, account.ID, "gmail.com")
+	assert.Error(t, err)
+
+	// Claiming doesn't add the domain, anyone can claim it
+	claim, err := accountService.ClaimDomain(ctx, account.ID, " "+strings.ToUpper(domain))
+	assert.NoError(t, err)
+	assert.Equal(t, domain, claim.Domain)
+	assert.Equal(t, "_gochat-challenge."+domain, claim.Record)
+	again, err := accountService.ClaimDomain(ctx, account.ID, domain)
+	assert.NoError(t, err)
+	assert.Equal(t, claim, again)
+	otherClaim, err := accountService.ClaimDomain(ctx, other.ID, domain)
+	assert.NoError(t, err)
+	assert.NotEqual(t, claim.Value, otherClaim.Value)
+	domains, err := accountService.ListDomains(ctx, account.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, domains)
+
+	// Only the account whose token is in DNS gets it
+	_, err = accountService.VerifyDomain(ctx, account.ID, domain)
+	assert.ErrorIs(t, err, services.ErrDomainNotVerified)
+	records[claim.Record] = []string{"v=spf1 -all", claim.Value}
+	_, err = accountService.VerifyDomain(ctx, account.ID, domain)
+	assert.NoError(t, err)
+	domains, err = accountService.ListDomains(ctx, account.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{domain}, domains)
+
+	// The other claims are gone, the domain can't be claimed again
+	_, err = accountService.VerifyDomain(ctx, other.ID, domain)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = accountService.ClaimDomain(ctx, other.ID, domain)
+	assert.ErrorContains(t, err, "already in use")
+	claims, err := accountService.ListDomainClaims(ctx, account.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, claims)
+}
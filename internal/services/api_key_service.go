@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gochat/internal/schema"
+	"gochat/internal/store"
+	"gochat/pkg/utils"
+	"strings"
+	"time"
+)
+
+// APIScope limits what an API key is allowed to do
+type APIScope string
+
+const (
+	APIScopeChat  APIScope = "chat"
+	APIScopeFiles APIScope = "files"
+)
+
+// IsValid checks if the scope is known
+func (s APIScope) IsValid() bool {
+	switch s {
+	case APIScopeChat, APIScopeFiles:
+		return true
+	}
+	return false
+}
+
+const (
+	apiKeyPrefix            = "gck_"
+	apiKeyDefaultExpiryDays = 90
+	apiKeyMaxExpiryDays     = 365
+)
+
+var (
+	ErrAPIKeyInvalid = errors.New("invalid api key")
+	ErrAPIKeyExpired = errors.New("api key expired")
+	ErrAPIKeyRevoked = errors.New("api key revoked")
+)
+
+type APIKeyService struct {
+	queries store.Store
+}
+
+type APIKeyParams struct {
+	Name          string
+	Scopes        []APIScope
+	ExpiresInDays int
+}
+
+type APIKeyDto struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []APIScope `json:"scopes"`
+	ExpiresAt  string     `json:"expiresAt"`
+	LastUsedAt *string    `json:"lastUsedAt"`
+	RevokedAt  *string    `json:"revokedAt"`
+	CreatedAt  string     `json:"createdAt"`
+}
+
+func NewAPIKeyService(s store.Store) *APIKeyService {
+	return &APIKeyService{queries: s}
+}
+
+// hashSecret returns the hex encoded sha256 of a plaintext secret, which is what we store
+func hashSecret(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func parseScopes(scopes string) []APIScope {
+	result := []APIScope{}
+	for _, s := range strings.Split(scopes, ",") {
+		if s != "" {
+			result = append(result, APIScope(s))
+		}
+	}
+	return result
+}
+
+func toAPIKeyDto(key schema.ApiKey) APIKeyDto {
+	dto := APIKeyDto{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    parseScopes(key.Scopes),
+		ExpiresAt: key.Expiresat,
+		CreatedAt: key.Createdat,
+	}
+	if key.Lastusedat.Valid {
+		dto.LastUsedAt = &key.Lastusedat.String
+	}
+	if key.Revokedat.Valid {
+		dto.RevokedAt = &key.Revokedat.String
+	}
+	return dto
+}
+
+// Create generates a new key for the user. The plaintext key is only returned here, we only keep its hash
+func (s *APIKeyService) Create(ctx context.Context, userID string, params APIKeyParams) (*APIKeyDto, string, error) {
+	if params.Name == "" {
+		return nil, "", fmt.Errorf("name is required")
+	}
+	if len(params.Scopes) == 0 {
+		return nil, "", fmt.Errorf("at least one scope is required")
+	}
+	scopes := make([]string, 0, len(params.Scopes))
+	for _, scope := range params.Scopes {
+		if !scope.IsValid() {
+			return nil, "", fmt.Errorf("invalid scope: %s", scope)
+		}
+		scopes = append(scopes, string(scope))
+	}
+
+	days := params.ExpiresInDays
+	if days == 0 {
+		days = apiKeyDefaultExpiryDays
+	}
+	if days < 0 || days > apiKeyMaxExpiryDays {
+		return nil, "", fmt.Errorf("expiry must be between 1 and %d days", apiKeyMaxExpiryDays)
+	}
+
+	plaintext, err := generateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key, err := s.queries.CreateApiKey(ctx, schema.CreateApiKeyParams{
+		ID:        uuid.New().String(),
+		User:      userID,
+		Name:      params.Name,
+		Prefix:    plaintext[:len(apiKeyPrefix)+6],
+		Hash:      hashSecret(plaintext),
+		Scopes:    strings.Join(scopes, ","),
+		Expiresat: time.Now().UTC().AddDate(0, 0, days).Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	dto := toAPIKeyDto(key)
+	return &dto, plaintext, nil
+}
+
+func (s *APIKeyService) List(ctx context.Context, userID string) ([]APIKeyDto, error) {
+	keys, err := s.queries.ListApiKeysByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	result := make([]APIKeyDto, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, toAPIKeyDto(key))
+	}
+	return result, nil
+}
+
+// Revoke revokes one of the user's keys. Returns sql.ErrNoRows when there is no active key to revoke
+func (s *APIKeyService) Revoke(ctx context.Context, userID string, id string) error {
+	affected, err := s.queries.RevokeApiKey(ctx, schema.RevokeApiKeyParams{
+		Revokedat: utils.GetTime(),
+		ID:        id,
+		User:      userID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Authenticate looks up the plaintext key and checks it is still usable
+func (s *APIKeyService) Authenticate(ctx context.Context, plaintext string) (*APIKeyDto, string, error) {
+	if !strings.HasPrefix(plaintext, apiKeyPrefix) {
+		return nil, "", ErrAPIKeyInvalid
+	}
+
+	key, err := s.queries.GetApiKeyByHash(ctx, hashSecret(plaintext))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, "", ErrAPIKeyInvalid
+		}
+		return nil, "", fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	if key.Revokedat.Valid {
+		return nil, "", ErrAPIKeyRevoked
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, key.Expiresat)
+	if err != nil || time.Now().After(expiresAt) {
+		return nil, "", ErrAPIKeyExpired
+	}
+
+	if err := s.queries.TouchApiKey(ctx, schema.TouchApiKeyParams{
+		Lastusedat: utils.GetTime(),
+		ID:         key.ID,
+	}); err != nil {
+		fmt.Printf("failed to update api key last use: %s\n", err)
+	}
+
+	dto := toAPIKeyDto(key)
+	return &dto, key.User, nil
+}
+
+// HasScope checks whether the key grants the given scope
+func (k *APIKeyDto) HasScope(scope APIScope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
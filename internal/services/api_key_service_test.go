@@ -0,0 +1,51 @@
+package services_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gochat/internal/services"
+	"testing"
+)
+
+func TestAPIKeyService(t *testing.T) {
+	ctx := context.Background()
+	testUserID := "1234abcd"
+
+	// New service
+	apiKeyService := services.NewAPIKeyService(testStore)
+	assert.NotNil(t, apiKeyService)
+
+	// Create key
+	key, plaintext, err := apiKeyService.Create(ctx, testUserID, services.APIKeyParams{
+		Name:   "test key",
+		Scopes: []services.APIScope{services.APIScopeChat},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, key)
+	assert.NotEmpty(t, plaintext)
+	assert.True(t, key.HasScope(services.APIScopeChat))
+	assert.False(t, key.HasScope(services.APIScopeFiles))
+
+	// Authenticate with the plaintext key
+	authenticated, userID, err := apiKeyService.Authenticate(ctx, plaintext)
+	assert.NoError(t, err)
+	assert.Equal(t, key.ID, authenticated.ID)
+	assert.Equal(t, testUserID, userID)
+
+	// Wrong key
+	_, _, err = apiKeyService.Authenticate(ctx, plaintext+"x")
+	assert.ErrorIs(t, err, services.ErrAPIKeyInvalid)
+
+	// Revoke
+	err = apiKeyService.Revoke(ctx, testUserID, key.ID)
+	assert.NoError(t, err)
+	_, _, err = apiKeyService.Authenticate(ctx, plaintext)
+	assert.ErrorIs(t, err, services.ErrAPIKeyRevoked)
+
+	// Invalid scope
+	_, _, err = apiKeyService.Create(ctx, testUserID, services.APIKeyParams{
+		Name:   "test key",
+		Scopes: []services.APIScope{"admin"},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gochat/internal/schema"
+	"gochat/internal/store"
+)
+
+// ErrConversationNotFound is also returned for conversations of other users
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// ConversationService records who a conversation belongs to. The conversations themselves only live
+// in the browser, their id is also the Milvus partition of their uploads.
+type ConversationService struct {
+	queries store.Store
+}
+
+func NewConversationService(s store.Store) *ConversationService {
+	return &ConversationService{queries: s}
+}
+
+// Claim makes the user the owner of a conversation nobody claimed yet, it is called before anything
+// reads or writes the conversation's partition
+func (s *ConversationService) Claim(ctx context.Context, userID string, id string) error {
+	if id == "" {
+		return fmt.Errorf("conversation is required")
+	}
+	err := s.queries.ClaimConversation(ctx, schema.ClaimConversationParams{ID: id, Owner: userID})
+	if err != nil {
+		return fmt.Errorf("failed to claim conversation: %w", err)
+	}
+	conversation, err := s.queries.GetConversation(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrConversationNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get conversation: %w", err)
+	}
+	if conversation.Owner != userID {
+		return ErrConversationNotFound
+	}
+	return nil
+}
+
+// Delete forgets the conversation and the knowledge bases the user attached to it, the caller drops
+// its partition
+func (s *ConversationService) Delete(ctx context.Context, userID string, id string) error {
+	if err := s.Claim(ctx, userID, id); err != nil {
+		return err
+	}
+	return s.queries.InTx(ctx, func(q schema.Querier) error {
+		err := q.DetachConversationKnowledgeBases(ctx, schema.DetachConversationKnowledgeBasesParams{
+			Conversation: id,
+			User:         userID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to detach knowledge bases: %w", err)
+		}
+		if _, err := q.DeleteConversation(ctx, schema.DeleteConversationParams{ID: id, Owner: userID}); err != nil {
+			return fmt.Errorf("failed to delete conversation: %w", err)
+		}
+		return nil
+	})
+}
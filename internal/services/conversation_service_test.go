@@ -0,0 +1,25 @@
+package services_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gochat/internal/services"
+	"testing"
+)
+
+func TestConversationService(t *testing.T) {
+	ctx := context.Background()
+	conversationService := services.NewConversationService(testStore)
+	conversationID := uuid.New().String()
+
+	// The first user to use a conversation owns it, claiming again is fine
+	assert.NoError(t, conversationService.Claim(ctx, "123ABCD", conversationID))
+	assert.NoError(t, conversationService.Claim(ctx, "123ABCD", conversationID))
+	assert.ErrorIs(t, conversationService.Claim(ctx, "1234abcd", conversationID), services.ErrConversationNotFound)
+	assert.ErrorIs(t, conversationService.Delete(ctx, "1234abcd", conversationID), services.ErrConversationNotFound)
+	assert.Error(t, conversationService.Claim(ctx, "123ABCD", ""))
+
+	assert.NoError(t, conversationService.Delete(ctx, "123ABCD", conversationID))
+	assert.NoError(t, conversationService.Claim(ctx, "1234abcd", conversationID))
+}
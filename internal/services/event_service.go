@@ -4,12 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	database "gochat/internal/db"
 	"gochat/internal/schema"
+	"gochat/internal/store"
 )
 
 type EventService struct {
-	queries *schema.Queries
+	queries store.Store
 	user    string
 }
 
@@ -21,24 +21,26 @@ const (
 	EventMessage   EventType = "message"
 	UnknownAccount EventType = "unknownAccount"
 	Evil           EventType = "evil"
+	// An admin acting as another user, the event belongs to the admin
+	EventImpersonationStart  EventType = "impersonationStart"
+	EventImpersonationEnd    EventType = "impersonationEnd"
+	EventImpersonatedRequest EventType = "impersonatedRequest"
+	// Whether an answer was grounded in documents and why
+	EventRetrieval EventType = "retrieval"
 )
 
 // IsValid checks if the event type is valid
 func (e EventType) IsValid() bool {
 	switch e {
-	case EventLogin, EventMessage, UnknownAccount, Evil:
+	case EventLogin, EventMessage, UnknownAccount, Evil,
+		EventImpersonationStart, EventImpersonationEnd, EventImpersonatedRequest, EventRetrieval:
 		return true
 	}
 	return false
 }
 
-func NewEventService(userId string) *EventService {
-	queries, _, err := database.Init()
-	if err != nil {
-		fmt.Println("Error initializing queries for event service: " + err.Error())
-		return nil
-	}
-	return &EventService{queries: queries, user: userId}
+func NewEventService(s store.Store, userId string) *EventService {
+	return &EventService{queries: s, user: userId}
 }
 
 func (es *EventService) Create(event EventType, metadata interface{}) (*schema.Event, error) {
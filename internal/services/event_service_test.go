@@ -3,15 +3,14 @@ package services_test
 import (
 	"github.com/stretchr/testify/assert"
 	"gochat/internal/services"
-	"os"
+	"sync"
 	"testing"
 )
 
 func TestEventService(t *testing.T) {
-	os.Setenv("DB_PATH", "../../database.db")
 	testUserID := "123ABCD"
 	// New service
-	eventService := services.NewEventService(testUserID)
+	eventService := services.NewEventService(testStore, testUserID)
 	assert.NotNil(t, eventService)
 
 	// Create Event
@@ -32,3 +31,26 @@ func TestEventService(t *testing.T) {
 	assert.NotNil(t, err)
 
 }
+
+func TestEventService_ConcurrentWrites(t *testing.T) {
+	eventService := services.NewEventService(testStore, "123ABCD")
+
+	// Requests share one pool, concurrent writers wait for each other instead of failing with SQLITE_BUSY
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := eventService.Create(services.EventMessage, nil); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,351 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gochat/internal/schema"
+	"gochat/internal/store"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldType is the kind of value an extraction field holds
+type FieldType string
+
+const (
+	FieldString  FieldType = "string"
+	FieldNumber  FieldType = "number"
+	FieldInteger FieldType = "integer"
+	FieldBoolean FieldType = "boolean"
+	// FieldDate is a day written as YYYY-MM-DD
+	FieldDate FieldType = "date"
+)
+
+// Status of the result of an extraction for one file
+const (
+	ExtractionPending = "pending"
+	ExtractionDone    = "done"
+	ExtractionFailed  = "failed"
+)
+
+var (
+	// ErrExtractionNotFound is also returned for extractions of other users
+	ErrExtractionNotFound = errors.New("extraction not found")
+
+	// validFieldName is also a CSV column and a JSON key, so it is kept plain
+	validFieldName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,63}$`)
+)
+
+// ExtractionField is one value to find in every document, the description tells the model what it is
+type ExtractionField struct {
+	Name        string    `json:"name"`
+	Type        FieldType `json:"type"`
+	Description string    `json:"description,omitempty"`
+	Required    bool      `json:"required,omitempty"`
+}
+
+// ValidateFields checks the schema of an extraction, it needs between 1 and 50 fields with unique names
+func ValidateFields(fields []ExtractionField) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("at least one field is required")
+	}
+	if len(fields) > 50 {
+		return fmt.Errorf("an extraction can have at most 50 fields")
+	}
+	seen := map[string]bool{}
+	for _, field := range fields {
+		if !validFieldName.MatchString(field.Name) {
+			return fmt.Errorf("invalid field name %q, use letters, digits and underscores", field.Name)
+		}
+		if seen[strings.ToLower(field.Name)] {
+			return fmt.Errorf("field %q is defined twice", field.Name)
+		}
+		seen[strings.ToLower(field.Name)] = true
+		switch field.Type {
+		case FieldString, FieldNumber, FieldInteger, FieldBoolean, FieldDate:
+		default:
+			return fmt.Errorf("field %q has invalid type %q", field.Name, field.Type)
+		}
+	}
+	return nil
+}
+
+// ParseRecord reads the JSON object the model answered with. Values are converted to the type of
+// their field where that is unambiguous, like "45%" for a number. Values that don't fit are left
+// out and reported in the error, keys that aren't fields are dropped.
+func ParseRecord(fields []ExtractionField, data string) (map[string]interface{}, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &raw); err != nil {
+		return nil, fmt.Errorf("answer is not a JSON object: %w", err)
+	}
+	record := map[string]interface{}{}
+	var problems []string
+	for _, field := range fields {
+		value, ok := raw[field.Name]
+		if !ok || value == nil {
+			continue
+		}
+		converted, err := convertValue(field.Type, value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", field.Name, err))
+			continue
+		}
+		record[field.Name] = converted
+	}
+	if len(problems) > 0 {
+		return record, fmt.Errorf("invalid values: %s", strings.Join(problems, "; "))
+	}
+	return record, nil
+}
+
+func convertValue(fieldType FieldType, value interface{}) (interface{}, error) {
+	switch fieldType {
+	case FieldString:
+		switch v := value.(type) {
+		case string:
+			return strings.TrimSpace(v), nil
+		case float64, bool:
+			return fmt.Sprint(v), nil
+		}
+	case FieldNumber, FieldInteger:
+		number, ok := value.(float64)
+		if s, isString := value.(string); isString {
+			// Percentages, thousands separators and decimal commas as they are written in reports
+			s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "%"))
+			if strings.Count(s, ",") == 1 && !strings.Contains(s, ".") {
+				s = strings.Replace(s, ",", ".", 1)
+			}
+			s = strings.NewReplacer(",", "", " ", "").Replace(s)
+			parsed, err := strconv.ParseFloat(s, 64)
+			number, ok = parsed, err == nil
+		}
+		if !ok {
+			break
+		}
+		if fieldType == FieldInteger && number != math.Trunc(number) {
+			return nil, fmt.Errorf("%v is not a whole number", number)
+		}
+		return number, nil
+	case FieldBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if parsed, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return parsed, nil
+			}
+		}
+	case FieldDate:
+		if s, ok := value.(string); ok {
+			if _, err := time.Parse(time.DateOnly, strings.TrimSpace(s)); err == nil {
+				return strings.TrimSpace(s), nil
+			}
+			return nil, fmt.Errorf("%q is not a date like 2024-10-31", s)
+		}
+	}
+	return nil, fmt.Errorf("%v is not a %s", value, fieldType)
+}
+
+// MissingFields returns the names of the required fields the record has no value for
+func MissingFields(fields []ExtractionField, record map[string]interface{}) []string {
+	var missing []string
+	for _, field := range fields {
+		if _, ok := record[field.Name]; field.Required && !ok {
+			missing = append(missing, field.Name)
+		}
+	}
+	return missing
+}
+
+type ExtractionService struct {
+	queries store.Store
+}
+
+func NewExtractionService(s store.Store) *ExtractionService {
+	return &ExtractionService{queries: s}
+}
+
+type ExtractionResultDto struct {
+	File      string                 `json:"fileId"`
+	FileName  string                 `json:"fileName"`
+	Status    string                 `json:"status"`
+	Data      map[string]interface{} `json:"data"`
+	Error     string                 `json:"error,omitempty"`
+	UpdatedAt string                 `json:"updatedAt"`
+}
+
+type ExtractionDto struct {
+	ID        string                `json:"id"`
+	Name      string                `json:"name"`
+	Fields    []ExtractionField     `json:"fields"`
+	CreatedAt string                `json:"createdAt"`
+	Results   []ExtractionResultDto `json:"results,omitempty"`
+}
+
+func toExtractionDto(extraction schema.Extraction) (*ExtractionDto, error) {
+	dto := &ExtractionDto{ID: extraction.ID, Name: extraction.Name, CreatedAt: extraction.Createdat}
+	if err := json.Unmarshal([]byte(extraction.Fields), &dto.Fields); err != nil {
+		return nil, fmt.Errorf("failed to read fields of extraction: %w", err)
+	}
+	return dto, nil
+}
+
+// Create records an extraction of the fields over the files, every file gets a pending result. The
+// caller checked that the files are the user's.
+func (s *ExtractionService) Create(ctx context.Context, userID string, name string, fields []ExtractionField, files []schema.File) (*ExtractionDto, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if err := ValidateFields(fields); err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("at least one file is required")
+	}
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.New().String()
+	err = s.queries.InTx(ctx, func(q schema.Querier) error {
+		_, err := q.CreateExtraction(ctx, schema.CreateExtractionParams{ID: id, Owner: userID, Name: name, Fields: string(encoded)})
+		if err != nil {
+			return fmt.Errorf("failed to create extraction: %w", err)
+		}
+		for _, file := range files {
+			err := q.AddExtractionResult(ctx, schema.AddExtractionResultParams{Extraction: id, File: file.ID})
+			if err != nil {
+				return fmt.Errorf("failed to add file to extraction: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, userID, id)
+}
+
+// Get returns the extraction with the results so far
+func (s *ExtractionService) Get(ctx context.Context, userID string, id string) (*ExtractionDto, error) {
+	extraction, err := s.queries.GetExtraction(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && extraction.Owner != userID) {
+		return nil, ErrExtractionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get extraction: %w", err)
+	}
+	dto, err := toExtractionDto(extraction)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.queries.ListExtractionResults(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list extraction results: %w", err)
+	}
+	for _, row := range rows {
+		result := ExtractionResultDto{
+			File:      row.File,
+			FileName:  row.Filename,
+			Status:    row.Status,
+			Error:     row.Error,
+			UpdatedAt: row.Updatedat,
+		}
+		if err := json.Unmarshal([]byte(row.Data), &result.Data); err != nil {
+			return nil, fmt.Errorf("failed to read extraction result: %w", err)
+		}
+		dto.Results = append(dto.Results, result)
+	}
+	return dto, nil
+}
+
+// List returns the user's extractions, newest first and without their results
+func (s *ExtractionService) List(ctx context.Context, userID string) ([]ExtractionDto, error) {
+	extractions, err := s.queries.ListExtractions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list extractions: %w", err)
+	}
+	result := make([]ExtractionDto, 0, len(extractions))
+	for _, extraction := range extractions {
+		dto, err := toExtractionDto(extraction)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *dto)
+	}
+	return result, nil
+}
+
+// SaveResult records what was extracted from a file, it failed when extractErr is set. The values
+// are kept in both cases, a failure can still have found some of the fields.
+func (s *ExtractionService) SaveResult(ctx context.Context, id string, fileID string, record map[string]interface{}, extractErr error) error {
+	if record == nil {
+		record = map[string]interface{}{}
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	params := schema.SaveExtractionResultParams{Status: ExtractionDone, Data: string(data), Extraction: id, File: fileID}
+	if extractErr != nil {
+		params.Status, params.Error = ExtractionFailed, extractErr.Error()
+	}
+	return s.queries.SaveExtractionResult(ctx, params)
+}
+
+// WriteCSV writes a row per file with a column per field, after the file name, status and error.
+// Every cell is escaped with csvCell, the values come from documents and the model.
+func (e *ExtractionDto) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	header := []string{"file", "status", "error"}
+	for _, field := range e.Fields {
+		header = append(header, csvCell(field.Name))
+	}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+	for _, result := range e.Results {
+		row := []string{csvCell(result.FileName), result.Status, csvCell(result.Error)}
+		for _, field := range e.Fields {
+			row = append(row, csvCell(formatValue(result.Data[field.Name])))
+		}
+		if err := out.Write(row); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// csvCell keeps spreadsheets from running a cell as a formula, by putting a quote in front of cells
+// that start like one. Numbers are left alone, -3 is a number and not a formula.
+func csvCell(value string) string {
+	if value == "" || !strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return value
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	return "'" + value
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,112 @@
+package services_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gochat/internal/schema"
+	"gochat/internal/services"
+	"gochat/internal/store"
+	"strings"
+	"testing"
+)
+
+func TestValidateFields(t *testing.T) {
+	assert.NoError(t, services.ValidateFields([]services.ExtractionField{
+		{Name: "respondents", Type: services.FieldInteger, Required: true},
+		{Name: "period_start", Type: services.FieldDate},
+	}))
+	assert.Error(t, services.ValidateFields(nil))
+	assert.ErrorContains(t, services.ValidateFields([]services.ExtractionField{{Name: "aantal respondenten", Type: services.FieldInteger}}), "invalid field name")
+	assert.ErrorContains(t, services.ValidateFields([]services.ExtractionField{{Name: "a", Type: services.FieldString}, {Name: "A", Type: services.FieldNumber}}), "twice")
+	assert.ErrorContains(t, services.ValidateFields([]services.ExtractionField{{Name: "a", Type: "percentage"}}), "invalid type")
+}
+
+func TestParseRecord(t *testing.T) {
+	fields := []services.ExtractionField{
+		{Name: "respondents", Type: services.FieldInteger},
+		{Name: "share", Type: services.FieldNumber},
+		{Name: "start", Type: services.FieldDate},
+		{Name: "online", Type: services.FieldBoolean},
+		{Name: "topic", Type: services.FieldString},
+	}
+	record, err := services.ParseRecord(fields, `{"respondents": 352, "share": "45,5%", "start": "2024-10-01", "online": "true", "topic": " Alcohol ", "other": 1}`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"respondents": 352.0, "share": 45.5, "start": "2024-10-01", "online": true, "topic": "Alcohol"}, record)
+
+	// Values that don't fit are left out and reported
+	record, err = services.ParseRecord(fields, `{"respondents": 35.2, "share": null, "start": "oktober 2024", "topic": "Alcohol"}`)
+	assert.ErrorContains(t, err, "respondents")
+	assert.ErrorContains(t, err, "start")
+	assert.Equal(t, map[string]interface{}{"topic": "Alcohol"}, record)
+	assert.Equal(t, []string{"respondents"}, services.MissingFields([]services.ExtractionField{{Name: "respondents", Required: true}, {Name: "share"}}, record))
+
+	_, err = services.ParseRecord(fields, "Er waren 352 respondenten")
+	assert.Error(t, err)
+}
+
+func TestExtractionService(t *testing.T) {
+	ctx := context.Background()
+	extractionService := services.NewExtractionService(testStore)
+	blobs, err := store.NewFSBlobStore(t.TempDir())
+	assert.NoError(t, err)
+	fileService := newFileService(t, blobs, "123ABCD")
+	report, err := fileService.Create(ctx, services.FileUpload{Name: "peiling.txt", Size: -1}, strings.NewReader("352 ouders"))
+	assert.NoError(t, err)
+	fields := []services.ExtractionField{
+		{Name: "respondents", Type: services.FieldInteger, Required: true},
+		{Name: "share", Type: services.FieldNumber},
+	}
+
+	_, err = extractionService.Create(ctx, "123ABCD", "Peilingen", fields, nil)
+	assert.Error(t, err)
+	extraction, err := extractionService.Create(ctx, "123ABCD", " Peilingen ", fields, []schema.File{*report})
+	assert.NoError(t, err)
+	assert.Equal(t, "Peilingen", extraction.Name)
+	assert.Equal(t, fields, extraction.Fields)
+	assert.Len(t, extraction.Results, 1)
+	assert.Equal(t, services.ExtractionPending, extraction.Results[0].Status)
+	assert.Equal(t, "peiling.txt", extraction.Results[0].FileName)
+
+	assert.NoError(t, extractionService.SaveResult(ctx, extraction.ID, report.ID, map[string]interface{}{"respondents": 352.0, "share": 12.5}, nil))
+	extraction, err = extractionService.Get(ctx, "123ABCD", extraction.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, services.ExtractionDone, extraction.Results[0].Status)
+	var csv strings.Builder
+	assert.NoError(t, extraction.WriteCSV(&csv))
+	assert.Equal(t, "file,status,error,respondents,share\npeiling.txt,done,,352,12.5\n", csv.String())
+
+	list, err := extractionService.List(ctx, "123ABCD")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, list)
+	assert.Equal(t, extraction.ID, list[0].ID)
+	assert.Empty(t, list[0].Results)
+
+	// Other users get the same answer as for an extraction that does not exist
+	_, err = extractionService.Get(ctx, "1234abcd", extraction.ID)
+	assert.ErrorIs(t, err, services.ErrExtractionNotFound)
+}
+
+func TestExtractionDto_WriteCSVFormulas(t *testing.T) {
+	extraction := services.ExtractionDto{
+		Fields: []services.ExtractionField{{Name: "=total"}, {Name: "amount"}},
+		Results: []services.ExtractionResultDto{{
+			FileName: "@budget.txt",
+			Status:   "done",
+			Data:     map[string]interface{}{"=total": `=HYPERLINK("http://example.com")`, "amount": -12.5},
+		}, {
+			FileName: "notes.txt",
+			Status:   "done",
+			Data:     map[string]interface{}{"=total": "+31 6 1234", "amount": "-1+2"},
+		}, {
+			FileName: "tab.txt",
+			Status:   "done",
+			Data:     map[string]interface{}{"=total": "\tcmd", "amount": "\r=1"},
+		}},
+	}
+	var csv strings.Builder
+	assert.NoError(t, extraction.WriteCSV(&csv))
+	assert.Equal(t, "file,status,error,'=total,amount\n"+
+		"'@budget.txt,done,,\"'=HYPERLINK(\"\"http://example.com\"\")\",-12.5\n"+
+		"notes.txt,done,,'+31 6 1234,'-1+2\n"+
+		"tab.txt,done,,'\tcmd,\"'\r=1\"\n", csv.String())
+}
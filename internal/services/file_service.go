@@ -2,52 +2,269 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	database "gochat/internal/db"
 	"gochat/internal/schema"
+	"gochat/internal/store"
+	"io"
+	"mime"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrFileNotFound = errors.New("file not found")
+	// ErrNoOriginal is returned for files uploaded before originals were stored
+	ErrNoOriginal = errors.New("the original of this file was not stored")
+
+	// validTag is what searches can filter on, lowercase words joined by dashes or underscores
+	validTag = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
 )
 
 type FileService struct {
-	queries *schema.Queries
+	queries store.Store
+	blobs   store.BlobStore
 	owner   string
 }
 
-func NewFileService(ctx *gin.Context) (*FileService, error) {
-	queries, _, err := database.Init()
-	if err != nil {
-		return nil, fmt.Errorf("Error initializing queries for event service: " + err.Error())
-	}
-
+func NewFileService(s store.Store, blobs store.BlobStore, ctx *gin.Context) (*FileService, error) {
 	owner, exist := ctx.Get("user")
 	if !exist {
 		return nil, fmt.Errorf("user not found in context")
 	}
-	return &FileService{queries: queries, owner: owner.(string)}, nil
+	return &FileService{queries: s, blobs: blobs, owner: owner.(string)}, nil
+}
+
+type FileUpload struct {
+	Name         string
+	Conversation string
+	// MimeType is what the client sent, the extension decides when it is missing or generic
+	MimeType string
+	Size     int64
+	Tags     []string
+}
+
+// NormalizeTags lowercases and dedupes tags, they may be sent comma separated. At most 32 are kept,
+// as many as a vector can store.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	var result []string
+	for _, field := range tags {
+		for _, tag := range strings.Split(field, ",") {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if tag == "" || seen[tag] {
+				continue
+			}
+			if !validTag.MatchString(tag) {
+				return nil, fmt.Errorf("invalid tag %q, use letters, digits, dashes and underscores", tag)
+			}
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	if len(result) > 32 {
+		return nil, fmt.Errorf("a file can have at most 32 tags")
+	}
+	return result, nil
+}
+
+// FileBlobKey is where the original of a file is stored, per owner so a bucket can be browsed by user
+func FileBlobKey(owner string, id string) string {
+	return "files/" + owner + "/" + id
+}
+
+func detectMimeType(name string, sent string) string {
+	if sent != "" && sent != "application/octet-stream" {
+		return sent
+	}
+	if byExtension := mime.TypeByExtension(filepath.Ext(name)); byExtension != "" {
+		return byExtension
+	}
+	return "application/octet-stream"
 }
 
-// Create Creates a file in the database
-func (fs *FileService) Create(ctx context.Context, fileName string) (*schema.File, error) {
+// Create stores the original and then records the file in the database
+func (fs *FileService) Create(ctx context.Context, upload FileUpload, content io.Reader) (*schema.File, error) {
+	tags, err := NormalizeTags(upload.Tags)
+	if err != nil {
+		return nil, err
+	}
 	id := uuid.New().String()
-	savedFile, err := fs.queries.CreateFile(ctx, schema.CreateFileParams{
-		Owner: fs.owner,
-		ID:    id,
-		Name:  fileName,
+	mimeType := detectMimeType(upload.Name, upload.MimeType)
+	key := FileBlobKey(fs.owner, id)
+
+	hash := sha256.New()
+	counted := &countingReader{r: io.TeeReader(content, hash)}
+	if err := fs.blobs.Put(ctx, key, counted, upload.Size, mimeType); err != nil {
+		return nil, fmt.Errorf("failed to store file: %w", err)
+	}
+
+	var savedFile schema.File
+	err = fs.queries.InTx(ctx, func(q schema.Querier) error {
+		var err error
+		savedFile, err = q.CreateFile(ctx, schema.CreateFileParams{
+			Owner:        fs.owner,
+			ID:           id,
+			Name:         upload.Name,
+			Hash:         hex.EncodeToString(hash.Sum(nil)),
+			Size:         counted.n,
+			Mimetype:     mimeType,
+			Conversation: upload.Conversation,
+		})
+		if err != nil {
+			return err
+		}
+		for _, tag := range tags {
+			if err := q.AddFileTag(ctx, schema.AddFileTagParams{File: id, Tag: tag}); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
 
 	if err != nil {
-		fmt.Printf("failed to create file: %s", err)
-		return nil, err
+		if err := fs.blobs.Delete(ctx, key); err != nil {
+			fmt.Println("failed to remove stored file: " + err.Error())
+		}
+		return nil, fmt.Errorf("failed to create file: %w", err)
 	}
 	return &savedFile, nil
 }
 
-func (fs *FileService) Get(id int64) *schema.Event {
-	file, err := fs.queries.GetEvent(context.Background(), id)
+// Get returns ErrFileNotFound for files of other users as well, so ids cannot be probed
+func (fs *FileService) Get(ctx context.Context, id string) (*schema.File, error) {
+	file, err := fs.queries.GetFile(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && file.Owner != fs.owner) {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// Open returns the file with its original, the caller closes the reader
+func (fs *FileService) Open(ctx context.Context, id string) (*schema.File, io.ReadCloser, error) {
+	file, err := fs.Get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if file.Hash == "" {
+		return nil, nil, ErrNoOriginal
+	}
+	content, err := fs.blobs.Get(ctx, FileBlobKey(file.Owner, file.ID))
+	if errors.Is(err, store.ErrBlobNotFound) {
+		return nil, nil, ErrNoOriginal
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, content, nil
+}
+
+// Delete removes the file with its tags, summaries, extraction results and knowledge base
+// memberships, and then its original. The vectors are up to the caller.
+func (fs *FileService) Delete(ctx context.Context, id string) error {
+	file, err := fs.Get(ctx, id)
 	if err != nil {
-		fmt.Printf("failed to GET file: %s", err)
+		return err
+	}
+	err = fs.queries.InTx(ctx, func(q schema.Querier) error {
+		if err := q.DeleteFileTags(ctx, file.ID); err != nil {
+			return err
+		}
+		if err := q.DeleteFileSummaries(ctx, file.ID); err != nil {
+			return err
+		}
+		if err := q.DeleteFileExtractionResults(ctx, file.ID); err != nil {
+			return err
+		}
+		if err := q.DeleteFileKnowledgeBaseFiles(ctx, file.ID); err != nil {
+			return err
+		}
+		deleted, err := q.DeleteFile(ctx, schema.DeleteFileParams{ID: file.ID, Owner: fs.owner})
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return ErrFileNotFound
+		}
 		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Files uploaded before originals were stored have no blob
+	if err := fs.blobs.Delete(ctx, FileBlobKey(file.Owner, file.ID)); err != nil && !errors.Is(err, store.ErrBlobNotFound) {
+		return fmt.Errorf("failed to remove stored file: %w", err)
 	}
-	return &file
+	return nil
+}
+
+// Tags returns the tags the file was uploaded with
+func (fs *FileService) Tags(ctx context.Context, id string) ([]string, error) {
+	file, err := fs.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return fs.queries.ListFileTags(ctx, file.ID)
+}
+
+// SetIndex records the embedding model and chunker version the file's vectors were made with
+func (fs *FileService) SetIndex(ctx context.Context, id string, model string, chunker int) error {
+	return fs.queries.SetFileIndex(ctx, schema.SetFileIndexParams{
+		ID:             id,
+		Embeddingmodel: model,
+		Chunkerversion: int64(chunker),
+	})
+}
+
+// ListConversation returns the files uploaded to a conversation, oldest first
+func (fs *FileService) ListConversation(ctx context.Context, conversation string) ([]schema.File, error) {
+	return fs.queries.ListConversationFiles(ctx, schema.ListConversationFilesParams{
+		Owner:        fs.owner,
+		Conversation: conversation,
+	})
+}
+
+// Summary returns the cached summary of a version of the file, ok is false when none was made yet
+func (fs *FileService) Summary(ctx context.Context, id string, version string) (string, bool, error) {
+	file, err := fs.Get(ctx, id)
+	if err != nil {
+		return "", false, err
+	}
+	summary, err := fs.queries.GetFileSummary(ctx, schema.GetFileSummaryParams{File: file.ID, Version: version})
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return summary.Summary, true, nil
+}
+
+// SaveSummary caches the summary of a version of the file, replacing one made before
+func (fs *FileService) SaveSummary(ctx context.Context, id string, version string, summary string) error {
+	file, err := fs.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return fs.queries.SaveFileSummary(ctx, schema.SaveFileSummaryParams{File: file.ID, Version: version, Summary: summary})
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
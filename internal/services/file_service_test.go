@@ -0,0 +1,135 @@
+package services_test
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gochat/internal/services"
+	"gochat/internal/store"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newFileService(t *testing.T, blobs store.BlobStore, userID string) *services.FileService {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("user", userID)
+	fileService, err := services.NewFileService(testStore, blobs, c)
+	assert.NoError(t, err)
+	return fileService
+}
+
+func TestFileService(t *testing.T) {
+	ctx := context.Background()
+	blobs, err := store.NewFSBlobStore(t.TempDir())
+	assert.NoError(t, err)
+	fileService := newFileService(t, blobs, "123ABCD")
+
+	file, err := fileService.Create(ctx, services.FileUpload{Name: "notes.pdf", Conversation: "conv-1", Size: -1}, strings.NewReader("# Notes"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), file.Size)
+	assert.Equal(t, "conv-1", file.Conversation)
+	assert.Equal(t, "application/pdf", file.Mimetype)
+	assert.Len(t, file.Hash, 64)
+
+	saved, content, err := fileService.Open(ctx, file.ID)
+	assert.NoError(t, err)
+	original, _ := io.ReadAll(content)
+	content.Close()
+	assert.Equal(t, "# Notes", string(original))
+	assert.Equal(t, file.Hash, saved.Hash)
+
+	// Tags are normalized and stored with the file
+	tagged, err := fileService.Create(ctx, services.FileUpload{Name: "plan.pdf", Size: -1, Tags: []string{"2024-Budget, q1", "q1"}}, strings.NewReader("plan"))
+	assert.NoError(t, err)
+	tags, err := fileService.Tags(ctx, tagged.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2024-budget", "q1"}, tags)
+	_, err = fileService.Create(ctx, services.FileUpload{Name: "plan.pdf", Size: -1, Tags: []string{"no spaces"}}, strings.NewReader("plan"))
+	assert.Error(t, err)
+
+	// The upload records what the vectors were made with
+	assert.NoError(t, fileService.SetIndex(ctx, file.ID, "nomic-embed-text", 2))
+	saved, err = fileService.Get(ctx, file.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "nomic-embed-text", saved.Embeddingmodel)
+	assert.Equal(t, int64(2), saved.Chunkerversion)
+
+	// Other users get the same answer as for a file that does not exist
+	_, _, err = newFileService(t, blobs, "1234abcd").Open(ctx, file.ID)
+	assert.ErrorIs(t, err, services.ErrFileNotFound)
+	_, _, err = fileService.Open(ctx, "does-not-exist")
+	assert.ErrorIs(t, err, services.ErrFileNotFound)
+}
+
+func TestFileSummary(t *testing.T) {
+	ctx := context.Background()
+	blobs, err := store.NewFSBlobStore(t.TempDir())
+	assert.NoError(t, err)
+	fileService := newFileService(t, blobs, "123ABCD")
+
+	first, err := fileService.Create(ctx, services.FileUpload{Name: "a.txt", Conversation: "conv-summary", Size: -1}, strings.NewReader("a"))
+	assert.NoError(t, err)
+	second, err := fileService.Create(ctx, services.FileUpload{Name: "b.txt", Conversation: "conv-summary", Size: -1}, strings.NewReader("b"))
+	assert.NoError(t, err)
+	files, err := fileService.ListConversation(ctx, "conv-summary")
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+	assert.ElementsMatch(t, []string{first.ID, second.ID}, []string{files[0].ID, files[1].ID})
+
+	_, ok, err := fileService.Summary(ctx, first.ID, "v1")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoError(t, fileService.SaveSummary(ctx, first.ID, "v1", "Over a"))
+	assert.NoError(t, fileService.SaveSummary(ctx, first.ID, "v1", "Over de letter a"))
+	summary, ok, err := fileService.Summary(ctx, first.ID, "v1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "Over de letter a", summary)
+	_, ok, err = fileService.Summary(ctx, first.ID, "v2")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	other := newFileService(t, blobs, "1234abcd")
+	_, _, err = other.Summary(ctx, first.ID, "v1")
+	assert.ErrorIs(t, err, services.ErrFileNotFound)
+	assert.ErrorIs(t, other.SaveSummary(ctx, first.ID, "v1", "x"), services.ErrFileNotFound)
+	files, err = other.ListConversation(ctx, "conv-summary")
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestFileService_Delete(t *testing.T) {
+	ctx := context.Background()
+	blobs, err := store.NewFSBlobStore(t.TempDir())
+	assert.NoError(t, err)
+	fileService := newFileService(t, blobs, "123ABCD")
+	kbService := services.NewKnowledgeBaseService(testStore)
+	user, err := services.NewUserService(testStore).Get(ctx, "123ABCD")
+	assert.NoError(t, err)
+
+	file, err := fileService.Create(ctx, services.FileUpload{Name: "weg.txt", Size: -1, Tags: []string{"oud"}}, strings.NewReader("weg"))
+	assert.NoError(t, err)
+	assert.NoError(t, fileService.SaveSummary(ctx, file.ID, "v1", "Over weg"))
+	kb, err := kbService.Create(ctx, user, services.KnowledgeBaseParams{Name: "Archief"})
+	assert.NoError(t, err)
+	_, err = kbService.AddFile(ctx, user, kb.ID, file.ID)
+	assert.NoError(t, err)
+
+	// Other users cannot delete it
+	assert.ErrorIs(t, newFileService(t, blobs, "1234abcd").Delete(ctx, file.ID), services.ErrFileNotFound)
+
+	assert.NoError(t, fileService.Delete(ctx, file.ID))
+	_, err = fileService.Get(ctx, file.ID)
+	assert.ErrorIs(t, err, services.ErrFileNotFound)
+	_, err = blobs.Get(ctx, services.FileBlobKey("123ABCD", file.ID))
+	assert.ErrorIs(t, err, store.ErrBlobNotFound)
+	tags, err := testStore.ListFileTags(ctx, file.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, tags)
+	files, err := kbService.ListFiles(ctx, user, kb.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+	assert.ErrorIs(t, fileService.Delete(ctx, file.ID), services.ErrFileNotFound)
+}
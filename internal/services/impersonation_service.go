@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gochat/internal/schema"
+	"gochat/internal/store"
+	"gochat/pkg/utils"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultImpersonationTTL = 15 * time.Minute
+	MaxImpersonationTTL     = 2 * time.Hour
+)
+
+var (
+	ErrImpersonationInvalid = errors.New("invalid impersonation")
+	ErrImpersonationExpired = errors.New("impersonation expired")
+	ErrImpersonationEnded   = errors.New("impersonation ended")
+	// ErrImpersonationForbidden is returned when the actor is no admin (anymore) or was disabled
+	ErrImpersonationForbidden = errors.New("not allowed to impersonate this user")
+)
+
+type ImpersonationService struct {
+	queries store.Store
+}
+
+type ImpersonationParams struct {
+	Reason string
+	TTL    time.Duration
+}
+
+// ImpersonationDto is an admin acting as another user, it is also what the views use for the banner
+type ImpersonationDto struct {
+	ID        string    `json:"id"`
+	ActorID   string    `json:"actorId"`
+	UserID    string    `json:"userId"`
+	SessionID string    `json:"-"`
+	Reason    string    `json:"reason"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func NewImpersonationService(s store.Store) *ImpersonationService {
+	return &ImpersonationService{queries: s}
+}
+
+func toImpersonationDto(imp schema.Impersonation) (*ImpersonationDto, error) {
+	expiresAt, err := time.Parse(time.RFC3339, imp.Expiresat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid impersonation expiry: %w", err)
+	}
+	return &ImpersonationDto{
+		ID:        imp.ID,
+		ActorID:   imp.Actor,
+		UserID:    imp.User,
+		SessionID: imp.Session,
+		Reason:    imp.Reason,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Start lets the actor act as the user until the TTL runs out. The impersonation is bound to the actor's
+// session, so logging out also ends it.
+func (s *ImpersonationService) Start(ctx context.Context, actorID string, sessionID string, userID string, params ImpersonationParams) (*ImpersonationDto, error) {
+	reason := strings.TrimSpace(params.Reason)
+	if reason == "" {
+		return nil, fmt.Errorf("a reason is required to impersonate a user")
+	}
+	if actorID == userID {
+		return nil, fmt.Errorf("you can't impersonate yourself")
+	}
+
+	ttl := params.TTL
+	if ttl <= 0 {
+		ttl = DefaultImpersonationTTL
+	}
+	if ttl > MaxImpersonationTTL {
+		return nil, fmt.Errorf("impersonation can last at most %s", MaxImpersonationTTL)
+	}
+
+	if _, err := s.queries.GetUser(ctx, userID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if err := s.checkActor(ctx, actorID, userID); err != nil {
+		return nil, err
+	}
+
+	imp, err := s.queries.CreateImpersonation(ctx, schema.CreateImpersonationParams{
+		ID:        uuid.New().String(),
+		Actor:     actorID,
+		User:      userID,
+		Session:   sessionID,
+		Reason:    reason,
+		Expiresat: time.Now().UTC().Add(ttl).Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create impersonation: %w", err)
+	}
+	return toImpersonationDto(imp)
+}
+
+// Validate checks that the impersonation belongs to the actor's session and is still running. The actor
+// is loaded again every time, an admin who lost the role or was disabled stops impersonating right away.
+func (s *ImpersonationService) Validate(ctx context.Context, id string, actorID string, sessionID string) (*ImpersonationDto, error) {
+	imp, err := s.queries.GetImpersonation(ctx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrImpersonationInvalid
+		}
+		return nil, fmt.Errorf("failed to get impersonation: %w", err)
+	}
+	if imp.Actor != actorID || imp.Session != sessionID {
+		return nil, ErrImpersonationInvalid
+	}
+	if imp.Endedat.Valid {
+		return nil, ErrImpersonationEnded
+	}
+
+	dto, err := toImpersonationDto(imp)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(dto.ExpiresAt) {
+		return nil, ErrImpersonationExpired
+	}
+	if err := s.checkActor(ctx, actorID, imp.User); err != nil {
+		if errors.Is(err, ErrImpersonationForbidden) {
+			// It stays ended when the role comes back
+			if endErr := s.End(ctx, imp.ID); endErr != nil {
+				fmt.Println(endErr)
+			}
+		}
+		return nil, err
+	}
+	return dto, nil
+}
+
+// checkActor allows enabled platform admins to impersonate anyone, and enabled account admins the
+// users of their own account
+func (s *ImpersonationService) checkActor(ctx context.Context, actorID string, userID string) error {
+	actor, err := s.queries.GetUser(ctx, actorID)
+	if err == sql.ErrNoRows {
+		return ErrImpersonationForbidden
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get actor: %w", err)
+	}
+	if actor.Disabledat.Valid {
+		return ErrImpersonationForbidden
+	}
+	switch Role(actor.Role) {
+	case RolePlatformAdmin:
+		return nil
+	case RoleAccountAdmin:
+		user, err := s.queries.GetUser(ctx, userID)
+		if err == sql.ErrNoRows {
+			return ErrImpersonationForbidden
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		if user.Account != actor.Account {
+			return ErrImpersonationForbidden
+		}
+		return nil
+	}
+	return ErrImpersonationForbidden
+}
+
+// End stops the impersonation, ending it twice is not an error
+func (s *ImpersonationService) End(ctx context.Context, id string) error {
+	_, err := s.queries.EndImpersonation(ctx, schema.EndImpersonationParams{
+		Endedat: utils.GetTime(),
+		ID:      id,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to end impersonation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package services_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gochat/internal/schema"
+	"gochat/internal/services"
+	"testing"
+	"time"
+)
+
+func createTestUser(t *testing.T, userService *services.UserService) *schema.User {
+	externalID := uuid.New().String()
+	user, err := userService.Create(context.Background(), services.UserParams{
+		Email:      externalID + "@test.com",
+		ExternalID: &externalID,
+	})
+	assert.NoError(t, err)
+	return user
+}
+
+func TestImpersonationService_StartAndEnd(t *testing.T) {
+	ctx := context.Background()
+	userService := services.NewUserService(testStore)
+	actorID := createTestUser(t, userService).ID
+	assert.NoError(t, userService.SetRole(ctx, actorID, services.RolePlatformAdmin))
+	target := createTestUser(t, userService)
+
+	session, _, err := services.NewSessionService(testStore).Create(ctx, actorID, services.SessionParams{})
+	assert.NoError(t, err)
+
+	impersonationService := services.NewImpersonationService(testStore)
+	assert.NotNil(t, impersonationService)
+
+	// A reason is required and the ttl is capped
+	_, err = impersonationService.Start(ctx, actorID, session.ID, target.ID, services.ImpersonationParams{})
+	assert.Error(t, err)
+	_, err = impersonationService.Start(ctx, actorID, session.ID, target.ID, services.ImpersonationParams{
+		Reason: "support ticket",
+		TTL:    services.MaxImpersonationTTL + time.Minute,
+	})
+	assert.Error(t, err)
+
+	imp, err := impersonationService.Start(ctx, actorID, session.ID, target.ID, services.ImpersonationParams{
+		Reason: "support ticket",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, target.ID, imp.UserID)
+	assert.WithinDuration(t, time.Now().Add(services.DefaultImpersonationTTL), imp.ExpiresAt, time.Minute)
+
+	validated, err := impersonationService.Validate(ctx, imp.ID, actorID, session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, imp.ID, validated.ID)
+
+	// It only works from the session that started it
+	_, err = impersonationService.Validate(ctx, imp.ID, actorID, "another-session")
+	assert.ErrorIs(t, err, services.ErrImpersonationInvalid)
+
+	assert.NoError(t, impersonationService.End(ctx, imp.ID))
+	_, err = impersonationService.Validate(ctx, imp.ID, actorID, session.ID)
+	assert.ErrorIs(t, err, services.ErrImpersonationEnded)
+
+	// Members can't start one
+	member := createTestUser(t, userService)
+	_, err = impersonationService.Start(ctx, member.ID, session.ID, target.ID, services.ImpersonationParams{Reason: "curious"})
+	assert.ErrorIs(t, err, services.ErrImpersonationForbidden)
+}
+
+func TestImpersonationService_ValidateReloadsActor(t *testing.T) {
+	ctx := context.Background()
+	userService := services.NewUserService(testStore)
+	impersonationService := services.NewImpersonationService(testStore)
+	actorID := createTestUser(t, userService).ID
+	target := createTestUser(t, userService)
+	session, _, err := services.NewSessionService(testStore).Create(ctx, actorID, services.SessionParams{})
+	assert.NoError(t, err)
+	start := func() *services.ImpersonationDto {
+		imp, err := impersonationService.Start(ctx, actorID, session.ID, target.ID, services.ImpersonationParams{Reason: "support ticket"})
+		assert.NoError(t, err)
+		return imp
+	}
+
+	// Losing the role ends it, getting it back does not bring it back
+	assert.NoError(t, userService.SetRole(ctx, actorID, services.RolePlatformAdmin))
+	imp := start()
+	assert.NoError(t, userService.SetRole(ctx, actorID, services.RoleMember))
+	_, err = impersonationService.Validate(ctx, imp.ID, actorID, session.ID)
+	assert.ErrorIs(t, err, services.ErrImpersonationForbidden)
+	assert.NoError(t, userService.SetRole(ctx, actorID, services.RolePlatformAdmin))
+	_, err = impersonationService.Validate(ctx, imp.ID, actorID, session.ID)
+	assert.ErrorIs(t, err, services.ErrImpersonationEnded)
+
+	// So does disabling the admin
+	imp = start()
+	assert.NoError(t, userService.Disable(ctx, actorID))
+	_, err = impersonationService.Validate(ctx, imp.ID, actorID, session.ID)
+	assert.ErrorIs(t, err, services.ErrImpersonationForbidden)
+}
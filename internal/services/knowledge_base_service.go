@@ -0,0 +1,354 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gochat/internal/schema"
+	"gochat/internal/store"
+	"gochat/pkg/utils"
+	"strings"
+)
+
+// KnowledgeBaseScope is who a knowledge base is shared with
+type KnowledgeBaseScope string
+
+const (
+	// KnowledgeBaseScopeAccount is shared with every user of the account, only account admins manage it
+	KnowledgeBaseScopeAccount KnowledgeBaseScope = "account"
+	// KnowledgeBaseScopeUser is private to the user who created it
+	KnowledgeBaseScopeUser KnowledgeBaseScope = "user"
+)
+
+var (
+	// ErrKnowledgeBaseNotFound is also returned for knowledge bases the user can't see
+	ErrKnowledgeBaseNotFound = errors.New("knowledge base not found")
+	ErrKnowledgeBaseReadOnly = errors.New("only account admins can change this knowledge base")
+)
+
+type KnowledgeBaseService struct {
+	queries store.Store
+}
+
+func NewKnowledgeBaseService(s store.Store) *KnowledgeBaseService {
+	return &KnowledgeBaseService{queries: s}
+}
+
+type KnowledgeBaseParams struct {
+	Name        string
+	Description string
+	Scope       KnowledgeBaseScope
+}
+
+type KnowledgeBaseDto struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Scope       KnowledgeBaseScope `json:"scope"`
+	CreatedAt   string             `json:"createdAt"`
+	UpdatedAt   string             `json:"updatedAt"`
+	// Partition is where the vectors of the knowledge base's files are copied to
+	Partition string `json:"-"`
+}
+
+// KnowledgeBasePartition is the Milvus partition of a knowledge base, partition names can't have dashes
+func KnowledgeBasePartition(id string) string {
+	return "kb_" + strings.ReplaceAll(id, "-", "_")
+}
+
+func toKnowledgeBaseDto(kb schema.KnowledgeBase) KnowledgeBaseDto {
+	scope := KnowledgeBaseScopeUser
+	if kb.Account.Valid {
+		scope = KnowledgeBaseScopeAccount
+	}
+	return KnowledgeBaseDto{
+		ID:          kb.ID,
+		Name:        kb.Name,
+		Description: kb.Description,
+		Scope:       scope,
+		CreatedAt:   kb.Createdat,
+		UpdatedAt:   kb.Updatedat,
+		Partition:   KnowledgeBasePartition(kb.ID),
+	}
+}
+
+func canRead(user *UserDto, kb schema.KnowledgeBase) bool {
+	if kb.Account.Valid {
+		return kb.Account.String == user.Account.ID
+	}
+	return kb.Owner.String == user.ID
+}
+
+func canManage(user *UserDto, kb schema.KnowledgeBase) bool {
+	if kb.Account.Valid {
+		return canRead(user, kb) && (user.Role == RoleAccountAdmin || user.Role == RolePlatformAdmin)
+	}
+	return kb.Owner.String == user.ID
+}
+
+// get returns the knowledge base if the user may read it, and when manage is set, change it
+func (s *KnowledgeBaseService) get(ctx context.Context, user *UserDto, id string, manage bool) (*schema.KnowledgeBase, error) {
+	kb, err := s.queries.GetKnowledgeBase(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !canRead(user, kb)) {
+		return nil, ErrKnowledgeBaseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get knowledge base: %w", err)
+	}
+	if manage && !canManage(user, kb) {
+		return nil, ErrKnowledgeBaseReadOnly
+	}
+	return &kb, nil
+}
+
+func (s *KnowledgeBaseService) Create(ctx context.Context, user *UserDto, params KnowledgeBaseParams) (*KnowledgeBaseDto, error) {
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	create := schema.CreateKnowledgeBaseParams{
+		ID:          uuid.New().String(),
+		Name:        params.Name,
+		Description: params.Description,
+	}
+	switch params.Scope {
+	case KnowledgeBaseScopeAccount:
+		if user.Role != RoleAccountAdmin && user.Role != RolePlatformAdmin {
+			return nil, ErrKnowledgeBaseReadOnly
+		}
+		create.Account = utils.StringToNullString(user.Account.ID)
+	case KnowledgeBaseScopeUser, "":
+		create.Owner = utils.StringToNullString(user.ID)
+	default:
+		return nil, fmt.Errorf("invalid scope: %s", params.Scope)
+	}
+
+	kb, err := s.queries.CreateKnowledgeBase(ctx, create)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create knowledge base: %w", err)
+	}
+	dto := toKnowledgeBaseDto(kb)
+	return &dto, nil
+}
+
+// List returns the knowledge bases of the user's account and the user's own
+func (s *KnowledgeBaseService) List(ctx context.Context, user *UserDto) ([]KnowledgeBaseDto, error) {
+	kbs, err := s.queries.ListKnowledgeBases(ctx, schema.ListKnowledgeBasesParams{
+		Account: utils.StringToNullString(user.Account.ID),
+		User:    utils.StringToNullString(user.ID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list knowledge bases: %w", err)
+	}
+	result := make([]KnowledgeBaseDto, 0, len(kbs))
+	for _, kb := range kbs {
+		result = append(result, toKnowledgeBaseDto(kb))
+	}
+	return result, nil
+}
+
+func (s *KnowledgeBaseService) Get(ctx context.Context, user *UserDto, id string) (*KnowledgeBaseDto, error) {
+	kb, err := s.get(ctx, user, id, false)
+	if err != nil {
+		return nil, err
+	}
+	dto := toKnowledgeBaseDto(*kb)
+	return &dto, nil
+}
+
+// GetManaged returns the knowledge base only when the user may change it
+func (s *KnowledgeBaseService) GetManaged(ctx context.Context, user *UserDto, id string) (*KnowledgeBaseDto, error) {
+	kb, err := s.get(ctx, user, id, true)
+	if err != nil {
+		return nil, err
+	}
+	dto := toKnowledgeBaseDto(*kb)
+	return &dto, nil
+}
+
+func (s *KnowledgeBaseService) Update(ctx context.Context, user *UserDto, id string, name string, description string) (*KnowledgeBaseDto, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if _, err := s.get(ctx, user, id, true); err != nil {
+		return nil, err
+	}
+	_, err := s.queries.UpdateKnowledgeBase(ctx, schema.UpdateKnowledgeBaseParams{
+		ID:          id,
+		Name:        name,
+		Description: description,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update knowledge base: %w", err)
+	}
+	return s.Get(ctx, user, id)
+}
+
+// Delete removes the knowledge base, its file list and the conversations it is attached to.
+// The files themselves stay, the caller drops the partition with the copied vectors.
+func (s *KnowledgeBaseService) Delete(ctx context.Context, user *UserDto, id string) (*KnowledgeBaseDto, error) {
+	kb, err := s.get(ctx, user, id, true)
+	if err != nil {
+		return nil, err
+	}
+	err = s.queries.InTx(ctx, func(q schema.Querier) error {
+		if err := q.DeleteKnowledgeBaseConversations(ctx, id); err != nil {
+			return fmt.Errorf("failed to detach knowledge base: %w", err)
+		}
+		if err := q.DeleteKnowledgeBaseFiles(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete knowledge base files: %w", err)
+		}
+		if _, err := q.DeleteKnowledgeBase(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete knowledge base: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	dto := toKnowledgeBaseDto(*kb)
+	return &dto, nil
+}
+
+// AddFile adds one of the user's own files to the knowledge base
+func (s *KnowledgeBaseService) AddFile(ctx context.Context, user *UserDto, id string, fileID string) (*schema.File, error) {
+	if _, err := s.get(ctx, user, id, true); err != nil {
+		return nil, err
+	}
+	file, err := s.queries.GetFile(ctx, fileID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && file.Owner != user.ID) {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+
+	err = s.queries.AddKnowledgeBaseFile(ctx, schema.AddKnowledgeBaseFileParams{Knowledgebase: id, File: fileID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add file: %w", err)
+	}
+	return &file, nil
+}
+
+// RemoveFile takes the file out of the knowledge base, returns ErrFileNotFound when it was not in it
+func (s *KnowledgeBaseService) RemoveFile(ctx context.Context, user *UserDto, id string, fileID string) error {
+	if _, err := s.get(ctx, user, id, true); err != nil {
+		return err
+	}
+	affected, err := s.queries.RemoveKnowledgeBaseFile(ctx, schema.RemoveKnowledgeBaseFileParams{Knowledgebase: id, File: fileID})
+	if err != nil {
+		return fmt.Errorf("failed to remove file: %w", err)
+	}
+	if affected == 0 {
+		return ErrFileNotFound
+	}
+	return nil
+}
+
+type KnowledgeBaseFileDto struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	MimeType  string `json:"mimeType"`
+	Size      int64  `json:"size"`
+	CreatedAt string `json:"createdAt"`
+}
+
+func (s *KnowledgeBaseService) ListFiles(ctx context.Context, user *UserDto, id string) ([]KnowledgeBaseFileDto, error) {
+	if _, err := s.get(ctx, user, id, false); err != nil {
+		return nil, err
+	}
+	files, err := s.queries.ListKnowledgeBaseFiles(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+	result := make([]KnowledgeBaseFileDto, 0, len(files))
+	for _, file := range files {
+		result = append(result, KnowledgeBaseFileDto{
+			ID:        file.ID,
+			Name:      file.Name,
+			MimeType:  file.Mimetype,
+			Size:      file.Size,
+			CreatedAt: file.Createdat,
+		})
+	}
+	return result, nil
+}
+
+// Attach makes the knowledge base searchable in one of the user's conversations
+func (s *KnowledgeBaseService) Attach(ctx context.Context, user *UserDto, conversationID string, id string) error {
+	if conversationID == "" {
+		return fmt.Errorf("conversation is required")
+	}
+	if _, err := s.get(ctx, user, id, false); err != nil {
+		return err
+	}
+	err := s.queries.AttachKnowledgeBase(ctx, schema.AttachKnowledgeBaseParams{
+		Conversation:  conversationID,
+		Knowledgebase: id,
+		User:          user.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to attach knowledge base: %w", err)
+	}
+	return nil
+}
+
+// Detach returns ErrKnowledgeBaseNotFound when the knowledge base was not attached
+func (s *KnowledgeBaseService) Detach(ctx context.Context, user *UserDto, conversationID string, id string) error {
+	affected, err := s.queries.DetachKnowledgeBase(ctx, schema.DetachKnowledgeBaseParams{
+		Conversation:  conversationID,
+		Knowledgebase: id,
+		User:          user.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to detach knowledge base: %w", err)
+	}
+	if affected == 0 {
+		return ErrKnowledgeBaseNotFound
+	}
+	return nil
+}
+
+// Attached returns the knowledge bases the user attached to the conversation. Ones the user can no
+// longer see, after moving to another account, are left out.
+func (s *KnowledgeBaseService) Attached(ctx context.Context, user *UserDto, conversationID string) ([]KnowledgeBaseDto, error) {
+	kbs, err := s.queries.ListConversationKnowledgeBases(ctx, schema.ListConversationKnowledgeBasesParams{
+		Conversation: conversationID,
+		User:         user.ID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attached knowledge bases: %w", err)
+	}
+	result := make([]KnowledgeBaseDto, 0, len(kbs))
+	for _, kb := range kbs {
+		if canRead(user, kb) {
+			result = append(result, toKnowledgeBaseDto(kb))
+		}
+	}
+	return result, nil
+}
+
+// Searches reports whether the file is in one of the knowledge bases the user attached to the
+// conversation
+func (s *KnowledgeBaseService) Searches(ctx context.Context, user *UserDto, conversationID string, fileID string) (bool, error) {
+	kbs, err := s.Attached(ctx, user, conversationID)
+	if err != nil {
+		return false, err
+	}
+	for _, kb := range kbs {
+		files, err := s.queries.ListKnowledgeBaseFiles(ctx, kb.ID)
+		if err != nil {
+			return false, fmt.Errorf("failed to list files: %w", err)
+		}
+		for _, file := range files {
+			if file.ID == fileID {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
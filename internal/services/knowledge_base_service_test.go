@@ -0,0 +1,114 @@
+package services_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gochat/internal/services"
+	"gochat/internal/store"
+	"strings"
+	"testing"
+)
+
+func TestKnowledgeBaseService(t *testing.T) {
+	ctx := context.Background()
+	accountService := services.NewAccountService(testStore)
+	userService := services.NewUserService(testStore)
+	kbService := services.NewKnowledgeBaseService(testStore)
+	account := createTestAccount(t, accountService)
+
+	domain := strings.ReplaceAll(account.ID, "-", "") + ".com"
+	_, err := userService.Import(ctx, account.ID, strings.NewReader(
+		"email,name,role\n"+
+			"anna@"+domain+",Anna,account_admin\n"+
+			"bert@"+domain+",Bert,\n",
+	))
+	assert.NoError(t, err)
+	users, _, err := userService.List(ctx, account.ID, services.PageParams{})
+	assert.NoError(t, err)
+	anna, err := userService.Get(ctx, users[0].ID)
+	assert.NoError(t, err)
+	bert, err := userService.Get(ctx, users[1].ID)
+	assert.NoError(t, err)
+
+	// Only account admins create knowledge bases for the whole account
+	_, err = kbService.Create(ctx, bert, services.KnowledgeBaseParams{Name: "Handbook", Scope: services.KnowledgeBaseScopeAccount})
+	assert.ErrorIs(t, err, services.ErrKnowledgeBaseReadOnly)
+	shared, err := kbService.Create(ctx, anna, services.KnowledgeBaseParams{Name: "Handbook", Scope: services.KnowledgeBaseScopeAccount})
+	assert.NoError(t, err)
+	own, err := kbService.Create(ctx, bert, services.KnowledgeBaseParams{Name: " Notes "})
+	assert.NoError(t, err)
+	assert.Equal(t, "Notes", own.Name)
+	assert.Equal(t, services.KnowledgeBaseScopeUser, own.Scope)
+	assert.Equal(t, "kb_"+strings.ReplaceAll(own.ID, "-", "_"), own.Partition)
+
+	kbs, err := kbService.List(ctx, bert)
+	assert.NoError(t, err)
+	assert.Len(t, kbs, 2)
+	kbs, err = kbService.List(ctx, anna)
+	assert.NoError(t, err)
+	assert.Len(t, kbs, 1)
+
+	// Members read the account's knowledge bases, other users' ones don't exist for them
+	_, err = kbService.Update(ctx, bert, shared.ID, "Mine now", "")
+	assert.ErrorIs(t, err, services.ErrKnowledgeBaseReadOnly)
+	_, err = kbService.Get(ctx, anna, own.ID)
+	assert.ErrorIs(t, err, services.ErrKnowledgeBaseNotFound)
+	updated, err := kbService.Update(ctx, anna, shared.ID, "Employee handbook", "Policies")
+	assert.NoError(t, err)
+	assert.Equal(t, "Policies", updated.Description)
+
+	// Files are added by their owner only
+	blobs, err := store.NewFSBlobStore(t.TempDir())
+	assert.NoError(t, err)
+	file, err := newFileService(t, blobs, bert.ID).Create(ctx, services.FileUpload{Name: "notes.txt", Size: -1}, strings.NewReader("notes"))
+	assert.NoError(t, err)
+	_, err = kbService.AddFile(ctx, anna, shared.ID, file.ID)
+	assert.ErrorIs(t, err, services.ErrFileNotFound)
+	_, err = kbService.AddFile(ctx, bert, own.ID, file.ID)
+	assert.NoError(t, err)
+	files, err := kbService.ListFiles(ctx, bert, own.ID)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, "notes.txt", files[0].Name)
+	assert.NoError(t, kbService.RemoveFile(ctx, bert, own.ID, file.ID))
+	assert.ErrorIs(t, kbService.RemoveFile(ctx, bert, own.ID, file.ID), services.ErrFileNotFound)
+
+	// Attachments are per user
+	assert.NoError(t, kbService.Attach(ctx, bert, "conv-1", shared.ID))
+	assert.NoError(t, kbService.Attach(ctx, bert, "conv-1", own.ID))
+	assert.ErrorIs(t, kbService.Attach(ctx, anna, "conv-1", own.ID), services.ErrKnowledgeBaseNotFound)
+	attached, err := kbService.Attached(ctx, bert, "conv-1")
+	assert.NoError(t, err)
+	assert.Len(t, attached, 2)
+	attached, err = kbService.Attached(ctx, anna, "conv-1")
+	assert.NoError(t, err)
+	assert.Empty(t, attached)
+
+	// A conversation searches the files of its knowledge bases
+	_, err = kbService.AddFile(ctx, bert, own.ID, file.ID)
+	assert.NoError(t, err)
+	searches, err := kbService.Searches(ctx, bert, "conv-1", file.ID)
+	assert.NoError(t, err)
+	assert.True(t, searches)
+	searches, err = kbService.Searches(ctx, bert, "conv-2", file.ID)
+	assert.NoError(t, err)
+	assert.False(t, searches)
+
+	assert.NoError(t, kbService.Detach(ctx, bert, "conv-1", own.ID))
+	assert.ErrorIs(t, kbService.Detach(ctx, bert, "conv-1", own.ID), services.ErrKnowledgeBaseNotFound)
+	searches, err = kbService.Searches(ctx, bert, "conv-1", file.ID)
+	assert.NoError(t, err)
+	assert.False(t, searches)
+
+	// Deleting detaches it from conversations
+	_, err = kbService.Delete(ctx, anna, shared.ID)
+	assert.NoError(t, err)
+	attached, err = kbService.Attached(ctx, bert, "conv-1")
+	assert.NoError(t, err)
+	assert.Empty(t, attached)
+
+	// The rest goes with the account
+	assert.NoError(t, accountService.Delete(ctx, account.ID))
+	_, err = kbService.Get(ctx, bert, own.ID)
+	assert.ErrorIs(t, err, services.ErrKnowledgeBaseNotFound)
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"gochat/internal/schema"
+	"gochat/internal/store"
+	"gochat/pkg/utils"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Provider IDs end up in the callback URL, so keep them url safe
+var oidcProviderIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+
+type OIDCProviderService struct {
+	queries store.Store
+}
+
+type OIDCProviderParams struct {
+	ID           string
+	AccountID    string
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// OIDCProviderConfig is a provider with its credentials resolved
+type OIDCProviderConfig struct {
+	ID           string   `json:"id"`
+	AccountID    string   `json:"accountId"`
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"clientId"`
+	ClientSecret string   `json:"-"`
+	Scopes       []string `json:"scopes"`
+}
+
+func NewOIDCProviderService(s store.Store) *OIDCProviderService {
+	return &OIDCProviderService{queries: s}
+}
+
+// resolveCredential allows credentials to be stored as env:NAME, so secrets don't have to live in the database
+func resolveCredential(value string) string {
+	if name, found := strings.CutPrefix(value, "env:"); found {
+		return os.Getenv(name)
+	}
+	return value
+}
+
+func toOIDCProviderConfig(p schema.OidcProvider) *OIDCProviderConfig {
+	return &OIDCProviderConfig{
+		ID:           p.ID,
+		AccountID:    p.Account.String,
+		Name:         p.Name,
+		Issuer:       strings.TrimSuffix(p.Issuer, "/"),
+		ClientID:     resolveCredential(p.Clientid),
+		ClientSecret: resolveCredential(p.Clientsecret),
+		Scopes:       strings.Fields(p.Scopes),
+	}
+}
+
+// Get returns the provider, or nil when it does not exist
+func (s *OIDCProviderService) Get(ctx context.Context, id string) (*OIDCProviderConfig, error) {
+	provider, err := s.queries.GetOidcProvider(ctx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get oidc provider: %w", err)
+	}
+	return toOIDCProviderConfig(provider), nil
+}
+
+func (s *OIDCProviderService) ListForAccount(ctx context.Context, accountID string) ([]OIDCProviderConfig, error) {
+	providers, err := s.queries.ListOidcProvidersByAccount(ctx, utils.StringToNullString(accountID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list oidc providers: %w", err)
+	}
+	result := make([]OIDCProviderConfig, 0, len(providers))
+	for _, p := range providers {
+		result = append(result, *toOIDCProviderConfig(p))
+	}
+	return result, nil
+}
+
+// GetForEmail returns the identity provider of the account the email's domain belongs to, or nil
+func (s *OIDCProviderService) GetForEmail(ctx context.Context, email string) (*OIDCProviderConfig, error) {
+	domain, err := getDomain(email)
+	if err != nil {
+		return nil, err
+	}
+	account, err := s.queries.GetAccountByDomain(ctx, domain)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+	providers, err := s.ListForAccount(ctx, account.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(providers) == 0 {
+		return nil, nil
+	}
+	return &providers[0], nil
+}
+
+func (s *OIDCProviderService) Create(ctx context.Context, params OIDCProviderParams) (*OIDCProviderConfig, error) {
+	if !oidcProviderIDPattern.MatchString(params.ID) {
+		return nil, fmt.Errorf("invalid provider id: %s", params.ID)
+	}
+	if !strings.HasPrefix(params.Issuer, "https://") && !strings.HasPrefix(params.Issuer, "http://localhost") {
+		return nil, fmt.Errorf("issuer must be an https url")
+	}
+	if params.ClientID == "" {
+		return nil, fmt.Errorf("client id is required")
+	}
+
+	scopes := params.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+
+	provider, err := s.queries.CreateOidcProvider(ctx, schema.CreateOidcProviderParams{
+		ID:           params.ID,
+		Account:      utils.StringToNullString(params.AccountID),
+		Name:         params.Name,
+		Issuer:       params.Issuer,
+		Clientid:     params.ClientID,
+		Clientsecret: params.ClientSecret,
+		Scopes:       strings.Join(scopes, " "),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create oidc provider: %w", err)
+	}
+	return toOIDCProviderConfig(provider), nil
+}
+
+func (s *OIDCProviderService) Delete(ctx context.Context, id string) error {
+	if err := s.queries.DeleteOidcProvider(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete oidc provider: %w", err)
+	}
+	return nil
+}
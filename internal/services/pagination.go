@@ -0,0 +1,40 @@
+package services
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// PageParams selects a page of a list, pages start at 1
+type PageParams struct {
+	Page     int
+	PageSize int
+	// Search matches anywhere in the searchable columns
+	Search string
+}
+
+// Normalized fills in defaults and caps the page size
+func (p PageParams) Normalized() PageParams {
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	if p.PageSize < 1 {
+		p.PageSize = defaultPageSize
+	}
+	if p.PageSize > maxPageSize {
+		p.PageSize = maxPageSize
+	}
+	return p
+}
+
+func (p PageParams) limit() int64 {
+	return int64(p.PageSize)
+}
+
+func (p PageParams) offset() int64 {
+	return int64((p.Page - 1) * p.PageSize)
+}
+
+func (p PageParams) searchPattern() string {
+	return "%" + p.Search + "%"
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gochat/internal/schema"
+	"gochat/internal/store"
+	"time"
+)
+
+// Event timestamps are written by sqlite's datetime('now')
+const eventTimeLayout = "2006-01-02 15:04:05"
+
+// ReportService answers operational questions across all accounts, it is used by gochatctl
+type ReportService struct {
+	queries store.Store
+}
+
+type EventFilter struct {
+	UserID string
+	Event  EventType
+	Since  time.Time
+	Limit  int
+}
+
+type EventDto struct {
+	ID        int64           `json:"id"`
+	Event     string          `json:"event"`
+	Timestamp string          `json:"timestamp"`
+	UserID    string          `json:"userId"`
+	Metadata  json.RawMessage `json:"metadata"`
+}
+
+type AccountUsage struct {
+	AccountID   string `json:"accountId"`
+	AccountName string `json:"accountName"`
+	Messages    int64  `json:"messages"`
+	ActiveUsers int64  `json:"activeUsers"`
+}
+
+func NewReportService(s store.Store) *ReportService {
+	return &ReportService{queries: s}
+}
+
+// Events returns the newest events matching the filter
+func (s *ReportService) Events(ctx context.Context, filter EventFilter) ([]EventDto, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	events, err := s.queries.ListEvents(ctx, schema.ListEventsParams{
+		User:  filter.UserID,
+		Event: string(filter.Event),
+		Since: filter.Since.UTC().Format(eventTimeLayout),
+		Limit: int64(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	result := make([]EventDto, 0, len(events))
+	for _, e := range events {
+		var metadata json.RawMessage
+		switch m := e.Metadata.(type) {
+		case []byte:
+			metadata = m
+		case string:
+			metadata = json.RawMessage(m)
+		}
+		if !json.Valid(metadata) {
+			metadata = json.RawMessage("null")
+		}
+		result = append(result, EventDto{
+			ID:        e.ID,
+			Event:     e.Event,
+			Timestamp: e.Timestamp,
+			UserID:    e.User,
+			Metadata:  metadata,
+		})
+	}
+	return result, nil
+}
+
+// Usage counts the messages and active users per account in [since, until)
+func (s *ReportService) Usage(ctx context.Context, since time.Time, until time.Time) ([]AccountUsage, error) {
+	rows, err := s.queries.UsageByAccount(ctx, schema.UsageByAccountParams{
+		Since: since.UTC().Format(eventTimeLayout),
+		Until: until.UTC().Format(eventTimeLayout),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	result := make([]AccountUsage, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, AccountUsage{
+			AccountID:   row.AccountID,
+			AccountName: row.AccountName,
+			Messages:    row.Messages,
+			ActiveUsers: row.ActiveUsers,
+		})
+	}
+	return result, nil
+}
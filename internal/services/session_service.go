@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gochat/internal/schema"
+	"gochat/internal/store"
+	"gochat/pkg/utils"
+	"strings"
+	"time"
+)
+
+const (
+	SessionTTL = 30 * 24 * time.Hour
+	// Parallel requests can race to rotate the same refresh token, the losers get this much slack
+	sessionRotationGrace = time.Minute
+)
+
+var (
+	ErrSessionInvalid = errors.New("invalid session")
+	ErrSessionExpired = errors.New("session expired")
+	ErrSessionRevoked = errors.New("session revoked")
+)
+
+type SessionService struct {
+	queries store.Store
+}
+
+type SessionParams struct {
+	UserAgent string
+	IP        string
+}
+
+func NewSessionService(s store.Store) *SessionService {
+	return &SessionService{queries: s}
+}
+
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Refresh tokens look like <sessionID>.<secret>, so we can find the session without storing the secret
+func splitRefreshToken(token string) (string, string, error) {
+	sessionID, secret, found := strings.Cut(token, ".")
+	if !found || sessionID == "" || secret == "" {
+		return "", "", ErrSessionInvalid
+	}
+	return sessionID, secret, nil
+}
+
+func sessionExpiry() string {
+	return time.Now().UTC().Add(SessionTTL).Format(time.RFC3339)
+}
+
+func checkSession(session schema.Session) error {
+	if session.Revokedat.Valid {
+		return ErrSessionRevoked
+	}
+	expiresAt, err := time.Parse(time.RFC3339, session.Expiresat)
+	if err != nil || time.Now().After(expiresAt) {
+		return ErrSessionExpired
+	}
+	return nil
+}
+
+// Create starts a new session for the user and returns its first refresh token
+func (s *SessionService) Create(ctx context.Context, userID string, params SessionParams) (*schema.Session, string, error) {
+	secret, err := generateSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	session, err := s.queries.CreateSession(ctx, schema.CreateSessionParams{
+		ID:          uuid.New().String(),
+		User:        userID,
+		Refreshhash: hashSecret(secret),
+		Useragent:   utils.StringToNullString(params.UserAgent),
+		Ip:          utils.StringToNullString(params.IP),
+		Expiresat:   sessionExpiry(),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return &session, session.ID + "." + secret, nil
+}
+
+// Rotate exchanges a refresh token for a new one. Presenting an already rotated token outside
+// the grace period is treated as theft and revokes the whole session.
+// When the new refresh token is empty the caller lost a rotation race and should only renew the access token.
+func (s *SessionService) Rotate(ctx context.Context, refreshToken string) (*schema.Session, string, error) {
+	sessionID, secret, err := splitRefreshToken(refreshToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	session, err := s.queries.GetSession(ctx, sessionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, "", ErrSessionInvalid
+		}
+		return nil, "", fmt.Errorf("failed to get session: %w", err)
+	}
+	if err := checkSession(session); err != nil {
+		return nil, "", err
+	}
+
+	presentedHash := hashSecret(secret)
+	if subtle.ConstantTimeCompare([]byte(presentedHash), []byte(session.Refreshhash)) != 1 {
+		if session.Previousrefreshhash.Valid &&
+			subtle.ConstantTimeCompare([]byte(presentedHash), []byte(session.Previousrefreshhash.String)) == 1 &&
+			rotatedRecently(session) {
+			return &session, "", nil
+		}
+
+		fmt.Printf("refresh token reuse detected for session %s, revoking\n", session.ID)
+		if err := s.Revoke(ctx, session.ID); err != nil {
+			fmt.Println(err)
+		}
+		return nil, "", ErrSessionRevoked
+	}
+
+	newSecret, err := generateSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	affected, err := s.queries.RotateSession(ctx, schema.RotateSessionParams{
+		Newhash:     hashSecret(newSecret),
+		Rotatedat:   utils.GetTime(),
+		Expiresat:   sessionExpiry(),
+		ID:          session.ID,
+		Currenthash: presentedHash,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to rotate session: %w", err)
+	}
+	if affected == 0 {
+		// Someone else rotated in between our read and write
+		return &session, "", nil
+	}
+
+	return &session, session.ID + "." + newSecret, nil
+}
+
+func rotatedRecently(session schema.Session) bool {
+	if !session.Rotatedat.Valid {
+		return false
+	}
+	rotatedAt, err := time.Parse(time.RFC3339, session.Rotatedat.String)
+	if err != nil {
+		return false
+	}
+	return time.Since(rotatedAt) < sessionRotationGrace
+}
+
+// Validate checks that the session exists, belongs to the user and has not been revoked
+func (s *SessionService) Validate(ctx context.Context, sessionID string, userID string) error {
+	session, err := s.queries.GetSession(ctx, sessionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrSessionInvalid
+		}
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+	if session.User != userID {
+		return ErrSessionInvalid
+	}
+	return checkSession(session)
+}
+
+// RevokeByRefreshToken revokes the session the refresh token belongs to, used when logging out
+func (s *SessionService) RevokeByRefreshToken(ctx context.Context, refreshToken string) error {
+	sessionID, secret, err := splitRefreshToken(refreshToken)
+	if err != nil {
+		return err
+	}
+	session, err := s.queries.GetSession(ctx, sessionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrSessionInvalid
+		}
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+
+	presentedHash := hashSecret(secret)
+	if presentedHash != session.Refreshhash && presentedHash != session.Previousrefreshhash.String {
+		return ErrSessionInvalid
+	}
+	return s.Revoke(ctx, session.ID)
+}
+
+func (s *SessionService) Revoke(ctx context.Context, sessionID string) error {
+	err := s.queries.RevokeSession(ctx, schema.RevokeSessionParams{
+		Revokedat: utils.GetTime(),
+		ID:        sessionID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// RevokeAllForUser logs the user out on every device, returns the number of sessions revoked
+func (s *SessionService) RevokeAllForUser(ctx context.Context, userID string) (int64, error) {
+	affected, err := s.queries.RevokeUserSessions(ctx, schema.RevokeUserSessionsParams{
+		Revokedat: utils.GetTime(),
+		User:      userID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return affected, nil
+}
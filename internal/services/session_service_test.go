@@ -0,0 +1,57 @@
+package services_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gochat/internal/services"
+	"testing"
+)
+
+func TestSessionService_Rotate(t *testing.T) {
+	ctx := context.Background()
+	testUserID := "1234abcd"
+
+	sessionService := services.NewSessionService(testStore)
+	assert.NotNil(t, sessionService)
+
+	session, refreshToken, err := sessionService.Create(ctx, testUserID, services.SessionParams{})
+	assert.NoError(t, err)
+	assert.NoError(t, sessionService.Validate(ctx, session.ID, testUserID))
+
+	// Rotating gives a new refresh token for the same session
+	rotated, newRefreshToken, err := sessionService.Rotate(ctx, refreshToken)
+	assert.NoError(t, err)
+	assert.Equal(t, session.ID, rotated.ID)
+	assert.NotEmpty(t, newRefreshToken)
+	assert.NotEqual(t, refreshToken, newRefreshToken)
+
+	// A parallel request with the old token is still let through, but gets no new refresh token
+	_, raceRefreshToken, err := sessionService.Rotate(ctx, refreshToken)
+	assert.NoError(t, err)
+	assert.Empty(t, raceRefreshToken)
+
+	// Reusing a token from two rotations ago revokes the session
+	_, _, err = sessionService.Rotate(ctx, newRefreshToken)
+	assert.NoError(t, err)
+	_, _, err = sessionService.Rotate(ctx, refreshToken)
+	assert.ErrorIs(t, err, services.ErrSessionRevoked)
+	assert.ErrorIs(t, sessionService.Validate(ctx, session.ID, testUserID), services.ErrSessionRevoked)
+}
+
+func TestSessionService_RevokeAllForUser(t *testing.T) {
+	ctx := context.Background()
+	testUserID := "1234abcd"
+
+	sessionService := services.NewSessionService(testStore)
+	first, _, err := sessionService.Create(ctx, testUserID, services.SessionParams{})
+	assert.NoError(t, err)
+	second, _, err := sessionService.Create(ctx, testUserID, services.SessionParams{})
+	assert.NoError(t, err)
+
+	revoked, err := sessionService.RevokeAllForUser(ctx, testUserID)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, revoked, int64(2))
+
+	assert.ErrorIs(t, sessionService.Validate(ctx, first.ID, testUserID), services.ErrSessionRevoked)
+	assert.ErrorIs(t, sessionService.Validate(ctx, second.ID, testUserID), services.ErrSessionRevoked)
+}
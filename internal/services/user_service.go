@@ -3,11 +3,14 @@ package services
 import (
 	"context"
 	"database/sql"
+	"encoding/csv"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
-	database "gochat/internal/db"
 	"gochat/internal/schema"
+	"gochat/internal/store"
 	"gochat/pkg/utils"
+	"io"
 	"strings"
 )
 
@@ -15,15 +18,51 @@ type UserParams struct {
 	Name       *string
 	Email      string
 	ExternalID *string
+	// AccountID skips the email domain lookup, used when the identity provider belongs to an account
+	AccountID *string
+	// EmailVerified is set when the identity provider vouches for Email, GetOrCreate only links a login
+	// to an existing user or an account by email when it is
+	EmailVerified bool
 }
 
 type UserSearchParams struct {
 }
 
+// Role determines what a user may manage besides their own conversations
+type Role string
+
+const (
+	RolePlatformAdmin Role = "platform_admin"
+	RoleAccountAdmin  Role = "account_admin"
+	RoleMember        Role = "member"
+)
+
+// IsValid checks if the role is known
+func (r Role) IsValid() bool {
+	switch r {
+	case RolePlatformAdmin, RoleAccountAdmin, RoleMember:
+		return true
+	}
+	return false
+}
+
+var ErrUserDisabled = errors.New("your account has been disabled")
+
+// ErrEmailNotVerified is returned when a new login can only be matched by an email address the
+// identity provider did not verify
+var ErrEmailNotVerified = errors.New("your identity provider did not verify your email address")
+
 type UserService struct {
-	queries *schema.Queries
+	queries store.Store
+	// blobs holds the originals of the files of deleted users, nil leaves them
+	blobs store.BlobStore
+	// removeVectors drops the vectors of the files of deleted users, nil leaves them
+	removeVectors VectorCleanup
 }
 
+// VectorCleanup removes the vectors of deleted files from every partition, rag.RemoveFiles does
+type VectorCleanup func(ctx context.Context, account string, fileIDs []string) error
+
 func getDomain(email string) (string, error) {
 	// Split the email address at the '@' symbol
 	parts := strings.Split(email, "@")
@@ -33,13 +72,20 @@ func getDomain(email string) (string, error) {
 	return parts[1], nil
 }
 
-func NewUserService() *UserService {
-	queries, _, err := database.Init()
-	if err != nil {
-		fmt.Println("Error initializing queries for user service: " + err.Error())
-		return nil
-	}
-	return &UserService{queries: queries}
+func NewUserService(s store.Store) *UserService {
+	return &UserService{queries: s}
+}
+
+// WithBlobs lets Delete remove the originals of the user's files
+func (us *UserService) WithBlobs(blobs store.BlobStore) *UserService {
+	us.blobs = blobs
+	return us
+}
+
+// WithVectorCleanup lets Delete remove the vectors of the user's files
+func (us *UserService) WithVectorCleanup(cleanup VectorCleanup) *UserService {
+	us.removeVectors = cleanup
+	return us
 }
 
 func (us *UserService) getAccountFromEmail(ctx context.Context, email string) (*schema.GetAccountByDomainRow, error) {
@@ -63,16 +109,22 @@ func (us *UserService) getAccountFromEmail(ctx context.Context, email string) (*
 }
 
 func (us *UserService) Create(ctx context.Context, params UserParams) (*schema.User, error) {
-	account, err := us.getAccountFromEmail(ctx, params.Email)
-	if err != nil {
-		fmt.Println("error getting account from email: " + err.Error())
-		return nil, fmt.Errorf("error getting account by domain: %s", err.Error())
+	var accountID string
+	if params.AccountID != nil {
+		accountID = *params.AccountID
+	} else {
+		account, err := us.getAccountFromEmail(ctx, params.Email)
+		if err != nil {
+			fmt.Println("error getting account from email: " + err.Error())
+			return nil, fmt.Errorf("error getting account by domain: %s", err.Error())
+		}
+		if account != nil {
+			accountID = account.ID
+		}
 	}
 
-
-
-	if account == nil {
-		eventService := NewEventService("")
+	if accountID == "" {
+		eventService := NewEventService(us.queries, "")
 		eventService.Create(UnknownAccount, map[string]interface{}{
 			"email":  params.Email,
 			"status": "error",
@@ -83,7 +135,7 @@ func (us *UserService) Create(ctx context.Context, params UserParams) (*schema.U
 	user := schema.CreateUserParams{
 		ID:      uuid.New().String(),
 		Email:   params.Email,
-		Account: account.ID,
+		Account: accountID,
 	}
 
 	if params.Name != nil {
@@ -111,7 +163,11 @@ type UserDto struct {
 	Email     string `json:"email"`
 	Name      string `json:"name"`
 	ExternalID string `json:"external_id"`
+	Role      Role   `json:"role"`
+	Disabled  bool   `json:"disabled"`
 	Account AccountDto
+	// Set when an admin is acting as this user, the views show a banner for it
+	Impersonation *ImpersonationDto `json:"impersonation,omitempty"`
 }
 
 func (us *UserService) Get(ctx context.Context, id string) (*UserDto, error) {
@@ -133,6 +189,8 @@ func (us *UserService) Get(ctx context.Context, id string) (*UserDto, error) {
 		Email:      user.Email,
 		Name:       user.Name.String,
 		ExternalID: user.Externalid.String,
+		Role:       Role(user.Role),
+		Disabled:   user.Disabledat.Valid,
 		Account:    AccountDto{
 			ID:   account.ID,
 			Name: account.Name,
@@ -159,23 +217,46 @@ func (us *UserService) GetUserByEmail(ctx context.Context, email string) (*schem
 
 }
 
+// GetOrCreate returns the user who logged in with an identity provider. A returning user is found by
+// the provider's id. The email only links a first login to an existing user, or puts a new user in
+// the account of its domain, when the provider verified it.
 func (us *UserService) GetOrCreate(ctx context.Context, params UserParams) (*schema.User, error) {
 	externalID := *params.ExternalID
-	var user *schema.User
 	// Until we have our own login
 	if externalID == "" {
 		return nil, fmt.Errorf("externalID is required")
 	}
 
-	userResponse, err := us.GetUserByEmail(ctx, params.Email)
+	userResponse, err := us.queries.GetUserByExternalID(ctx, utils.StringToNullString(externalID))
+	if err == nil {
+		return us.checkLogin(&userResponse, params)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get user by external id: %w", err)
+	}
+
+	if !params.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+	existing, err := us.GetUserByEmail(ctx, params.Email)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user by email: iw", err)
+		return nil, fmt.Errorf("failed to get user by email: %w", err)
 	}
-	if userResponse != nil {
-		return userResponse, nil
+	if existing != nil {
+		if _, err := us.checkLogin(existing, params); err != nil {
+			return nil, err
+		}
+		if err := us.queries.SetUserExternalID(ctx, schema.SetUserExternalIDParams{
+			Externalid: utils.StringToNullString(externalID),
+			ID:         existing.ID,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to link user: %w", err)
+		}
+		existing.Externalid = utils.StringToNullString(externalID)
+		return existing, nil
 	}
 
-	user, err = us.Create(ctx, params)
+	user, err := us.Create(ctx, params)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
@@ -183,3 +264,317 @@ func (us *UserService) GetOrCreate(ctx context.Context, params UserParams) (*sch
 
 	return user, nil
 }
+
+// checkLogin refuses users who are disabled, or who belong to another account than the identity
+// provider they logged in with
+func (us *UserService) checkLogin(user *schema.User, params UserParams) (*schema.User, error) {
+	// An account's own identity provider may only log in users of that account
+	if params.AccountID != nil && user.Account != *params.AccountID {
+		return nil, fmt.Errorf("user does not belong to this identity provider's account")
+	}
+	if user.Disabledat.Valid {
+		return nil, ErrUserDisabled
+	}
+	return user, nil
+}
+
+func toUserDto(user schema.User, account AccountDto) UserDto {
+	return UserDto{
+		ID:         user.ID,
+		Email:      user.Email,
+		Name:       user.Name.String,
+		ExternalID: user.Externalid.String,
+		Role:       Role(user.Role),
+		Disabled:   user.Disabledat.Valid,
+		Account:    account,
+	}
+}
+
+// ListByAccount returns all users of an account
+func (us *UserService) ListByAccount(ctx context.Context, accountID string) ([]UserDto, error) {
+	account, err := us.queries.GetAccount(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+	users, err := us.queries.ListUsersByAccount(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	result := make([]UserDto, 0, len(users))
+	for _, user := range users {
+		result = append(result, toUserDto(user, AccountDto{ID: account.ID, Name: account.Name}))
+	}
+	return result, nil
+}
+
+// SetRole changes the user's role, returns sql.ErrNoRows when the user does not exist
+func (us *UserService) SetRole(ctx context.Context, userID string, role Role) error {
+	if !role.IsValid() {
+		return fmt.Errorf("invalid role: %s", role)
+	}
+	affected, err := us.queries.UpdateUserRole(ctx, schema.UpdateUserRoleParams{
+		Role: string(role),
+		ID:   userID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// List returns a page of users, optionally limited to one account
+func (us *UserService) List(ctx context.Context, accountID string, params PageParams) ([]UserDto, int64, error) {
+	params = params.Normalized()
+	users, err := us.queries.ListUsersPage(ctx, schema.ListUsersPageParams{
+		Account: accountID,
+		Search:  params.searchPattern(),
+		Limit:   params.limit(),
+		Offset:  params.offset(),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+	total, err := us.queries.CountUsers(ctx, schema.CountUsersParams{
+		Account: accountID,
+		Search:  params.searchPattern(),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	result := make([]UserDto, 0, len(users))
+	for _, user := range users {
+		result = append(result, toUserDto(user, AccountDto{ID: user.Account}))
+	}
+	return result, total, nil
+}
+
+// Disable blocks the user from logging in and ends their sessions and api keys
+func (us *UserService) Disable(ctx context.Context, userID string) error {
+	return us.queries.InTx(ctx, func(q schema.Querier) error {
+		affected, err := q.DisableUser(ctx, schema.DisableUserParams{
+			Disabledat: utils.GetTime(),
+			ID:         userID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to disable user: %w", err)
+		}
+		if affected == 0 {
+			return sql.ErrNoRows
+		}
+		if _, err := q.RevokeUserSessions(ctx, schema.RevokeUserSessionsParams{Revokedat: utils.GetTime(), User: userID}); err != nil {
+			return fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+		if _, err := q.RevokeUserApiKeys(ctx, schema.RevokeUserApiKeysParams{Revokedat: utils.GetTime(), User: userID}); err != nil {
+			return fmt.Errorf("failed to revoke api keys: %w", err)
+		}
+		return nil
+	})
+}
+
+// Enable lets a disabled user log in again, revoked sessions and api keys stay revoked
+func (us *UserService) Enable(ctx context.Context, userID string) error {
+	affected, err := us.queries.EnableUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to enable user: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Delete removes the user and everything that belongs to them, returns sql.ErrNoRows when the user does not exist
+func (us *UserService) Delete(ctx context.Context, userID string) error {
+	var account string
+	var files []schema.File
+	err := us.queries.InTx(ctx, func(q schema.Querier) error {
+		user, err := q.GetUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		account = user.Account
+		affected, userFiles, err := deleteUser(ctx, q, userID)
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return sql.ErrNoRows
+		}
+		files = userFiles
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	removeDeletedFiles(ctx, us.blobs, us.removeVectors, account, files)
+	return nil
+}
+
+// deleteUser deletes the rows that reference the user, then the user. It returns the deleted files, their
+// vectors and originals are removed by the caller once the transaction is committed.
+func deleteUser(ctx context.Context, q schema.Querier, userID string) (int64, []schema.File, error) {
+	files, err := q.ListUserFiles(ctx, userID)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to list files of user: %w", err)
+	}
+	steps := []struct {
+		name string
+		run  func(context.Context, string) error
+	}{
+		{"events", q.DeleteUserEvents},
+		{"knowledge base attachments", q.DeleteUserConversationKnowledgeBases},
+		{"knowledge base files", q.DeleteUserKnowledgeBaseFiles},
+		{"knowledge bases", func(ctx context.Context, userID string) error {
+			return q.DeleteUserKnowledgeBases(ctx, utils.StringToNullString(userID))
+		}},
+		{"file tags", q.DeleteUserFileTags},
+		{"file summaries", q.DeleteUserFileSummaries},
+		{"extraction results", q.DeleteUserExtractionResults},
+		{"extractions", q.DeleteUserExtractions},
+		{"files", q.DeleteUserFiles},
+		{"conversations", q.DeleteUserConversations},
+		{"api keys", q.DeleteUserApiKeys},
+		{"impersonations", q.DeleteUserImpersonations},
+		{"sessions", q.DeleteUserSessions},
+	}
+	for _, step := range steps {
+		if err := step.run(ctx, userID); err != nil {
+			return 0, nil, fmt.Errorf("failed to delete %s of user: %w", step.name, err)
+		}
+	}
+
+	affected, err := q.DeleteUser(ctx, userID)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to delete user: %w", err)
+	}
+	return affected, files, nil
+}
+
+// removeDeletedFiles removes what is kept of deleted files outside the database, their vectors and
+// originals. The rows are gone already, what can't be removed is logged and left behind.
+func removeDeletedFiles(ctx context.Context, blobs store.BlobStore, removeVectors VectorCleanup, account string, files []schema.File) {
+	if removeVectors != nil {
+		ids := make([]string, len(files))
+		for i, file := range files {
+			ids[i] = file.ID
+		}
+		if err := removeVectors(ctx, account, ids); err != nil {
+			fmt.Println("failed to remove vectors of deleted files: " + err.Error())
+		}
+	}
+	if blobs == nil {
+		return
+	}
+	for _, file := range files {
+		if file.Hash == "" {
+			continue
+		}
+		if err := blobs.Delete(ctx, FileBlobKey(file.Owner, file.ID)); err != nil && !errors.Is(err, store.ErrBlobNotFound) {
+			fmt.Println("failed to remove stored file: " + err.Error())
+		}
+	}
+}
+
+type UserImportError struct {
+	Line  int    `json:"line"`
+	Email string `json:"email"`
+	Error string `json:"error"`
+}
+
+type UserImportResult struct {
+	Created int               `json:"created"`
+	Skipped int               `json:"skipped"`
+	Errors  []UserImportError `json:"errors"`
+}
+
+// Import creates users in the account from a CSV with a header row. Only the email column is required,
+// name and role are optional. Existing users are skipped, failing rows don't stop the import.
+func (us *UserService) Import(ctx context.Context, accountID string, r io.Reader) (*UserImportResult, error) {
+	if _, err := us.queries.GetAccountById(ctx, accountID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("account not found: %s", accountID)
+		}
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, fmt.Errorf("csv has no email column")
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	result := &UserImportResult{Errors: []UserImportError{}}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to read csv line %d: %w", line, err)
+		}
+
+		email := field(record, "email")
+		fail := func(err error) {
+			result.Errors = append(result.Errors, UserImportError{Line: line, Email: email, Error: err.Error()})
+		}
+		if _, err := getDomain(email); err != nil {
+			fail(err)
+			continue
+		}
+		role := Role(field(record, "role"))
+		if role == "" {
+			role = RoleMember
+		}
+		if !role.IsValid() || role == RolePlatformAdmin {
+			fail(fmt.Errorf("invalid role: %s", role))
+			continue
+		}
+
+		existing, err := us.GetUserByEmail(ctx, email)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		if existing != nil {
+			result.Skipped++
+			continue
+		}
+
+		name := field(record, "name")
+		user, err := us.Create(ctx, UserParams{Email: email, Name: &name, AccountID: &accountID})
+		if err != nil {
+			fail(err)
+			continue
+		}
+		if role != RoleMember {
+			if err := us.SetRole(ctx, user.ID, role); err != nil {
+				fail(err)
+				continue
+			}
+		}
+		result.Created++
+	}
+	return result, nil
+}
@@ -2,18 +2,44 @@ package services_test
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"gochat/internal/services"
+	"gochat/internal/store"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
+// testStore is shared by the tests like the application shares its pool
+var testStore store.Store
+
 func TestMain(m *testing.M) {
-	// Set up shared environment variables or configurations
-	os.Setenv("DB_PATH", "../../database.db")
-	os.Exit(m.Run())
+	// Every run gets a fresh database with the migrations and the seed data
+	dir, err := os.MkdirTemp("", "gochat-services")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	ctx := context.Background()
+	testStore, _, err = store.Open(ctx, store.Config{Driver: store.DriverSQLite, DSN: filepath.Join(dir, "database.db")})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := store.Seed(ctx, testStore); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	testStore.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
 }
 
 func TestUserService_CreateUser(t *testing.T) {
@@ -27,7 +53,7 @@ func TestUserService_CreateUser(t *testing.T) {
 	}
 
 	// New service
-	userService := services.NewUserService()
+	userService := services.NewUserService(testStore)
 	assert.NotNil(t, userService)
 
 	// Create User
@@ -53,7 +79,7 @@ func TestUserService_CreateUser_Account(t *testing.T) {
 	}
 
 	// New service
-	userService := services.NewUserService()
+	userService := services.NewUserService(testStore)
 	assert.NotNil(t, userService)
 
 	// Create User
@@ -74,7 +100,7 @@ func TestUserService_GetUser(t *testing.T) {
 	}
 
 	// New service
-	userService := services.NewUserService()
+	userService := services.NewUserService(testStore)
 
 	// Create a user first
 	createdUser, err := userService.Create(ctx, newUserParams)
@@ -105,7 +131,7 @@ func TestUserService_GetOrCreate_ExistingUser(t *testing.T) {
 	}
 
 	// New service
-	userService := services.NewUserService()
+	userService := services.NewUserService(testStore)
 
 	// Create a user first
 	createdUser, err := userService.Create(ctx, newUserParams)
@@ -124,11 +150,12 @@ func TestUserService_GetOrCreate_NewUser(t *testing.T) {
 	externalID := uuid.New().String()
 
 	// Call GetOrCreate with a new user
-	userService := services.NewUserService()
+	userService := services.NewUserService(testStore)
 	newlyCreated, err := userService.GetOrCreate(ctx, services.UserParams{
-		Name:       nil,
-		Email:      uuid.New().String() + "@test.com",
-		ExternalID: &externalID,
+		Name:          nil,
+		Email:         uuid.New().String() + "@test.com",
+		ExternalID:    &externalID,
+		EmailVerified: true,
 	})
 	assert.NoError(t, err)
 
@@ -137,3 +164,112 @@ func TestUserService_GetOrCreate_NewUser(t *testing.T) {
 	fmt.Println("newly created: ", newlyCreated.ID)
 	assert.Equal(t, externalID, newlyCreated.Externalid.String)
 }
+
+func TestUserService_GetOrCreate_LinksVerifiedEmailOnly(t *testing.T) {
+	ctx := context.Background()
+	externalID := "https://login.example.com/tenant-a#" + uuid.New().String()
+	email := uuid.New().String() + "@test.com"
+	userService := services.NewUserService(testStore)
+	createdUser, err := userService.Create(ctx, services.UserParams{Email: email, ExternalID: &externalID})
+	assert.NoError(t, err)
+
+	// Another tenant claiming the same address is not the same user
+	otherID := "https://login.example.com/tenant-b#" + uuid.New().String()
+	_, err = userService.GetOrCreate(ctx, services.UserParams{Email: email, ExternalID: &otherID})
+	assert.ErrorIs(t, err, services.ErrEmailNotVerified)
+	newID := uuid.New().String()
+	_, err = userService.GetOrCreate(ctx, services.UserParams{Email: newID + "@test.com", ExternalID: &newID})
+	assert.ErrorIs(t, err, services.ErrEmailNotVerified)
+
+	// A verified address links the login, after that it's found by its id
+	linked, err := userService.GetOrCreate(ctx, services.UserParams{Email: email, ExternalID: &otherID, EmailVerified: true})
+	assert.NoError(t, err)
+	assert.Equal(t, createdUser.ID, linked.ID)
+	assert.Equal(t, otherID, linked.Externalid.String)
+	found, err := userService.GetOrCreate(ctx, services.UserParams{Email: "changed@test.com", ExternalID: &otherID})
+	assert.NoError(t, err)
+	assert.Equal(t, createdUser.ID, found.ID)
+}
+
+func TestUserService_SetRole(t *testing.T) {
+	ctx := context.Background()
+	externalID := uuid.New().String()
+
+	userService := services.NewUserService(testStore)
+	createdUser, err := userService.Create(ctx, services.UserParams{
+		Email:      externalID + "@test.com",
+		ExternalID: &externalID,
+	})
+	assert.NoError(t, err)
+
+	// New users are members
+	user, err := userService.Get(ctx, createdUser.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, services.RoleMember, user.Role)
+
+	assert.NoError(t, userService.SetRole(ctx, createdUser.ID, services.RoleAccountAdmin))
+	user, err = userService.Get(ctx, createdUser.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, services.RoleAccountAdmin, user.Role)
+
+	assert.Error(t, userService.SetRole(ctx, createdUser.ID, services.Role("owner")))
+	assert.ErrorIs(t, userService.SetRole(ctx, "idontexist", services.RoleMember), sql.ErrNoRows)
+
+	// The user shows up in the account's user list
+	users, err := userService.ListByAccount(ctx, "A1234")
+	assert.NoError(t, err)
+	assert.Contains(t, users, *user)
+}
+
+func TestUserService_Disable(t *testing.T) {
+	ctx := context.Background()
+	externalID := uuid.New().String()
+	params := services.UserParams{
+		Email:      externalID + "@test.com",
+		ExternalID: &externalID,
+	}
+
+	userService := services.NewUserService(testStore)
+	createdUser, err := userService.Create(ctx, params)
+	assert.NoError(t, err)
+	session, _, err := services.NewSessionService(testStore).Create(ctx, createdUser.ID, services.SessionParams{})
+	assert.NoError(t, err)
+
+	// Disabling logs the user out and blocks logging in again
+	assert.NoError(t, userService.Disable(ctx, createdUser.ID))
+	assert.ErrorIs(t, services.NewSessionService(testStore).Validate(ctx, session.ID, createdUser.ID), services.ErrSessionRevoked)
+	_, err = userService.GetOrCreate(ctx, params)
+	assert.ErrorIs(t, err, services.ErrUserDisabled)
+
+	assert.NoError(t, userService.Enable(ctx, createdUser.ID))
+	_, err = userService.GetOrCreate(ctx, params)
+	assert.NoError(t, err)
+
+	assert.NoError(t, userService.Delete(ctx, createdUser.ID))
+	assert.ErrorIs(t, userService.Delete(ctx, createdUser.ID), sql.ErrNoRows)
+}
+
+func TestUserService_Delete(t *testing.T) {
+	ctx := context.Background()
+	externalID := uuid.New().String()
+	blobs, err := store.NewFSBlobStore(t.TempDir())
+	assert.NoError(t, err)
+	var removed []string
+	userService := services.NewUserService(testStore).WithBlobs(blobs).WithVectorCleanup(func(ctx context.Context, account string, fileIDs []string) error {
+		removed = fileIDs
+		return errors.New("milvus is down")
+	})
+	createdUser, err := userService.Create(ctx, services.UserParams{Email: externalID + "@test.com", ExternalID: &externalID})
+	assert.NoError(t, err)
+	file, err := newFileService(t, blobs, createdUser.ID).Create(ctx, services.FileUpload{Name: "a.txt", Size: -1}, strings.NewReader("a"))
+	assert.NoError(t, err)
+
+	// Vectors that can't be removed don't keep the user around
+	assert.NoError(t, userService.Delete(ctx, createdUser.ID))
+	assert.Equal(t, []string{file.ID}, removed)
+	_, err = blobs.Get(ctx, services.FileBlobKey(createdUser.ID, file.ID))
+	assert.ErrorIs(t, err, store.ErrBlobNotFound)
+	user, err := userService.Get(ctx, createdUser.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+}
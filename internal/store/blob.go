@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore keeps the bytes of uploaded files, the database only has their metadata
+type BlobStore interface {
+	// Put stores r under key, size is -1 when it is unknown
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns ErrBlobNotFound when nothing is stored under key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+type BlobDriver string
+
+const (
+	BlobDriverFS BlobDriver = "fs"
+	BlobDriverS3 BlobDriver = "s3"
+)
+
+type BlobConfig struct {
+	Driver BlobDriver
+	// Path is the root directory of the filesystem backend
+	Path string
+	S3   S3Config
+}
+
+// BlobConfigFromEnv selects S3 with BLOB_DRIVER=s3, the filesystem otherwise. Without BLOB_PATH
+// the files go next to the SQLite database, so they end up on the same volume.
+func BlobConfigFromEnv() BlobConfig {
+	if BlobDriver(os.Getenv("BLOB_DRIVER")) == BlobDriverS3 {
+		return BlobConfig{Driver: BlobDriverS3, S3: S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Insecure:  os.Getenv("S3_INSECURE") == "true",
+		}}
+	}
+	path := os.Getenv("BLOB_PATH")
+	if path == "" {
+		path = filepath.Join(filepath.Dir(os.Getenv("DB_PATH")), "files")
+	}
+	return BlobConfig{Driver: BlobDriverFS, Path: path}
+}
+
+func OpenBlobStore(ctx context.Context, cfg BlobConfig) (BlobStore, error) {
+	switch cfg.Driver {
+	case BlobDriverFS:
+		return NewFSBlobStore(cfg.Path)
+	case BlobDriverS3:
+		return NewS3BlobStore(ctx, cfg.S3)
+	}
+	return nil, fmt.Errorf("unknown blob driver %q", cfg.Driver)
+}
+
+// validBlobKey keeps keys usable as relative paths, they may never point outside the store
+func validBlobKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid blob key %q", key)
+		}
+	}
+	return nil
+}
+
+type fsBlobStore struct {
+	root string
+}
+
+func NewFSBlobStore(root string) (BlobStore, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &fsBlobStore{root: root}, nil
+}
+
+func (s *fsBlobStore) path(key string) (string, error) {
+	if err := validBlobKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file first, a failed upload never leaves half a file under key
+func (s *fsBlobStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *fsBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	return f, err
+}
+
+func (s *fsBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
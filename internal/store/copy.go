@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// copyTables lists the tables in foreign key order. SQLite databases from before foreign keys were
+// switched on can hold rows pointing at nothing, Postgres refuses those, so they are skipped.
+var copyTables = []struct {
+	name    string
+	orphans string
+}{
+	{"account", ""},
+	{"account_domain", `account NOT IN (SELECT id FROM account)`},
+	{"domain_claim", `account NOT IN (SELECT id FROM account)`},
+	{"user", `account NOT IN (SELECT id FROM account)`},
+	{"session", `user NOT IN (SELECT id FROM user)`},
+	{"api_key", `user NOT IN (SELECT id FROM user)`},
+	{"oidc_provider", `account IS NOT NULL AND account NOT IN (SELECT id FROM account)`},
+	{"impersonation", `actor NOT IN (SELECT id FROM user) OR user NOT IN (SELECT id FROM user) OR session NOT IN (SELECT id FROM session)`},
+	{"event", `user NOT IN (SELECT id FROM user)`},
+	{"file", `owner NOT IN (SELECT id FROM user)`},
+	{"file_tag", `file NOT IN (SELECT id FROM file)`},
+	{"file_summary", `file NOT IN (SELECT id FROM file)`},
+	{"extraction", `owner NOT IN (SELECT id FROM user)`},
+	{"extraction_result", `extraction NOT IN (SELECT id FROM extraction) OR file NOT IN (SELECT id FROM file)`},
+	{"knowledge_base", `(account IS NOT NULL AND account NOT IN (SELECT id FROM account)) OR (owner IS NOT NULL AND owner NOT IN (SELECT id FROM user))`},
+	{"knowledge_base_file", `knowledgeBase NOT IN (SELECT id FROM knowledge_base) OR file NOT IN (SELECT id FROM file)`},
+	{"conversation", `owner NOT IN (SELECT id FROM user)`},
+	{"conversation_knowledge_base", `knowledgeBase NOT IN (SELECT id FROM knowledge_base) OR user NOT IN (SELECT id FROM user)`},
+}
+
+type TableCopy struct {
+	Table   string `json:"table"`
+	Copied  int64  `json:"copied"`
+	Skipped int64  `json:"skipped"`
+}
+
+// CopyToPostgres copies every row of a SQLite store into an empty Postgres store, in one transaction.
+// Both schemas have to be at the same version, run the migrations of both first.
+func CopyToPostgres(ctx context.Context, from Store, to Store) ([]TableCopy, error) {
+	src, ok := from.(*sqliteStore)
+	if !ok {
+		return nil, fmt.Errorf("copy source has to be SQLite, not %s", from.Driver())
+	}
+	dst, ok := to.(*postgresStore)
+	if !ok {
+		return nil, fmt.Errorf("copy destination has to be Postgres, not %s", to.Driver())
+	}
+
+	var result []TableCopy
+	err := inTx(ctx, dst.db, func(tx *sql.Tx) error {
+		for _, table := range copyTables {
+			var existing int64
+			if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM "`+table.name+`"`).Scan(&existing); err != nil {
+				return fmt.Errorf("failed to check %s: %w", table.name, err)
+			}
+			if existing > 0 {
+				return fmt.Errorf("table %s in Postgres is not empty", table.name)
+			}
+
+			copied, skipped, err := copyTable(ctx, src.db, tx, table.name, table.orphans)
+			if err != nil {
+				return fmt.Errorf("failed to copy %s: %w", table.name, err)
+			}
+			result = append(result, TableCopy{Table: table.name, Copied: copied, Skipped: skipped})
+		}
+
+		// Event ids were copied as they are, new events continue after the highest one
+		_, err := tx.ExecContext(ctx, `SELECT setval(pg_get_serial_sequence('event', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM event`)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func copyTable(ctx context.Context, src *sql.DB, dst *sql.Tx, table string, orphans string) (int64, int64, error) {
+	query := "SELECT * FROM " + table
+	var skipped int64
+	if orphans != "" {
+		query += " WHERE NOT (" + orphans + ")"
+		if err := src.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table+" WHERE "+orphans).Scan(&skipped); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	rows, err := src.QueryContext(ctx, query)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, 0, err
+	}
+	// Unquoted camelCase names end up lowercase in Postgres, quoting them all also covers "user"
+	quoted := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = `"` + strings.ToLower(column) + `"`
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	insert, err := dst.PrepareContext(ctx, fmt.Sprintf(`INSERT INTO "%s" (%s) VALUES (%s)`,
+		table, strings.Join(quoted, ", "), strings.Join(placeholders, ", ")))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer insert.Close()
+
+	var copied int64
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return copied, skipped, err
+		}
+		// JSON columns come out of SQLite as bytes, Postgres would take those for bytea
+		for i, value := range values {
+			if b, ok := value.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		if _, err := insert.ExecContext(ctx, values...); err != nil {
+			return copied, skipped, err
+		}
+		copied++
+	}
+	return copied, skipped, rows.Err()
+}
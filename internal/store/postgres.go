@@ -0,0 +1,728 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"gochat/internal/schema"
+	"gochat/internal/schema/pgschema"
+)
+
+// The Postgres queries return the same columns with the same types as the SQLite ones, so most rows
+// and params convert directly. A query that drifts apart fails to compile here.
+type postgresQueries struct {
+	pg *pgschema.Queries
+}
+
+var _ schema.Querier = (*postgresQueries)(nil)
+
+type postgresStore struct {
+	*postgresQueries
+	db *sql.DB
+}
+
+func NewPostgres(db *sql.DB) Store {
+	return &postgresStore{postgresQueries: &postgresQueries{pg: pgschema.New(db)}, db: db}
+}
+
+func (s *postgresStore) InTx(ctx context.Context, fn func(q schema.Querier) error) error {
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		return fn(&postgresQueries{pg: s.pg.WithTx(tx)})
+	})
+}
+
+func (s *postgresStore) Driver() Driver {
+	return DriverPostgres
+}
+
+func (s *postgresStore) Close() error {
+	return s.db.Close()
+}
+
+// Event metadata is a JSON column in SQLite, which sqlc leaves untyped, and text in Postgres
+func fromPgEvent(e pgschema.Event) schema.Event {
+	var metadata interface{}
+	if e.Metadata.Valid {
+		metadata = e.Metadata.String
+	}
+	return schema.Event{
+		ID:        e.ID,
+		Event:     e.Event,
+		Timestamp: e.Timestamp,
+		Metadata:  metadata,
+		User:      e.User,
+	}
+}
+
+func toNullString(value interface{}) sql.NullString {
+	switch v := value.(type) {
+	case string:
+		return sql.NullString{String: v, Valid: true}
+	case []byte:
+		return sql.NullString{String: string(v), Valid: true}
+	}
+	return sql.NullString{}
+}
+
+func (q *postgresQueries) AddExtractionResult(ctx context.Context, arg schema.AddExtractionResultParams) error {
+	return q.pg.AddExtractionResult(ctx, pgschema.AddExtractionResultParams(arg))
+}
+
+func (q *postgresQueries) AddFileTag(ctx context.Context, arg schema.AddFileTagParams) error {
+	return q.pg.AddFileTag(ctx, pgschema.AddFileTagParams(arg))
+}
+
+func (q *postgresQueries) AddKnowledgeBaseFile(ctx context.Context, arg schema.AddKnowledgeBaseFileParams) error {
+	return q.pg.AddKnowledgeBaseFile(ctx, pgschema.AddKnowledgeBaseFileParams(arg))
+}
+
+func (q *postgresQueries) AttachKnowledgeBase(ctx context.Context, arg schema.AttachKnowledgeBaseParams) error {
+	return q.pg.AttachKnowledgeBase(ctx, pgschema.AttachKnowledgeBaseParams(arg))
+}
+
+func (q *postgresQueries) ClaimConversation(ctx context.Context, arg schema.ClaimConversationParams) error {
+	return q.pg.ClaimConversation(ctx, pgschema.ClaimConversationParams(arg))
+}
+
+func (q *postgresQueries) CountAccounts(ctx context.Context, search string) (int64, error) {
+	return q.pg.CountAccounts(ctx, search)
+}
+
+func (q *postgresQueries) CountUsers(ctx context.Context, arg schema.CountUsersParams) (int64, error) {
+	return q.pg.CountUsers(ctx, pgschema.CountUsersParams(arg))
+}
+
+func (q *postgresQueries) CreateAccount(ctx context.Context, arg schema.CreateAccountParams) (schema.Account, error) {
+	row, err := q.pg.CreateAccount(ctx, pgschema.CreateAccountParams(arg))
+	return schema.Account(row), err
+}
+
+func (q *postgresQueries) CreateAccountDomain(ctx context.Context, arg schema.CreateAccountDomainParams) (schema.AccountDomain, error) {
+	row, err := q.pg.CreateAccountDomain(ctx, pgschema.CreateAccountDomainParams(arg))
+	return schema.AccountDomain(row), err
+}
+
+func (q *postgresQueries) CreateApiKey(ctx context.Context, arg schema.CreateApiKeyParams) (schema.ApiKey, error) {
+	row, err := q.pg.CreateApiKey(ctx, pgschema.CreateApiKeyParams(arg))
+	return schema.ApiKey(row), err
+}
+
+func (q *postgresQueries) CreateDomainClaim(ctx context.Context, arg schema.CreateDomainClaimParams) error {
+	return q.pg.CreateDomainClaim(ctx, pgschema.CreateDomainClaimParams(arg))
+}
+
+func (q *postgresQueries) CreateEvent(ctx context.Context, arg schema.CreateEventParams) (schema.Event, error) {
+	row, err := q.pg.CreateEvent(ctx, pgschema.CreateEventParams{User: arg.User, Event: arg.Event, Metadata: toNullString(arg.Metadata)})
+	return fromPgEvent(row), err
+}
+
+func (q *postgresQueries) CreateExtraction(ctx context.Context, arg schema.CreateExtractionParams) (schema.Extraction, error) {
+	row, err := q.pg.CreateExtraction(ctx, pgschema.CreateExtractionParams(arg))
+	return schema.Extraction(row), err
+}
+
+func (q *postgresQueries) CreateFile(ctx context.Context, arg schema.CreateFileParams) (schema.File, error) {
+	row, err := q.pg.CreateFile(ctx, pgschema.CreateFileParams(arg))
+	return schema.File(row), err
+}
+
+func (q *postgresQueries) CreateImpersonation(ctx context.Context, arg schema.CreateImpersonationParams) (schema.Impersonation, error) {
+	row, err := q.pg.CreateImpersonation(ctx, pgschema.CreateImpersonationParams(arg))
+	return schema.Impersonation(row), err
+}
+
+func (q *postgresQueries) CreateKnowledgeBase(ctx context.Context, arg schema.CreateKnowledgeBaseParams) (schema.KnowledgeBase, error) {
+	row, err := q.pg.CreateKnowledgeBase(ctx, pgschema.CreateKnowledgeBaseParams(arg))
+	return schema.KnowledgeBase(row), err
+}
+
+func (q *postgresQueries) CreateOidcProvider(ctx context.Context, arg schema.CreateOidcProviderParams) (schema.OidcProvider, error) {
+	row, err := q.pg.CreateOidcProvider(ctx, pgschema.CreateOidcProviderParams(arg))
+	return schema.OidcProvider(row), err
+}
+
+func (q *postgresQueries) CreateSession(ctx context.Context, arg schema.CreateSessionParams) (schema.Session, error) {
+	row, err := q.pg.CreateSession(ctx, pgschema.CreateSessionParams(arg))
+	return schema.Session(row), err
+}
+
+func (q *postgresQueries) CreateUser(ctx context.Context, arg schema.CreateUserParams) (schema.User, error) {
+	row, err := q.pg.CreateUser(ctx, pgschema.CreateUserParams(arg))
+	return schema.User(row), err
+}
+
+func (q *postgresQueries) DeleteAccount(ctx context.Context, id string) (int64, error) {
+	return q.pg.DeleteAccount(ctx, id)
+}
+
+func (q *postgresQueries) DeleteAccountConversationKnowledgeBases(ctx context.Context, account sql.NullString) error {
+	return q.pg.DeleteAccountConversationKnowledgeBases(ctx, account)
+}
+
+func (q *postgresQueries) DeleteAccountDomain(ctx context.Context, domain string) error {
+	return q.pg.DeleteAccountDomain(ctx, domain)
+}
+
+func (q *postgresQueries) DeleteAccountDomainClaims(ctx context.Context, account string) error {
+	return q.pg.DeleteAccountDomainClaims(ctx, account)
+}
+
+func (q *postgresQueries) DeleteAccountDomainForAccount(ctx context.Context, arg schema.DeleteAccountDomainForAccountParams) (int64, error) {
+	return q.pg.DeleteAccountDomainForAccount(ctx, pgschema.DeleteAccountDomainForAccountParams(arg))
+}
+
+func (q *postgresQueries) DeleteAccountDomains(ctx context.Context, account string) error {
+	return q.pg.DeleteAccountDomains(ctx, account)
+}
+
+func (q *postgresQueries) DeleteAccountKnowledgeBaseFiles(ctx context.Context, account sql.NullString) error {
+	return q.pg.DeleteAccountKnowledgeBaseFiles(ctx, account)
+}
+
+func (q *postgresQueries) DeleteAccountKnowledgeBases(ctx context.Context, account sql.NullString) error {
+	return q.pg.DeleteAccountKnowledgeBases(ctx, account)
+}
+
+func (q *postgresQueries) DeleteAccountOidcProviders(ctx context.Context, account sql.NullString) error {
+	return q.pg.DeleteAccountOidcProviders(ctx, account)
+}
+
+func (q *postgresQueries) DeleteConversation(ctx context.Context, arg schema.DeleteConversationParams) (int64, error) {
+	return q.pg.DeleteConversation(ctx, pgschema.DeleteConversationParams(arg))
+}
+
+func (q *postgresQueries) DeleteDomainClaim(ctx context.Context, arg schema.DeleteDomainClaimParams) (int64, error) {
+	return q.pg.DeleteDomainClaim(ctx, pgschema.DeleteDomainClaimParams(arg))
+}
+
+func (q *postgresQueries) DeleteDomainClaims(ctx context.Context, domain string) error {
+	return q.pg.DeleteDomainClaims(ctx, domain)
+}
+
+func (q *postgresQueries) DeleteFile(ctx context.Context, arg schema.DeleteFileParams) (int64, error) {
+	return q.pg.DeleteFile(ctx, pgschema.DeleteFileParams(arg))
+}
+
+func (q *postgresQueries) DeleteFileExtractionResults(ctx context.Context, file string) error {
+	return q.pg.DeleteFileExtractionResults(ctx, file)
+}
+
+func (q *postgresQueries) DeleteFileKnowledgeBaseFiles(ctx context.Context, file string) error {
+	return q.pg.DeleteFileKnowledgeBaseFiles(ctx, file)
+}
+
+func (q *postgresQueries) DeleteFileSummaries(ctx context.Context, file string) error {
+	return q.pg.DeleteFileSummaries(ctx, file)
+}
+
+func (q *postgresQueries) DeleteFileTags(ctx context.Context, file string) error {
+	return q.pg.DeleteFileTags(ctx, file)
+}
+
+func (q *postgresQueries) DeleteKnowledgeBase(ctx context.Context, id string) (int64, error) {
+	return q.pg.DeleteKnowledgeBase(ctx, id)
+}
+
+func (q *postgresQueries) DeleteKnowledgeBaseConversations(ctx context.Context, knowledgebase string) error {
+	return q.pg.DeleteKnowledgeBaseConversations(ctx, knowledgebase)
+}
+
+func (q *postgresQueries) DeleteKnowledgeBaseFiles(ctx context.Context, knowledgebase string) error {
+	return q.pg.DeleteKnowledgeBaseFiles(ctx, knowledgebase)
+}
+
+func (q *postgresQueries) DeleteOidcProvider(ctx context.Context, id string) error {
+	return q.pg.DeleteOidcProvider(ctx, id)
+}
+
+func (q *postgresQueries) DeleteUser(ctx context.Context, id string) (int64, error) {
+	return q.pg.DeleteUser(ctx, id)
+}
+
+func (q *postgresQueries) DeleteUserApiKeys(ctx context.Context, user string) error {
+	return q.pg.DeleteUserApiKeys(ctx, user)
+}
+
+func (q *postgresQueries) DeleteUserConversationKnowledgeBases(ctx context.Context, user string) error {
+	return q.pg.DeleteUserConversationKnowledgeBases(ctx, user)
+}
+
+func (q *postgresQueries) DeleteUserConversations(ctx context.Context, owner string) error {
+	return q.pg.DeleteUserConversations(ctx, owner)
+}
+
+func (q *postgresQueries) DeleteUserEvents(ctx context.Context, user string) error {
+	return q.pg.DeleteUserEvents(ctx, user)
+}
+
+func (q *postgresQueries) DeleteUserExtractionResults(ctx context.Context, owner string) error {
+	return q.pg.DeleteUserExtractionResults(ctx, owner)
+}
+
+func (q *postgresQueries) DeleteUserExtractions(ctx context.Context, owner string) error {
+	return q.pg.DeleteUserExtractions(ctx, owner)
+}
+
+func (q *postgresQueries) DeleteUserFileSummaries(ctx context.Context, owner string) error {
+	return q.pg.DeleteUserFileSummaries(ctx, owner)
+}
+
+func (q *postgresQueries) DeleteUserFileTags(ctx context.Context, owner string) error {
+	return q.pg.DeleteUserFileTags(ctx, owner)
+}
+
+func (q *postgresQueries) DeleteUserFiles(ctx context.Context, owner string) error {
+	return q.pg.DeleteUserFiles(ctx, owner)
+}
+
+func (q *postgresQueries) DeleteUserImpersonations(ctx context.Context, user string) error {
+	return q.pg.DeleteUserImpersonations(ctx, user)
+}
+
+func (q *postgresQueries) DeleteUserKnowledgeBaseFiles(ctx context.Context, user string) error {
+	return q.pg.DeleteUserKnowledgeBaseFiles(ctx, user)
+}
+
+func (q *postgresQueries) DeleteUserKnowledgeBases(ctx context.Context, owner sql.NullString) error {
+	return q.pg.DeleteUserKnowledgeBases(ctx, owner)
+}
+
+func (q *postgresQueries) DeleteUserSessions(ctx context.Context, user string) error {
+	return q.pg.DeleteUserSessions(ctx, user)
+}
+
+func (q *postgresQueries) DetachConversationKnowledgeBases(ctx context.Context, arg schema.DetachConversationKnowledgeBasesParams) error {
+	return q.pg.DetachConversationKnowledgeBases(ctx, pgschema.DetachConversationKnowledgeBasesParams(arg))
+}
+
+func (q *postgresQueries) DetachKnowledgeBase(ctx context.Context, arg schema.DetachKnowledgeBaseParams) (int64, error) {
+	return q.pg.DetachKnowledgeBase(ctx, pgschema.DetachKnowledgeBaseParams(arg))
+}
+
+func (q *postgresQueries) DisableUser(ctx context.Context, arg schema.DisableUserParams) (int64, error) {
+	return q.pg.DisableUser(ctx, pgschema.DisableUserParams(arg))
+}
+
+func (q *postgresQueries) EnableUser(ctx context.Context, id string) (int64, error) {
+	return q.pg.EnableUser(ctx, id)
+}
+
+func (q *postgresQueries) EndImpersonation(ctx context.Context, arg schema.EndImpersonationParams) (int64, error) {
+	return q.pg.EndImpersonation(ctx, pgschema.EndImpersonationParams(arg))
+}
+
+func (q *postgresQueries) GetAccount(ctx context.Context, id string) (schema.GetAccountRow, error) {
+	row, err := q.pg.GetAccount(ctx, id)
+	return schema.GetAccountRow(row), err
+}
+
+func (q *postgresQueries) GetAccountByDomain(ctx context.Context, domain string) (schema.GetAccountByDomainRow, error) {
+	row, err := q.pg.GetAccountByDomain(ctx, domain)
+	return schema.GetAccountByDomainRow(row), err
+}
+
+func (q *postgresQueries) GetAccountById(ctx context.Context, id string) (schema.Account, error) {
+	row, err := q.pg.GetAccountById(ctx, id)
+	return schema.Account(row), err
+}
+
+func (q *postgresQueries) GetApiKeyByHash(ctx context.Context, hash string) (schema.ApiKey, error) {
+	row, err := q.pg.GetApiKeyByHash(ctx, hash)
+	return schema.ApiKey(row), err
+}
+
+func (q *postgresQueries) GetConversation(ctx context.Context, id string) (schema.Conversation, error) {
+	row, err := q.pg.GetConversation(ctx, id)
+	return schema.Conversation(row), err
+}
+
+func (q *postgresQueries) GetDomainClaim(ctx context.Context, arg schema.GetDomainClaimParams) (schema.DomainClaim, error) {
+	row, err := q.pg.GetDomainClaim(ctx, pgschema.GetDomainClaimParams(arg))
+	return schema.DomainClaim(row), err
+}
+
+func (q *postgresQueries) GetEvent(ctx context.Context, id int64) (schema.Event, error) {
+	row, err := q.pg.GetEvent(ctx, id)
+	return fromPgEvent(row), err
+}
+
+func (q *postgresQueries) GetExtraction(ctx context.Context, id string) (schema.Extraction, error) {
+	row, err := q.pg.GetExtraction(ctx, id)
+	return schema.Extraction(row), err
+}
+
+func (q *postgresQueries) GetFile(ctx context.Context, id string) (schema.File, error) {
+	row, err := q.pg.GetFile(ctx, id)
+	return schema.File(row), err
+}
+
+func (q *postgresQueries) GetFileSummary(ctx context.Context, arg schema.GetFileSummaryParams) (schema.FileSummary, error) {
+	row, err := q.pg.GetFileSummary(ctx, pgschema.GetFileSummaryParams(arg))
+	return schema.FileSummary(row), err
+}
+
+func (q *postgresQueries) GetImpersonation(ctx context.Context, id string) (schema.Impersonation, error) {
+	row, err := q.pg.GetImpersonation(ctx, id)
+	return schema.Impersonation(row), err
+}
+
+func (q *postgresQueries) GetKnowledgeBase(ctx context.Context, id string) (schema.KnowledgeBase, error) {
+	row, err := q.pg.GetKnowledgeBase(ctx, id)
+	return schema.KnowledgeBase(row), err
+}
+
+func (q *postgresQueries) GetOidcProvider(ctx context.Context, id string) (schema.OidcProvider, error) {
+	row, err := q.pg.GetOidcProvider(ctx, id)
+	return schema.OidcProvider(row), err
+}
+
+func (q *postgresQueries) GetSession(ctx context.Context, id string) (schema.Session, error) {
+	row, err := q.pg.GetSession(ctx, id)
+	return schema.Session(row), err
+}
+
+func (q *postgresQueries) GetUser(ctx context.Context, id string) (schema.GetUserRow, error) {
+	row, err := q.pg.GetUser(ctx, id)
+	return schema.GetUserRow(row), err
+}
+
+func (q *postgresQueries) GetUserByEmail(ctx context.Context, email string) (schema.User, error) {
+	row, err := q.pg.GetUserByEmail(ctx, email)
+	return schema.User(row), err
+}
+
+func (q *postgresQueries) GetUserByExternalID(ctx context.Context, externalid sql.NullString) (schema.User, error) {
+	row, err := q.pg.GetUserByExternalID(ctx, externalid)
+	return schema.User(row), err
+}
+
+func (q *postgresQueries) ListAccount(ctx context.Context) ([]schema.Account, error) {
+	rows, err := q.pg.ListAccount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.Account, len(rows))
+	for i, row := range rows {
+		result[i] = schema.Account(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListAccountDomains(ctx context.Context, account string) ([]schema.AccountDomain, error) {
+	rows, err := q.pg.ListAccountDomains(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.AccountDomain, len(rows))
+	for i, row := range rows {
+		result[i] = schema.AccountDomain(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListAccountsPage(ctx context.Context, arg schema.ListAccountsPageParams) ([]schema.Account, error) {
+	rows, err := q.pg.ListAccountsPage(ctx, pgschema.ListAccountsPageParams(arg))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.Account, len(rows))
+	for i, row := range rows {
+		result[i] = schema.Account(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListAllFileTags(ctx context.Context) ([]schema.FileTag, error) {
+	rows, err := q.pg.ListAllFileTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.FileTag, len(rows))
+	for i, row := range rows {
+		result[i] = schema.FileTag(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListApiKeysByUser(ctx context.Context, user string) ([]schema.ApiKey, error) {
+	rows, err := q.pg.ListApiKeysByUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.ApiKey, len(rows))
+	for i, row := range rows {
+		result[i] = schema.ApiKey(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListConversationFiles(ctx context.Context, arg schema.ListConversationFilesParams) ([]schema.File, error) {
+	rows, err := q.pg.ListConversationFiles(ctx, pgschema.ListConversationFilesParams(arg))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.File, len(rows))
+	for i, row := range rows {
+		result[i] = schema.File(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListConversationIDs(ctx context.Context) ([]string, error) {
+	return q.pg.ListConversationIDs(ctx)
+}
+
+func (q *postgresQueries) ListConversationKnowledgeBases(ctx context.Context, arg schema.ListConversationKnowledgeBasesParams) ([]schema.KnowledgeBase, error) {
+	rows, err := q.pg.ListConversationKnowledgeBases(ctx, pgschema.ListConversationKnowledgeBasesParams(arg))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.KnowledgeBase, len(rows))
+	for i, row := range rows {
+		result[i] = schema.KnowledgeBase(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListDomainClaims(ctx context.Context, account string) ([]schema.DomainClaim, error) {
+	rows, err := q.pg.ListDomainClaims(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.DomainClaim, len(rows))
+	for i, row := range rows {
+		result[i] = schema.DomainClaim(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListEvents(ctx context.Context, arg schema.ListEventsParams) ([]schema.Event, error) {
+	rows, err := q.pg.ListEvents(ctx, pgschema.ListEventsParams(arg))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.Event, len(rows))
+	for i, row := range rows {
+		result[i] = fromPgEvent(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListExtractionResults(ctx context.Context, extraction string) ([]schema.ListExtractionResultsRow, error) {
+	rows, err := q.pg.ListExtractionResults(ctx, extraction)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.ListExtractionResultsRow, len(rows))
+	for i, row := range rows {
+		result[i] = schema.ListExtractionResultsRow(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListExtractions(ctx context.Context, owner string) ([]schema.Extraction, error) {
+	rows, err := q.pg.ListExtractions(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.Extraction, len(rows))
+	for i, row := range rows {
+		result[i] = schema.Extraction(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListFileAccounts(ctx context.Context) ([]schema.ListFileAccountsRow, error) {
+	rows, err := q.pg.ListFileAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.ListFileAccountsRow, len(rows))
+	for i, row := range rows {
+		result[i] = schema.ListFileAccountsRow(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListFileTags(ctx context.Context, file string) ([]string, error) {
+	return q.pg.ListFileTags(ctx, file)
+}
+
+func (q *postgresQueries) ListFiles(ctx context.Context) ([]schema.File, error) {
+	rows, err := q.pg.ListFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.File, len(rows))
+	for i, row := range rows {
+		result[i] = schema.File(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListKnowledgeBaseFiles(ctx context.Context, knowledgebase string) ([]schema.File, error) {
+	rows, err := q.pg.ListKnowledgeBaseFiles(ctx, knowledgebase)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.File, len(rows))
+	for i, row := range rows {
+		result[i] = schema.File(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListKnowledgeBaseMemberships(ctx context.Context) ([]schema.KnowledgeBaseFile, error) {
+	rows, err := q.pg.ListKnowledgeBaseMemberships(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.KnowledgeBaseFile, len(rows))
+	for i, row := range rows {
+		result[i] = schema.KnowledgeBaseFile(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListKnowledgeBases(ctx context.Context, arg schema.ListKnowledgeBasesParams) ([]schema.KnowledgeBase, error) {
+	rows, err := q.pg.ListKnowledgeBases(ctx, pgschema.ListKnowledgeBasesParams(arg))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.KnowledgeBase, len(rows))
+	for i, row := range rows {
+		result[i] = schema.KnowledgeBase(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListOidcProvidersByAccount(ctx context.Context, account sql.NullString) ([]schema.OidcProvider, error) {
+	rows, err := q.pg.ListOidcProvidersByAccount(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.OidcProvider, len(rows))
+	for i, row := range rows {
+		result[i] = schema.OidcProvider(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListUser(ctx context.Context) ([]schema.User, error) {
+	rows, err := q.pg.ListUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.User, len(rows))
+	for i, row := range rows {
+		result[i] = schema.User(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListUserFiles(ctx context.Context, owner string) ([]schema.File, error) {
+	rows, err := q.pg.ListUserFiles(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.File, len(rows))
+	for i, row := range rows {
+		result[i] = schema.File(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListUsersByAccount(ctx context.Context, account string) ([]schema.User, error) {
+	rows, err := q.pg.ListUsersByAccount(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.User, len(rows))
+	for i, row := range rows {
+		result[i] = schema.User(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) ListUsersPage(ctx context.Context, arg schema.ListUsersPageParams) ([]schema.User, error) {
+	rows, err := q.pg.ListUsersPage(ctx, pgschema.ListUsersPageParams(arg))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.User, len(rows))
+	for i, row := range rows {
+		result[i] = schema.User(row)
+	}
+	return result, nil
+}
+
+func (q *postgresQueries) RemoveKnowledgeBaseFile(ctx context.Context, arg schema.RemoveKnowledgeBaseFileParams) (int64, error) {
+	return q.pg.RemoveKnowledgeBaseFile(ctx, pgschema.RemoveKnowledgeBaseFileParams(arg))
+}
+
+func (q *postgresQueries) RevokeApiKey(ctx context.Context, arg schema.RevokeApiKeyParams) (int64, error) {
+	return q.pg.RevokeApiKey(ctx, pgschema.RevokeApiKeyParams(arg))
+}
+
+func (q *postgresQueries) RevokeSession(ctx context.Context, arg schema.RevokeSessionParams) error {
+	return q.pg.RevokeSession(ctx, pgschema.RevokeSessionParams(arg))
+}
+
+func (q *postgresQueries) RevokeUserApiKeys(ctx context.Context, arg schema.RevokeUserApiKeysParams) (int64, error) {
+	return q.pg.RevokeUserApiKeys(ctx, pgschema.RevokeUserApiKeysParams(arg))
+}
+
+func (q *postgresQueries) RevokeUserSessions(ctx context.Context, arg schema.RevokeUserSessionsParams) (int64, error) {
+	return q.pg.RevokeUserSessions(ctx, pgschema.RevokeUserSessionsParams(arg))
+}
+
+func (q *postgresQueries) RotateSession(ctx context.Context, arg schema.RotateSessionParams) (int64, error) {
+	return q.pg.RotateSession(ctx, pgschema.RotateSessionParams(arg))
+}
+
+func (q *postgresQueries) SaveExtractionResult(ctx context.Context, arg schema.SaveExtractionResultParams) error {
+	return q.pg.SaveExtractionResult(ctx, pgschema.SaveExtractionResultParams(arg))
+}
+
+func (q *postgresQueries) SaveFileSummary(ctx context.Context, arg schema.SaveFileSummaryParams) error {
+	return q.pg.SaveFileSummary(ctx, pgschema.SaveFileSummaryParams(arg))
+}
+
+func (q *postgresQueries) SetFileIndex(ctx context.Context, arg schema.SetFileIndexParams) error {
+	return q.pg.SetFileIndex(ctx, pgschema.SetFileIndexParams(arg))
+}
+
+func (q *postgresQueries) SetUserExternalID(ctx context.Context, arg schema.SetUserExternalIDParams) error {
+	return q.pg.SetUserExternalID(ctx, pgschema.SetUserExternalIDParams(arg))
+}
+
+func (q *postgresQueries) TouchApiKey(ctx context.Context, arg schema.TouchApiKeyParams) error {
+	return q.pg.TouchApiKey(ctx, pgschema.TouchApiKeyParams(arg))
+}
+
+func (q *postgresQueries) UpdateAccountName(ctx context.Context, arg schema.UpdateAccountNameParams) (int64, error) {
+	return q.pg.UpdateAccountName(ctx, pgschema.UpdateAccountNameParams(arg))
+}
+
+func (q *postgresQueries) UpdateKnowledgeBase(ctx context.Context, arg schema.UpdateKnowledgeBaseParams) (int64, error) {
+	return q.pg.UpdateKnowledgeBase(ctx, pgschema.UpdateKnowledgeBaseParams(arg))
+}
+
+func (q *postgresQueries) UpdateUserAccount(ctx context.Context, arg schema.UpdateUserAccountParams) error {
+	return q.pg.UpdateUserAccount(ctx, pgschema.UpdateUserAccountParams(arg))
+}
+
+func (q *postgresQueries) UpdateUserRole(ctx context.Context, arg schema.UpdateUserRoleParams) (int64, error) {
+	return q.pg.UpdateUserRole(ctx, pgschema.UpdateUserRoleParams(arg))
+}
+
+func (q *postgresQueries) UsageByAccount(ctx context.Context, arg schema.UsageByAccountParams) ([]schema.UsageByAccountRow, error) {
+	rows, err := q.pg.UsageByAccount(ctx, pgschema.UsageByAccountParams(arg))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]schema.UsageByAccountRow, len(rows))
+	for i, row := range rows {
+		result[i] = schema.UsageByAccountRow(row)
+	}
+	return result, nil
+}
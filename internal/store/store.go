@@ -0,0 +1,151 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	database "gochat/internal/db"
+	"gochat/internal/schema"
+	"io/fs"
+	"os"
+)
+
+// Store is where the services keep their data. schema.Querier is generated by sqlc from the SQLite
+// queries, the Postgres backend implements the same interface on top of its own generated package.
+type Store interface {
+	schema.Querier
+	// InTx runs fn with queries bound to one transaction, it commits when fn returns nil
+	InTx(ctx context.Context, fn func(q schema.Querier) error) error
+	Driver() Driver
+	Close() error
+}
+
+type Driver string
+
+const (
+	DriverSQLite   Driver = "sqlite"
+	DriverPostgres Driver = "postgres"
+)
+
+type Config struct {
+	Driver Driver
+	// DSN is the file path for SQLite and the connection url for Postgres
+	DSN string
+}
+
+// ConfigFromEnv selects Postgres with DB_DRIVER=postgres and DATABASE_URL, SQLite with DB_PATH otherwise
+func ConfigFromEnv() Config {
+	if Driver(os.Getenv("DB_DRIVER")) == DriverPostgres {
+		return Config{Driver: DriverPostgres, DSN: os.Getenv("DATABASE_URL")}
+	}
+	return Config{Driver: DriverSQLite, DSN: os.Getenv("DB_PATH")}
+}
+
+// Connect opens the configured database without touching its schema
+func Connect(cfg Config) (Store, error) {
+	switch cfg.Driver {
+	case DriverSQLite:
+		if cfg.DSN == "" {
+			return nil, fmt.Errorf("DB_PATH environment variable not set")
+		}
+		db, err := database.Open(cfg.DSN)
+		if err != nil {
+			return nil, err
+		}
+		return NewSQLite(db), nil
+	case DriverPostgres:
+		if cfg.DSN == "" {
+			return nil, fmt.Errorf("DATABASE_URL environment variable not set")
+		}
+		db, err := database.OpenPostgres(cfg.DSN)
+		if err != nil {
+			return nil, err
+		}
+		return NewPostgres(db), nil
+	}
+	return nil, fmt.Errorf("unknown database driver %q", cfg.Driver)
+}
+
+// Open connects to the configured database and brings its schema up to date.
+// It returns the versions of the migrations that were applied.
+func Open(ctx context.Context, cfg Config) (Store, []int, error) {
+	s, err := Connect(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	migrator, err := NewMigrator(s, nil)
+	if err != nil {
+		s.Close()
+		return nil, nil, err
+	}
+	applied, err := migrator.Up(ctx, 0)
+	if err != nil {
+		s.Close()
+		return nil, nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return s, applied, nil
+}
+
+// NewMigrator returns the migrator for the store's database. It reads the migrations from fsys,
+// nil uses the ones built into the binary.
+func NewMigrator(s Store, fsys fs.FS) (*database.Migrator, error) {
+	switch s := s.(type) {
+	case *sqliteStore:
+		if fsys == nil {
+			fsys = database.EmbeddedMigrations()
+		}
+		return database.NewMigrator(s.db, fsys)
+	case *postgresStore:
+		if fsys == nil {
+			fsys = database.EmbeddedPostgresMigrations()
+		}
+		return database.NewPostgresMigrator(s.db, fsys)
+	}
+	return nil, fmt.Errorf("no migrations for %s", s.Driver())
+}
+
+// Seed loads the development data, it only exists for SQLite
+func Seed(ctx context.Context, s Store) error {
+	sqlite, ok := s.(*sqliteStore)
+	if !ok {
+		return fmt.Errorf("seed data is only available for SQLite")
+	}
+	return database.Seed(ctx, sqlite.db)
+}
+
+// inTx is the transaction handling both backends share
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type sqliteStore struct {
+	*schema.Queries
+	db *sql.DB
+}
+
+func NewSQLite(db *sql.DB) Store {
+	return &sqliteStore{Queries: schema.New(db), db: db}
+}
+
+func (s *sqliteStore) InTx(ctx context.Context, fn func(q schema.Querier) error) error {
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		return fn(s.Queries.WithTx(tx))
+	})
+}
+
+func (s *sqliteStore) Driver() Driver {
+	return DriverSQLite
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,134 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	database "gochat/internal/db"
+	"gochat/internal/schema"
+	"gochat/internal/store"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openSQLite(t *testing.T) store.Store {
+	ctx := context.Background()
+	s, _, err := store.Open(ctx, store.Config{Driver: store.DriverSQLite, DSN: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	assert.NoError(t, store.Seed(ctx, s))
+	return s
+}
+
+func TestSQLiteStore_InTx(t *testing.T) {
+	ctx := context.Background()
+	s := openSQLite(t)
+
+	failed := errors.New("failed")
+	err := s.InTx(ctx, func(q schema.Querier) error {
+		if _, err := q.CreateAccount(ctx, schema.CreateAccountParams{ID: "rolled-back", Name: "Rolled back"}); err != nil {
+			return err
+		}
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	_, err = s.GetAccountById(ctx, "rolled-back")
+	assert.Error(t, err)
+
+	err = s.InTx(ctx, func(q schema.Querier) error {
+		_, err := q.CreateAccount(ctx, schema.CreateAccountParams{ID: "committed", Name: "Committed"})
+		return err
+	})
+	assert.NoError(t, err)
+	_, err = s.GetAccountById(ctx, "committed")
+	assert.NoError(t, err)
+}
+
+// TestPostgres needs an empty database, `make test-postgres` starts one in a container.
+// Everything in it is dropped first.
+func TestPostgres(t *testing.T) {
+	url := os.Getenv("POSTGRES_TEST_URL")
+	if url == "" {
+		t.Skip("POSTGRES_TEST_URL not set")
+	}
+	ctx := context.Background()
+
+	pg, err := store.Connect(store.Config{Driver: store.DriverPostgres, DSN: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pg.Close()
+	migrator, err := store.NewMigrator(pg, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, migrator.Goto(ctx, database.NilVersion))
+	_, err = migrator.Up(ctx, 0)
+	assert.NoError(t, err)
+
+	// The seed data and one more event are copied from SQLite
+	sqlite := openSQLite(t)
+	_, err = sqlite.CreateEvent(ctx, schema.CreateEventParams{User: "1234abcd", Event: "login", Metadata: `{"via": "test"}`})
+	assert.NoError(t, err)
+
+	copies, err := store.CopyToPostgres(ctx, sqlite, pg)
+	assert.NoError(t, err)
+	counts := map[string]int64{}
+	for _, c := range copies {
+		counts[c.Table] = c.Copied
+	}
+	assert.Equal(t, int64(1), counts["account"])
+	assert.Equal(t, int64(2), counts["account_domain"])
+	assert.Equal(t, int64(2), counts["user"])
+	assert.Equal(t, int64(2), counts["event"])
+
+	// A second copy would duplicate everything
+	_, err = store.CopyToPostgres(ctx, sqlite, pg)
+	assert.Error(t, err)
+
+	// The queries behave like they do on SQLite
+	account, err := pg.GetAccount(ctx, "A1234")
+	assert.NoError(t, err)
+	assert.Equal(t, "test account", account.Name)
+
+	users, err := pg.ListUsersPage(ctx, schema.ListUsersPageParams{Account: "A1234", Search: "%ALBERT%", Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+
+	event, err := pg.CreateEvent(ctx, schema.CreateEventParams{User: "1234abcd", Event: "message", Metadata: `{}`})
+	assert.NoError(t, err)
+	assert.Greater(t, event.ID, int64(99999))
+
+	err = pg.InTx(ctx, func(q schema.Querier) error {
+		_, err := q.DeleteUser(ctx, "123ABCD")
+		return err
+	})
+	assert.NoError(t, err)
+	_, err = pg.GetUser(ctx, "123ABCD")
+	assert.Error(t, err)
+}
+
+func TestFSBlobStore(t *testing.T) {
+	ctx := context.Background()
+	blobs, err := store.NewFSBlobStore(t.TempDir())
+	assert.NoError(t, err)
+
+	assert.NoError(t, blobs.Put(ctx, "files/user/1", strings.NewReader("hello"), 5, "text/plain"))
+	r, err := blobs.Get(ctx, "files/user/1")
+	assert.NoError(t, err)
+	content, _ := io.ReadAll(r)
+	r.Close()
+	assert.Equal(t, "hello", string(content))
+
+	assert.NoError(t, blobs.Delete(ctx, "files/user/1"))
+	_, err = blobs.Get(ctx, "files/user/1")
+	assert.ErrorIs(t, err, store.ErrBlobNotFound)
+
+	// Keys never leave the root
+	for _, key := range []string{"", "/etc/passwd", "../outside", "files/../../outside", "files//1"} {
+		assert.Error(t, blobs.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"), key)
+	}
+}
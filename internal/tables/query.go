@@ -0,0 +1,253 @@
+package tables
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gochat/internal/ai"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// queryTimeout stops a query that joins its way into the billions of rows
+	queryTimeout = 5 * time.Second
+	// maxResultRows is how many rows of a result are shown, aggregates are over all of them
+	maxResultRows = 100
+	// maxScanRows is how many rows of a result are read at all
+	maxScanRows = 100000
+	// maxCellLength is how much of a value is kept in a result, the rows shown are in the prompt
+	maxCellLength = 1000
+)
+
+// ErrNotSelect is returned for anything but a single SELECT
+var ErrNotSelect = errors.New("only a single SELECT query is allowed")
+
+// Aggregate summarizes a numeric column of a result
+type Aggregate struct {
+	Column string
+	Count  int
+	Sum    float64
+	Min    float64
+	Max    float64
+}
+
+func (a Aggregate) Mean() float64 {
+	return a.Sum / float64(a.Count)
+}
+
+// Result is what a query returned. Rows holds at most maxResultRows rows, Total is how many there were.
+type Result struct {
+	Columns    []string
+	Rows       [][]string
+	Total      int
+	Truncated  bool
+	Aggregates []Aggregate
+}
+
+// checkSelect allows a single SELECT or WITH statement, a trailing semicolon is fine. The connection
+// is read only as well, this gives the model a clear error instead of a failed write.
+func checkSelect(query string) (string, error) {
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+	if strings.Contains(query, ";") {
+		return "", ErrNotSelect
+	}
+	fields := strings.Fields(strings.ToLower(query))
+	if len(fields) == 0 || (fields[0] != "select" && fields[0] != "with") {
+		return "", ErrNotSelect
+	}
+	return query, nil
+}
+
+// Query runs a read only query. The first query switches the connection to read only, no tables can
+// be loaded after it.
+func (d *Database) Query(ctx context.Context, query string) (*Result, error) {
+	query, err := checkSelect(query)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.setReadOnly(ctx); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	rows, err := d.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Columns: columns}
+	aggregates := make([]*Aggregate, len(columns))
+	// A column is numeric as long as it has no text, NULLs don't count
+	numeric := make([]bool, len(columns))
+	for i := range numeric {
+		numeric[i] = true
+	}
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if result.Total == maxScanRows {
+			result.Truncated = true
+			break
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		result.Total++
+		row := make([]string, len(columns))
+		for i, value := range values {
+			row[i] = truncate(format(value), maxCellLength)
+			if value == nil || !numeric[i] {
+				continue
+			}
+			n, ok := toFloat(value)
+			if !ok {
+				numeric[i] = false
+				continue
+			}
+			if aggregates[i] == nil {
+				aggregates[i] = &Aggregate{Column: columns[i], Min: n, Max: n}
+			}
+			a := aggregates[i]
+			a.Count++
+			a.Sum += n
+			a.Min = math.Min(a.Min, n)
+			a.Max = math.Max(a.Max, n)
+		}
+		if len(result.Rows) < maxResultRows {
+			result.Rows = append(result.Rows, row)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, a := range aggregates {
+		if a != nil && numeric[i] {
+			result.Aggregates = append(result.Aggregates, *a)
+		}
+	}
+	return result, nil
+}
+
+func (d *Database) setReadOnly(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.readOnly {
+		return nil
+	}
+	if _, err := d.db.ExecContext(ctx, "PRAGMA query_only = ON"); err != nil {
+		return err
+	}
+	d.readOnly = true
+	return nil
+}
+
+// truncate shortens s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "…"
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func format(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'g', 12, 64)
+}
+
+// Markdown shows the result as a table, with the aggregates of numeric columns under it when there
+// is more than one row
+func (r *Result) Markdown() string {
+	if len(r.Rows) == 0 {
+		return "The query returned no rows."
+	}
+	cell := strings.NewReplacer("|", "\\|", "\n", " ")
+	var b strings.Builder
+	b.WriteString("| " + strings.Join(r.Columns, " | ") + " |\n")
+	b.WriteString("|" + strings.Repeat(" --- |", len(r.Columns)) + "\n")
+	for _, row := range r.Rows {
+		cells := make([]string, len(row))
+		for i, value := range row {
+			cells[i] = cell.Replace(value)
+		}
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	switch {
+	case r.Truncated:
+		fmt.Fprintf(&b, "\nShowing %d of more than %d rows.\n", len(r.Rows), r.Total)
+	case len(r.Rows) < r.Total:
+		fmt.Fprintf(&b, "\nShowing %d of %d rows.\n", len(r.Rows), r.Total)
+	case r.Total == 1:
+		b.WriteString("\n1 row.\n")
+	default:
+		fmt.Fprintf(&b, "\n%d rows.\n", r.Total)
+	}
+	if r.Total > 1 {
+		for _, a := range r.Aggregates {
+			fmt.Fprintf(&b, "- %s: count %d, sum %s, min %s, max %s, mean %s\n", a.Column, a.Count,
+				formatNumber(a.Sum), formatNumber(a.Min), formatNumber(a.Max), formatNumber(a.Mean()))
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Tool lets the model query the tables. The query it ran is sent to the user as a tool_call event,
+// the result as a tool_result event, like any tool.
+func (d *Database) Tool() ai.Tool {
+	return ai.Tool{
+		Name: "query_tables",
+		Description: "Runs a read-only SQLite SELECT query on the spreadsheets the user uploaded, use it for counts, sums, averages and lookups in their data. " +
+			"Returns the result table and count, sum, min, max and mean of numeric columns. Tables:\n" + d.Schema(),
+		Parameters: json.RawMessage(`{"type":"object","properties":{"query":{"type":"string","description":"a single SQLite SELECT statement"}},"required":["query"]}`),
+		Timeout:    queryTimeout + time.Second,
+		Run: func(ctx context.Context, arguments string) (string, error) {
+			var args struct {
+				Query string `json:"query"`
+			}
+			if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+				return "", fmt.Errorf("invalid arguments: %w", err)
+			}
+			result, err := d.Query(ctx, args.Query)
+			if err != nil {
+				return "", err
+			}
+			return result.Markdown(), nil
+		},
+	}
+}
@@ -0,0 +1,321 @@
+// Package tables loads CSV and XLSX files into an in-memory SQLite database, so numeric questions
+// about spreadsheets are answered with SQL instead of by searching rows embedded as sentences.
+package tables
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3"
+	"github.com/xuri/excelize/v2"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxRows is how many rows of a sheet are loaded, the rest is left out
+	maxRows = 100000
+	// maxColumns keeps a wide export from making tables nobody can query
+	maxColumns = 200
+	// maxValueLength is the longest string, blob or row SQLite makes, randomblob(1e9) and the like fail
+	// instead of taking the memory
+	maxValueLength = 1 << 20
+	// maxQueryLength is the longest statement the model can send
+	maxQueryLength = 100000
+)
+
+// driverName is the sqlite3 driver with the limits above on every connection
+const driverName = "sqlite3_tables"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			conn.SetLimit(sqlite3.SQLITE_LIMIT_LENGTH, maxValueLength)
+			conn.SetLimit(sqlite3.SQLITE_LIMIT_SQL_LENGTH, maxQueryLength)
+			return nil
+		},
+	})
+}
+
+// ErrReadOnly is returned when tables are loaded after the first query
+var ErrReadOnly = errors.New("tables can't be loaded after they were queried")
+
+var (
+	notIdentifier = regexp.MustCompile(`[^a-z0-9_]+`)
+	integer       = regexp.MustCompile(`^-?\d+$`)
+)
+
+// IsTabular reports whether the file is loaded as a table instead of being embedded
+func IsTabular(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv", ".tsv", ".xlsx":
+		return true
+	}
+	return false
+}
+
+// Column is a column of a table, Type is INTEGER, REAL or TEXT
+type Column struct {
+	Name string
+	Type string
+}
+
+// Table is a sheet of a file loaded into the database
+type Table struct {
+	Name string
+	// Source is the file, and for a workbook the sheet, the table was loaded from
+	Source  string
+	Columns []Column
+	Rows    int
+}
+
+// Database holds the tables of a conversation. It lives in memory on a single connection, which
+// is switched to read only by the first query.
+type Database struct {
+	db     *sql.DB
+	Tables []Table
+	// mu guards readOnly, a query abandoned at its timeout may still be running
+	mu       sync.Mutex
+	readOnly bool
+}
+
+func Open() (*Database, error) {
+	// Every connection to :memory: is a database of its own, so there is only one and it stays open
+	db, err := sql.Open(driverName, "file:"+uuid.New().String()+"?mode=memory")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	return &Database{db: db}, nil
+}
+
+func (d *Database) Close() error {
+	return d.db.Close()
+}
+
+// Load adds the sheets of a CSV or XLSX file as tables
+func (d *Database) Load(ctx context.Context, name string, r io.Reader) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.readOnly {
+		return ErrReadOnly
+	}
+	var sheets []sheet
+	var err error
+	if strings.ToLower(filepath.Ext(name)) == ".xlsx" {
+		sheets, err = readWorkbook(name, r)
+	} else {
+		var rows [][]string
+		rows, err = readCSV(r)
+		sheets = []sheet{{source: name, rows: rows}}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	for _, s := range sheets {
+		if len(s.rows) < 2 {
+			continue
+		}
+		if err := d.create(ctx, s); err != nil {
+			return fmt.Errorf("failed to load %s: %w", s.source, err)
+		}
+	}
+	return nil
+}
+
+type sheet struct {
+	source string
+	rows   [][]string
+}
+
+// readCSV reads comma, semicolon or tab separated values, whichever the first line has most of
+func readCSV(r io.Reader) ([][]string, error) {
+	buffered := bufio.NewReader(r)
+	first, err := buffered.Peek(4096)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, err
+	}
+	if line, _, ok := bytes.Cut(first, []byte("\n")); ok || len(line) > 0 {
+		first = line
+	}
+	reader := csv.NewReader(buffered)
+	reader.Comma = ','
+	for _, comma := range []rune{';', '\t'} {
+		if bytes.Count(first, []byte(string(comma))) > bytes.Count(first, []byte(string(reader.Comma))) {
+			reader.Comma = comma
+		}
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	var rows [][]string
+	for len(rows) <= maxRows {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) > 0 && len(rows[0]) > 0 {
+		rows[0][0] = strings.TrimPrefix(rows[0][0], "\ufeff")
+	}
+	return rows, nil
+}
+
+// readWorkbook reads every sheet of a workbook, cells as they are stored and not as they are shown
+func readWorkbook(name string, r io.Reader) ([]sheet, error) {
+	workbook, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer workbook.Close()
+	var sheets []sheet
+	for _, sheetName := range workbook.GetSheetList() {
+		rows, err := workbook.GetRows(sheetName, excelize.Options{RawCellValue: true})
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) > maxRows+1 {
+			rows = rows[:maxRows+1]
+		}
+		sheets = append(sheets, sheet{source: name + " / " + sheetName, rows: rows})
+	}
+	return sheets, nil
+}
+
+// identifier makes a name usable in SQL without quotes
+func identifier(name string, fallback string) string {
+	id := strings.Trim(notIdentifier.ReplaceAllString(strings.ToLower(strings.TrimSpace(name)), "_"), "_")
+	if id == "" {
+		id = fallback
+	}
+	if id[0] >= '0' && id[0] <= '9' {
+		id = "t_" + id
+	}
+	return id
+}
+
+// unique appends a number to a name that was taken
+func unique(name string, taken map[string]bool) string {
+	result := name
+	for i := 2; taken[result]; i++ {
+		result = fmt.Sprintf("%s_%d", name, i)
+	}
+	taken[result] = true
+	return result
+}
+
+// number reads a value the way spreadsheets are written in Dutch as well, 12,5 is 12.5
+func number(value string) (float64, bool) {
+	if strings.Count(value, ",") == 1 && !strings.Contains(value, ".") {
+		value = strings.Replace(value, ",", ".", 1)
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	return parsed, err == nil
+}
+
+// columnType is the narrowest type all values of the column fit, empty values are NULL
+func columnType(rows [][]string, i int) string {
+	result := "INTEGER"
+	for _, row := range rows {
+		if i >= len(row) || strings.TrimSpace(row[i]) == "" {
+			continue
+		}
+		value := strings.TrimSpace(row[i])
+		if result == "INTEGER" && !integer.MatchString(value) {
+			result = "REAL"
+		}
+		if _, ok := number(value); !ok {
+			return "TEXT"
+		}
+	}
+	return result
+}
+
+func (d *Database) create(ctx context.Context, s sheet) error {
+	header, rows := s.rows[0], s.rows[1:]
+	if len(header) > maxColumns {
+		return fmt.Errorf("a table can have at most %d columns", maxColumns)
+	}
+	taken := map[string]bool{}
+	for _, table := range d.Tables {
+		taken[table.Name] = true
+	}
+	base := strings.TrimSuffix(s.source, filepath.Ext(s.source))
+	if before, sheetName, ok := strings.Cut(s.source, " / "); ok {
+		base = strings.TrimSuffix(before, filepath.Ext(before)) + "_" + sheetName
+	}
+	table := Table{Name: unique(identifier(base, "table"), taken), Source: s.source, Rows: len(rows)}
+	columns := map[string]bool{}
+	var definitions []string
+	for i, name := range header {
+		column := Column{Name: unique(identifier(name, fmt.Sprintf("column_%d", i+1)), columns), Type: columnType(rows, i)}
+		table.Columns = append(table.Columns, column)
+		definitions = append(definitions, column.Name+" "+column.Type)
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (%s)", table.Name, strings.Join(definitions, ", "))); err != nil {
+		return err
+	}
+	insert, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s VALUES (%s)", table.Name, strings.TrimSuffix(strings.Repeat("?, ", len(header)), ", ")))
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	values := make([]interface{}, len(header))
+	for _, row := range rows {
+		for i, column := range table.Columns {
+			value := ""
+			if i < len(row) {
+				value = strings.TrimSpace(row[i])
+			}
+			values[i] = value
+			switch {
+			case value == "":
+				values[i] = nil
+			case column.Type != "TEXT":
+				values[i], _ = number(value)
+			}
+		}
+		if _, err := insert.ExecContext(ctx, values...); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	d.Tables = append(d.Tables, table)
+	return nil
+}
+
+// Schema describes the tables for the model, one line per table
+func (d *Database) Schema() string {
+	var lines []string
+	for _, table := range d.Tables {
+		var columns []string
+		for _, column := range table.Columns {
+			columns = append(columns, column.Name+" "+column.Type)
+		}
+		lines = append(lines, fmt.Sprintf("%s(%s) -- %d rows from %s", table.Name, strings.Join(columns, ", "), table.Rows, table.Source))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,156 @@
+package tables
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+	"strings"
+	"testing"
+)
+
+const survey = "\ufeffGemeente;Respondenten;Tevredenheid (%);Opmerking\n" +
+	"Utrecht;352;81,5;\n" +
+	"Zeist;120;74;te weinig parkeerplaatsen\n" +
+	"Houten;;90;\n"
+
+func open(t *testing.T) *Database {
+	database, err := Open()
+	assert.NoError(t, err)
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+func TestIsTabular(t *testing.T) {
+	assert.True(t, IsTabular("enquete.CSV"))
+	assert.True(t, IsTabular("begroting.xlsx"))
+	assert.False(t, IsTabular("notulen.txt"))
+	assert.False(t, IsTabular("oud.xls"))
+}
+
+func TestLoadCSV(t *testing.T) {
+	ctx := context.Background()
+	database := open(t)
+	assert.NoError(t, database.Load(ctx, "enquête 2024.csv", strings.NewReader(survey)))
+	assert.NoError(t, database.Load(ctx, "enquête 2024.csv", strings.NewReader("a,b\n1,2\n")))
+
+	assert.Len(t, database.Tables, 2)
+	table := database.Tables[0]
+	assert.Equal(t, "enqu_te_2024", table.Name)
+	assert.Equal(t, 3, table.Rows)
+	assert.Equal(t, []Column{
+		{Name: "gemeente", Type: "TEXT"},
+		{Name: "respondenten", Type: "INTEGER"},
+		{Name: "tevredenheid", Type: "REAL"},
+		{Name: "opmerking", Type: "TEXT"},
+	}, table.Columns)
+	assert.Equal(t, "enqu_te_2024_2", database.Tables[1].Name)
+	assert.Contains(t, database.Schema(), "enqu_te_2024(gemeente TEXT, respondenten INTEGER, tevredenheid REAL, opmerking TEXT) -- 3 rows from enquête 2024.csv")
+
+	// Empty cells are NULL, decimal commas are numbers
+	result, err := database.Query(ctx, "SELECT gemeente, respondenten, tevredenheid FROM enqu_te_2024 ORDER BY gemeente;")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gemeente", "respondenten", "tevredenheid"}, result.Columns)
+	assert.Equal(t, [][]string{{"Houten", "", "90"}, {"Utrecht", "352", "81.5"}, {"Zeist", "120", "74"}}, result.Rows)
+	assert.Equal(t, []Aggregate{
+		{Column: "respondenten", Count: 2, Sum: 472, Min: 120, Max: 352},
+		{Column: "tevredenheid", Count: 3, Sum: 245.5, Min: 74, Max: 90},
+	}, result.Aggregates)
+	assert.Equal(t, "| gemeente | respondenten | tevredenheid |\n| --- | --- | --- |\n"+
+		"| Houten |  | 90 |\n| Utrecht | 352 | 81.5 |\n| Zeist | 120 | 74 |\n\n3 rows.\n"+
+		"- respondenten: count 2, sum 472, min 120, max 352, mean 236\n"+
+		"- tevredenheid: count 3, sum 245.5, min 74, max 90, mean 81.8333333333", result.Markdown())
+
+	result, err = database.Query(ctx, "select count(*) as n from enqu_te_2024 where respondenten > 1000")
+	assert.NoError(t, err)
+	assert.Equal(t, "| n |\n| --- |\n| 0 |\n\n1 row.", result.Markdown())
+}
+
+func TestLoadWorkbook(t *testing.T) {
+	workbook := excelize.NewFile()
+	assert.NoError(t, workbook.SetSheetRow("Sheet1", "A1", &[]interface{}{"Post", "Bedrag"}))
+	assert.NoError(t, workbook.SetSheetRow("Sheet1", "A2", &[]interface{}{"Huur", 1200.5}))
+	assert.NoError(t, workbook.SetSheetRow("Sheet1", "A3", &[]interface{}{"Energie", 300}))
+	_, err := workbook.NewSheet("Leeg")
+	assert.NoError(t, err)
+	var buffer bytes.Buffer
+	assert.NoError(t, workbook.Write(&buffer))
+
+	database := open(t)
+	assert.NoError(t, database.Load(context.Background(), "Begroting.xlsx", &buffer))
+	// Empty sheets are left out
+	assert.Len(t, database.Tables, 1)
+	assert.Equal(t, "begroting_sheet1", database.Tables[0].Name)
+	assert.Equal(t, "Begroting.xlsx / Sheet1", database.Tables[0].Source)
+
+	result, err := database.Query(context.Background(), "SELECT sum(bedrag) AS totaal FROM begroting_sheet1")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"1500.5"}}, result.Rows)
+}
+
+func TestQueryReadOnly(t *testing.T) {
+	ctx := context.Background()
+	database := open(t)
+	assert.NoError(t, database.Load(ctx, "enquete.csv", strings.NewReader(survey)))
+
+	for _, query := range []string{
+		"DELETE FROM enquete",
+		"SELECT 1; DROP TABLE enquete",
+		"ATTACH DATABASE 'x.db' AS x",
+		"",
+	} {
+		_, err := database.Query(ctx, query)
+		assert.ErrorIs(t, err, ErrNotSelect, query)
+	}
+	// A write hidden in a WITH is refused by the connection
+	_, err := database.Query(ctx, "WITH x AS (SELECT 1) INSERT INTO enquete (gemeente) SELECT * FROM x")
+	assert.Error(t, err)
+	result, err := database.Query(ctx, "SELECT count(*) FROM enquete")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"3"}}, result.Rows)
+
+	// Nothing can be loaded once the model started querying
+	assert.ErrorIs(t, database.Load(ctx, "meer.csv", strings.NewReader("a\n1\n")), ErrReadOnly)
+}
+
+func TestQueryTool(t *testing.T) {
+	database := open(t)
+	assert.NoError(t, database.Load(context.Background(), "enquete.csv", strings.NewReader(survey)))
+	tool := database.Tool()
+	assert.Equal(t, "query_tables", tool.Name)
+	assert.Contains(t, tool.Description, "enquete(gemeente TEXT, respondenten INTEGER")
+
+	result, err := tool.Run(context.Background(), `{"query":"SELECT max(respondenten) FROM enquete"}`)
+	assert.NoError(t, err)
+	assert.Contains(t, result, "| 352 |")
+	_, err = tool.Run(context.Background(), `{"query":"UPDATE enquete SET respondenten = 0"}`)
+	assert.ErrorIs(t, err, ErrNotSelect)
+}
+
+func TestQueryLimits(t *testing.T) {
+	ctx := context.Background()
+	database := open(t)
+	assert.NoError(t, database.Load(ctx, "enquete.csv", strings.NewReader(survey)))
+
+	// Values that would take gigabytes fail instead
+	for _, query := range []string{
+		"SELECT randomblob(1000000000)",
+		"SELECT zeroblob(1000000000)",
+		"SELECT length(group_concat(hex(randomblob(100000)))) FROM enquete, enquete, enquete",
+		"SELECT '" + strings.Repeat("x", maxQueryLength) + "'",
+	} {
+		_, err := database.Query(ctx, query)
+		assert.Error(t, err, query[:min(len(query), 60)])
+	}
+
+	// printf gives up with NULL
+	result, err := database.Query(ctx, "SELECT printf('%.*c', 1000000000, 'x')")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{""}}, result.Rows)
+
+	// Long values are cut short in the result
+	result, err = database.Query(ctx, "SELECT printf('%.*c', 5000, 'é')")
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, len(result.Rows[0][0]), maxCellLength+len("…"))
+	assert.True(t, strings.HasSuffix(result.Rows[0][0], "é…"))
+}